@@ -12,10 +12,6 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func init() {
-	log.SetLevel(log.DebugLevel)
-}
-
 // MarkovAI is an implementation of an AI that aims to
 // improvise in realtime. In this implementation, the current
 // history of real playing is used to generate transition
@@ -71,6 +67,14 @@ type AI struct {
 	// neural network
 	ff *gobrain.FeedForward
 
+	// SwingAware makes Learn2 straighten the off beats of swung notes
+	// before it learns them, keeping how much they swing in Swing, and
+	// Lick2 swing its licks as much again. The swing is on a grid of
+	// SwingSubdivision ticks, an eighth note if it is not set.
+	SwingAware       bool
+	Swing            float64
+	SwingSubdivision int
+
 	ff2 [4]*gobrain.FeedForward
 }
 
@@ -89,6 +93,7 @@ func New() (m *AI) {
 	m.HighPassFilter = 60
 	m.MinimumLickLength = 2
 	m.MaximumLickLength = 30
+	m.SwingSubdivision = 32
 	m.ff2 = [4]*gobrain.FeedForward{}
 	return m
 }
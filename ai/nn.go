@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 
 	"github.com/schollz/gobrain"
@@ -24,6 +25,13 @@ func (ai *AI) Learn2(notes music.Notes) (err error) {
 	ai.toggleLearning(true)
 	defer ai.toggleLearning(false)
 
+	if ai.SwingAware {
+		sort.Sort(notes)
+		ai.Swing = notes.DetectSwing(ai.SwingSubdivision)
+		notes = notes.Straightened(ai.SwingSubdivision, ai.Swing)
+		logger.Debugf("Straightened a swing of %2.2f", ai.Swing)
+	}
+
 	// Analyze the notes
 	logger.Info("Analyzing notes")
 	ai.notes = ai.Analyze(notes)
@@ -97,6 +105,20 @@ func (ai *AI) Lick2(startBeat int) (lick *music.Music, err error) {
 
 	// Convert the notes to a music
 	lick = ConvertNotes(notes, startBeat)
+	if ai.SwingAware {
+		lick = swung(lick, ai.SwingSubdivision, ai.Swing)
+	}
+	return
+}
+
+// swung returns the notes of music swung as much as the ones learned
+func swung(mus *music.Music, subdivision int, swing float64) (swung *music.Music) {
+	notes := music.Notes(mus.GetAll())
+	sort.Sort(notes)
+	swung = music.New()
+	for _, note := range notes.Swung(subdivision, swing) {
+		swung.AddNote(note)
+	}
 	return
 }
 
@@ -2,21 +2,23 @@ package ai2
 
 import (
 	"errors"
+	"math"
 	"math/rand"
 	"sort"
+	"sync"
 
 	"github.com/schollz/pianoai/music"
 	log "github.com/sirupsen/logrus"
 	hashids "github.com/speps/go-hashids"
 )
 
-func init() {
-	log.SetLevel(log.DebugLevel)
-}
-
 type AI struct {
 	// HighPassFilter only uses notes above a certain level
 	HighPassFilter int
+	// LowPassFilter, if set, only uses notes below it, so that
+	// together they keep the notes from HighPassFilter up to (but
+	// not including) LowPassFilter
+	LowPassFilter int
 
 	// MinimumLickLength is the minimum number of notes for a lick
 	MinimumLickLength int
@@ -29,7 +31,12 @@ type AI struct {
 	IsLearning bool
 	HasLearned bool
 
-	// LinkLength is how many links should be used
+	// Order is the order of the Markov chain, how many of the previous
+	// chords decide which chord comes next. Higher orders repeat longer
+	// motifs of what was learned, and lower orders wander more.
+	Order int
+	// LinkLength is the old name of the Order,
+	// which it takes the place of if it is set
 	LinkLength int
 
 	// WindowSize is how many total notes to include
@@ -41,6 +48,13 @@ type AI struct {
 	chords           map[string][]Chord
 	chordArray       []Chord
 	chordStringArray []string
+	rhythm           rhythm
+	dynamics         dynamics
+	drums            *drumPattern
+	// unsettled is the number of the last of the chordArray that can
+	// still change, and tail has the notes they were learned from
+	unsettled int
+	tail      map[int]map[int]music.Note
 
 	Jazzy          bool
 	Stacatto       bool
@@ -48,6 +62,61 @@ type AI struct {
 
 	MaxChordDistance int
 	TicksBerBeat     int
+	// TicksPerBar is the length of a bar, which is 4 beats if not set
+	TicksPerBar int
+	// LickLength is the number of beats a lick goes on for, which is
+	// 4 beats if not set. None of its chords start after that, but
+	// the last of them can be held past it.
+	LickLength int
+
+	// Key and Mode constrain the pitches of a lick to a scale,
+	// which is disabled when Key is empty
+	Key  string
+	Mode string
+	// Scale, if it has any intervals, constrains the pitches of a
+	// lick to that scale on the tonic of Key (or C) instead of Mode
+	Scale music.Scale
+
+	// Temperature changes how likely the less common continuations
+	// are to be picked: 1 follows what was learned, lower values
+	// stick to the most common and higher values are more adventurous
+	Temperature float64
+	// BlendRatio mixes the two models of a Blend, from 0 for the first
+	// to 1 for the second. blendStart is where the chords of the second
+	// model start, or 0 when there is no blend.
+	BlendRatio float64
+	blendStart int
+
+	// MinVelocity and MaxVelocity limit how soft and loud the notes
+	// of a lick can be, which otherwise follow the learned dynamics
+	MinVelocity, MaxVelocity int
+	// Intensity, if set, is the average velocity of what was just
+	// played, which licks follow by IntensitySensitivity (from 0 to 1)
+	Intensity            float64
+	IntensitySensitivity float64
+
+	// RestProbabilityScale is how often licks rest compared to what was
+	// learned, from 0 for never to 1 for as often (the default) or more
+	RestProbabilityScale float64
+
+	// Humanize adds a little randomness to the timing and velocity of licks
+	Humanize Humanize
+
+	// BassChannel is the MIDI channel (0-15) of the bass lines
+	BassChannel int
+	// HarmonyChannel is the MIDI channel (0-15) of the chords of Harmonize
+	HarmonyChannel int
+	// DrumChannel is the MIDI channel (0-15) of the drums, which is
+	// channel 10 of the General MIDI drums unless it is changed
+	DrumChannel int
+	// Voicing is how the chords of Harmonize are voiced: in "root"
+	// position (the default), the "first" or "second" inversion,
+	// "spread" out, or to "lead" on from the chord before
+	Voicing string
+
+	// guards what was learned, so Forget and Learn can be called
+	// while a Lick is being made
+	sync.RWMutex
 }
 
 type Chord struct {
@@ -55,6 +124,8 @@ type Chord struct {
 	Velocity int
 	Duration int
 	Lag      int
+	// Rest is a silence instead of a chord, as long as the Lag
+	Rest bool `json:",omitempty"`
 }
 
 func New(ticksPerBeat int) (ai *AI) {
@@ -65,7 +136,7 @@ func New(ticksPerBeat int) (ai *AI) {
 	ai.hasher = hashids.NewData()
 	ai.hasher.Salt = "piano"
 	ai.hasher.MinLength = 8
-	ai.LinkLength = 3
+	ai.Order = 3
 	ai.WindowSizeMin = 20
 	ai.WindowSizeMax = 40
 	ai.Jazzy = true
@@ -73,13 +144,156 @@ func New(ticksPerBeat int) (ai *AI) {
 	ai.MaxChordDistance = 6 // DEPRECATED?
 	ai.Stacatto = true
 	ai.TicksBerBeat = ticksPerBeat
+	ai.Mode = "major"
+	ai.Temperature = 1
+	ai.MinVelocity = 30
+	ai.MaxVelocity = 120
+	ai.RestProbabilityScale = 1
+	ai.BassChannel = 1
+	ai.HarmonyChannel = 2
+	ai.DrumChannel = 9
 	return ai
 }
 
+// inRange returns whether a pitch passes the high-pass and low-pass
+// filters, and must be called without the lock
+func (ai *AI) inRange(pitch int) bool {
+	ai.RLock()
+	defer ai.RUnlock()
+	return pitch >= ai.HighPassFilter && (ai.LowPassFilter <= 0 || pitch < ai.LowPassFilter)
+}
+
+// SetFilters changes the HighPassFilter and the LowPassFilter, which
+// can be done while the AI is learning
+func (ai *AI) SetFilters(highPass, lowPass int) {
+	ai.Lock()
+	defer ai.Unlock()
+	ai.HighPassFilter, ai.LowPassFilter = highPass, lowPass
+}
+
+// pickCandidate picks one of the places that a lick can continue from.
+// The candidates are grouped by the chord that comes next, and each
+// group is weighted by how often it occurs raised to 1/Temperature.
+// When blending, how often it occurs is mixed from the two models by
+// BlendRatio, for which the learned chords start at offset in the
+// chordStringArray, and the second model at blendStart in those.
+func (ai *AI) pickCandidate(candidates []int, chordStringArray []string, order, offset, blendStart int) int {
+	groups := make(map[string][]int)
+	names := []string{}
+	for _, candidate := range candidates {
+		next := ""
+		if candidate+order < len(chordStringArray) {
+			next = chordStringArray[candidate+order]
+		}
+		if _, ok := groups[next]; !ok {
+			names = append(names, next)
+		}
+		groups[next] = append(groups[next], candidate)
+	}
+	sort.Strings(names)
+
+	weights := make([]float64, len(names))
+	if blendStart > 0 {
+		learned := len(chordStringArray) - 2*offset
+		sources := make([][]int, len(names))
+		for i, name := range names {
+			for _, candidate := range groups[name] {
+				sources[i] = append(sources[i], ((candidate+order-offset)%learned+learned)%learned)
+			}
+		}
+		weights = blendWeights(sources, blendStart, ai.BlendRatio)
+	} else {
+		for i, name := range names {
+			weights[i] = float64(len(groups[name]))
+		}
+	}
+
+	var group []int
+	if ai.Temperature <= 0 {
+		// only the most common
+		best := -1.0
+		for i, name := range names {
+			if weights[i] > best {
+				best, group = weights[i], groups[name]
+			}
+		}
+	} else {
+		total := 0.0
+		for i := range names {
+			weights[i] = math.Pow(weights[i], 1/ai.Temperature)
+			total += weights[i]
+		}
+		r := rand.Float64() * total
+		for i, name := range names {
+			group = groups[name]
+			r -= weights[i]
+			if r < 0 {
+				break
+			}
+		}
+	}
+	return group[rand.Intn(len(group))]
+}
+
+// findSequence returns the starts of a sequence of chords, leaving
+// out the windows at either end that are only there to wrap around
+func findSequence(chordStringArray []string, sequence []string, windowSize int) (starts []int) {
+	starts = []int{}
+	for i := range chordStringArray {
+		if i < windowSize || i > len(chordStringArray)-windowSize {
+			continue
+		}
+		foundMatch := true
+		for j := range sequence {
+			if chordStringArray[i+j] != sequence[j] {
+				foundMatch = false
+				break
+			}
+		}
+		if foundMatch {
+			starts = append(starts, i)
+		}
+	}
+	return
+}
+
+// order returns the Order, or the LinkLength if it is set
+func (ai *AI) order() int {
+	if ai.LinkLength > 0 {
+		return ai.LinkLength
+	}
+	return ai.Order
+}
+
 func (ai *AI) toggleLearning(l bool) {
 	ai.IsLearning = l
 }
 
+// SetTempo changes the ticks of a beat and of a bar, which a lick
+// that is being made goes on with until it is done
+func (ai *AI) SetTempo(ticksPerBeat, ticksPerBar int) {
+	ai.Lock()
+	defer ai.Unlock()
+	ai.TicksBerBeat = ticksPerBeat
+	ai.TicksPerBar = ticksPerBar
+}
+
+// tempo returns the ticks of a beat and of a bar (or 0 if it is not
+// set), and must be called without the lock
+func (ai *AI) tempo() (ticksPerBeat, ticksPerBar int) {
+	ai.RLock()
+	defer ai.RUnlock()
+	return ai.TicksBerBeat, ai.TicksPerBar
+}
+
+// Learning returns whether the AI is busy learning or making a
+// lick, which can be asked while it is
+func (ai *AI) Learning() bool {
+	ai.RLock()
+	defer ai.RUnlock()
+	return ai.IsLearning
+}
+
 func (ai *AI) encode(ints []int) string {
 	h, _ := hashids.NewWithData(ai.hasher)
 	e, _ := h.Encode(ints)
@@ -97,29 +311,60 @@ func (ai *AI) Learn(mus *music.Music) (err error) {
 	logger := log.WithFields(log.Fields{
 		"function": "AI.Analyze",
 	})
+	if ai.order() < 1 {
+		return errors.New("Order must be at least 1")
+	}
 	if len(mus.Notes) < ai.WindowSizeMax {
 		return errors.New("Too few notes")
 	}
 	logger.Debug("Analyzing...")
 	// initialize the links and the chords
+	ai.Lock()
 	ai.links = make(map[string]string)
 	ai.chords = make(map[string][]Chord)
+	ai.Unlock()
 
+	chordArray, chordStringArray, unsettled, unsettledBeat := ai.analyze(mus.Notes)
+	logger.Debugf("...analyzed %d chords", len(chordArray))
+	if len(chordArray) < ai.WindowSizeMax {
+		return errors.New("Need more notes")
+	}
+	rhythm := learnRhythm(chordArray)
+	dynamics := ai.learnDynamics(mus.Notes)
+	// only replace what was learned before if there is enough
+	ai.Lock()
+	ai.chordArray = chordArray
+	ai.chordStringArray = chordStringArray
+	ai.rhythm = rhythm
+	ai.dynamics = dynamics
+	ai.blendStart = 0
+	ai.HasLearned = true
+	ai.unsettled = len(chordArray) - unsettled
+	ai.tail = notesSince(mus.Notes, unsettledBeat)
+	ai.Unlock()
+	return
+}
+
+// analyze finds the chords of the notes, in order, and the index of the
+// first one that is unsettled (with the beat it is on, or -1 if there is
+// none): a chord is settled once the note after it and the end of one of
+// its notes have been played, and more notes can not change it.
+func (ai *AI) analyze(notes map[int]map[int]music.Note) (chordArray []Chord, chordStringArray []string, unsettled int, unsettledBeat int) {
+	// the tempo can change while it is learning
+	ticksPerBeat, _ := ai.tempo()
 	// sort the beats
-	beats := make([]int, len(mus.Notes))
-	beatI := 0
-	for beat := range mus.Notes {
+	beats := make([]int, 0, len(notes))
+	for beat := range notes {
 		if beat == 0 {
 			continue
 		}
-		beats[beatI] = beat
-		beatI++
+		beats = append(beats, beat)
 	}
 	sort.Ints(beats)
 
-	ai.chordArray = make([]Chord, len(beats))
-	ai.chordStringArray = make([]string, len(beats))
-	chordArrayI := 0
+	chordArray = make([]Chord, 0, len(beats))
+	chordStringArray = make([]string, 0, len(beats))
+	unsettledBeat = -1
 	for _, beat1 := range beats {
 		chord := Chord{
 			Pitches: []int{},
@@ -128,13 +373,13 @@ func (ai *AI) Learn(mus *music.Music) (err error) {
 		lag := 0
 		velocity := 0
 
-		for note1 := range mus.Notes[beat1] {
-			if !mus.Notes[beat1][note1].On || note1 < ai.HighPassFilter || mus.Notes[beat1][note1].Velocity < 70 || mus.Notes[beat1][note1].Beat != beat1 {
+		for note1 := range notes[beat1] {
+			if !notes[beat1][note1].On || !ai.inRange(note1) || notes[beat1][note1].Velocity < 70 || notes[beat1][note1].Beat != beat1 {
 				continue
 			}
 			chord.Pitches = append(chord.Pitches, note1)
 			if velocity == 0 {
-				velocity = mus.Notes[beat1][note1].Velocity
+				velocity = notes[beat1][note1].Velocity
 			}
 			if duration > 0 && lag > 0 {
 				continue
@@ -144,14 +389,14 @@ func (ai *AI) Learn(mus *music.Music) (err error) {
 				if beat2 <= beat1 {
 					continue
 				}
-				for note2 := range mus.Notes[beat2] {
-					if mus.Notes[beat2][note2].Beat != beat2 {
+				for note2 := range notes[beat2] {
+					if notes[beat2][note2].Beat != beat2 {
 						continue
 					}
-					if lag == 0 && mus.Notes[beat2][note2].On {
+					if lag == 0 && notes[beat2][note2].On {
 						lag = beat2 - beat1
 					}
-					if duration == 0 && note2 == note1 && !mus.Notes[beat2][note2].On {
+					if duration == 0 && note2 == note1 && !notes[beat2][note2].On {
 						duration = beat2 - beat1
 					}
 				}
@@ -160,92 +405,162 @@ func (ai *AI) Learn(mus *music.Music) (err error) {
 		if len(chord.Pitches) == 0 {
 			continue
 		}
+		if unsettledBeat < 0 && (lag == 0 || duration == 0) {
+			unsettled, unsettledBeat = len(chordArray), beat1
+		}
 		chord.Velocity = velocity
 		chord.Duration = duration
-		if lag > ai.TicksBerBeat*4 {
-			lag = ai.TicksBerBeat * 4
+		if lag > ticksPerBeat*4 {
+			lag = ticksPerBeat * 4
 		}
 		chord.Lag = lag
-		chordString := ai.encode(chord.Pitches)
-		ai.chordStringArray[chordArrayI] = chordString
-		ai.chordArray[chordArrayI] = chord
-		chordArrayI++
+		// a long enough silence after the chord is a rest of its own
+		silence := lag - duration
+		if duration > 0 && silence > restBeats*ticksPerBeat {
+			chord.Lag = duration
+		}
+		// the same chord is encoded the same way however it was played
+		sortedPitches := append([]int{}, chord.Pitches...)
+		sort.Ints(sortedPitches)
+		chordStringArray = append(chordStringArray, ai.encode(sortedPitches))
+		chordArray = append(chordArray, chord)
+		if chord.Lag < lag {
+			chordStringArray = append(chordStringArray, restString)
+			chordArray = append(chordArray, Chord{Pitches: []int{}, Lag: silence, Rest: true})
+		}
 	}
-	ai.chordArray = ai.chordArray[:chordArrayI]
-	ai.chordStringArray = ai.chordStringArray[:chordArrayI]
-	logger.Debugf("...analyzed %d chords", len(ai.chordArray))
-	if len(ai.chordArray) < ai.WindowSizeMax {
-		return errors.New("Need more notes")
+	if unsettledBeat < 0 {
+		unsettled = len(chordArray)
 	}
-	ai.HasLearned = true
 	return
 }
 
+// Forget clears everything that was learned, so that the AI
+// has to Learn again before making another Lick. A Lick that is
+// already being made carries on with what was learned before.
+func (ai *AI) Forget() {
+	ai.Lock()
+	defer ai.Unlock()
+	ai.links = nil
+	ai.chords = nil
+	ai.chordArray = nil
+	ai.chordStringArray = nil
+	ai.drums = nil
+	ai.unsettled = 0
+	ai.tail = nil
+	ai.rhythm = nil
+	ai.dynamics = nil
+	ai.blendStart = 0
+	ai.HasLearned = false
+}
+
 // Lick generates a sequence of chords using the Markov
-// probabilities. Must run Learn() beforehand.
+// probabilities, LickLength beats long. Must run
+// Learn() beforehand.
 func (ai *AI) Lick(startBeat int) (lick *music.Music, err error) {
+	return ai.lick(startBeat, -1)
+}
+
+// lickBeats returns the LickLength, or 4 beats if it is not set
+func (ai *AI) lickBeats() int {
+	if ai.LickLength <= 0 {
+		return 4
+	}
+	return ai.LickLength
+}
+
+// lick generates a lick that starts from one of the learned chords,
+// or from a random one if start is negative
+func (ai *AI) lick(startBeat int, start int) (lick *music.Music, err error) {
 	logger := log.WithFields(log.Fields{
 		"function": "AI.Lick",
 	})
+	if ai.order() < 1 {
+		err = errors.New("Order must be at least 1")
+		return
+	}
 
+	ai.Lock()
 	if !ai.HasLearned || ai.IsLearning {
+		ai.Unlock()
 		err = errors.New("Learning must be finished")
 		return
 	}
 	ai.IsLearning = true
+	// the slices are only ever replaced, so these stay
+	// the same even if the AI forgets or learns again
+	learnedChords := ai.chordArray
+	learnedStrings := ai.chordStringArray
+	learnedRhythm := ai.rhythm
+	learnedDynamics := ai.dynamics
+	blendStart := ai.blendStart
+	ticksPerBeat, ticksPerBar := ai.TicksBerBeat, ai.TicksPerBar
+	thinning := ai.thinning(learnedDynamics)
+	ai.Unlock()
+	defer func() {
+		ai.Lock()
+		ai.IsLearning = false
+		ai.Unlock()
+	}()
 	lick = music.New()
 
-	start := rand.Intn(len(ai.chordArray))
+	if start < 0 && blendStart > 0 {
+		// start in either model, as often as they are blended
+		if rand.Float64() < ai.BlendRatio {
+			start = blendStart + rand.Intn(len(learnedChords)-blendStart)
+		} else {
+			start = rand.Intn(blendStart)
+		}
+	} else if start < 0 {
+		start = rand.Intn(len(learnedChords))
+	}
+	start = start % len(learnedChords)
 	song := []int{}
 
 	for {
 		// expanded to allow it to wrap
 		windowSize := ai.WindowSizeMin + rand.Intn(ai.WindowSizeMax-ai.WindowSizeMin)
 		logger.Debugf("Determing next %d notes", windowSize)
-		chordStringArray := append(ai.chordStringArray[(len(ai.chordStringArray)-windowSize-1):], ai.chordStringArray...)
-		chordStringArray = append(chordStringArray, ai.chordStringArray[:windowSize+1]...)
+		chordStringArray := append(learnedStrings[(len(learnedStrings)-windowSize-1):], learnedStrings...)
+		chordStringArray = append(chordStringArray, learnedStrings[:windowSize+1]...)
 
 		// add the chord indicies to the song
 		for i := 0; i < windowSize; i++ {
 			startI := start + i
-			if startI >= len(ai.chordStringArray) {
+			if startI >= len(learnedStrings) {
 				startI = 0
 				start = -1 * i
 			}
 			song = append(song, startI)
 		}
 
-		// ending criteria
+		// ending criteria, with chords for twice the length, so that
+		// it does not run out whatever the rhythm of the lick is
 		lickLength := 0
 		for _, index := range song {
-			lickLength += ai.chordArray[index].Lag
+			lickLength += learnedChords[index].Lag
 		}
-		if lickLength > ai.TicksBerBeat*4 {
-			logger.Debugf("Lick is long enough (%d ticks / %d beats)", lickLength, lickLength/ai.TicksBerBeat)
+		if lickLength > 2*ticksPerBeat*ai.lickBeats() {
+			logger.Debugf("Lick is long enough (%d ticks / %d beats)", lickLength, lickLength/ticksPerBeat)
 			break
 		}
 
-		// find a new start sequence that is the same as the end sequence of the current song
-		sequenceToFind := make([]string, ai.LinkLength)
-		for i := 0; i < ai.LinkLength; i++ {
-			sequenceToFind[i] = ai.chordStringArray[song[len(song)-(ai.LinkLength-i)]]
+		// find a new start sequence that is the same as the end sequence of the current
+		// song, falling back to shorter sequences if it was never learned
+		order := ai.order()
+		if order > windowSize {
+			order = windowSize
 		}
-		// find the starts of that sequence
-		logger.Debugf("sequence to find: %+v", sequenceToFind)
-		candidateStarts := []int{}
-		for i := range chordStringArray {
-			if i < windowSize || i > len(chordStringArray)-windowSize {
-				continue
+		var candidateStarts []int
+		for ; order > 0; order-- {
+			sequenceToFind := make([]string, order)
+			for i := 0; i < order; i++ {
+				sequenceToFind[i] = learnedStrings[song[len(song)-(order-i)]]
 			}
-			foundMatch := true
-			for j := 0; j < ai.LinkLength; j++ {
-				if chordStringArray[i+j] != sequenceToFind[j] {
-					foundMatch = false
-					break
-				}
-			}
-			if foundMatch {
-				candidateStarts = append(candidateStarts, i)
+			logger.Debugf("sequence to find: %+v", sequenceToFind)
+			candidateStarts = findSequence(chordStringArray, sequenceToFind, windowSize)
+			if len(candidateStarts) > 0 {
+				break
 			}
 		}
 
@@ -253,18 +568,33 @@ func (ai *AI) Lick(startBeat int) (lick *music.Music, err error) {
 		if len(candidateStarts) == 0 {
 			start += windowSize
 		} else {
-			start = candidateStarts[rand.Intn(len(candidateStarts))] - windowSize + ai.LinkLength + 1
+			start = ai.pickCandidate(candidateStarts, chordStringArray, order, windowSize+1, blendStart) - windowSize + order + 1
 		}
 	}
 
-	// for i, s := range ai.chordStringArray {
+	// for i, s := range learnedStrings {
 	// 	fmt.Println(i, s)
 	// }
 
 	// make them into a song
 	firstBeat := startBeat
-	quantizer := 8
-	for _, index := range song {
+	previousGap := 0
+	tonic, _ := music.KeyTonic(ai.Key)
+	scale := ai.Scale
+	restLengths, restShare := learnedRests(learnedChords)
+	for i, index := range song {
+		// no chord starts after the end of the lick
+		if firstBeat-startBeat >= ticksPerBeat*ai.lickBeats() {
+			break
+		}
+		// rests are as long as they were played, but a lick does not
+		// start with one, and they are left out by a RestProbabilityScale below 1
+		if learnedChords[index].Rest {
+			if firstBeat > startBeat && (ai.RestProbabilityScale >= 1 || rand.Float64() < ai.RestProbabilityScale) {
+				firstBeat += learnedChords[index].Lag / quantizer * quantizer
+			}
+			continue
+		}
 		extraDuration := 0
 		stacatto := 0
 		if ai.Stacatto {
@@ -272,27 +602,42 @@ func (ai *AI) Lick(startBeat int) (lick *music.Music, err error) {
 		}
 		if ai.Jazzy {
 			if rand.Intn(20) == 1 {
-				extraDuration += ai.TicksBerBeat * (1 + rand.Intn(4))
+				extraDuration += ticksPerBeat * (1 + rand.Intn(4))
 			}
 		}
 
-		for _, pitch := range ai.chordArray[index].Pitches {
-			logger.Debugf("Adding note %d @ %d with lag %d", pitch, (firstBeat)/quantizer*quantizer, ai.chordArray[index].Lag)
+		// gentler licks leave out some of the chords, but keep the rhythm
+		pitches := learnedChords[index].Pitches
+		if thinning > 0 && i > 0 && rand.Float64() < thinning {
+			pitches = nil
+		}
+		for _, pitch := range pitches {
+			if len(scale.Intervals) > 0 {
+				pitch = scale.Snap(pitch, tonic)
+			} else if ai.Key != "" {
+				pitch = music.SnapToKey(pitch, ai.Key, ai.Mode)
+			}
+			logger.Tracef("Adding note %d @ %d with lag %d", pitch, (firstBeat)/quantizer*quantizer, learnedChords[index].Lag)
 			onNote := music.Note{
 				On:       true,
 				Pitch:    pitch,
-				Velocity: ai.chordArray[index].Velocity,
+				Velocity: learnedChords[index].Velocity,
 				Beat:     (firstBeat) / quantizer * quantizer,
 			}
+			if velocity, ok := learnedDynamics.velocity(barPosition(onNote.Beat, ticksPerBeat, ticksPerBar)); ok {
+				onNote.Velocity = velocity
+			}
+			onNote.Velocity = ai.clampVelocity(ai.intensify(onNote.Velocity))
 			offNote := music.Note{
 				On:       false,
 				Pitch:    pitch,
 				Velocity: 0,
-				Beat:     (firstBeat+ai.chordArray[index].Duration)/quantizer*quantizer + extraDuration,
+				Beat:     (firstBeat+learnedChords[index].Duration)/quantizer*quantizer + extraDuration,
 			}
 			if offNote.Beat-onNote.Beat > 16 {
 				offNote.Beat -= stacatto
 			}
+			ai.humanize(&onNote, &offNote, startBeat)
 			lick.AddNote(onNote)
 			lick.AddNote(offNote)
 			if ai.DisallowChords {
@@ -300,13 +645,28 @@ func (ai *AI) Lick(startBeat int) (lick *music.Music, err error) {
 				break
 			}
 		}
-		firstBeat += (ai.chordArray[index].Lag)/quantizer*quantizer + extraDuration + stacatto
+		// the first gap is the one that was played after the chord,
+		// and the rest follow the rhythm that was learned
+		gap := learnedChords[index].Lag / quantizer * quantizer
+		if i > 0 {
+			if next, ok := learnedRhythm.next(previousGap); ok {
+				gap = next
+			}
+		}
+		previousGap = gap
+		firstBeat += gap + extraDuration
+		if gap > 0 {
+			firstBeat += stacatto
+		}
 		if ai.Jazzy {
 			if rand.Intn(10) == 1 {
-				firstBeat += ai.TicksBerBeat
+				firstBeat += ticksPerBeat
 			}
 		}
+		// and more rests are added by a RestProbabilityScale above 1
+		if extra := (ai.RestProbabilityScale - 1) * restShare; extra > 0 && rand.Float64() < extra {
+			firstBeat += restLengths[rand.Intn(len(restLengths))] / quantizer * quantizer
+		}
 	}
-	ai.IsLearning = false
 	return
 }
@@ -2,6 +2,7 @@ package ai2
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/schollz/pianoai/music"
@@ -19,6 +20,47 @@ func TestAI2(t *testing.T) {
 	fmt.Println(ai.Lick(0))
 }
 
+func TestLickLength(t *testing.T) {
+	ai := New(250)
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai.Learn(m)
+	// the longest a chord is held for, which the last can be past the end
+	held := 0
+	for _, chord := range ai.chordArray {
+		if chord.Duration > held {
+			held = chord.Duration
+		}
+	}
+	ai.Jazzy = false
+	rand.Seed(1)
+	for _, beats := range []int{2, 8, 32} {
+		ai.LickLength = beats
+		for i := 0; i < 20; i++ {
+			lick, err := ai.Lick(100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			length := beats * ai.TicksBerBeat
+			lastOn := 0
+			for _, note := range lick.GetAll() {
+				if note.On && note.Beat > lastOn {
+					lastOn = note.Beat
+				}
+			}
+			if lastOn >= 100+length {
+				t.Errorf("a lick of %d beats has a chord on %d", beats, lastOn)
+			}
+			// the end is where the last note is turned off
+			if end := lick.End(); end <= lastOn || end > 100+length+held {
+				t.Errorf("a lick of %d beats ends on %d, after a chord on %d", beats, end, lastOn)
+			}
+		}
+	}
+}
+
 func TestAI1(t *testing.T) {
 	ai := New(250)
 	m, err := music.Open("../testing/c_scale2.json")
@@ -34,3 +76,39 @@ func TestAI1(t *testing.T) {
 	}
 	// fmt.Println(ai.Lick(0))
 }
+
+func TestPickCandidate(t *testing.T) {
+	// the chords after the candidates are x, x, x and y,
+	// so x is three times as likely as y
+	chords := []string{"a", "x", "x", "x", "y"}
+	candidates := []int{0, 1, 2, 3}
+	ai := New(64)
+	rand.Seed(1)
+	for _, test := range []struct {
+		temperature float64
+		min, max    int
+	}{
+		// only the most common, and y never
+		{0, 0, 0},
+		{1, 850, 1150},
+		// x is nine times as likely
+		{0.5, 300, 500},
+		// all but evenly
+		{100, 1850, 2150},
+	} {
+		ai.Temperature = test.temperature
+		picked := make(map[int]int)
+		for i := 0; i < 4000; i++ {
+			picked[ai.pickCandidate(candidates, chords, 1, 0, 0)]++
+		}
+		if picked[3] < test.min || picked[3] > test.max {
+			t.Errorf("expected y to be picked %d-%d times at a temperature of %g, got %d", test.min, test.max, test.temperature, picked[3])
+		}
+		// the candidates of x are as likely as each other
+		for _, candidate := range candidates[:3] {
+			if share := float64(picked[candidate]) / float64(4000-picked[3]); share < 0.28 || share > 0.39 {
+				t.Errorf("expected candidate %d to be a third of the x at a temperature of %g, got %.2f", candidate, test.temperature, share)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ai2
+
+import (
+	"errors"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// lowestBass is the lowest pitch of the bass line (C2)
+const lowestBass = 36
+
+// GenerateBass makes a walking bass line for the harmony of some chords
+// (as returned by music.GetChords), with a bar of bass for every bar that
+// the chords span, starting at startBeat. The root of each bar is the
+// lowest note played in it, and the bass plays the root on the first beat,
+// the fifth in the middle of the bar, the third on the other beats and
+// leads into the root of the next bar on the last beat. The notes are on
+// BassChannel.
+func (ai *AI) GenerateBass(chords [][]music.Note, startBeat int) (bass *music.Music, err error) {
+	bass = music.New()
+	beatTicks, ticksPerBar := ai.tempo()
+	if ticksPerBar <= 0 {
+		ticksPerBar = 4 * beatTicks
+	}
+	if beatTicks <= 0 {
+		err = errors.New("Ticks per beat must be set")
+		return
+	}
+	beatsPerBar := ticksPerBar / beatTicks
+	if beatsPerBar < 1 {
+		beatsPerBar = 1
+	}
+
+	// the root of every bar, which stays the same through empty bars
+	firstBar, lastBar := -1, -1
+	lowest := make(map[int]int)
+	for _, chord := range chords {
+		for _, note := range chord {
+			bar := note.Beat / ticksPerBar
+			if firstBar < 0 || bar < firstBar {
+				firstBar = bar
+			}
+			if bar > lastBar {
+				lastBar = bar
+			}
+			if pitch, ok := lowest[bar]; !ok || note.Pitch < pitch {
+				lowest[bar] = note.Pitch
+			}
+		}
+	}
+	if firstBar < 0 {
+		err = errors.New("No harmony to follow")
+		return
+	}
+	roots := make([]int, lastBar-firstBar+1)
+	for i := range roots {
+		if pitch, ok := lowest[firstBar+i]; ok {
+			roots[i] = lowestBass + pitch%12
+		} else {
+			roots[i] = roots[i-1]
+		}
+	}
+
+	third := 4
+	if ai.Mode == "minor" {
+		third = 3
+	}
+	for i, root := range roots {
+		nextRoot := roots[(i+1)%len(roots)]
+		for beat := 0; beat < beatsPerBar; beat++ {
+			pitch := root + third
+			velocity := 70
+			switch {
+			case beat == 0:
+				pitch = root
+				velocity = 85
+			case beat == beatsPerBar/2 && beatsPerBar > 2:
+				pitch = root + 7
+			case beat == beatsPerBar-1:
+				// a semitone below the next root
+				pitch = nextRoot - 1
+				if pitch < lowestBass {
+					pitch += 12
+				}
+			}
+			onBeat := startBeat + i*ticksPerBar + beat*beatTicks
+			bass.AddNote(music.Note{
+				On:       true,
+				Pitch:    pitch,
+				Velocity: ai.clampVelocity(velocity),
+				Beat:     onBeat,
+				Channel:  ai.BassChannel,
+			})
+			// a little detached, like a plucked string
+			bass.AddNote(music.Note{
+				On:      false,
+				Pitch:   pitch,
+				Beat:    onBeat + beatTicks*9/10,
+				Channel: ai.BassChannel,
+			})
+		}
+	}
+	return
+}
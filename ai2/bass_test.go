@@ -0,0 +1,42 @@
+package ai2
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestGenerateBass(t *testing.T) {
+	ai := New(4)
+	// a bar of C major, an empty bar and a bar of G major
+	chords := [][]music.Note{
+		{{On: true, Pitch: 60, Beat: 0}, {On: true, Pitch: 64, Beat: 0}, {On: true, Pitch: 67, Beat: 1}},
+		{{On: true, Pitch: 55, Beat: 32}, {On: true, Pitch: 71, Beat: 32}},
+	}
+	bass, err := ai.GenerateBass(chords, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := bass.Consolidate()
+	if len(notes) != 12 {
+		t.Fatalf("expected 3 bars of 4 beats, got %+v", notes)
+	}
+	// roots on the first beat, fifths in the middle
+	expected := map[int]int{100: 36, 108: 43, 116: 36, 124: 43, 132: 43, 140: 50}
+	for _, note := range notes {
+		if pitch, ok := expected[note.Beat]; ok && note.Pitch != pitch {
+			t.Errorf("expected %d at %d, got %d", pitch, note.Beat, note.Pitch)
+		}
+		if note.Channel != ai.BassChannel || note.Duration < 1 {
+			t.Errorf("got %+v", note)
+		}
+	}
+	// leading into G on the last beat of the second bar
+	if _, ok := bass.Notes[128][42]; !ok {
+		t.Errorf("expected an F# leading into G, got %+v", bass.Notes[128])
+	}
+
+	if _, err = ai.GenerateBass(nil, 0); err == nil {
+		t.Errorf("there is no harmony to follow")
+	}
+}
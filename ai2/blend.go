@@ -0,0 +1,83 @@
+package ai2
+
+import (
+	"errors"
+)
+
+// Blend has the AI improvise in between the styles of two models,
+// instead of what it learned. Where a lick can go next is picked from
+// the chances of each model, mixed by BlendRatio: 0 plays like modelA,
+// 1 like modelB and 0.5 halfway between them. It sets BlendRatio to the
+// ratio, which can then be changed while improvising. The blend lasts
+// until the AI learns or forgets.
+func (ai *AI) Blend(modelA, modelB *Model, ratio float64) (err error) {
+	if modelA == nil || modelB == nil || len(modelA.Chords) == 0 || len(modelB.Chords) == 0 {
+		return errors.New("Models must have chords to blend")
+	}
+	if len(modelA.Chords) != len(modelA.ChordStrings) || len(modelB.Chords) != len(modelB.ChordStrings) {
+		return errors.New("Models have chords that are not encoded")
+	}
+	if len(modelA.Chords)+len(modelB.Chords) < ai.WindowSizeMax {
+		return errors.New("Models have too few chords to blend")
+	}
+	chordStrings := append(append([]string{}, modelA.ChordStrings...), modelB.ChordStrings...)
+	dynamics := make(map[int][]int)
+	for _, d := range []map[int][]int{modelA.Dynamics, modelB.Dynamics} {
+		for position, velocities := range d {
+			dynamics[position] = append(dynamics[position], velocities...)
+		}
+	}
+	ai.Lock()
+	chords := append(ai.rescale(modelA), ai.rescale(modelB)...)
+	ai.chordArray = chords
+	ai.chordStringArray = chordStrings
+	ai.rhythm = learnRhythm(chords)
+	ai.dynamics = dynamics
+	ai.blendStart = len(modelA.Chords)
+	ai.BlendRatio = ratio
+	ai.HasLearned = true
+	ai.unsettled, ai.tail = 0, nil
+	ai.Unlock()
+	return
+}
+
+// blendWeights returns how likely each group of candidates is, from how
+// often it comes next in each of the blended models, mixed by the
+// ratio. The candidates are indices of the learned chords.
+func blendWeights(groups [][]int, blendStart int, ratio float64) (weights []float64) {
+	if ratio < 0 {
+		ratio = 0
+	} else if ratio > 1 {
+		ratio = 1
+	}
+	countsA, countsB := make([]int, len(groups)), make([]int, len(groups))
+	totalA, totalB := 0, 0
+	for i, group := range groups {
+		for _, candidate := range group {
+			if candidate < blendStart {
+				countsA[i]++
+				totalA++
+			} else {
+				countsB[i]++
+				totalB++
+			}
+		}
+	}
+	// a model that never played the sequence has no say
+	shareA, shareB := 1-ratio, ratio
+	if totalA == 0 {
+		shareA, shareB = 0, 1
+	} else if totalB == 0 {
+		shareA, shareB = 1, 0
+	}
+	weights = make([]float64, len(groups))
+	for i := range groups {
+		if totalA > 0 {
+			weights[i] += shareA * float64(countsA[i]) / float64(totalA)
+		}
+		if totalB > 0 {
+			weights[i] += shareB * float64(countsB[i]) / float64(totalB)
+		}
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package ai2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestBlendWeights(t *testing.T) {
+	// three candidates of the first model, two of them going on to
+	// the first group, and one of the second model in the second group
+	groups := [][]int{{0, 1}, {2, 10}}
+	for _, test := range []struct {
+		ratio    float64
+		expected []float64
+	}{
+		{0, []float64{2.0 / 3, 1.0 / 3}},
+		{1, []float64{0, 1}},
+		{0.5, []float64{1.0 / 3, 2.0 / 3}},
+	} {
+		weights := blendWeights(groups, 5, test.ratio)
+		for i := range test.expected {
+			if d := weights[i] - test.expected[i]; d > 1e-9 || d < -1e-9 {
+				t.Errorf("ratio %v: got %v, expected %v", test.ratio, weights, test.expected)
+			}
+		}
+	}
+	// the second model never played it
+	if weights := blendWeights([][]int{{0}, {1}}, 5, 1); weights[0] != 0.5 || weights[1] != 0.5 {
+		t.Errorf("got %v", weights)
+	}
+}
+
+func TestBlend(t *testing.T) {
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(os.TempDir(), "pianoai_blend")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	models := []*Model{}
+	for i, semitones := range []int{0, 5} {
+		ai := New(250)
+		m.Transpose(semitones)
+		if err = ai.Learn(m); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, string('a'+rune(i))+".json")
+		if err = ai.Save(filename); err != nil {
+			t.Fatal(err)
+		}
+		model, err := LoadModel(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		models = append(models, model)
+	}
+
+	ai := New(250)
+	if err = ai.Blend(models[0], models[1], 0.25); err != nil {
+		t.Fatal(err)
+	}
+	if ai.blendStart != len(models[0].Chords) || len(ai.chordArray) != len(models[0].Chords)+len(models[1].Chords) || ai.BlendRatio != 0.25 {
+		t.Errorf("got %d chords from %d, ratio %v", len(ai.chordArray), ai.blendStart, ai.BlendRatio)
+	}
+	for _, ratio := range []float64{0, 0.5, 1} {
+		ai.BlendRatio = ratio
+		lick, err := ai.Lick(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lick.GetAll()) == 0 {
+			t.Errorf("empty lick with ratio %v", ratio)
+		}
+	}
+
+	filename := filepath.Join(dir, "blend.json")
+	if err = ai.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := New(250)
+	if err = loaded.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.blendStart != ai.blendStart {
+		t.Errorf("the blend was not saved")
+	}
+	if err = loaded.Learn(m); err != nil || loaded.blendStart != 0 {
+		t.Errorf("learning should end the blend")
+	}
+}
@@ -0,0 +1,179 @@
+package ai2
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// the General MIDI drums of the grooves
+const (
+	Kick      = 36
+	Snare     = 38
+	ClosedHat = 42
+)
+
+// drumPattern is how often each drum was hit on each sixteenth of
+// the bar, from 0 to 1, and how hard it was hit on average
+type drumPattern struct {
+	steps      int
+	hits       map[int][]float64
+	velocities map[int]int
+}
+
+// sixteenth returns the length of a sixteenth note, at least a tick
+func (ai *AI) sixteenth() int {
+	ticksPerBeat, _ := ai.tempo()
+	if ticksPerBeat < 4 {
+		return 1
+	}
+	return ticksPerBeat / 4
+}
+
+// barTicks returns the TicksPerBar, or 4 beats if it is not set
+func (ai *AI) barTicks() int {
+	ticksPerBeat, ticksPerBar := ai.tempo()
+	if ticksPerBar <= 0 {
+		return 4 * ticksPerBeat
+	}
+	return ticksPerBar
+}
+
+// LearnDrums learns the groove of the notes on the DrumChannel, which
+// GenerateDrums then plays instead of the one it has to start with
+func (ai *AI) LearnDrums(mus *music.Music) (err error) {
+	ticksPerBar, sixteenth := ai.barTicks(), ai.sixteenth()
+	if ticksPerBar <= 0 {
+		return errors.New("Ticks per beat must be set")
+	}
+	pattern := drumPattern{
+		steps:      ticksPerBar / sixteenth,
+		hits:       make(map[int][]float64),
+		velocities: make(map[int]int),
+	}
+	if pattern.steps < 1 {
+		pattern.steps = 1
+	}
+	firstBar, lastBar := -1, -1
+	hit := make(map[[3]int]bool)
+	count := 0
+	for _, note := range mus.GetAll() {
+		if !note.On || note.Channel != ai.DrumChannel {
+			continue
+		}
+		bar := note.Beat / ticksPerBar
+		// to the nearest sixteenth, which can be the next bar's first
+		step := (note.Beat%ticksPerBar + sixteenth/2) / sixteenth
+		if step >= pattern.steps {
+			bar, step = bar+1, 0
+		}
+		if firstBar < 0 || bar < firstBar {
+			firstBar = bar
+		}
+		if bar > lastBar {
+			lastBar = bar
+		}
+		if _, ok := pattern.hits[note.Pitch]; !ok {
+			pattern.hits[note.Pitch] = make([]float64, pattern.steps)
+		}
+		if !hit[[3]int{bar, step, note.Pitch}] {
+			hit[[3]int{bar, step, note.Pitch}] = true
+			pattern.hits[note.Pitch][step]++
+		}
+		pattern.velocities[note.Pitch] += note.Velocity
+		count++
+	}
+	if count == 0 {
+		return errors.New("No drums to learn")
+	}
+	bars := float64(lastBar - firstBar + 1)
+	for pitch, steps := range pattern.hits {
+		times := 0.0
+		for step := range steps {
+			times += steps[step]
+			steps[step] /= bars
+		}
+		pattern.velocities[pitch] = int(float64(pattern.velocities[pitch])/times + 0.5)
+	}
+	ai.Lock()
+	ai.drums = &pattern
+	ai.Unlock()
+	return
+}
+
+// defaultGroove returns the drum pattern that is played until one is
+// learned, for the time signature of TicksPerBar: a kick on the first
+// beat (and the middle of bars of an even number of at least four beats),
+// a snare on the other beats in between and a closed hi-hat on the eighths
+func (ai *AI) defaultGroove() drumPattern {
+	ticksPerBar, sixteenth := ai.barTicks(), ai.sixteenth()
+	pattern := drumPattern{
+		steps: ticksPerBar / sixteenth,
+		hits: map[int][]float64{
+			Kick:      make([]float64, ticksPerBar/sixteenth),
+			Snare:     make([]float64, ticksPerBar/sixteenth),
+			ClosedHat: make([]float64, ticksPerBar/sixteenth),
+		},
+		velocities: map[int]int{Kick: 100, Snare: 90, ClosedHat: 60},
+	}
+	ticksPerBeat, _ := ai.tempo()
+	beatsPerBar := ticksPerBar / ticksPerBeat
+	for beat := 0; beat < beatsPerBar; beat++ {
+		step := beat * ticksPerBeat / sixteenth
+		switch {
+		case beat == 0, beatsPerBar >= 4 && beatsPerBar%2 == 0 && beat == beatsPerBar/2:
+			pattern.hits[Kick][step] = 1
+		case beat%2 == 1:
+			pattern.hits[Snare][step] = 1
+		}
+	}
+	for step := 0; step < pattern.steps; step += 2 {
+		pattern.hits[ClosedHat][step] = 1
+	}
+	return pattern
+}
+
+// GenerateDrums makes a number of bars of a groove starting at
+// startBeat, which is the one learned with LearnDrums if it fits the
+// TicksPerBar (or else the default groove), with each drum hit as
+// often as it was played on each sixteenth. The notes are on DrumChannel.
+func (ai *AI) GenerateDrums(bars int, startBeat int) (drums *music.Music, err error) {
+	drums = music.New()
+	if ticksPerBeat, _ := ai.tempo(); ticksPerBeat <= 0 {
+		err = errors.New("Ticks per beat must be set")
+		return
+	}
+	ticksPerBar, sixteenth := ai.barTicks(), ai.sixteenth()
+	ai.RLock()
+	learned := ai.drums
+	ai.RUnlock()
+	pattern := ai.defaultGroove()
+	if learned != nil && learned.steps == ticksPerBar/sixteenth {
+		pattern = *learned
+	}
+	for bar := 0; bar < bars; bar++ {
+		for pitch, steps := range pattern.hits {
+			for step, often := range steps {
+				if often < 1 && rand.Float64() >= often {
+					continue
+				}
+				beat := startBeat + bar*ticksPerBar + step*sixteenth
+				drums.AddNote(music.Note{
+					On:       true,
+					Pitch:    pitch,
+					Velocity: ai.clampVelocity(pattern.velocities[pitch]),
+					Beat:     beat,
+					Channel:  ai.DrumChannel,
+				})
+				drums.AddNote(music.Note{
+					On:      false,
+					Pitch:   pitch,
+					Beat:    beat + sixteenth/2 + 1,
+					Channel: ai.DrumChannel,
+				})
+			}
+		}
+	}
+	return
+}
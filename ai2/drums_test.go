@@ -0,0 +1,76 @@
+package ai2
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func drumHits(drums *music.Music) map[int][]int {
+	hits := make(map[int][]int)
+	for _, note := range drums.GetAll() {
+		if note.On {
+			hits[note.Pitch] = append(hits[note.Pitch], note.Beat)
+		}
+	}
+	for pitch := range hits {
+		sort.Ints(hits[pitch])
+	}
+	return hits
+}
+
+func TestDrums(t *testing.T) {
+	ai := New(64)
+	ai.TicksPerBar = 4 * 64
+	drums, err := ai.GenerateDrums(2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := drumHits(drums)
+	if len(hits[Kick]) != 4 || hits[Kick][0] != 100 || hits[Kick][1] != 100+2*64 {
+		t.Errorf("Kicks in 4/4 are on %v", hits[Kick])
+	}
+	if len(hits[Snare]) != 4 || hits[Snare][0] != 100+64 || hits[Snare][1] != 100+3*64 {
+		t.Errorf("Snares in 4/4 are on %v", hits[Snare])
+	}
+	if len(hits[ClosedHat]) != 16 {
+		t.Errorf("Got %d hi-hats in two bars of 4/4", len(hits[ClosedHat]))
+	}
+	for _, note := range drums.GetAll() {
+		if note.Channel != 9 {
+			t.Fatalf("Drum on channel %d", note.Channel)
+		}
+	}
+
+	ai.TicksPerBar = 3 * 64
+	drums, _ = ai.GenerateDrums(1, 0)
+	hits = drumHits(drums)
+	if len(hits[Kick]) != 1 || len(hits[Snare]) != 1 || hits[Snare][0] != 64 || len(hits[ClosedHat]) != 6 {
+		t.Errorf("Got %v in 3/4", hits)
+	}
+
+	// a kick on every beat and nothing else is learned from channel 10
+	played := music.New()
+	for beat := 0; beat < 9*64; beat += 64 {
+		played.AddNote(music.Note{On: true, Pitch: Kick, Velocity: 80, Beat: beat + 3, Channel: 9})
+		played.AddNote(music.Note{Pitch: Kick, Beat: beat + 10, Channel: 9})
+		played.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: beat})
+	}
+	if err = ai.LearnDrums(played); err != nil {
+		t.Fatal(err)
+	}
+	drums, _ = ai.GenerateDrums(1, 0)
+	hits = drumHits(drums)
+	if len(hits) != 1 || len(hits[Kick]) != 3 || hits[Kick][2] != 128 {
+		t.Errorf("Got %v after learning", hits)
+	}
+	ai.Forget()
+	if err = ai.LearnDrums(music.New()); err == nil {
+		t.Error("Learned drums from no drums")
+	}
+	drums, _ = ai.GenerateDrums(1, 0)
+	if len(drumHits(drums)[Snare]) != 1 {
+		t.Error("Did not go back to the default groove")
+	}
+}
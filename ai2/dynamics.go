@@ -0,0 +1,103 @@
+package ai2
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// dynamics are the velocities that were played at each sixteenth of a bar,
+// so that picking one at random follows how loud notes were played there
+type dynamics map[int][]int
+
+// barPosition returns the sixteenth of the bar that a beat falls on,
+// for bars of ticksPerBar (or 4 beats if it is not set)
+func barPosition(beat, ticksPerBeat, ticksPerBar int) int {
+	sixteenth := ticksPerBeat / 4
+	if sixteenth < 1 {
+		sixteenth = 1
+	}
+	if ticksPerBar <= 0 {
+		ticksPerBar = 4 * ticksPerBeat
+	}
+	if ticksPerBar <= 0 {
+		return 0
+	}
+	return (beat % ticksPerBar) / sixteenth
+}
+
+// learnDynamics collects the velocities of every note-on above the high pass filter
+func (ai *AI) learnDynamics(notes map[int]map[int]music.Note) (d dynamics) {
+	d = make(dynamics)
+	ticksPerBeat, ticksPerBar := ai.tempo()
+	for beat := range notes {
+		for _, note := range notes[beat] {
+			if !note.On || note.Velocity == 0 || !ai.inRange(note.Pitch) {
+				continue
+			}
+			p := barPosition(note.Beat, ticksPerBeat, ticksPerBar)
+			d[p] = append(d[p], note.Velocity)
+		}
+	}
+	return
+}
+
+// velocity picks a velocity for a position in the bar, if any were played there
+func (d dynamics) velocity(position int) (velocity int, ok bool) {
+	velocities := d[position]
+	if len(velocities) == 0 {
+		return
+	}
+	return velocities[rand.Intn(len(velocities))], true
+}
+
+// clampVelocity keeps a velocity between MinVelocity and MaxVelocity
+func (ai *AI) clampVelocity(velocity int) int {
+	if ai.MaxVelocity > 0 && velocity > ai.MaxVelocity {
+		velocity = ai.MaxVelocity
+	}
+	if velocity < ai.MinVelocity {
+		velocity = ai.MinVelocity
+	}
+	return velocity
+}
+
+// average returns the average of the learned velocities
+func (d dynamics) average() float64 {
+	sum, count := 0, 0
+	for _, velocities := range d {
+		for _, velocity := range velocities {
+			sum += velocity
+		}
+		count += len(velocities)
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count)
+}
+
+// sensitivity returns the IntensitySensitivity, between 0 and 1,
+// which is 0 if there is no Intensity to follow
+func (ai *AI) sensitivity() float64 {
+	if ai.Intensity <= 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, ai.IntensitySensitivity))
+}
+
+// intensify moves a velocity towards the Intensity, by the sensitivity
+func (ai *AI) intensify(velocity int) int {
+	return velocity + int(math.Round(ai.sensitivity()*(ai.Intensity-float64(velocity))))
+}
+
+// thinning returns how likely each chord of a lick is to be left out,
+// which is more the softer the Intensity is than the learned dynamics
+func (ai *AI) thinning(d dynamics) float64 {
+	learned := d.average()
+	if learned == 0 || ai.Intensity >= learned {
+		return 0
+	}
+	return ai.sensitivity() * (1 - ai.Intensity/learned)
+}
@@ -0,0 +1,40 @@
+package ai2
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestIntensity(t *testing.T) {
+	ai := New(250)
+	ai.Humanize = Humanize{}
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai.Learn(m)
+	average := func(lick *music.Music) float64 {
+		return lick.Stats().AverageVelocity
+	}
+
+	rand.Seed(1)
+	normal, err := ai.Lick(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai.Intensity, ai.IntensitySensitivity = 35, 1
+	rand.Seed(1)
+	gentle, _ := ai.Lick(0)
+	if average(gentle) > 36 || average(gentle) >= average(normal) {
+		t.Errorf("expected a gentle lick, got %2.0f instead of %2.0f", average(gentle), average(normal))
+	}
+	if gentle.Stats().Notes >= normal.Stats().Notes {
+		t.Errorf("expected a gentle lick to have fewer notes, got %d instead of %d", gentle.Stats().Notes, normal.Stats().Notes)
+	}
+	ai.Intensity = 115
+	if bold, _ := ai.Lick(0); average(bold) < 110 {
+		t.Errorf("expected a bold lick, got %2.0f", average(bold))
+	}
+}
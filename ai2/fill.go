@@ -0,0 +1,66 @@
+package ai2
+
+import (
+	"errors"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// GenerateFill makes a fill of a number of bars, starting at beat 0,
+// that carries on from the context (consolidated notes, such as the
+// last phrase that was played) like Respond does, or from anywhere if
+// there is no context. Every note of the fill is turned off before the
+// end of its last bar, so it is over by the downbeat after it.
+func (ai *AI) GenerateFill(context []music.Note, bars int) (fill *music.Music, err error) {
+	if bars < 1 {
+		err = errors.New("A fill must be at least a bar long")
+		return
+	}
+	ticksPerBeat, ticksPerBar := ai.tempo()
+	if ticksPerBar <= 0 {
+		ticksPerBar = 4 * ticksPerBeat
+	}
+	length := bars * ticksPerBar
+	if length < 2 {
+		err = errors.New("Ticks per beat must be set")
+		return
+	}
+	start := -1
+	if len(context) > 0 {
+		start = ai.continuation(context)
+	}
+	fill = music.New()
+	// licks are a few beats long, so a long fill takes a few of them
+	for covered := 0; covered < length-1; {
+		var lick *music.Music
+		lick, err = ai.lick(0, start)
+		if err != nil {
+			return
+		}
+		start = -1
+		lickEnd := 0
+		for _, note := range lick.Consolidate() {
+			note.Beat += covered
+			if note.Beat >= length-1 {
+				continue
+			}
+			end := note.Beat + note.Duration
+			if end > length-1 {
+				end = length - 1
+			}
+			if end <= note.Beat {
+				end = note.Beat + 1
+			}
+			if end > lickEnd {
+				lickEnd = end
+			}
+			fill.AddNote(music.Note{On: true, Pitch: note.Pitch, Velocity: note.Velocity, Beat: note.Beat, Channel: note.Channel})
+			fill.AddNote(music.Note{On: false, Pitch: note.Pitch, Beat: end, Channel: note.Channel})
+		}
+		if lickEnd <= covered {
+			break
+		}
+		covered = lickEnd
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package ai2
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestGenerateFill(t *testing.T) {
+	ai := New(250)
+	ai.TicksPerBar = 1000
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ai.Learn(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for bars := 1; bars <= 2; bars++ {
+		fill, err := ai.GenerateFill(m.Consolidate()[:20], bars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes := fill.Consolidate()
+		if len(notes) == 0 {
+			t.Errorf("empty fill of %d bars", bars)
+		}
+		for _, note := range notes {
+			if note.Beat < 0 || note.Beat+note.Duration >= bars*ai.TicksPerBar {
+				t.Errorf("%+v is not over before bar %d", note, bars+1)
+			}
+		}
+	}
+	if _, err = ai.GenerateFill(nil, 0); err == nil {
+		t.Errorf("a fill can't be shorter than a bar")
+	}
+}
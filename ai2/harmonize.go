@@ -0,0 +1,269 @@
+package ai2
+
+import (
+	"errors"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// lowestHarmony is the lowest root of the chords of a harmony (C3)
+const lowestHarmony = 48
+
+// degreePreference is the order that the chords of a key are tried in,
+// so that a tie goes to the more common chord
+var degreePreference = []int{0, 4, 3, 5, 1, 2, 6}
+
+// Harmonize makes chords to go under a melody (consolidated notes, as
+// returned by music.Consolidate), on the same beats as the melody. There
+// is a chord on every strong beat that the melody plays through, which
+// is the first beat of the bar and the middle of bars with an even
+// number of beats (at least four). The chords are the triads of the Key,
+// or of the key detected from the melody if Key is empty, and the one
+// picked fits the melody notes sounding with it best, with the ones on
+// the strong beat counting double, leaning towards the pitches that were
+// learned, if anything was (and to the I, V, IV and vi chords in that
+// order if it is a tie). Chords are voiced by the Voicing below the
+// melody, leaving out any chord note a semitone away from a melody note
+// sounding with it. The notes are on HarmonyChannel.
+func (ai *AI) Harmonize(melody []music.Note) (harmony *music.Music, err error) {
+	harmony = music.New()
+	beatTicks, ticksPerBar := ai.tempo()
+	if ticksPerBar <= 0 {
+		ticksPerBar = 4 * beatTicks
+	}
+	if beatTicks <= 0 {
+		err = errors.New("Ticks per beat must be set")
+		return
+	}
+	step := ticksPerBar
+	if beatsPerBar := ticksPerBar / beatTicks; beatsPerBar >= 4 && beatsPerBar%2 == 0 {
+		step = ticksPerBar / 2
+	}
+
+	notes := []music.Note{}
+	tune := music.New()
+	first, end := 0, 0
+	for _, note := range melody {
+		if !note.On {
+			continue
+		}
+		if note.Duration < 1 {
+			note.Duration = 1
+		}
+		if len(notes) == 0 || note.Beat < first {
+			first = note.Beat
+		}
+		if note.Beat+note.Duration > end {
+			end = note.Beat + note.Duration
+		}
+		notes = append(notes, note)
+		tune.AddNote(note)
+		tune.AddNote(music.Note{Pitch: note.Pitch, Beat: note.Beat + note.Duration})
+	}
+	if len(notes) == 0 {
+		err = errors.New("No melody to harmonize")
+		return
+	}
+
+	key, mode := ai.Key, ai.Mode
+	if key == "" {
+		key, mode, _ = tune.DetectKey()
+	}
+	triads := keyTriads(key, mode)
+	if len(triads) != len(degreePreference) {
+		err = errors.New("Unknown key " + key + " " + mode)
+		return
+	}
+	learned := ai.learnedPitchClasses()
+	if _, ok := voicings[ai.Voicing]; !ok {
+		err = errors.New("Unknown voicing " + ai.Voicing)
+		return
+	}
+	var previous []int
+
+	for beat := first - first%step; beat < end; beat += step {
+		spanEnd := beat + step
+		if spanEnd > end {
+			spanEnd = end
+		}
+		// how long each pitch class sounds in the span,
+		// and which pitches the chord has to stay clear of
+		var weights [12]float64
+		sounding := []music.Note{}
+		lowest := 128
+		velocity, count := 0, 0
+		for _, note := range notes {
+			from, to := note.Beat, note.Beat+note.Duration
+			if from < beat {
+				from = beat
+			}
+			if to > spanEnd {
+				to = spanEnd
+			}
+			if to <= from {
+				continue
+			}
+			weight := float64(to - from)
+			if note.Beat <= beat {
+				weight *= 2
+			}
+			weights[pitchClass(note.Pitch)] += weight
+			sounding = append(sounding, note)
+			if note.Pitch < lowest {
+				lowest = note.Pitch
+			}
+			velocity += note.Velocity
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+
+		best, bestScore := -1, 0.0
+		for _, degree := range degreePreference {
+			triad := triads[degree]
+			score := 0.0
+			for pc, weight := range weights {
+				if weight == 0 {
+					continue
+				}
+				for _, tone := range triad {
+					switch pitchClass(pc - tone) {
+					case 0:
+						score += weight
+					case 1, 11:
+						score -= 2 * weight
+					}
+				}
+			}
+			for _, tone := range triad {
+				score += learned[tone] * float64(spanEnd-beat) / 2
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = degree, score
+			}
+		}
+
+		// voice the chord below the lowest note of the melody
+		root := lowestHarmony + triads[best][0]
+		for root+pitchClass(triads[best][2]-triads[best][0]) >= lowest && root-12 >= lowestBass {
+			root -= 12
+		}
+		chord := []int{}
+		for _, tone := range triads[best] {
+			chord = append(chord, root+pitchClass(tone-triads[best][0]))
+		}
+		chord = voicings[ai.Voicing](previous, chord)
+		for chord[len(chord)-1] >= lowest && chord[0]-12 >= lowestBass {
+			for i := range chord {
+				chord[i] -= 12
+			}
+		}
+		previous = chord
+		velocity = ai.clampVelocity(velocity / count * 4 / 5)
+		offBeat := spanEnd - 1
+		if offBeat <= beat {
+			offBeat = beat + 1
+		}
+		for _, pitch := range chord {
+			if clashes(pitch, sounding) {
+				continue
+			}
+			harmony.AddNote(music.Note{
+				On:       true,
+				Pitch:    pitch,
+				Velocity: velocity,
+				Beat:     beat,
+				Channel:  ai.HarmonyChannel,
+			})
+			harmony.AddNote(music.Note{
+				On:      false,
+				Pitch:   pitch,
+				Beat:    offBeat,
+				Channel: ai.HarmonyChannel,
+			})
+		}
+	}
+	return
+}
+
+// voicings are the ways of voicing the chords of Harmonize, from the
+// pitches of the chord in root position and the chord before it (if any)
+var voicings = map[string]func(previous, chord []int) []int{
+	"":     func(previous, chord []int) []int { return chord },
+	"root": func(previous, chord []int) []int { return chord },
+	"first": func(previous, chord []int) []int {
+		return music.Invert(chord, 1)
+	},
+	"second": func(previous, chord []int) []int {
+		return music.Invert(chord, 2)
+	},
+	"spread": func(previous, chord []int) []int {
+		return music.Spread(chord)
+	},
+	"lead": music.VoiceLead,
+}
+
+// keyTriads returns the pitch classes of the root, third and fifth of
+// the triad on every degree of the scale of a key, starting on the tonic
+func keyTriads(key, mode string) (triads [][3]int) {
+	tonic, ok := music.KeyTonic(key)
+	if !ok {
+		return
+	}
+	scale := []int{}
+	for pc := 0; pc < 12; pc++ {
+		pitch := tonic + pc
+		if music.SnapToKey(pitch, key, mode) == pitch {
+			scale = append(scale, pitchClass(pitch))
+		}
+	}
+	if len(scale) == 12 {
+		// the mode was not recognized
+		return
+	}
+	for degree := range scale {
+		triads = append(triads, [3]int{
+			scale[degree],
+			scale[(degree+2)%len(scale)],
+			scale[(degree+4)%len(scale)],
+		})
+	}
+	return
+}
+
+// learnedPitchClasses returns how much of what was learned is
+// on each pitch class, adding up to 1 (or 0 if nothing was learned)
+func (ai *AI) learnedPitchClasses() (share [12]float64) {
+	ai.RLock()
+	learnedChords := ai.chordArray
+	ai.RUnlock()
+	total := 0
+	for _, chord := range learnedChords {
+		for _, pitch := range chord.Pitches {
+			share[pitchClass(pitch)]++
+			total++
+		}
+	}
+	for pc := range share {
+		if total > 0 {
+			share[pc] /= float64(total)
+		}
+	}
+	return
+}
+
+// clashes returns whether a pitch is a semitone away from any of the
+// notes, in any octave
+func clashes(pitch int, notes []music.Note) bool {
+	for _, note := range notes {
+		if d := pitchClass(note.Pitch - pitch); d == 1 || d == 11 {
+			return true
+		}
+	}
+	return false
+}
+
+func pitchClass(pitch int) int {
+	return (pitch%12 + 12) % 12
+}
@@ -0,0 +1,92 @@
+package ai2
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestHarmonize(t *testing.T) {
+	ai := New(4)
+	ai.Key = "C"
+	// C E in the first half of the bar, F A in the second and a long G
+	melody := []music.Note{
+		{On: true, Pitch: 72, Velocity: 80, Beat: 0, Duration: 4},
+		{On: true, Pitch: 76, Velocity: 80, Beat: 4, Duration: 4},
+		{On: true, Pitch: 77, Velocity: 80, Beat: 8, Duration: 4},
+		{On: true, Pitch: 81, Velocity: 80, Beat: 12, Duration: 4},
+		{On: true, Pitch: 79, Velocity: 80, Beat: 16, Duration: 8},
+	}
+	harmony, err := ai.Harmonize(melody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int][]int{0: {48, 52, 55}, 8: {53, 57, 60}, 16: {48, 52, 55}}
+	chords := make(map[int][]int)
+	for _, note := range harmony.Consolidate() {
+		chords[note.Beat] = append(chords[note.Beat], note.Pitch)
+		if note.Channel != ai.HarmonyChannel || note.Duration < 1 {
+			t.Errorf("got %+v", note)
+		}
+	}
+	for beat, pitches := range expected {
+		for _, pitch := range pitches {
+			if _, ok := harmony.Notes[beat][pitch]; !ok {
+				t.Errorf("expected %v at %d, got %v", pitches, beat, chords)
+			}
+		}
+	}
+	if len(chords) != len(expected) {
+		t.Errorf("expected chords on the strong beats, got %v", chords)
+	}
+
+	// B would clash with the C of the melody
+	harmony, err = ai.Harmonize([]music.Note{
+		{On: true, Pitch: 72, Velocity: 80, Beat: 0, Duration: 4},
+		{On: true, Pitch: 71, Velocity: 80, Beat: 4, Duration: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, note := range harmony.Consolidate() {
+		if note.Pitch%12 == 11 || note.Pitch%12 == 0 && note.Pitch >= 71 {
+			t.Errorf("expected no clash, got %+v", harmony.Consolidate())
+		}
+	}
+
+	if _, err = ai.Harmonize(nil); err == nil {
+		t.Errorf("there is no melody to harmonize")
+	}
+}
+
+func TestVoicing(t *testing.T) {
+	ai := New(4)
+	ai.Key = "C"
+	// C and then F, well above the chords
+	melody := []music.Note{
+		{On: true, Pitch: 84, Velocity: 80, Beat: 0, Duration: 8},
+		{On: true, Pitch: 89, Velocity: 80, Beat: 8, Duration: 8},
+	}
+	for voicing, expected := range map[string]map[int][]int{
+		"root":   {0: {48, 52, 55}, 8: {53, 57, 60}},
+		"spread": {0: {48, 55, 64}, 8: {53, 60, 69}},
+		"lead":   {0: {48, 52, 55}, 8: {48, 53, 57}},
+	} {
+		ai.Voicing = voicing
+		harmony, err := ai.Harmonize(melody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for beat, pitches := range expected {
+			for _, pitch := range pitches {
+				if _, ok := harmony.Notes[beat][pitch]; !ok {
+					t.Errorf("expected %s chords %v, got %v", voicing, expected, harmony.Consolidate())
+				}
+			}
+		}
+	}
+	ai.Voicing = "close"
+	if _, err := ai.Harmonize(melody); err == nil {
+		t.Errorf("expected an unknown voicing")
+	}
+}
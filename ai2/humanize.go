@@ -0,0 +1,32 @@
+package ai2
+
+import (
+	"math/rand"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// Humanize makes licks sound less mechanical, by moving every note up to
+// Timing ticks early or late and making it up to Velocity softer or louder.
+// Both are 0 (off) by default. The randomness comes from math/rand, so
+// seeding it makes the licks reproducible.
+type Humanize struct {
+	Timing, Velocity int
+}
+
+// humanize moves a note and its note-off by the same amount,
+// so that the note keeps its length, but never before startBeat
+func (ai *AI) humanize(onNote, offNote *music.Note, startBeat int) {
+	if ai.Humanize.Timing > 0 {
+		offset := rand.Intn(2*ai.Humanize.Timing+1) - ai.Humanize.Timing
+		if onNote.Beat+offset < startBeat {
+			offset = startBeat - onNote.Beat
+		}
+		onNote.Beat += offset
+		offNote.Beat += offset
+	}
+	if ai.Humanize.Velocity > 0 {
+		onNote.Velocity += rand.Intn(2*ai.Humanize.Velocity+1) - ai.Humanize.Velocity
+		onNote.Velocity = ai.clampVelocity(onNote.Velocity)
+	}
+}
@@ -0,0 +1,36 @@
+package ai2
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestHumanize(t *testing.T) {
+	ai := New(250)
+	on := music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 100}
+	off := music.Note{Pitch: 60, Beat: 150}
+	ai.humanize(&on, &off, 0)
+	if on.Beat != 100 || off.Beat != 150 || on.Velocity != 80 {
+		t.Errorf("humanize should be off by default, got %+v %+v", on, off)
+	}
+
+	ai.Humanize = Humanize{Timing: 5, Velocity: 10}
+	humanized := make([]music.Note, 2)
+	for i := range humanized {
+		rand.Seed(1)
+		on, off = music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 100}, music.Note{Pitch: 60, Beat: 150}
+		ai.humanize(&on, &off, 98)
+		if on.Beat < 98 || on.Beat > 105 || off.Beat-on.Beat != 50 {
+			t.Errorf("got %+v %+v", on, off)
+		}
+		if on.Velocity < 70 || on.Velocity > 90 {
+			t.Errorf("got velocity %d", on.Velocity)
+		}
+		humanized[i] = on
+	}
+	if humanized[0] != humanized[1] {
+		t.Errorf("the same seed should humanize the same way")
+	}
+}
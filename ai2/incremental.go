@@ -0,0 +1,83 @@
+package ai2
+
+import (
+	"errors"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// LearnIncremental learns from only the notes that were played since
+// the last Learn (or LearnIncremental), which must all come after the
+// notes learned before. It learns the same as Learn would from all of
+// the notes, without going through the ones before again, apart from
+// the last few chords whose ends had not been played yet.
+func (ai *AI) LearnIncremental(newNotes []music.Note) (err error) {
+	if ai.order() < 1 {
+		return errors.New("Order must be at least 1")
+	}
+	ai.RLock()
+	blended := ai.blendStart > 0
+	notes := notesSince(ai.tail, 0)
+	ai.RUnlock()
+	if blended {
+		return errors.New("Can not learn more on top of a blend")
+	}
+	added := make(map[int]map[int]music.Note)
+	for _, note := range newNotes {
+		if _, ok := notes[note.Beat][note.Pitch]; ok {
+			continue
+		}
+		if notes[note.Beat] == nil {
+			notes[note.Beat] = make(map[int]music.Note)
+		}
+		if added[note.Beat] == nil {
+			added[note.Beat] = make(map[int]music.Note)
+		}
+		notes[note.Beat][note.Pitch] = note
+		added[note.Beat][note.Pitch] = note
+	}
+	chordArray, chordStringArray, unsettled, unsettledBeat := ai.analyze(notes)
+	newDynamics := ai.learnDynamics(added)
+
+	ai.Lock()
+	defer ai.Unlock()
+	// the chords that could still change are learned again, and the
+	// rest are kept, copying them so that a Lick can go on using them
+	settled := len(ai.chordArray) - ai.unsettled
+	ai.unsettled = len(chordArray) - unsettled
+	ai.chordArray = append(ai.chordArray[:settled:settled], chordArray...)
+	ai.chordStringArray = append(ai.chordStringArray[:settled:settled], chordStringArray...)
+	ai.tail = notesSince(notes, unsettledBeat)
+	ai.rhythm = learnRhythm(ai.chordArray)
+	merged := make(dynamics)
+	for _, d := range []dynamics{ai.dynamics, newDynamics} {
+		for position, velocities := range d {
+			merged[position] = append(merged[position], velocities...)
+		}
+	}
+	ai.dynamics = merged
+	ai.HasLearned = len(ai.chordArray) >= ai.WindowSizeMax
+	if !ai.HasLearned {
+		err = errors.New("Need more notes")
+	}
+	return
+}
+
+// notesSince returns a copy of the notes from a beat on,
+// or none if the beat is negative
+func notesSince(notes map[int]map[int]music.Note, beat int) (since map[int]map[int]music.Note) {
+	since = make(map[int]map[int]music.Note)
+	if beat < 0 {
+		return
+	}
+	for b, pitches := range notes {
+		if b < beat {
+			continue
+		}
+		since[b] = make(map[int]music.Note, len(pitches))
+		for pitch, note := range pitches {
+			since[b][pitch] = note
+		}
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package ai2
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestLearnIncremental(t *testing.T) {
+	// a melody with some notes held over the ones after them, and rests
+	notes := []music.Note{}
+	beat := 1
+	for i := 0; i < 300; i++ {
+		pitch := 70 + (i*7)%12
+		duration := 40
+		if i%5 == 0 {
+			duration = 200
+		}
+		notes = append(notes,
+			music.Note{On: true, Pitch: pitch, Velocity: 70 + i%40, Beat: beat},
+			music.Note{Pitch: pitch, Beat: beat + duration})
+		beat += 64
+		if i%16 == 15 {
+			beat += 3 * 64
+		}
+	}
+	// the note-offs come in order along with the note-ons
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Beat < notes[j].Beat })
+	before := func(notes []music.Note, beat int) (m *music.Music) {
+		m = music.New()
+		for _, note := range notes {
+			if note.Beat < beat {
+				m.AddNote(note)
+			}
+		}
+		return
+	}
+	between := func(notes []music.Note, from, to int) (between []music.Note) {
+		for _, note := range notes {
+			if note.Beat >= from && note.Beat < to {
+				between = append(between, note)
+			}
+		}
+		return
+	}
+	sorted := func(d dynamics) dynamics {
+		for _, velocities := range d {
+			sort.Ints(velocities)
+		}
+		return d
+	}
+
+	full := New(64)
+	if err := full.Learn(before(notes, beat)); err != nil {
+		t.Fatal(err)
+	}
+	splits := []int{5000, 5100, 9000, 9001, 13000, beat}
+	incremental := New(64)
+	if err := incremental.Learn(before(notes, splits[0])); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(splits); i++ {
+		if err := incremental.LearnIncremental(between(notes, splits[i-1], splits[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fromScratch := New(64)
+	if err := fromScratch.LearnIncremental(between(notes, 0, 1000)); err == nil {
+		t.Error("expected to need more notes")
+	}
+	if err := fromScratch.LearnIncremental(between(notes, 1000, beat)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ai := range []*AI{incremental, fromScratch} {
+		if !reflect.DeepEqual(ai.chordArray, full.chordArray) || !reflect.DeepEqual(ai.chordStringArray, full.chordStringArray) {
+			t.Fatalf("expected the same %d chords as learning all at once, got %d", len(full.chordArray), len(ai.chordArray))
+		}
+		if !reflect.DeepEqual(ai.rhythm, full.rhythm) || !reflect.DeepEqual(sorted(ai.dynamics), sorted(full.dynamics)) {
+			t.Error("expected the same rhythm and dynamics as learning all at once")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ai2
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+)
+
+// Model is what the AI has learned, as it is saved to disk
+type Model struct {
+	TicksPerBeat int
+	Chords       []Chord
+	ChordStrings []string
+	Dynamics     map[int][]int
+	// BlendStart is where the chords of the second model of a Blend
+	// start, or 0 if it is not a blend
+	BlendStart int `json:",omitempty"`
+}
+
+// Save writes what the AI has learned to a file
+func (ai *AI) Save(filename string) (err error) {
+	m, err := ai.Model()
+	if err != nil {
+		return
+	}
+	bModel, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(filename, bModel, 0644)
+}
+
+// Model returns what the AI has learned, as Save writes it
+func (ai *AI) Model() (m *Model, err error) {
+	ai.RLock()
+	defer ai.RUnlock()
+	if !ai.HasLearned {
+		return nil, errors.New("Nothing has been learned")
+	}
+	m = &Model{
+		TicksPerBeat: ai.TicksBerBeat,
+		Chords:       ai.chordArray,
+		ChordStrings: ai.chordStringArray,
+		Dynamics:     ai.dynamics,
+		BlendStart:   ai.blendStart,
+	}
+	return
+}
+
+// LoadModel reads a model from a file made by Save
+func LoadModel(filename string) (m *Model, err error) {
+	bModel, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	return DecodeModel(bModel)
+}
+
+// DecodeModel reads a model from the data of a file made by Save
+func DecodeModel(bModel []byte) (m *Model, err error) {
+	m = new(Model)
+	err = json.Unmarshal(bModel, m)
+	if err != nil {
+		return
+	}
+	if len(m.Chords) == 0 || len(m.Chords) != len(m.ChordStrings) {
+		err = errors.New("Model has no chords")
+	}
+	return
+}
+
+// Load reads what the AI learned from a file made by Save,
+// so that it does not have to learn again
+func (ai *AI) Load(filename string) (err error) {
+	m, err := LoadModel(filename)
+	if err != nil {
+		return
+	}
+	return ai.UseModel(m)
+}
+
+// UseModel makes the AI play from a model, as if it had learned it.
+// Like Learn, it needs at least WindowSizeMax chords to improvise from.
+func (ai *AI) UseModel(m *Model) (err error) {
+	if len(m.Chords) < ai.WindowSizeMax {
+		return errors.New("Model has too few chords")
+	}
+	ai.Lock()
+	chords := ai.rescale(m)
+	ai.chordArray = chords
+	ai.chordStringArray = m.ChordStrings
+	ai.rhythm = learnRhythm(chords)
+	ai.dynamics = m.Dynamics
+	ai.blendStart = m.BlendStart
+	ai.HasLearned = true
+	ai.unsettled, ai.tail = 0, nil
+	ai.Unlock()
+	return
+}
+
+// rescale returns the chords of a model with the lags and
+// durations (which are in ticks) at the ticks per beat of the AI,
+// and must be called with the lock held
+func (ai *AI) rescale(m *Model) (chords []Chord) {
+	chords = append([]Chord{}, m.Chords...)
+	if m.TicksPerBeat > 0 && ai.TicksBerBeat > 0 && m.TicksPerBeat != ai.TicksBerBeat {
+		for i := range chords {
+			chords[i].Duration = chords[i].Duration * ai.TicksBerBeat / m.TicksPerBeat
+			chords[i].Lag = chords[i].Lag * ai.TicksBerBeat / m.TicksPerBeat
+		}
+	}
+	return
+}
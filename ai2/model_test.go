@@ -0,0 +1,69 @@
+package ai2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestSaveLoad(t *testing.T) {
+	ai := New(250)
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ai.Learn(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(os.TempDir(), "pianoai_model.json")
+	defer os.Remove(filename)
+	err = ai.Save(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ai2 := New(250)
+	err = ai2.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ai2.HasLearned {
+		t.Errorf("should have learned")
+	}
+	if len(ai2.chordArray) != len(ai.chordArray) || len(ai2.chordStringArray) != len(ai.chordStringArray) {
+		t.Errorf("got %d chords, expected %d", len(ai2.chordArray), len(ai.chordArray))
+	}
+	if len(ai2.dynamics) != len(ai.dynamics) {
+		t.Errorf("got dynamics for %d positions, expected %d", len(ai2.dynamics), len(ai.dynamics))
+	}
+	lick, err := ai2.Lick(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, note := range lick.GetAll() {
+		if note.On && (note.Velocity < ai2.MinVelocity || note.Velocity > ai2.MaxVelocity) {
+			t.Errorf("velocity %d is out of range", note.Velocity)
+		}
+	}
+}
+
+func TestUseSmallModel(t *testing.T) {
+	small := &Model{TicksPerBeat: 250}
+	for i := 0; i < 5; i++ {
+		small.Chords = append(small.Chords, Chord{Pitches: []int{60 + i}, Velocity: 80, Duration: 100, Lag: 100})
+		small.ChordStrings = append(small.ChordStrings, string('a'+rune(i)))
+	}
+	ai := New(250)
+	if err := ai.UseModel(small); err == nil || ai.HasLearned {
+		t.Errorf("a model of 5 chords should not be used")
+	}
+	if err := ai.Blend(small, small, 0.5); err == nil || ai.HasLearned {
+		t.Errorf("models of 5 chords should not be blended")
+	}
+	if _, err := ai.Lick(0); err == nil {
+		t.Errorf("expected no lick without a model")
+	}
+}
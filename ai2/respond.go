@@ -0,0 +1,86 @@
+package ai2
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// Respond generates an answer to a phrase, starting at beat 0. The answer
+// carries on from where the phrase would have gone in what was learned,
+// matching as many of the last chords of the phrase as Order allows (and
+// fewer if those were never played), or from anywhere if none match.
+func (ai *AI) Respond(phrase []music.Note) (response *music.Music, err error) {
+	if len(phrase) == 0 {
+		err = errors.New("Nothing to respond to")
+		return
+	}
+	return ai.lick(0, ai.continuation(phrase))
+}
+
+// continuation returns one of the learned chords that came after the
+// end of the phrase, or -1 for any of them if none did
+func (ai *AI) continuation(phrase []music.Note) (start int) {
+	ai.RLock()
+	learnedStrings := ai.chordStringArray
+	ai.RUnlock()
+	start = -1
+	candidates := ai.followers(ai.phraseChords(phrase), learnedStrings)
+	if len(candidates) > 0 {
+		start = candidates[rand.Intn(len(candidates))]
+	}
+	return
+}
+
+// phraseChords encodes the notes of a phrase as chords, like Learn
+// does, with the notes that start on the same beat in one chord
+func (ai *AI) phraseChords(phrase []music.Note) (chords []string) {
+	pitches := make(map[int][]int)
+	beats := []int{}
+	for _, note := range phrase {
+		if !note.On || !ai.inRange(note.Pitch) {
+			continue
+		}
+		if _, ok := pitches[note.Beat]; !ok {
+			beats = append(beats, note.Beat)
+		}
+		pitches[note.Beat] = append(pitches[note.Beat], note.Pitch)
+	}
+	sort.Ints(beats)
+	chords = make([]string, len(beats))
+	for i, beat := range beats {
+		sort.Ints(pitches[beat])
+		chords[i] = ai.encode(pitches[beat])
+	}
+	return
+}
+
+// followers returns the indices of the learned chords that came right
+// after the end of the phrase, for the longest ending that was learned
+func (ai *AI) followers(chords []string, learnedStrings []string) (starts []int) {
+	order := ai.order()
+	if order > len(chords) {
+		order = len(chords)
+	}
+	for ; order > 0; order-- {
+		ending := chords[len(chords)-order:]
+		for i := 0; i+order < len(learnedStrings); i++ {
+			foundMatch := true
+			for j := range ending {
+				if learnedStrings[i+j] != ending[j] {
+					foundMatch = false
+					break
+				}
+			}
+			if foundMatch {
+				starts = append(starts, i+order)
+			}
+		}
+		if len(starts) > 0 {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package ai2
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestRespond(t *testing.T) {
+	ai := New(250)
+	m, err := music.Open("../testing/em_jam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ai.Learn(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the phrase is the start of what was learned,
+	// so the end of it is always found
+	phrase := m.Consolidate()[:20]
+	if len(ai.followers(ai.phraseChords(phrase), ai.chordStringArray)) == 0 {
+		t.Errorf("the end of the phrase should be found")
+	}
+	response, err := ai.Respond(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.GetAll()) == 0 {
+		t.Errorf("empty response")
+	}
+	if _, err = ai.Respond(nil); err == nil {
+		t.Errorf("should not respond to nothing")
+	}
+}
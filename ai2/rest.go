@@ -0,0 +1,22 @@
+package ai2
+
+// restString is how a rest is encoded among the chords
+const restString = "rest"
+
+// restBeats is how many beats of silence after a chord there have
+// to be for it to be learned as a rest
+const restBeats = 1
+
+// learnedRests returns the lengths of the rests that were
+// learned, and what share of the chords they are
+func learnedRests(chords []Chord) (lengths []int, share float64) {
+	for _, chord := range chords {
+		if chord.Rest {
+			lengths = append(lengths, chord.Lag)
+		}
+	}
+	if len(chords) > 0 {
+		share = float64(len(lengths)) / float64(len(chords))
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package ai2
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestRests(t *testing.T) {
+	ai := New(64)
+	ai.Jazzy = false
+	ai.Humanize = Humanize{}
+	// long enough for a few of the phrases
+	ai.LickLength = 16
+	// phrases of four quarter notes with three beats of silence after them
+	m := music.New()
+	for phrase := 0; phrase < 15; phrase++ {
+		for i, pitch := range []int{72, 74, 76, 77} {
+			beat := 1 + phrase*448 + i*64
+			m.AddNote(music.Note{On: true, Pitch: pitch, Velocity: 80, Beat: beat})
+			m.AddNote(music.Note{On: false, Pitch: pitch, Beat: beat + 32})
+		}
+	}
+	if err := ai.Learn(m); err != nil {
+		t.Fatal(err)
+	}
+	_, share := learnedRests(ai.chordArray)
+	// the last phrase has nothing after it
+	if share != 14.0/74 {
+		t.Errorf("expected a rest after every phrase but the last, got %2.2f of the chords", share)
+	}
+
+	longestGap := func(lick *music.Music) (longest int) {
+		notes := lick.Consolidate()
+		for i := 1; i < len(notes); i++ {
+			if gap := notes[i].Beat - notes[i-1].Beat; gap > longest {
+				longest = gap
+			}
+		}
+		return
+	}
+	rand.Seed(1)
+	lick, err := ai.Lick(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gap := longestGap(lick); gap < 200 {
+		t.Errorf("expected the lick to rest, got gaps of at most %d", gap)
+	}
+	ai.RestProbabilityScale = 0
+	rand.Seed(1)
+	lick, _ = ai.Lick(0)
+	if gap := longestGap(lick); gap > 100 {
+		t.Errorf("expected the lick not to rest, got a gap of %d", gap)
+	}
+}
@@ -0,0 +1,40 @@
+package ai2
+
+import "math/rand"
+
+// quantizer is the grid, in ticks, that the notes of a lick are placed on
+const quantizer = 8
+
+// rhythm is a Markov chain of the gaps between the starts of consecutive
+// chords, in multiples of the quantizer. Each gap maps to every gap that
+// followed it, so picking one at random picks it as often as it was played.
+// Notes played within a quantizer of each other have a gap of zero, which
+// keeps them together as a chord.
+type rhythm map[int][]int
+
+// learnRhythm builds the rhythm from the lags of the chords, leaving
+// out the rests, which keep their own lengths
+func learnRhythm(chords []Chord) (r rhythm) {
+	r = make(rhythm)
+	played := []Chord{}
+	for _, chord := range chords {
+		if !chord.Rest {
+			played = append(played, chord)
+		}
+	}
+	// the last chord has nothing after it, so its lag is not a gap
+	for i := 1; i < len(played)-1; i++ {
+		previous := played[i-1].Lag / quantizer
+		r[previous] = append(r[previous], played[i].Lag/quantizer)
+	}
+	return
+}
+
+// next picks a gap in ticks to follow the previous gap, if that gap was learned
+func (r rhythm) next(previous int) (gap int, ok bool) {
+	gaps := r[previous/quantizer]
+	if len(gaps) == 0 {
+		return
+	}
+	return gaps[rand.Intn(len(gaps))] * quantizer, true
+}
@@ -0,0 +1,33 @@
+package ai2
+
+import "testing"
+
+func TestRhythm(t *testing.T) {
+	chords := []Chord{
+		{Lag: 80},
+		{Lag: 40},
+		{Lag: 80},
+		{Lag: 4}, // a rolled chord
+		{Lag: 40},
+		{Lag: 0},
+	}
+	r := learnRhythm(chords)
+	if len(r[80/quantizer]) != 2 {
+		t.Errorf("expected two gaps after 80, got %+v", r)
+	}
+	for i := 0; i < 20; i++ {
+		gap, ok := r.next(80)
+		if !ok || (gap != 40 && gap != 0) {
+			t.Errorf("got gap %d after 80", gap)
+		}
+	}
+	if gap, ok := r.next(0); !ok || gap != 40 {
+		t.Errorf("got gap %d after a chord, expected 40", gap)
+	}
+	if _, ok := r.next(160); ok {
+		t.Errorf("160 was never played")
+	}
+	if len(r[40/quantizer]) != 1 {
+		t.Errorf("the last chord should not be learned, got %+v", r)
+	}
+}
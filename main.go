@@ -2,16 +2,25 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
 	"github.com/schollz/pianoai/player"
 	"github.com/urfave/cli"
 )
 
 var version string
 
+// calibrationClicks is how many clicks --calibrate measures the latency with
+const calibrationClicks = 8
+
 func main() {
 
 	app := cli.NewApp()
@@ -30,37 +39,98 @@ func main() {
 			Usage: "tick frequency in hertz",
 		},
 		cli.IntFlag{
+			Name:  "resolution",
+			Value: 0,
+			Usage: "ticks per beat, which overrides the tick frequency",
+		},
+		cli.StringFlag{
 			Name:  "hp",
-			Value: 65,
-			Usage: "high pass note threshold to use for leraning",
+			Value: "65",
+			Usage: "high pass note threshold to use for leraning (a pitch or a name like F4)",
+		},
+		cli.StringFlag{
+			Name:  "lp",
+			Value: "",
+			Usage: "low pass note threshold to use for learning (default: none)",
+		},
+		cli.IntFlag{
+			Name:  "middlec",
+			Value: 4,
+			Usage: "octave of middle C in the names of notes (4 for C4, or 3 for C3)",
+		},
+		cli.BoolFlag{
+			Name:  "filter",
+			Usage: "do not record the notes outside of --hp and --lp",
 		},
 		cli.IntFlag{
 			Name:  "waits",
 			Value: 2,
 			Usage: "beats of silence before AI jumps in",
 		},
+		cli.Float64Flag{
+			Name:  "wait-bars",
+			Value: 0,
+			Usage: "bars of silence before AI jumps in, at any tempo, instead of --waits",
+		},
 		cli.IntFlag{
 			Name:  "quantize",
-			Value: 64,
+			Value: player.DefaultQuantize,
 			Usage: "1/quantize is shortest possible note",
 		},
 		cli.StringFlag{
 			Name:  "file,f",
 			Value: "music_history.json",
-			Usage: "file save/load to when pressing bottom C",
+			Usage: "file save/load to when pressing bottom C (made along with its directory)",
+		},
+		cli.BoolFlag{
+			Name:  "compact",
+			Usage: "save the history in a shorter form, which is compressed too if the file ends in .gz",
+		},
+		cli.StringFlag{
+			Name:  "session",
+			Value: "",
+			Usage: "session bundle (.zip) to start from, with the history, the AI and the settings, as saved by the bundle action",
 		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "debug mode",
 		},
+		cli.StringFlag{
+			Name:  "log",
+			Value: "info",
+			Usage: "log level (trace, debug, info, warn or error)",
+		},
 		cli.BoolFlag{
 			Name:  "manual",
 			Usage: "AI is activated manually",
 		},
+		cli.BoolFlag{
+			Name:  "respond",
+			Usage: "AI answers each phrase you play",
+		},
+		cli.IntFlag{
+			Name:  "length",
+			Value: 4,
+			Usage: "beats the AI improvises for",
+		},
+		cli.Float64Flag{
+			Name:  "intensity",
+			Value: 0.5,
+			Usage: "how much the AI plays as hard as you, from 0 to 1",
+		},
+		cli.IntFlag{
+			Name:  "min-notes",
+			Value: 8,
+			Usage: "fewest notes to teach the AI with",
+		},
+		cli.BoolFlag{
+			Name:  "fill",
+			Usage: "AI plays a short fill when you stop for a moment, ending before the next bar",
+		},
 		cli.IntFlag{
 			Name:  "link",
 			Value: 3,
-			Usage: "AI LinkLength",
+			Usage: "AI Markov order, the number of chords that decide the next",
 		},
 		cli.BoolFlag{
 			Name:  "jazzy",
@@ -74,13 +144,240 @@ func main() {
 			Name:  "chords",
 			Usage: "AI Allow chords",
 		},
+		cli.IntFlag{
+			Name:  "humanize",
+			Value: 0,
+			Usage: "AI timing (in ticks) and velocity jitter",
+		},
+		cli.IntFlag{
+			Name:  "channel",
+			Value: 1,
+			Usage: "MIDI channel (1-16) the AI plays on",
+		},
+		cli.Float64Flag{
+			Name:  "swing",
+			Value: 0,
+			Usage: "swing of the AI and the loop, from 0 (straight) to 0.66 (shuffle)",
+		},
+		cli.IntFlag{
+			Name:  "subdivision",
+			Value: 8,
+			Usage: "notes that swing, 8 for eighths or 16 for sixteenths",
+		},
+		cli.IntFlag{
+			Name:  "polyphony",
+			Value: 0,
+			Usage: "most notes to play at once (default: unlimited)",
+		},
+		cli.IntFlag{
+			Name:  "stuck",
+			Value: 0,
+			Usage: "beats a key can be held before it is turned off (default: never)",
+		},
+		cli.BoolFlag{
+			Name:  "thru",
+			Usage: "send what is played on the keyboard to the output too",
+		},
+		cli.Float64Flag{
+			Name:  "echo",
+			Value: 0,
+			Usage: "repeat what is played on the keyboard every number of beats (default: off)",
+		},
+		cli.IntFlag{
+			Name:  "echo-feedback",
+			Value: 3,
+			Usage: "number of times the echo repeats a note",
+		},
+		cli.Float64Flag{
+			Name:  "echo-decay",
+			Value: 0.6,
+			Usage: "how loud each echo is compared to the one before",
+		},
+		cli.StringFlag{
+			Name:  "echo-cc",
+			Value: "",
+			Usage: "control changes that set the echo delay and feedback, e.g. 20,21 (default: none)",
+		},
+		cli.BoolFlag{
+			Name:  "send-clock",
+			Usage: "send MIDI clock to the output, for other gear to follow the BPM",
+		},
+		cli.BoolFlag{
+			Name:  "clock",
+			Usage: "follow the MIDI clock of the input, such as a drum machine, instead of the BPM",
+		},
 		cli.BoolFlag{
 			Name:  "follow",
 			Usage: "AI velocities follow the host",
 		},
+		cli.StringFlag{
+			Name:  "curve",
+			Value: "linear",
+			Usage: "velocity curve of the keyboard (linear, exponential or logarithmic)",
+		},
+		cli.StringFlag{
+			Name:  "osc",
+			Usage: "UDP address to listen for OSC on, such as :57120",
+		},
+		cli.StringFlag{
+			Name:  "websocket",
+			Usage: "address to serve the notes on as a WebSocket, such as :8080",
+		},
+		cli.StringFlag{
+			Name:  "api",
+			Usage: "address to serve the HTTP API on, such as :8081",
+		},
+		cli.StringFlag{
+			Name:  "replay",
+			Usage: "play a saved history (.json) or MIDI file (.mid) as if it were played on the keyboard",
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of the randomness of the AI, to improvise the same way every time (default: random)",
+		},
+		cli.IntFlag{
+			Name:  "step",
+			Usage: "record in step mode, with steps of a 1/value note (e.g. 16 for sixteenths)",
+		},
+		cli.StringFlag{
+			Name:  "arp",
+			Usage: "arpeggiate held chords (up, down, updown or random)",
+		},
+		cli.BoolFlag{
+			Name:  "metronome",
+			Usage: "click the beats on the drums",
+		},
+		cli.DurationFlag{
+			Name:  "autosave",
+			Value: 0,
+			Usage: "how often to save the history, such as 1m (default: never)",
+		},
+		cli.IntFlag{
+			Name:  "countin",
+			Value: 0,
+			Usage: "bars of metronome before playing back",
+		},
+		cli.IntFlag{
+			Name:  "transpose",
+			Value: 0,
+			Usage: "semitones to transpose the history by when playing it back or looping it",
+		},
+		cli.DurationFlag{
+			Name:  "latency",
+			Value: 0,
+			Usage: "how long the output takes to be heard, to play that much early, such as 20ms",
+		},
+		cli.BoolFlag{
+			Name:  "calibrate",
+			Usage: "measure the latency first, by playing a key along with the first 8 clicks",
+		},
+		cli.BoolFlag{
+			Name:  "tempo-follow",
+			Usage: "change the tempo gradually to the tempo you play at",
+		},
+		cli.Float64Flag{
+			Name:  "tempo-rate",
+			Value: 2,
+			Usage: "most BPM the tempo is changed by each beat when following it",
+		},
+		cli.StringFlag{
+			Name:  "time",
+			Value: "4/4",
+			Usage: "time signature, for the bars of the metronome",
+		},
+		cli.StringFlag{
+			Name:  "input",
+			Value: "",
+			Usage: "name of the MIDI input device",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Value: "",
+			Usage: "name of the MIDI output device",
+		},
+		cli.StringSliceFlag{
+			Name:  "jam",
+			Usage: "name of another MIDI input device to listen to, such as a second keyboard",
+		},
+		cli.StringFlag{
+			Name:  "learn-from",
+			Value: "",
+			Usage: "devices the AI learns from, 0 for the input and 1 on for the --jam ones, e.g. 0,2 (default: all)",
+		},
+		cli.StringFlag{
+			Name:  "network",
+			Value: "",
+			Usage: "address of an RTP-MIDI session to play and listen on instead of the MIDI devices, such as 192.168.1.10:5004",
+		},
+		cli.BoolFlag{
+			Name:  "devices",
+			Usage: "list the MIDI devices and exit",
+		},
+		cli.Float64Flag{
+			Name:  "temperature",
+			Value: 1,
+			Usage: "AI adventurousness, which also follows the mod wheel",
+		},
+		cli.StringFlag{
+			Name:  "blend",
+			Value: "",
+			Usage: "two saved AI models to improvise in between, e.g. bach.json,jazz.json",
+		},
+		cli.Float64Flag{
+			Name:  "blend-ratio",
+			Value: 0.5,
+			Usage: "mix of the blended models, from 0 for the first to 1 for the second",
+		},
+		cli.IntFlag{
+			Name:  "blend-cc",
+			Value: 0,
+			Usage: "control change that sets the blend ratio, such as a knob (default: none)",
+		},
+		cli.StringSliceFlag{
+			Name:  "instrument",
+			Usage: "set the program of a MIDI channel (1-16), e.g. 2=33",
+		},
+		cli.StringSliceFlag{
+			Name:  "control",
+			Usage: "assign a control key to an action, e.g. 48=teach or C3=teach",
+		},
+		cli.Float64Flag{
+			Name:  "rests",
+			Value: 1,
+			Usage: "how often the AI rests compared to you, from 0 for never",
+		},
+		cli.StringFlag{
+			Name:  "voicing",
+			Value: "root",
+			Usage: "how the chords of harmonize are voiced: root, first, second, spread or lead",
+		},
+		cli.StringFlag{
+			Name:  "key",
+			Value: "",
+			Usage: "constrain AI to a key (e.g. C, F#, Bb, or auto to find it from what is played)",
+		},
+		cli.StringFlag{
+			Name:  "scale",
+			Value: "",
+			Usage: "constrain AI to a scale on the key (e.g. dorian, blues or 0,2,3,7,8)",
+		},
+		cli.BoolFlag{
+			Name:  "minor",
+			Usage: "key is minor",
+		},
 	}
 
 	app.Action = func(c *cli.Context) (err error) {
+		if c.GlobalBool("devices") {
+			devices, err := piano.ListDevices()
+			if err != nil {
+				return err
+			}
+			for _, device := range devices {
+				fmt.Printf("%d) %s (%s) input: %t, output: %t\n", device.ID, device.Name, device.Interface, device.IsInput, device.IsOutput)
+			}
+			return nil
+		}
 		fmt.Println(`
 		
 		______ _____                   ___  _____ 
@@ -102,19 +399,236 @@ func main() {
 
 	 Lets play some music!
 											`)
-		p, err := player.New(c.GlobalInt("bpm"), c.GlobalInt("tick"), c.GlobalBool("debug"))
+		if err = player.SetLogLevel(c.GlobalString("log")); err != nil {
+			return
+		}
+		player.LogAsynchronously()
+		music.MiddleCOctave = c.GlobalInt("middlec")
+		if c.GlobalInt64("seed") != 0 {
+			rand.Seed(c.GlobalInt64("seed"))
+		} else {
+			rand.Seed(time.Now().UnixNano())
+		}
+		highPass, err := parsePitch(c.GlobalString("hp"))
+		if err != nil {
+			return
+		}
+		lowPass, err := parsePitch(c.GlobalString("lp"))
+		if err != nil {
+			return
+		}
+		opts := player.Options{
+			BPM:              c.GlobalInt("bpm"),
+			ListenHertz:      c.GlobalInt("tick"),
+			Resolution:       c.GlobalInt("resolution"),
+			Quantize:         c.GlobalInt("quantize"),
+			Order:            c.GlobalInt("link"),
+			HighPassFilter:   highPass,
+			LowPassFilter:    lowPass,
+			BeatsOfSilence:   c.GlobalInt("waits"),
+			SilenceThreshold: c.GlobalFloat64("wait-bars"),
+			HistoryFile:      c.GlobalString("file"),
+			Input:            c.GlobalString("input"),
+			Output:           c.GlobalString("output"),
+			Debug:            c.GlobalBool("debug"),
+		}
+		if c.GlobalString("network") != "" {
+			opts.Piano, err = piano.NewNetwork(c.GlobalString("network"))
+			if err != nil {
+				return
+			}
+		}
+		p, err := player.NewWithOptions(opts)
 		if err != nil {
 			return
 		}
-		p.HighPassFilter = c.GlobalInt("hp")
-		p.AI = ai2.New(p.TicksPerBeat)
-		p.AI.HighPassFilter = c.GlobalInt("hp")
-		p.AI.LinkLength = c.GlobalInt("link")
+		for _, name := range c.GlobalStringSlice("jam") {
+			var input *piano.Piano
+			input, err = piano.NewInput(name)
+			if err != nil {
+				return
+			}
+			p.Inputs = append(p.Inputs, input)
+		}
+		if c.GlobalString("learn-from") != "" {
+			var devices []int
+			for _, device := range strings.Split(c.GlobalString("learn-from"), ",") {
+				var id int
+				id, err = strconv.Atoi(device)
+				if err != nil || id < 0 || id > len(p.Inputs) {
+					return fmt.Errorf("could not learn from device '%s'", device)
+				}
+				devices = append(devices, id)
+			}
+			p.TeachFilter = p.DeviceFilter(devices...)
+		}
+		p.FilterHistory = c.GlobalBool("filter")
 		p.AI.Jazzy = c.GlobalBool("jazzy")
 		p.AI.Stacatto = c.GlobalBool("stacatto")
+		p.AI.Voicing = c.GlobalString("voicing")
+		p.AI.RestProbabilityScale = c.GlobalFloat64("rests")
 		p.AI.DisallowChords = !c.GlobalBool("chords")
-		p.ManualAI = c.GlobalBool("manual")
+		p.AI.Humanize = ai2.Humanize{Timing: c.GlobalInt("humanize"), Velocity: c.GlobalInt("humanize")}
+		p.AutoImprovise = !c.GlobalBool("manual")
+		p.CallResponse = c.GlobalBool("respond")
+		p.FillMode = c.GlobalBool("fill")
+		p.LickLength = c.GlobalInt("length")
+		p.MinNotesToTeach = c.GlobalInt("min-notes")
+		p.IntensitySensitivity = c.GlobalFloat64("intensity")
 		p.UseHostVelocity = c.GlobalBool("follow")
+		p.Thru = c.GlobalBool("thru")
+		p.Echo.Delay = c.GlobalFloat64("echo")
+		p.Echo.Feedback = c.GlobalInt("echo-feedback")
+		p.Echo.Decay = c.GlobalFloat64("echo-decay")
+		if c.GlobalString("echo-cc") != "" {
+			_, err = fmt.Sscanf(c.GlobalString("echo-cc"), "%d,%d", &p.Echo.DelayController, &p.Echo.FeedbackController)
+			if err != nil {
+				return fmt.Errorf("could not use echo controllers '%s': %s", c.GlobalString("echo-cc"), err.Error())
+			}
+		}
+		p.ExternalClock = c.GlobalBool("clock")
+		p.SendClock = c.GlobalBool("send-clock")
+		p.MaxPolyphony = c.GlobalInt("polyphony")
+		p.Swing = c.GlobalFloat64("swing")
+		if c.GlobalInt("subdivision") != 8 && c.GlobalInt("subdivision") != 16 {
+			return fmt.Errorf("swing subdivision %d is not 8 or 16", c.GlobalInt("subdivision"))
+		}
+		p.SwingSubdivision = c.GlobalInt("subdivision")
+		p.MaxNoteDuration = c.GlobalInt("stuck")
+		if c.GlobalInt("channel") < 1 || c.GlobalInt("channel") > 16 {
+			return fmt.Errorf("MIDI channel %d is not between 1 and 16", c.GlobalInt("channel"))
+		}
+		p.AIChannel = c.GlobalInt("channel") - 1
+		switch c.GlobalString("curve") {
+		case "linear":
+		case "exponential":
+			p.VelocityCurve = player.ExponentialCurve(2)
+		case "logarithmic":
+			p.VelocityCurve = player.LogarithmicCurve(10)
+		default:
+			return fmt.Errorf("unknown velocity curve '%s'", c.GlobalString("curve"))
+		}
+		if c.GlobalInt("step") > 0 {
+			p.StepMode = true
+			p.StepLength = p.TicksPerBeat * 4 / c.GlobalInt("step")
+		}
+		switch c.GlobalString("arp") {
+		case "":
+		case "up", "down", "updown", "random":
+			p.Arpeggiate = true
+			p.Arpeggiator.Mode = c.GlobalString("arp")
+		default:
+			return fmt.Errorf("unknown arpeggiator mode '%s'", c.GlobalString("arp"))
+		}
+		p.Metronome = c.GlobalBool("metronome")
+		p.CountIn = c.GlobalInt("countin")
+		p.PlaybackTranspose = c.GlobalInt("transpose")
+		p.OutputLatency = c.GlobalDuration("latency")
+		p.TempoFollow = c.GlobalBool("tempo-follow")
+		p.MaxTempoChange = c.GlobalFloat64("tempo-rate")
+		p.CompactHistory = c.GlobalBool("compact")
+		p.AutosaveInterval = c.GlobalDuration("autosave")
+		var numerator, denominator int
+		_, err = fmt.Sscanf(c.GlobalString("time"), "%d/%d", &numerator, &denominator)
+		if err == nil {
+			err = p.SetTimeSignature(numerator, denominator)
+		}
+		if err != nil {
+			return fmt.Errorf("could not use time signature '%s': %s", c.GlobalString("time"), err.Error())
+		}
+		p.Temperature = c.GlobalFloat64("temperature")
+		p.BlendController = c.GlobalInt("blend-cc")
+		if c.GlobalString("blend") != "" {
+			models := strings.Split(c.GlobalString("blend"), ",")
+			if len(models) != 2 {
+				return fmt.Errorf("could not blend '%s', it needs two models", c.GlobalString("blend"))
+			}
+			err = p.Blend(models[0], models[1], c.GlobalFloat64("blend-ratio"))
+			if err != nil {
+				return
+			}
+		}
+		for _, control := range c.GlobalStringSlice("control") {
+			var name, action string
+			_, err = fmt.Sscanf(strings.Replace(control, "=", " ", 1), "%s %s", &name, &action)
+			if err != nil {
+				return fmt.Errorf("could not parse control '%s'", control)
+			}
+			var pitch int
+			pitch, err = parsePitch(name)
+			if err != nil {
+				return
+			}
+			err = p.SetControl(pitch, action)
+			if err != nil {
+				return
+			}
+		}
+		for _, instrument := range c.GlobalStringSlice("instrument") {
+			var channel, program int
+			_, err = fmt.Sscanf(strings.Replace(instrument, "=", " ", 1), "%d %d", &channel, &program)
+			if err != nil {
+				return fmt.Errorf("could not parse instrument '%s'", instrument)
+			}
+			err = p.SetInstrument(channel-1, program)
+			if err != nil {
+				return
+			}
+		}
+		if c.GlobalString("key") == "auto" {
+			p.AutoKey = true
+			p.ConstrainToKey = true
+			if c.GlobalBool("minor") {
+				p.Mode = "minor"
+			}
+		} else if c.GlobalString("key") != "" {
+			p.Key = c.GlobalString("key")
+			p.ConstrainToKey = true
+			if c.GlobalBool("minor") {
+				p.Mode = "minor"
+			}
+		}
+		if c.GlobalString("scale") != "" {
+			p.Scale, err = music.ParseScale(c.GlobalString("scale"))
+			if err != nil {
+				return
+			}
+		}
+		if c.GlobalString("session") != "" {
+			if err = p.LoadSession(c.GlobalString("session")); err != nil {
+				return fmt.Errorf("could not load session '%s': %s", c.GlobalString("session"), err.Error())
+			}
+		}
+		if c.GlobalString("osc") != "" {
+			if err = p.StartOSC(c.GlobalString("osc")); err != nil {
+				return err
+			}
+		}
+		if c.GlobalString("websocket") != "" {
+			if err = p.StartWebSocket(c.GlobalString("websocket")); err != nil {
+				return err
+			}
+		}
+		if c.GlobalString("api") != "" {
+			if err = p.StartAPI(c.GlobalString("api")); err != nil {
+				return err
+			}
+		}
+		if c.GlobalString("replay") != "" {
+			var replay *music.Music
+			if filepath.Ext(c.GlobalString("replay")) == ".mid" {
+				replay, err = music.OpenMIDI(c.GlobalString("replay"))
+			} else {
+				replay, err = music.Open(c.GlobalString("replay"))
+			}
+			if err != nil {
+				return
+			}
+			go p.ReplayFrom(replay)
+		}
+		if c.GlobalBool("calibrate") {
+			go p.CalibrateLatency(calibrationClicks)
+		}
 		p.Start()
 		return nil
 	}
@@ -124,3 +638,16 @@ func main() {
 		fmt.Print(err)
 	}
 }
+
+// parsePitch reads a pitch as a number or a name like C4,
+// where nothing is 0
+func parsePitch(s string) (pitch int, err error) {
+	if s == "" {
+		return
+	}
+	pitch, err = strconv.Atoi(s)
+	if err != nil {
+		pitch, err = music.PitchFromName(s)
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package music
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// abcBarsPerLine is the number of bars on each line of the tune
+const abcBarsPerLine = 4
+
+// ExportABC writes the notes as a tune in ABC notation, on a grid of
+// sixteenth notes, in the Key and time signature of the music. Notes
+// that start together are written as a chord, and the gaps as rests.
+func (m *Music) ExportABC(w io.Writer) (err error) {
+	bars := m.scoreBars()
+	m.RLock()
+	ks := newKeySpelling(m.Key, m.Mode)
+	beatsPerBar, beatUnit := m.timeSignature()
+	bpm := m.bpm()
+	m.RUnlock()
+	if len(bars) == 0 {
+		bars = [][]scoreEvent{{{length: beatsPerBar * 16 / beatUnit}}}
+	}
+
+	b := bufio.NewWriter(w)
+	key := string(ks.tonic.letter)
+	if ks.tonic.accidental > 0 {
+		key += strings.Repeat("#", ks.tonic.accidental)
+	} else {
+		key += strings.Repeat("b", -ks.tonic.accidental)
+	}
+	if ks.minor {
+		key += "m"
+	}
+	fmt.Fprintf(b, "X:1\nT:pianoai\nM:%d/%d\nL:1/16\nQ:1/4=%d\nK:%s\n", beatsPerBar, beatUnit, bpm, key)
+	for i, bar := range bars {
+		// the accidentals written in the bar, by letter and octave
+		accidentals := make(map[spelling]int)
+		tokens := make([]string, len(bar))
+		for j, event := range bar {
+			var token strings.Builder
+			if len(event.pitches) == 0 {
+				token.WriteString("z")
+			}
+			if len(event.pitches) > 1 {
+				token.WriteString("[")
+			}
+			for _, pitch := range event.pitches {
+				s := ks.spell(pitch)
+				at := spelling{letter: s.letter, octave: s.octave}
+				current, ok := accidentals[at]
+				if !ok {
+					current = ks.signature[s.letter]
+				}
+				if s.accidental != current {
+					token.WriteString(abcAccidental(s.accidental))
+					accidentals[at] = s.accidental
+				}
+				token.WriteString(abcNote(s))
+			}
+			if len(event.pitches) > 1 {
+				token.WriteString("]")
+			}
+			if event.length != 1 {
+				fmt.Fprintf(&token, "%d", event.length)
+			}
+			if event.tied {
+				token.WriteString("-")
+			}
+			tokens[j] = token.String()
+		}
+		b.WriteString(strings.Join(tokens, " "))
+		switch {
+		case i == len(bars)-1:
+			b.WriteString(" |]\n")
+		case (i+1)%abcBarsPerLine == 0:
+			b.WriteString(" |\n")
+		default:
+			b.WriteString(" | ")
+		}
+	}
+	return b.Flush()
+}
+
+// abcAccidental returns the sharps, flats or natural sign of ABC
+func abcAccidental(accidental int) string {
+	switch {
+	case accidental > 0:
+		return strings.Repeat("^", accidental)
+	case accidental < 0:
+		return strings.Repeat("_", -accidental)
+	}
+	return "="
+}
+
+// abcNote returns the letter of a note in ABC, which is a capital for
+// the octave of middle C and small for the one above, with commas and
+// apostrophes for lower and higher
+func abcNote(s spelling) string {
+	if s.octave >= 5 {
+		return strings.ToLower(string(s.letter)) + strings.Repeat("'", s.octave-5)
+	}
+	return string(s.letter) + strings.Repeat(",", 4-s.octave)
+}
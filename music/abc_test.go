@@ -0,0 +1,42 @@
+package music
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportABC(t *testing.T) {
+	m := New()
+	m.TicksPerBeat = 4
+	m.BPM = 100
+	m.Key, m.Mode = "F", "major"
+	m.BeatsPerBar, m.BeatUnit = 3, 4
+	// a quarter, an eighth and an eighth rest
+	m.AddNote(Note{On: true, Pitch: 65, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 65, Beat: 4})
+	m.AddNote(Note{On: true, Pitch: 70, Velocity: 80, Beat: 4})
+	m.AddNote(Note{On: false, Pitch: 70, Beat: 6})
+	// a B natural and a chord tied over the bar line
+	m.AddNote(Note{On: true, Pitch: 71, Velocity: 80, Beat: 8})
+	m.AddNote(Note{On: false, Pitch: 71, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 48, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 84, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: false, Pitch: 48, Beat: 16})
+	m.AddNote(Note{On: false, Pitch: 84, Beat: 16})
+
+	var b bytes.Buffer
+	if err := m.ExportABC(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "X:1\nT:pianoai\nM:3/4\nL:1/16\nQ:1/4=100\nK:F\n" +
+		"F4 B2 z2 =B2 [C,c']2- | [C,c']4 z8 |]\n"
+	if b.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", b.String(), expected)
+	}
+
+	b.Reset()
+	if err := New().ExportABC(&b); err != nil || !strings.HasSuffix(b.String(), "z16 |]\n") {
+		t.Errorf("expected an empty bar, got %s", b.String())
+	}
+}
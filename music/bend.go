@@ -0,0 +1,86 @@
+package music
+
+import "sort"
+
+// MaxBend is how far the pitch can be bent either way, as a Bend Value
+// from -MaxBend-1 to MaxBend. A Value of 0 is the center, no bend.
+const MaxBend = 8191
+
+// Bend is a move of the pitch bend wheel on a channel,
+// which bends all the notes sounding on it
+type Bend struct {
+	Beat    int
+	Value   int
+	Channel int
+}
+
+// AddBend adds a bend, replacing the one on the same
+// channel on the same beat if there is one
+func (m *Music) AddBend(b Bend) {
+	if b.Value > MaxBend {
+		b.Value = MaxBend
+	} else if b.Value < -MaxBend-1 {
+		b.Value = -MaxBend - 1
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.Bends == nil {
+		m.Bends = make(map[int][]Bend)
+	}
+	m.changes++
+	for i, other := range m.Bends[b.Beat] {
+		if other.Channel == b.Channel {
+			m.Bends[b.Beat][i] = b
+			return
+		}
+	}
+	m.Bends[b.Beat] = append(m.Bends[b.Beat], b)
+}
+
+// GetBends returns the bends on a beat
+func (m *Music) GetBends(beat int) (hasBends bool, bends []Bend) {
+	m.RLock()
+	defer m.RUnlock()
+	bends, hasBends = m.Bends[beat]
+	if hasBends {
+		bends = append([]Bend{}, bends...)
+	}
+	return
+}
+
+// AllBends returns all the bends, in order of beat and channel
+func (m *Music) AllBends() (bends []Bend) {
+	m.RLock()
+	defer m.RUnlock()
+	bends = []Bend{}
+	for _, beatBends := range m.Bends {
+		bends = append(bends, beatBends...)
+	}
+	sort.SliceStable(bends, func(i, j int) bool {
+		if bends[i].Beat == bends[j].Beat {
+			return bends[i].Channel < bends[j].Channel
+		}
+		return bends[i].Beat < bends[j].Beat
+	})
+	return
+}
+
+// CenterBends returns bends back to the center for every channel
+// that is left bent after the last of the bends, on the beat after
+func CenterBends(bends []Bend) (centered []Bend) {
+	last := make(map[int]Bend)
+	for _, bend := range bends {
+		last[bend.Channel] = bend
+	}
+	channels := []int{}
+	for channel, bend := range last {
+		if bend.Value != 0 {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Ints(channels)
+	for _, channel := range channels {
+		centered = append(centered, Bend{Beat: last[channel].Beat + 1, Channel: channel})
+	}
+	return
+}
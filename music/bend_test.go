@@ -0,0 +1,62 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBends(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 40})
+	m.AddBend(Bend{Beat: 10, Value: 4096})
+	m.AddBend(Bend{Beat: 10, Value: 20000})
+	m.AddBend(Bend{Beat: 20, Value: -8192, Channel: 1})
+	m.AddBend(Bend{Beat: 30, Value: 0, Channel: 1})
+	expected := []Bend{{10, MaxBend, 0}, {20, -8192, 1}, {30, 0, 1}}
+	checkBends := func(what string, bends []Bend) {
+		if len(bends) != len(expected) {
+			t.Fatalf("%s: got %+v, expected %+v", what, bends, expected)
+		}
+		for i := range expected {
+			if bends[i] != expected[i] {
+				t.Errorf("%s: got %+v, expected %+v", what, bends, expected)
+			}
+		}
+	}
+	checkBends("added", m.AllBends())
+	// only channel 0 is left bent
+	if centered := CenterBends(m.AllBends()); len(centered) != 1 || centered[0] != (Bend{11, 0, 0}) {
+		t.Errorf("got %+v", centered)
+	}
+
+	filename := filepath.Join(os.TempDir(), "pianoai_bends.json")
+	defer os.Remove(filename)
+	if err := m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBends("saved", m2.AllBends())
+	if len(m2.GetAll()) != 2 {
+		t.Errorf("got %+v", m2.Notes)
+	}
+
+	midiFile := filepath.Join(os.TempDir(), "pianoai_bends.mid")
+	defer os.Remove(midiFile)
+	m.TicksPerBeat = DefaultTicksPerBeat
+	if err := m.ExportMIDI(midiFile); err != nil {
+		t.Fatal(err)
+	}
+	m3, err := OpenMIDI(midiFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the export returns channel 0 to the center
+	expected = append(expected, Bend{11, 0, 0})
+	expected[1], expected[2], expected[3] = expected[3], expected[1], expected[2]
+	checkBends("exported", m3.AllBends())
+}
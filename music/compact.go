@@ -0,0 +1,126 @@
+package music
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// compactMusic is how SaveCompact saves music: every note, in order, as
+// its beat after the note before, its pitch, its velocity and flags of
+// whether it is on, whether it is Sustained, its Channel and its Source,
+// with the Offsets and Devices of the notes that have one by their place
+// in Deltas
+type compactMusic struct {
+	Deltas  [][4]int
+	Offsets map[int]float64 `json:",omitempty"`
+	Devices map[int]int     `json:",omitempty"`
+	Bends   map[int][]Bend  `json:",omitempty"`
+}
+
+const (
+	compactOn        = 1
+	compactSustained = 2
+	// the channel takes the 4 bits after the flags, and the source the rest
+	compactChannelShift = 2
+	compactSourceShift  = 6
+)
+
+// SaveCompact is like Save, but writes the notes in a much shorter
+// form, which Open reads as well. With a name that ends in ".gz" it
+// is compressed too.
+func (m *Music) SaveCompact(filename string) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	bMusic, err := json.Marshal(m.compact())
+	if err != nil {
+		return
+	}
+	err = writeFile(filename, bMusic, KeepBackup)
+	if err == nil {
+		m.saved = m.changes
+	}
+	return
+}
+
+// Encode returns the music in the form SaveCompact writes it, for
+// keeping it somewhere other than a file of its own
+func (m *Music) Encode() ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	return json.Marshal(m.compact())
+}
+
+// compact returns the music in its compact form, and must be
+// called with the lock held
+func (m *Music) compact() (compact compactMusic) {
+	beats := make([]int, 0, len(m.Notes))
+	for beat := range m.Notes {
+		beats = append(beats, beat)
+	}
+	sort.Ints(beats)
+	compact.Deltas = [][4]int{}
+	compact.Bends = m.Bends
+	last := 0
+	for _, beat := range beats {
+		pitches := make([]int, 0, len(m.Notes[beat]))
+		for pitch := range m.Notes[beat] {
+			pitches = append(pitches, pitch)
+		}
+		sort.Ints(pitches)
+		for _, pitch := range pitches {
+			note := m.Notes[beat][pitch]
+			flags := note.Channel<<compactChannelShift | int(note.Source)<<compactSourceShift
+			if note.On {
+				flags |= compactOn
+			}
+			if note.Sustained {
+				flags |= compactSustained
+			}
+			if note.Offset != 0 {
+				if compact.Offsets == nil {
+					compact.Offsets = make(map[int]float64)
+				}
+				compact.Offsets[len(compact.Deltas)] = note.Offset
+			}
+			if note.Device != 0 {
+				if compact.Devices == nil {
+					compact.Devices = make(map[int]int)
+				}
+				compact.Devices[len(compact.Deltas)] = note.Device
+			}
+			compact.Deltas = append(compact.Deltas, [4]int{beat - last, pitch, note.Velocity, flags})
+			last = beat
+		}
+	}
+	return
+}
+
+// notes returns the notes of music in its compact form
+func (compact compactMusic) notes() (notes map[int]map[int]Note, err error) {
+	notes = make(map[int]map[int]Note)
+	beat := 0
+	for i, delta := range compact.Deltas {
+		beat += delta[0]
+		flags := delta[3]
+		note := Note{
+			On:        flags&compactOn != 0,
+			Pitch:     delta[1],
+			Velocity:  delta[2],
+			Beat:      beat,
+			Sustained: flags&compactSustained != 0,
+			Channel:   flags >> compactChannelShift & 0x0F,
+			Source:    Source(flags >> compactSourceShift),
+			Offset:    compact.Offsets[i],
+			Device:    compact.Devices[i],
+		}
+		if note.Source < 0 || int(note.Source) >= len(sourceNames) {
+			return nil, fmt.Errorf("unknown %s of the note at %d", note.Source, beat)
+		}
+		if _, ok := notes[beat]; !ok {
+			notes[beat] = make(map[int]Note)
+		}
+		notes[beat][note.Pitch] = note
+	}
+	return
+}
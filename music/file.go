@@ -0,0 +1,86 @@
+package music
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipSuffix is the end of the name of a file that is compressed
+const gzipSuffix = ".gz"
+
+// BackupSuffix is put on the end of the name of a saved file for the
+// version before it, which is kept when KeepBackup is set
+const BackupSuffix = ".bak"
+
+// KeepBackup keeps the previous version of the music every time it is
+// saved, so that it can be opened if the file itself is ever corrupt
+var KeepBackup = true
+
+// writeFile writes a file all at once, so that it is never left half
+// written: the data goes to a temporary file next to it first, which
+// then takes its place. The directory is made if it does not exist.
+func writeFile(filename string, data []byte, backup bool) (err error) {
+	if strings.HasSuffix(filename, gzipSuffix) {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(data)
+		if err = w.Close(); err != nil {
+			return
+		}
+		data = compressed.Bytes()
+	}
+	dir := filepath.Dir(filename)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return
+	}
+	if backup {
+		err = os.Rename(filename, filename+BackupSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// readFile reads a file, decompressing it if it was compressed
+// whatever its name is
+func readFile(filename string) (data []byte, err error) {
+	data, err = ioutil.ReadFile(filename)
+	if err != nil || len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,96 @@
+package music
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "history.json")
+
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80})
+	if err = m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 80, Beat: 10})
+	if err = m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected only the file and its backup, got %d files", len(files))
+	}
+	backup, err := Open(filename + BackupSuffix)
+	if err != nil || len(backup.GetAll()) != 1 {
+		t.Errorf("expected the backup to have the first note, got %v", err)
+	}
+
+	// a file cut off halfway through falls back to the backup
+	if err = ioutil.WriteFile(filename, []byte(`{"0":{"60":{"On":tr`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open(filename)
+	if err != nil || len(opened.GetAll()) != 1 {
+		t.Errorf("expected the backup to be opened, got %v", err)
+	}
+	os.Remove(filename + BackupSuffix)
+	if _, err = Open(filename); err == nil {
+		t.Error("expected an error without a backup")
+	}
+	if _, err = Open(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file to not exist, got %v", err)
+	}
+}
+
+func TestSaveCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := New()
+	for beat := 0; beat < 1000; beat += 10 {
+		m.AddNote(Note{On: true, Pitch: 60 + beat%12, Velocity: 80, Beat: beat, Channel: 3, Source: Accompaniment})
+		m.AddNote(Note{Pitch: 60 + beat%12, Beat: beat + 5, Sustained: true})
+	}
+	m.AddNote(Note{On: true, Pitch: 50, Velocity: 80, Beat: 1000, Offset: 0.25, Device: 2})
+	m.AddBend(Bend{Beat: 20, Value: 100, Channel: 1})
+	sizes := make(map[string]int64)
+	for _, name := range []string{"plain.json", "plain.json.gz", "compact.json", "compact.json.gz"} {
+		filename := filepath.Join(dir, name)
+		if name[0] == 'c' {
+			err = m.SaveCompact(filename)
+		} else {
+			err = m.Save(filename)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(filename)
+		sizes[name] = info.Size()
+		opened, err := Open(filename)
+		if err != nil {
+			t.Fatalf("could not open %s: %s", name, err)
+		}
+		if notes := opened.Consolidate(); len(notes) != 101 || notes[1] != (Note{On: true, Pitch: 70, Velocity: 80, Beat: 10, Duration: 5, Sustained: true, Channel: 3, Source: Accompaniment}) {
+			t.Errorf("expected the notes back from %s, got %+v", name, notes[1])
+		} else if notes[100].Offset != 0.25 || notes[100].Device != 2 {
+			t.Errorf("expected the offset and device back from %s, got %+v", name, notes[100])
+		}
+		if bends := opened.AllBends(); len(bends) != 1 || bends[0].Value != 100 {
+			t.Errorf("expected the bend back from %s, got %+v", name, bends)
+		}
+	}
+	if sizes["compact.json"] >= sizes["plain.json"]/3 || sizes["plain.json.gz"] >= sizes["plain.json"]/3 {
+		t.Errorf("expected the files to be smaller, got %+v", sizes)
+	}
+}
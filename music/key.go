@@ -0,0 +1,135 @@
+package music
+
+import (
+	"math"
+	"strings"
+)
+
+// noteOffsets maps the note letters to their semitone above C
+var noteOffsets = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// modeIntervals are the semitones above the tonic for each mode
+var modeIntervals = map[string][]int{
+	"major": {0, 2, 4, 5, 7, 9, 11},
+	"minor": {0, 2, 3, 5, 7, 8, 10},
+}
+
+// KeyTonic returns the pitch class (0 = C, 11 = B) of a key
+// like "C", "F#" or "Bb", and whether the key could be understood.
+func KeyTonic(key string) (tonic int, ok bool) {
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return
+	}
+	tonic, ok = noteOffsets[strings.ToUpper(key[:1])[0]]
+	if !ok {
+		return
+	}
+	for _, c := range key[1:] {
+		switch c {
+		case '#':
+			tonic++
+		case 'b':
+			tonic--
+		default:
+			return 0, false
+		}
+	}
+	tonic = (tonic%12 + 12) % 12
+	return
+}
+
+// SnapToKey moves a pitch to the nearest pitch in the scale of the key
+// and mode ("major" or "minor"), preferring the lower pitch when two are
+// equally near. Pitches are returned unchanged if the key or mode is
+// not recognized.
+func SnapToKey(pitch int, key string, mode string) int {
+	tonic, ok := KeyTonic(key)
+	if !ok {
+		return pitch
+	}
+	intervals, ok := modeIntervals[strings.ToLower(mode)]
+	if !ok {
+		return pitch
+	}
+	return Scale{Intervals: intervals}.Snap(pitch, tonic)
+}
+
+// keyProfiles are the Krumhansl-Kessler profiles of how well each
+// pitch class above the tonic fits in a major and a minor key
+var keyProfiles = map[string][12]float64{
+	"major": {6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88},
+	"minor": {6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17},
+}
+
+// keyNames are the usual names of the keys, by tonic
+var keyNames = map[string][12]string{
+	"major": {"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"},
+	"minor": {"C", "C#", "D", "Eb", "E", "F", "F#", "G", "G#", "A", "Bb", "B"},
+}
+
+// minKeyNotes is the number of notes it takes to trust DetectKey fully
+const minKeyNotes = 16
+
+// DetectKey guesses the key and mode ("major" or "minor") of the
+// music with the Krumhansl-Schmuckler algorithm, from how long each
+// pitch class is held. The confidence goes from 0 to 1, and is low
+// when there are only a few notes or another key fits almost as well.
+func (m *Music) DetectKey() (key string, mode string, confidence float64) {
+	key, mode = "C", "major"
+	notes := m.Consolidate()
+	var histogram [12]float64
+	for _, note := range notes {
+		duration := note.Duration
+		if duration < 1 {
+			duration = 1
+		}
+		histogram[(note.Pitch%12+12)%12] += float64(duration)
+	}
+
+	best, second := -1.0, -1.0
+	for _, profileMode := range []string{"major", "minor"} {
+		profile := keyProfiles[profileMode]
+		for tonic := 0; tonic < 12; tonic++ {
+			var rotated [12]float64
+			for pc := range rotated {
+				rotated[pc] = profile[(pc-tonic+12)%12]
+			}
+			r := correlation(histogram, rotated)
+			if r > best {
+				second = best
+				best = r
+				key, mode = keyNames[profileMode][tonic], profileMode
+			} else if r > second {
+				second = r
+			}
+		}
+	}
+	if best <= 0 {
+		return
+	}
+	confidence = best * math.Min(1, 5*(best-second)) * math.Min(1, float64(len(notes))/minKeyNotes)
+	return
+}
+
+// correlation returns the Pearson correlation, which is 0 if
+// either has no variation
+func correlation(x, y [12]float64) float64 {
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i] / 12
+		meanY += y[i] / 12
+	}
+	var covariance, varX, varY float64
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		varX += (x[i] - meanX) * (x[i] - meanX)
+		varY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return covariance / math.Sqrt(varX*varY)
+}
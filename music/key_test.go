@@ -0,0 +1,84 @@
+package music
+
+import "testing"
+
+func TestDetectKey(t *testing.T) {
+	m := New()
+	// a G major scale and the G at the top, with the tonic and fifth held longer
+	beat := 0
+	for _, pitch := range []int{55, 57, 59, 60, 62, 64, 66, 67, 62, 59, 55, 62, 67, 66, 67, 55} {
+		duration := 10
+		if pitch%12 == 7 || pitch%12 == 2 {
+			duration = 30
+		}
+		m.AddNote(Note{On: true, Pitch: pitch, Velocity: 80, Beat: beat})
+		m.AddNote(Note{On: false, Pitch: pitch, Beat: beat + duration})
+		beat += duration
+	}
+	key, mode, confidence := m.DetectKey()
+	if key != "G" || mode != "major" {
+		t.Errorf("got %s %s, expected G major", key, mode)
+	}
+	if confidence < 0.3 {
+		t.Errorf("got a low confidence of %2.2f", confidence)
+	}
+
+	// all twelve pitch classes the same
+	m = New()
+	for pitch := 60; pitch < 72; pitch++ {
+		m.AddNote(Note{On: true, Pitch: pitch, Velocity: 80, Beat: pitch * 10})
+		m.AddNote(Note{On: false, Pitch: pitch, Beat: pitch*10 + 5})
+	}
+	if _, _, confidence := m.DetectKey(); confidence != 0 {
+		t.Errorf("got a confidence of %2.2f for a chromatic scale", confidence)
+	}
+
+	// a single note could be in a lot of keys
+	m = New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 10})
+	if _, _, confidence := m.DetectKey(); confidence > 0.1 {
+		t.Errorf("got a confidence of %2.2f for a single note", confidence)
+	}
+}
+
+func TestKeyTonic(t *testing.T) {
+	for key, expected := range map[string]int{"C": 0, "F#": 6, "Bb": 10, "b": 11, " Eb ": 3, "Cb": 11, "B#": 0, "C##": 2} {
+		if tonic, ok := KeyTonic(key); !ok || tonic != expected {
+			t.Errorf("expected %q to be %d, got %d (%t)", key, expected, tonic, ok)
+		}
+	}
+	for _, key := range []string{"", "H", "C+", "Cm"} {
+		if _, ok := KeyTonic(key); ok {
+			t.Errorf("expected %q not to be a key", key)
+		}
+	}
+}
+
+func TestSnapToKey(t *testing.T) {
+	for _, test := range []struct {
+		pitch     int
+		key, mode string
+		expected  int
+	}{
+		// in the key already
+		{64, "C", "major", 64},
+		// F# is as near to F as to G, and goes down
+		{66, "C", "major", 65},
+		{63, "C", "major", 62},
+		{64, "A", "minor", 64},
+		{61, "A", "minor", 60},
+		{66, "D", "Minor", 65},
+		// G at the top is as near to F# as to G#, and G# is not a pitch
+		{127, "B", "major", 126},
+		// C at the bottom is as near to B as to C#, and B is not a pitch
+		{0, "B", "major", 1},
+		// a key or mode it does not know leaves the pitch alone
+		{66, "H", "major", 66},
+		{66, "C", "lydian", 66},
+	} {
+		if pitch := SnapToKey(test.pitch, test.key, test.mode); pitch != test.expected {
+			t.Errorf("expected %d in %s %s to be %d, got %d", test.pitch, test.key, test.mode, test.expected, pitch)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package music
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lilypondDurations are the lengths in sixteenth notes that can be
+// written as a single Lilypond duration, from the longest
+var lilypondDurations = []struct {
+	length int
+	token  string
+}{
+	{16, "1"}, {12, "2."}, {8, "2"}, {6, "4."}, {4, "4"}, {3, "8."}, {2, "8"}, {1, "16"},
+}
+
+// ExportLilypond writes the notes as a Lilypond score, on a grid of
+// sixteenth notes, in the Key and time signature of the music. The
+// pitches are spelled for the key, and lengths that are not a single
+// note value are written as tied notes.
+func (m *Music) ExportLilypond(w io.Writer) (err error) {
+	bars := m.scoreBars()
+	m.RLock()
+	ks := newKeySpelling(m.Key, m.Mode)
+	beatsPerBar, beatUnit := m.timeSignature()
+	bpm := m.bpm()
+	m.RUnlock()
+	if len(bars) == 0 {
+		bars = [][]scoreEvent{{{length: beatsPerBar * 16 / beatUnit}}}
+	}
+	// the bass clef if most of the notes are below middle C
+	low, total := 0, 0
+	for _, bar := range bars {
+		for _, event := range bar {
+			for _, pitch := range event.pitches {
+				total++
+				if pitch < 60 {
+					low++
+				}
+			}
+		}
+	}
+	clef := "treble"
+	if 2*low > total {
+		clef = "bass"
+	}
+	mode := "major"
+	if ks.minor {
+		mode = "minor"
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "\\version \"2.18.2\"\n\n{\n  \\clef %s\n  \\key %s \\%s\n  \\time %d/%d\n  \\tempo 4 = %d\n",
+		clef, lilypondName(ks.tonic), mode, beatsPerBar, beatUnit, bpm)
+	for _, bar := range bars {
+		tokens := []string{}
+		for _, event := range bar {
+			name := "r"
+			if len(event.pitches) == 1 {
+				name = lilypondPitch(ks.spell(event.pitches[0]))
+			} else if len(event.pitches) > 1 {
+				pitches := make([]string, len(event.pitches))
+				for i, pitch := range event.pitches {
+					pitches[i] = lilypondPitch(ks.spell(pitch))
+				}
+				name = "<" + strings.Join(pitches, " ") + ">"
+			}
+			for remaining := event.length; remaining > 0; {
+				for _, duration := range lilypondDurations {
+					if duration.length > remaining {
+						continue
+					}
+					token := name + duration.token
+					remaining -= duration.length
+					if len(event.pitches) > 0 && (remaining > 0 || event.tied) {
+						token += "~"
+					}
+					tokens = append(tokens, token)
+					break
+				}
+			}
+		}
+		fmt.Fprintf(b, "  %s |\n", strings.Join(tokens, " "))
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// lilypondName returns the name of a note in Lilypond, without its octave
+func lilypondName(s spelling) string {
+	name := strings.ToLower(string(s.letter))
+	switch {
+	case s.accidental > 0:
+		name += strings.Repeat("is", s.accidental)
+	case s.accidental < 0 && (name == "e" || name == "a"):
+		// not "ees" and "aes"
+		name += "s" + strings.Repeat("es", -s.accidental-1)
+	case s.accidental < 0:
+		name += strings.Repeat("es", -s.accidental)
+	}
+	return name
+}
+
+// lilypondPitch returns a note with its octave, where c is the C
+// below middle C, with apostrophes for higher and commas for lower
+func lilypondPitch(s spelling) string {
+	if s.octave >= 3 {
+		return lilypondName(s) + strings.Repeat("'", s.octave-3)
+	}
+	return lilypondName(s) + strings.Repeat(",", 3-s.octave)
+}
@@ -0,0 +1,42 @@
+package music
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportLilypond(t *testing.T) {
+	m := New()
+	m.TicksPerBeat = 4
+	m.BPM = 100
+	m.Key, m.Mode = "Eb", "major"
+	// a dotted quarter, then an E flat and a C sharp
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 67, Beat: 6})
+	m.AddNote(Note{On: true, Pitch: 63, Velocity: 80, Beat: 6})
+	m.AddNote(Note{On: false, Pitch: 63, Beat: 8})
+	m.AddNote(Note{On: true, Pitch: 61, Velocity: 80, Beat: 8})
+	m.AddNote(Note{On: false, Pitch: 61, Beat: 12})
+	// five sixteenths of a chord, tied over the bar line
+	m.AddNote(Note{On: true, Pitch: 48, Velocity: 80, Beat: 12})
+	m.AddNote(Note{On: true, Pitch: 72, Velocity: 80, Beat: 12})
+	m.AddNote(Note{On: false, Pitch: 48, Beat: 17})
+	m.AddNote(Note{On: false, Pitch: 72, Beat: 17})
+
+	var b bytes.Buffer
+	if err := m.ExportLilypond(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"\\key es \\major\n",
+		"\\time 4/4\n",
+		"\\tempo 4 = 100\n",
+		"  g'4. es'8 des'4 <c c''>4~ |\n",
+		"  <c c''>16 r2. r8. |\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// midiSubdivisions is how many MIDI ticks each tick is written as
+// when some of the notes have an Offset, to keep their timing
+const midiSubdivisions = 8
+
+// midiEvent is a single channel event in a standard MIDI file track
+type midiEvent struct {
+	tick   int
+	status byte
+	data1  byte
+	data2  byte
+}
+
+// ExportMIDI writes all the notes as a type-0 standard MIDI file, each
+// on its own channel. The beats are written directly as MIDI ticks, using
+// TicksPerBeat as the division and BPM for the tempo. The notes are paired
+// using Consolidate, so that the file never contains stuck notes, and
+// the pitch bends are written too, returning to the center at the end.
+// If any of the notes have an Offset, every beat is written as
+// midiSubdivisions MIDI ticks instead, so that they are played on time.
+func (m *Music) ExportMIDI(filename string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Music.ExportMIDI",
+	})
+	notes := m.Consolidate()
+	m.RLock()
+	// the offsets of the note-offs, by the note-ons they end
+	offOffsets := make([]float64, len(notes))
+	subdivisions := 1
+	for i, note := range notes {
+		if off, ok := m.Notes[note.Beat+note.Duration][note.Pitch]; ok && !off.On {
+			offOffsets[i] = off.Offset
+		}
+		if note.Offset != 0 || offOffsets[i] != 0 {
+			subdivisions = midiSubdivisions
+		}
+	}
+	m.RUnlock()
+	if m.ticksPerBeat()*subdivisions > math.MaxInt16 {
+		subdivisions = 1
+	}
+	midiTick := func(beat int, offset float64) int {
+		return int(math.Floor((float64(beat)+offset)*float64(subdivisions) + 0.5))
+	}
+
+	events := []midiEvent{}
+	for i, note := range notes {
+		if note.Pitch < 0 || note.Pitch > 127 {
+			continue
+		}
+		duration := note.Duration
+		if duration < 1 {
+			duration = 1
+		}
+		on := midiTick(note.Beat, note.Offset)
+		off := midiTick(note.Beat+duration, offOffsets[i])
+		if off <= on {
+			off = on + 1
+		}
+		channel := byte(note.Channel & 0x0F)
+		events = append(events, midiEvent{on, 0x90 | channel, byte(note.Pitch), byte(clampVelocity(note.Velocity))})
+		events = append(events, midiEvent{off, 0x80 | channel, byte(note.Pitch), 0})
+	}
+	bends := m.AllBends()
+	for _, bend := range append(bends, CenterBends(bends)...) {
+		value := bend.Value + MaxBend + 1
+		events = append(events, midiEvent{midiTick(bend.Beat, 0), 0xE0 | byte(bend.Channel&0x0F), byte(value & 0x7F), byte(value >> 7)})
+	}
+	// note-offs go before note-ons on the same tick
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick == events[j].tick {
+			return events[i].status&0xF0 < events[j].status&0xF0
+		}
+		return events[i].tick < events[j].tick
+	})
+
+	var track bytes.Buffer
+	// tempo meta event, in microseconds per quarter note
+	tempo := 60000000 / m.bpm()
+	writeVarLen(&track, 0)
+	track.Write([]byte{0xFF, 0x51, 0x03, byte(tempo >> 16), byte(tempo >> 8), byte(tempo)})
+	prevTick := 0
+	for _, event := range events {
+		writeVarLen(&track, event.tick-prevTick)
+		track.Write([]byte{event.status, event.data1, event.data2})
+		prevTick = event.tick
+	}
+	// end of track
+	writeVarLen(&track, 0)
+	track.Write([]byte{0xFF, 0x2F, 0x00})
+
+	var file bytes.Buffer
+	file.WriteString("MThd")
+	binary.Write(&file, binary.BigEndian, uint32(6))
+	binary.Write(&file, binary.BigEndian, uint16(0))
+	binary.Write(&file, binary.BigEndian, uint16(1))
+	binary.Write(&file, binary.BigEndian, uint16(m.ticksPerBeat()*subdivisions))
+	file.WriteString("MTrk")
+	binary.Write(&file, binary.BigEndian, uint32(track.Len()))
+	file.Write(track.Bytes())
+
+	logger.Debugf("Writing %d events to %s", len(events), filename)
+	return ioutil.WriteFile(filename, file.Bytes(), 0644)
+}
+
+// OpenMIDI reads a standard MIDI file (type 0 or 1) into a new Music.
+// All the tracks are merged and the ticks are rescaled from the file's
+// division to DefaultTicksPerBeat. Meta and system exclusive events are
+// skipped, except for the first tempo which sets the BPM. Note-ons
+// are paired with their note-offs, and any note still sounding at the
+// end of the file is turned off on the last tick. Pitch bends are kept.
+func OpenMIDI(filename string) (m *Music, err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Music.OpenMIDI",
+	})
+	m = New()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if len(data) < 14 || string(data[0:4]) != "MThd" {
+		err = errors.New("not a standard MIDI file")
+		return
+	}
+	headerLength := int(binary.BigEndian.Uint32(data[4:8]))
+	numTracks := int(binary.BigEndian.Uint16(data[10:12]))
+	division := int(binary.BigEndian.Uint16(data[12:14]))
+	if division&0x8000 != 0 {
+		err = errors.New("SMPTE time division is not supported")
+		return
+	}
+	if division == 0 {
+		err = errors.New("invalid time division")
+		return
+	}
+
+	events := []midiEvent{}
+	bpm := 0
+	pos := 8 + headerLength
+	for track := 0; track < numTracks && pos+8 <= len(data); track++ {
+		chunkLength := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		chunkStart := pos + 8
+		chunkEnd := chunkStart + chunkLength
+		if chunkEnd > len(data) {
+			err = fmt.Errorf("track %d is truncated", track)
+			return
+		}
+		if string(data[pos:pos+4]) != "MTrk" {
+			pos = chunkEnd
+			track--
+			continue
+		}
+		var trackEvents []midiEvent
+		var trackBPM int
+		trackEvents, trackBPM, err = readTrack(data[chunkStart:chunkEnd])
+		if err != nil {
+			err = fmt.Errorf("track %d: %s", track, err.Error())
+			return
+		}
+		if bpm == 0 {
+			bpm = trackBPM
+		}
+		events = append(events, trackEvents...)
+		pos = chunkEnd
+	}
+	if bpm > 0 {
+		m.BPM = bpm
+	}
+	m.TicksPerBeat = DefaultTicksPerBeat
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].tick < events[j].tick
+	})
+
+	// pair up the notes, of each pitch on each channel
+	type channelPitch struct {
+		channel, pitch int
+	}
+	onBeats := make(map[channelPitch]int)
+	lastBeat := 0
+	for _, event := range events {
+		beat := event.tick * m.TicksPerBeat / division
+		if beat > lastBeat {
+			lastBeat = beat
+		}
+		if event.status&0xF0 == 0xE0 {
+			value := int(event.data1) | int(event.data2)<<7
+			m.AddBend(Bend{Beat: beat, Value: value - MaxBend - 1, Channel: int(event.status & 0x0F)})
+			continue
+		}
+		pitch, channel := int(event.data1), int(event.status&0x0F)
+		isOn := event.status&0xF0 == 0x90 && event.data2 > 0
+		key := channelPitch{channel, pitch}
+		onBeat, sounding := onBeats[key]
+		if isOn {
+			if sounding {
+				m.addOff(pitch, channel, beat, onBeat)
+			}
+			m.AddNote(Note{On: true, Pitch: pitch, Velocity: int(event.data2), Beat: beat, Channel: channel})
+			onBeats[key] = beat
+		} else if sounding {
+			m.addOff(pitch, channel, beat, onBeat)
+			delete(onBeats, key)
+		}
+	}
+	for key, onBeat := range onBeats {
+		m.addOff(key.pitch, key.channel, lastBeat, onBeat)
+	}
+	logger.Debugf("Read %d events from %d tracks", len(events), numTracks)
+	return
+}
+
+// addOff turns off a pitch on a channel, moving it back a tick
+// if it would otherwise replace a note-on on the same beat
+func (m *Music) addOff(pitch, channel, beat, onBeat int) {
+	if beat <= onBeat {
+		beat = onBeat + 1
+	}
+	m.RLock()
+	_, taken := m.Notes[beat][pitch]
+	m.RUnlock()
+	if taken && beat-1 > onBeat {
+		beat--
+	}
+	m.AddNote(Note{On: false, Pitch: pitch, Velocity: 0, Beat: beat, Channel: channel})
+}
+
+// readTrack returns the note and pitch bend events of a single track,
+// along with the BPM of the first tempo meta event (if any)
+func readTrack(data []byte) (events []midiEvent, bpm int, err error) {
+	events = []midiEvent{}
+	tick := 0
+	var status byte
+	pos := 0
+	for pos < len(data) {
+		var delta int
+		delta, pos, err = readVarLen(data, pos)
+		if err != nil {
+			return
+		}
+		tick += delta
+		if pos >= len(data) {
+			err = errors.New("unexpected end of track")
+			return
+		}
+		if data[pos]&0x80 != 0 {
+			status = data[pos]
+			pos++
+		} else if status == 0 {
+			err = errors.New("running status without a status byte")
+			return
+		}
+		switch {
+		case status == 0xFF:
+			// meta event
+			if pos >= len(data) {
+				err = errors.New("unexpected end of track")
+				return
+			}
+			metaType := data[pos]
+			var length int
+			length, pos, err = readVarLen(data, pos+1)
+			if err != nil {
+				return
+			}
+			if pos+length > len(data) {
+				err = errors.New("unexpected end of track")
+				return
+			}
+			if metaType == 0x51 && length == 3 && bpm == 0 {
+				tempo := int(data[pos])<<16 | int(data[pos+1])<<8 | int(data[pos+2])
+				if tempo > 0 {
+					bpm = 60000000 / tempo
+				}
+			}
+			pos += length
+			status = 0
+		case status == 0xF0 || status == 0xF7:
+			// system exclusive
+			var length int
+			length, pos, err = readVarLen(data, pos)
+			if err != nil {
+				return
+			}
+			pos += length
+			status = 0
+		case status&0xF0 == 0xC0 || status&0xF0 == 0xD0:
+			pos++
+		default:
+			if pos+2 > len(data) {
+				err = errors.New("unexpected end of track")
+				return
+			}
+			if status&0xF0 == 0x80 || status&0xF0 == 0x90 || status&0xF0 == 0xE0 {
+				events = append(events, midiEvent{tick, status, data[pos], data[pos+1]})
+			}
+			pos += 2
+		}
+	}
+	return
+}
+
+// readVarLen reads a MIDI variable-length quantity
+func readVarLen(data []byte, pos int) (value int, newPos int, err error) {
+	for i := 0; i < 4; i++ {
+		if pos >= len(data) {
+			err = errors.New("unexpected end of variable-length quantity")
+			return
+		}
+		b := data[pos]
+		pos++
+		value = value<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			newPos = pos
+			return
+		}
+	}
+	err = errors.New("variable-length quantity is too long")
+	return
+}
+
+// writeVarLen writes a MIDI variable-length quantity
+func writeVarLen(buf *bytes.Buffer, value int) {
+	if value < 0 {
+		value = 0
+	}
+	b := []byte{byte(value & 0x7F)}
+	for value >>= 7; value > 0; value >>= 7 {
+		b = append([]byte{byte(value&0x7F | 0x80)}, b...)
+	}
+	buf.Write(b)
+}
+
+func clampVelocity(v int) int {
+	if v < 1 {
+		return 1
+	}
+	if v > 127 {
+		return 127
+	}
+	return v
+}
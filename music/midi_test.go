@@ -0,0 +1,81 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMIDIRoundTrip(t *testing.T) {
+	m, err := Open("../testing/c_scale.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.BPM = 100
+	m.TicksPerBeat = DefaultTicksPerBeat
+	m.AddNote(Note{On: true, Pitch: 40, Velocity: 70, Beat: 1, Channel: 1})
+	m.AddNote(Note{On: false, Pitch: 40, Beat: 100, Channel: 1})
+	filename := filepath.Join(os.TempDir(), "pianoai_c_scale.mid")
+	defer os.Remove(filename)
+	err = m.ExportMIDI(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := OpenMIDI(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.BPM != 100 {
+		t.Errorf("got BPM %d, expected 100", m2.BPM)
+	}
+	ons, offs := 0, 0
+	for _, note := range m2.GetAll() {
+		if note.On {
+			ons++
+		} else {
+			offs++
+		}
+	}
+	if ons == 0 || ons != offs {
+		t.Errorf("got %d note-ons and %d note-offs", ons, offs)
+	}
+	for _, note := range m.GetAll() {
+		if !note.On {
+			continue
+		}
+		_, notes := m2.Get(note.Beat)
+		found := false
+		for _, note2 := range notes {
+			if note2.Pitch == note.Pitch && note2.On && note2.Velocity == note.Velocity && note2.Channel == note.Channel {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %+v", note)
+		}
+	}
+	if off := m2.Notes[100][40]; off.On || off.Channel != 1 {
+		t.Errorf("expected the note-off on channel 1, got %+v", off)
+	}
+}
+
+func TestMIDIOffset(t *testing.T) {
+	m := New()
+	m.TicksPerBeat = 10
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 2, Offset: 0.5})
+	m.AddNote(Note{Pitch: 60, Beat: 4, Offset: 0.25})
+	filename := filepath.Join(os.TempDir(), "pianoai_offset.mid")
+	defer os.Remove(filename)
+	if err := m.ExportMIDI(filename); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := OpenMIDI(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// at 250 ticks per beat instead of 10, 2.5 and 4.25 ticks are 62.5 and 106.25
+	if notes := m2.Consolidate(); len(notes) != 1 || notes[0].Beat != 62 || notes[0].Duration != 44 {
+		t.Errorf("expected the note to keep its offsets, got %+v", notes)
+	}
+}
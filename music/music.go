@@ -3,7 +3,8 @@ package music
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math"
+	"sort"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
@@ -16,11 +17,32 @@ type Note struct {
 	Pitch    int
 	Velocity int
 	Beat     int
+	// Duration is the number of ticks the note is held, which
+	// is only filled in for note-ons returned by Consolidate
+	Duration int
+	// Sustained marks a note-off that was held back by the sustain
+	// pedal, and the note-ons returned by Consolidate that it ends
+	Sustained bool
+	// Channel is the MIDI channel (0-15) the note is played on
+	Channel int
+	// Source is where the note came from, the keyboard if not set
+	Source Source `json:",omitempty"`
+	// Offset is how far into its tick the note was played, from 0 up
+	// to 1 tick, for the timing that is finer than the Beat
+	Offset float64 `json:",omitempty"`
+	// Device is which MIDI input a note from the keyboard came from,
+	// 0 for the main one
+	Device int `json:",omitempty"`
+}
+
+// ExactBeat returns when the note was played, in ticks, with its Offset
+func (n Note) ExactBeat() float64 {
+	return float64(n.Beat) + n.Offset
 }
 
 // Time returns when it will be played (or turned off)
 func (n *Note) Time() string {
-	return fmt.Sprintf("%2.5f", n.Beat)
+	return fmt.Sprintf("%d", n.Beat)
 }
 
 func (n *Note) Name() string {
@@ -42,13 +64,46 @@ func (p Notes) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// DefaultBPM and DefaultTicksPerBeat are the timings assumed
+// for music that does not specify its own (120 BPM listened at 500 Hz)
+const (
+	DefaultBPM          = 120
+	DefaultTicksPerBeat = 250
+)
+
 // Music stores all the notes that will be played / were already played
 type Music struct {
 	// Notes map: tick -> pitch -> note
 	Notes map[int]map[int]Note
+	// Bends map: tick -> the pitch bends on that tick
+	Bends map[int][]Bend
+	// BPM and TicksPerBeat describe how the ticks relate to time,
+	// which is needed when converting to other formats
+	BPM          int
+	TicksPerBeat int
+	// Key and Mode ("major" or "minor"), and BeatsPerBar and BeatUnit
+	// of the time signature, are written in the scores. They are
+	// C major and 4/4 if not set.
+	Key         string
+	Mode        string
+	BeatsPerBar int
+	BeatUnit    int
+	// changes counts the changes to the notes, and saved
+	// is the count when the notes were last saved
+	changes, saved int
+	// added is where the notes are, in the order they were added
+	// (or by beat, for the ones added at about the same time), and
+	// inserted is where they were added, in exactly that order
+	added    []noteKey
+	inserted []noteKey
 	sync.RWMutex
 }
 
+// noteKey is where a note is in Notes
+type noteKey struct {
+	beat, pitch int
+}
+
 // New returns a new object
 func New() *Music {
 	m := new(Music)
@@ -58,23 +113,74 @@ func New() *Music {
 	return m
 }
 
-// OpenMusic opens a previous music
-func Open(filename string) (*Music, error) {
-	bMusic, err := ioutil.ReadFile(filename)
+// savedMusic is how music with bends is saved. Music without
+// bends is saved as just the map of the notes, as it always was.
+type savedMusic struct {
+	Notes map[int]map[int]Note
+	Bends map[int][]Bend `json:",omitempty"`
+}
+
+// Open opens music that was saved, or the backup of it that Save kept
+// if the file itself is missing or can not be read
+func Open(filename string) (m *Music, err error) {
+	m, err = open(filename)
+	if err == nil {
+		return
+	}
+	backup, errBackup := open(filename + BackupSuffix)
+	if errBackup != nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"function": "Music.Open",
+	}).Warnf("Could not open %s (%s), so opened its backup", filename, err.Error())
+	return backup, nil
+}
+
+// open opens music in any of the forms it is saved in,
+// and with or without compression
+func open(filename string) (*Music, error) {
+	bMusic, err := readFile(filename)
 	if err != nil {
-		return new(Music), err
+		return New(), err
 	}
-	m := new(Music)
+	return Decode(bMusic)
+}
+
+// Decode reads music from the data of a file it was saved in, in any
+// of its forms (but not compressed)
+func Decode(bMusic []byte) (m *Music, err error) {
+	m = New()
 	m.Lock()
-	err = json.Unmarshal(bMusic, &m.Notes)
+	var saved savedMusic
+	var compact compactMusic
+	if json.Unmarshal(bMusic, &compact) == nil && compact.Deltas != nil {
+		m.Notes, err = compact.notes()
+		m.Bends = compact.Bends
+	} else if json.Unmarshal(bMusic, &saved) == nil && saved.Notes != nil {
+		m.Notes, m.Bends = saved.Notes, saved.Bends
+	} else {
+		err = json.Unmarshal(bMusic, &m.Notes)
+	}
+	if m.Notes == nil {
+		m.Notes = make(map[int]map[int]Note)
+	}
+	m.reorder()
 	m.Unlock()
-	return m, err
+	return
 }
 
 // AddNote will add a note in a thread-safe way.
 func (m *Music) AddNote(n Note) (err error) {
 	m.Lock()
 	defer m.Unlock()
+	m.addNote(n)
+	return
+}
+
+// addNote adds a note, unless there already is one of the same pitch
+// on the same beat, and must be called with the lock held
+func (m *Music) addNote(n Note) {
 	if _, hasTime := m.Notes[n.Beat]; hasTime {
 		if _, hasNote := m.Notes[n.Beat][n.Pitch]; hasNote {
 			return
@@ -83,23 +189,143 @@ func (m *Music) AddNote(n Note) (err error) {
 		m.Notes[n.Beat] = make(map[int]Note)
 	}
 	m.Notes[n.Beat][n.Pitch] = n
+	m.changes++
+	// AddNote is called from goroutines that can run in any order,
+	// so the notes that come in late are put back in order of beat
+	key := noteKey{n.Beat, n.Pitch}
+	m.inserted = append(m.inserted, key)
+	i := len(m.added)
+	m.added = append(m.added, key)
+	for ; i > 0 && m.added[i-1].beat > key.beat; i-- {
+		m.added[i] = m.added[i-1]
+	}
+	m.added[i] = key
+}
+
+// reorder puts the notes in order of beat, for when the order they
+// were added in is not known, and must be called with the lock held
+func (m *Music) reorder() {
+	m.added = m.added[:0]
+	for beat := range m.Notes {
+		for pitch := range m.Notes[beat] {
+			m.added = append(m.added, noteKey{beat, pitch})
+		}
+	}
+	sort.Slice(m.added, func(i, j int) bool {
+		if m.added[i].beat == m.added[j].beat {
+			return m.added[i].pitch < m.added[j].pitch
+		}
+		return m.added[i].beat < m.added[j].beat
+	})
+	m.inserted = append(m.inserted[:0], m.added...)
+}
+
+// AddedSince returns the notes added after the first count of them, in
+// the order they were added (leaving out the ones removed since), and
+// how many have been added in all, to ask for the ones after that next
+// time. All of them are returned if the music was Reset since.
+func (m *Music) AddedSince(count int) (notes []Note, total int) {
+	m.RLock()
+	defer m.RUnlock()
+	total = len(m.inserted)
+	if count > total {
+		count = 0
+	}
+	notes = []Note{}
+	// a note is added in the same place again after it was removed
+	seen := make(map[noteKey]bool)
+	for _, key := range m.inserted[count:] {
+		if note, ok := m.Notes[key.beat][key.pitch]; ok && !seen[key] {
+			seen[key] = true
+			notes = append(notes, note)
+		}
+	}
+	return
+}
+
+// RemoveLast removes the n notes that were added last, such as a
+// passage that was fumbled, and returns how many were removed
+func (m *Music) RemoveLast(n int) (removed int) {
+	m.Lock()
+	defer m.Unlock()
+	for removed < n && len(m.added) > 0 {
+		key := m.added[len(m.added)-1]
+		m.added = m.added[:len(m.added)-1]
+		if _, ok := m.Notes[key.beat][key.pitch]; !ok {
+			continue
+		}
+		delete(m.Notes[key.beat], key.pitch)
+		if len(m.Notes[key.beat]) == 0 {
+			delete(m.Notes, key.beat)
+		}
+		removed++
+	}
+	if removed > 0 {
+		m.changes++
+	}
 	return
 }
 
+// Merge adds all the notes of other, shifted by beatOffset ticks, such as
+// to put a lick of the AI at a point of a recording, and returns the
+// number of notes there are now. Notes that land on the same beat are
+// played together, but a note is not added where there already is one
+// of the same pitch.
+func (m *Music) Merge(other *Music, beatOffset int) (count int) {
+	notes := other.GetAll()
+	m.Lock()
+	defer m.Unlock()
+	for _, note := range notes {
+		note.Beat += beatOffset
+		m.addNote(note)
+	}
+	for beat := range m.Notes {
+		count += len(m.Notes[beat])
+	}
+	return
+}
+
+// Filter returns new music with only the notes that pred is true for,
+// along with the bends and everything about the music, such as its BPM
+func (m *Music) Filter(pred func(Note) bool) *Music {
+	m.RLock()
+	defer m.RUnlock()
+	filtered := m.withoutNotes()
+	for beat := range m.Notes {
+		for _, note := range m.Notes[beat] {
+			if pred(note) {
+				filtered.addNote(note)
+			}
+		}
+	}
+	if len(m.Bends) > 0 {
+		filtered.Bends = make(map[int][]Bend)
+		for beat, bends := range m.Bends {
+			filtered.Bends[beat] = append([]Bend{}, bends...)
+		}
+	}
+	return filtered
+}
+
 // Get retrieve notes in music in a thread-safe way
 func (m *Music) Get(beat int) (hasNotes bool, notes []Note) {
+	return m.AppendNotes(nil, beat)
+}
+
+// AppendNotes is like Get, but appends the notes of the beat to a
+// slice, so that the same slice can be used for every beat without
+// allocating. The slice is returned unchanged if there are no notes.
+func (m *Music) AppendNotes(notes []Note, beat int) (hasNotes bool, result []Note) {
 	m.RLock()
 	defer m.RUnlock()
+	result = notes
 	var notesMap map[int]Note
 	notesMap, hasNotes = m.Notes[beat]
 	if !hasNotes {
 		return
 	}
-	notes = make([]Note, len(notesMap))
-	i := 0
 	for _, note := range notesMap {
-		notes[i] = note
-		i++
+		result = append(result, note)
 	}
 	return
 }
@@ -116,6 +342,19 @@ func (m *Music) HasFuture(currentBeat int) bool {
 	return false
 }
 
+// End returns the last beat that has any notes, which is where
+// the music ends once the last note is turned off (0 if it is empty)
+func (m *Music) End() (end int) {
+	m.RLock()
+	defer m.RUnlock()
+	for beat := range m.Notes {
+		if beat > end {
+			end = beat
+		}
+	}
+	return
+}
+
 // GetAll retrieve notes in music in a thread-safe way
 func (m *Music) GetAll() (notes []Note) {
 	logger := log.WithFields(log.Fields{
@@ -124,6 +363,11 @@ func (m *Music) GetAll() (notes []Note) {
 	logger.Debug("Getting all")
 	m.RLock()
 	defer m.RUnlock()
+	return m.getAll()
+}
+
+// getAll returns all the notes, and must be called with the lock held
+func (m *Music) getAll() (notes []Note) {
 	notes = []Note{}
 	for beat := range m.Notes {
 		for pitch := range m.Notes[beat] {
@@ -133,12 +377,247 @@ func (m *Music) GetAll() (notes []Note) {
 	return
 }
 
-func (m *Music) Save(filename string) (err error) {
+// GetRange returns the notes from startBeat up to (but not including)
+// endBeat in time order, and the notes on the same beat from the lowest
+func (m *Music) GetRange(startBeat, endBeat int) (notes []Note) {
 	m.RLock()
 	defer m.RUnlock()
-	bMusic, err := json.Marshal(m.Notes)
+	notes = []Note{}
+	for beat := range m.Notes {
+		if beat < startBeat || beat >= endBeat {
+			continue
+		}
+		for _, note := range m.Notes[beat] {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Beat == notes[j].Beat {
+			return notes[i].Pitch < notes[j].Pitch
+		}
+		return notes[i].Beat < notes[j].Beat
+	})
+	return
+}
+
+// Consolidate pairs each note-on with the next note-off of the same
+// pitch and returns the note-ons, in time order, with their Duration
+// set. A note-on that is turned on again before it is turned off ends
+// at the retrigger, and a note-on that is never turned off lasts until
+// the last beat of the music. The music itself is left unchanged.
+func (m *Music) Consolidate() (notes Notes) {
+	all := Notes(m.GetAll())
+	sort.Sort(all)
+	notes = Notes{}
+	sounding := make(map[int]int)
+	lastBeat := 0
+	for _, note := range all {
+		if note.Beat > lastBeat {
+			lastBeat = note.Beat
+		}
+		if i, ok := sounding[note.Pitch]; ok {
+			notes[i].Duration = note.Beat - notes[i].Beat
+			notes[i].Sustained = !note.On && note.Sustained
+			delete(sounding, note.Pitch)
+		}
+		if note.On {
+			note.Duration = 0
+			sounding[note.Pitch] = len(notes)
+			notes = append(notes, note)
+		}
+	}
+	for _, i := range sounding {
+		notes[i].Duration = lastBeat - notes[i].Beat
+	}
+	return
+}
+
+// Transpose returns a copy of the notes shifted by a number of semitones,
+// without the ones that end up outside of the MIDI range (0-127), and
+// the number of notes that were left out
+func (p Notes) Transpose(semitones int) (transposed Notes, dropped int) {
+	transposed = make(Notes, 0, len(p))
+	for _, note := range p {
+		note.Pitch += semitones
+		if note.Pitch < 0 || note.Pitch > 127 {
+			dropped++
+			continue
+		}
+		transposed = append(transposed, note)
+	}
+	return
+}
+
+// Transpose shifts the pitch of every note by a number of semitones.
+// Notes that end up outside of the MIDI range (0-127) are removed,
+// and the number of removed notes is returned.
+func (m *Music) Transpose(semitones int) (dropped int) {
+	m.Lock()
+	defer m.Unlock()
+	m.changes++
+	for beat := range m.Notes {
+		transposed := make(map[int]Note)
+		for _, note := range m.Notes[beat] {
+			note.Pitch += semitones
+			if note.Pitch < 0 || note.Pitch > 127 {
+				dropped++
+				continue
+			}
+			transposed[note.Pitch] = note
+		}
+		if len(transposed) == 0 {
+			delete(m.Notes, beat)
+		} else {
+			m.Notes[beat] = transposed
+		}
+	}
+	added := m.added[:0]
+	for _, key := range m.added {
+		key.pitch += semitones
+		if key.pitch >= 0 && key.pitch <= 127 {
+			added = append(added, key)
+		}
+	}
+	m.added = added
+	for i := range m.inserted {
+		m.inserted[i].pitch += semitones
+	}
+	return
+}
+
+// Quantize moves every note towards the nearest multiple of grid ticks.
+// The optional strength, between 0 and 1 (the default), is how far the
+// notes are moved, so that some of the feel can be kept. Notes stay in
+// order, and a note is never moved onto another note of the same pitch:
+// it is placed just after it instead (a note-off at least a grid after).
+func (m *Music) Quantize(grid int, strength ...float64) {
+	if grid < 1 {
+		return
+	}
+	s := 1.0
+	if len(strength) > 0 {
+		s = math.Max(0, math.Min(1, strength[0]))
+	}
+	// the notes are read and put back under the one lock, so that
+	// none that are added in between are lost
+	m.Lock()
+	defer m.Unlock()
+	notes := Notes(m.getAll())
+	sort.Sort(notes)
+	m.changes++
+	m.Notes = make(map[int]map[int]Note)
+	last := make(map[int]int)
+	// where the notes were moved to, to keep the order they were added in
+	moved := make(map[noteKey]noteKey)
+	for _, note := range notes {
+		exact := note.ExactBeat()
+		nearest := int(math.Floor(exact/float64(grid)+0.5)) * grid
+		beat := int(math.Floor(exact + s*(float64(nearest)-exact) + 0.5))
+		if previous, ok := last[note.Pitch]; ok && beat <= previous {
+			if note.On {
+				beat = previous + 1
+			} else {
+				beat = previous + grid
+			}
+		}
+		last[note.Pitch] = beat
+		moved[noteKey{note.Beat, note.Pitch}] = noteKey{beat, note.Pitch}
+		note.Beat, note.Offset = beat, 0
+		if _, ok := m.Notes[beat]; !ok {
+			m.Notes[beat] = make(map[int]Note)
+		}
+		m.Notes[beat][note.Pitch] = note
+	}
+	added := m.added[:0]
+	for _, key := range m.added {
+		if key, ok := moved[key]; ok {
+			added = append(added, key)
+		}
+	}
+	m.added = added
+	for i, key := range m.inserted {
+		if key, ok := moved[key]; ok {
+			m.inserted[i] = key
+		}
+	}
+}
+
+// GetChords groups the notes (as returned by Consolidate) into chords,
+// in time order. A note belongs to a chord if it starts within tolerance
+// ticks of the first note of the chord, since people never play all
+// the notes of a chord at exactly the same time.
+func (m *Music) GetChords(tolerance int) (chords [][]Note) {
+	chords = [][]Note{}
+	for _, note := range m.Consolidate() {
+		if len(chords) > 0 && note.Beat-chords[len(chords)-1][0].Beat <= tolerance {
+			chords[len(chords)-1] = append(chords[len(chords)-1], note)
+			continue
+		}
+		chords = append(chords, []Note{note})
+	}
+	return
+}
+
+// Save writes the music to a file, making its directory if it has to.
+// The file is replaced all at once, and the version before it is kept
+// with BackupSuffix on the end if KeepBackup is set. With a name that
+// ends in ".gz" the file is compressed.
+func (m *Music) Save(filename string) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	var bMusic []byte
+	if len(m.Bends) > 0 {
+		bMusic, err = json.Marshal(savedMusic{m.Notes, m.Bends})
+	} else {
+		bMusic, err = json.Marshal(m.Notes)
+	}
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(filename, bMusic, 0755)
+	err = writeFile(filename, bMusic, KeepBackup)
+	if err == nil {
+		m.saved = m.changes
+	}
+	return
+}
+
+// Reset removes all the notes, starting the music over
+func (m *Music) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.Notes = make(map[int]map[int]Note)
+	m.Bends = nil
+	m.added = nil
+	m.inserted = nil
+	m.changes = 0
+	m.saved = 0
+}
+
+// Unsaved returns whether the notes have changed since they were last saved
+func (m *Music) Unsaved() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.changes != m.saved
+}
+
+func (m *Music) bpm() int {
+	if m.BPM <= 0 {
+		return DefaultBPM
+	}
+	return m.BPM
+}
+
+func (m *Music) timeSignature() (beatsPerBar, beatUnit int) {
+	beatsPerBar, beatUnit = m.BeatsPerBar, m.BeatUnit
+	if beatsPerBar <= 0 || beatUnit <= 0 {
+		beatsPerBar, beatUnit = 4, 4
+	}
+	return
+}
+
+func (m *Music) ticksPerBeat() int {
+	if m.TicksPerBeat <= 0 {
+		return DefaultTicksPerBeat
+	}
+	return m.TicksPerBeat
 }
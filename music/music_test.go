@@ -0,0 +1,319 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConsolidate(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 10})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 30})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 90, Beat: 40})
+	m.AddNote(Note{On: false, Pitch: 64, Beat: 50})
+	// never turned off
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 60, Beat: 45})
+	// never turned on
+	m.AddNote(Note{On: false, Pitch: 72, Beat: 20})
+
+	expected := []Note{
+		{On: true, Pitch: 60, Velocity: 80, Beat: 10, Duration: 20},
+		{On: true, Pitch: 64, Velocity: 70, Beat: 10, Duration: 30},
+		{On: true, Pitch: 64, Velocity: 90, Beat: 40, Duration: 10},
+		{On: true, Pitch: 67, Velocity: 60, Beat: 45, Duration: 5},
+	}
+	notes := m.Consolidate()
+	if len(notes) != len(expected) {
+		t.Fatalf("got %d notes, expected %d: %+v", len(notes), len(expected), notes)
+	}
+	for _, e := range expected {
+		found := false
+		for _, note := range notes {
+			if note == e {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %+v in %+v", e, notes)
+		}
+	}
+	if len(m.GetAll()) != 7 {
+		t.Errorf("Consolidate should not change the music")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	m := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.AddNote(Note{On: j%2 == 0, Pitch: 40 + i, Velocity: 64, Beat: j})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.GetAll()
+				m.Get(j)
+				m.HasFuture(j)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(m.GetAll()) != 50*100 {
+		t.Errorf("got %d notes, expected %d", len(m.GetAll()), 50*100)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: true, Pitch: 120, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 120, Beat: 10})
+	dropped := m.Transpose(10)
+	if dropped != 2 {
+		t.Errorf("dropped %d notes, expected 2", dropped)
+	}
+	notes := m.GetAll()
+	if len(notes) != 1 || notes[0].Pitch != 70 {
+		t.Errorf("got %+v", notes)
+	}
+	if _, ok := m.Notes[10]; ok {
+		t.Errorf("empty beats should be removed")
+	}
+
+	original := Notes{{On: true, Pitch: 60, Duration: 4}, {On: true, Pitch: 5, Duration: 4}}
+	transposed, dropped := original.Transpose(-7)
+	if dropped != 1 || len(transposed) != 1 || transposed[0].Pitch != 53 || original[0].Pitch != 60 {
+		t.Errorf("got %+v dropping %d from %+v", transposed, dropped, original)
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 3})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 9})
+	m.AddNote(Note{On: true, Pitch: 62, Velocity: 80, Beat: 14})
+	m.AddNote(Note{On: false, Pitch: 62, Beat: 20})
+	m.Quantize(16)
+	expected := map[int]int{0: 60, 16: 60}
+	for beat, pitch := range expected {
+		if _, ok := m.Notes[beat][pitch]; !ok {
+			t.Errorf("expected pitch %d at %d, got %+v", pitch, beat, m.Notes)
+		}
+	}
+	// the note-off of 62 can't be on the same beat as its note-on
+	if off, ok := m.Notes[32][62]; !ok || off.On || !m.Notes[16][62].On {
+		t.Errorf("expected pitch 62 from 16 to 32, got %+v", m.Notes)
+	}
+
+	m = New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 4})
+	m.Quantize(16, 0.5)
+	if _, ok := m.Notes[2][60]; !ok {
+		t.Errorf("expected half quantization to 2, got %+v", m.Notes)
+	}
+}
+
+func TestGetChords(t *testing.T) {
+	m := New()
+	// a C major triad played with a slight spread
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 100})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 80, Beat: 102})
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 104})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 200})
+	m.AddNote(Note{On: false, Pitch: 64, Beat: 201})
+	m.AddNote(Note{On: false, Pitch: 67, Beat: 202})
+	// followed by a single note
+	m.AddNote(Note{On: true, Pitch: 72, Velocity: 80, Beat: 250})
+	m.AddNote(Note{On: false, Pitch: 72, Beat: 300})
+
+	chords := m.GetChords(5)
+	if len(chords) != 2 {
+		t.Fatalf("got %d chords, expected 2: %+v", len(chords), chords)
+	}
+	if len(chords[0]) != 3 {
+		t.Errorf("got %d notes in the triad, expected 3: %+v", len(chords[0]), chords[0])
+	}
+	if len(chords[1]) != 1 || chords[1][0].Pitch != 72 {
+		t.Errorf("expected a single 72, got %+v", chords[1])
+	}
+	if len(m.GetChords(0)) != 4 {
+		t.Errorf("expected no grouping without a tolerance")
+	}
+}
+
+func TestUnsaved(t *testing.T) {
+	m := New()
+	if m.Unsaved() {
+		t.Errorf("new music has nothing to save")
+	}
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	if !m.Unsaved() {
+		t.Errorf("added note is not saved")
+	}
+	filename := filepath.Join(os.TempDir(), "pianoai_unsaved.json")
+	defer os.Remove(filename)
+	if err := m.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	if m.Unsaved() {
+		t.Errorf("music was just saved")
+	}
+	m.Transpose(1)
+	if !m.Unsaved() {
+		t.Errorf("transposed notes are not saved")
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 80, Beat: 20})
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 20})
+	m.AddNote(Note{On: true, Pitch: 62, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: false, Pitch: 62, Beat: 30})
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 5})
+	notes := m.GetRange(10, 30)
+	expected := []int{62, 60, 64}
+	if len(notes) != len(expected) {
+		t.Fatalf("got %+v", notes)
+	}
+	for i, pitch := range expected {
+		if notes[i].Pitch != pitch {
+			t.Errorf("expected %d at %d, got %+v", pitch, i, notes)
+		}
+	}
+	if notes := m.GetRange(40, 50); notes == nil || len(notes) != 0 {
+		t.Errorf("expected an empty slice, got %#v", notes)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 20})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 30})
+	lick := New()
+	lick.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 0})
+	lick.AddNote(Note{On: false, Pitch: 64, Beat: 10})
+	lick.AddNote(Note{On: true, Pitch: 60, Velocity: 70, Beat: 10})
+	if count := m.Merge(lick, 20); count != 4 {
+		t.Errorf("got %d notes, expected 4", count)
+	}
+	if m.Notes[20][64].Velocity != 70 || m.Notes[30][64].On {
+		t.Errorf("the lick should start at 20, got %+v", m.Notes)
+	}
+	// the note-off of the recording is kept
+	if m.Notes[20][60].Velocity != 80 || m.Notes[30][60].On {
+		t.Errorf("the recording should be unchanged, got %+v", m.Notes)
+	}
+	if count := m.Merge(m, 100); count != 8 {
+		t.Errorf("got %d notes after merging with itself, expected 8", count)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := New()
+	m.BPM, m.Key = 90, "D"
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 10, Source: AI})
+	m.AddNote(Note{On: false, Pitch: 64, Beat: 20, Source: AI})
+	m.AddBend(Bend{Beat: 5, Value: 100})
+	human := m.Filter(func(note Note) bool { return note.Source == Human })
+	notes := human.Consolidate()
+	if len(notes) != 1 || notes[0].Pitch != 60 || notes[0].Duration != 10 {
+		t.Errorf("expected only the human note, got %+v", notes)
+	}
+	if human.BPM != 90 || human.Key != "D" || len(human.AllBends()) != 1 {
+		t.Errorf("expected the rest of the music to be kept, got %+v", human)
+	}
+	if len(m.GetAll()) != 4 {
+		t.Errorf("expected the music to be left alone")
+	}
+}
+
+func TestRemoveLast(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 20})
+	// added late, but played before the note-off
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 80, Beat: 15})
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 30})
+	m.Transpose(1)
+	if removed := m.RemoveLast(2); removed != 2 {
+		t.Errorf("removed %d notes, expected 2", removed)
+	}
+	notes := m.GetAll()
+	if len(notes) != 2 || m.Notes[10][61].Pitch != 61 || m.Notes[15][65].Pitch != 65 {
+		t.Errorf("got %+v", m.Notes)
+	}
+	m.Quantize(8)
+	if removed := m.RemoveLast(1); removed != 1 || len(m.Notes[16]) != 0 || len(m.Notes[8]) != 1 {
+		t.Errorf("expected the quantized note at 16 to be removed, got %+v", m.Notes)
+	}
+	if removed := m.RemoveLast(5); removed != 1 || len(m.Notes) != 0 {
+		t.Errorf("removed %d notes, expected the last one: %+v", removed, m.Notes)
+	}
+}
+
+func TestQuantizeOffset(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Beat: 1, Offset: 0.5})
+	if beat := m.GetAll()[0].ExactBeat(); beat != 1.5 {
+		t.Errorf("expected the note at 1.5, got %f", beat)
+	}
+	// 1.5 is as near to 3 as to 0, where 1 would go
+	m.Quantize(3)
+	if note := m.GetAll()[0]; note.Beat != 3 || note.Offset != 0 {
+		t.Errorf("expected the note on tick 3 without its offset, got %+v", note)
+	}
+}
+
+func TestQuantizeWhileAdding(t *testing.T) {
+	m := New()
+	done := make(chan bool)
+	go func() {
+		for pitch := 0; pitch < 100; pitch++ {
+			m.AddNote(Note{On: true, Pitch: pitch, Beat: 3*pitch + 1})
+		}
+		close(done)
+	}()
+	for quantizing := true; quantizing; {
+		select {
+		case <-done:
+			quantizing = false
+		default:
+			m.Quantize(4)
+		}
+	}
+	if notes := m.GetAll(); len(notes) != 100 {
+		t.Errorf("expected none of the notes added while quantizing to be lost, got %d", len(notes))
+	}
+}
+
+func TestAddedSince(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 80, Beat: 20})
+	_, count := m.AddedSince(0)
+	// added late, before the notes there already are
+	m.AddNote(Note{On: true, Pitch: 62, Velocity: 80, Beat: 5})
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 30})
+	m.RemoveLast(1)
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 80, Beat: 30})
+	notes, total := m.AddedSince(count)
+	if total != 5 || len(notes) != 2 || notes[0].Beat != 5 || notes[1].Beat != 30 {
+		t.Errorf("expected the two notes added since, got %+v of %d", notes, total)
+	}
+	m.Reset()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	if notes, total = m.AddedSince(count); total != 1 || len(notes) != 1 {
+		t.Errorf("expected all of the notes after a reset, got %+v of %d", notes, total)
+	}
+}
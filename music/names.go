@@ -0,0 +1,59 @@
+package music
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MiddleCOctave is the octave that middle C (pitch 60) is in, which
+// is 4 in scientific pitch notation (C4) and 3 on some keyboards (C3)
+var MiddleCOctave = 4
+
+// sharpNames are the names of the pitch classes, with sharps
+var sharpNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// NoteName returns the name of a pitch, like "C4" or "F#5",
+// with the octaves numbered to follow MiddleCOctave
+func NoteName(pitch int) string {
+	octave := pitch/12 - 5 + MiddleCOctave
+	if pitch < 0 && pitch%12 != 0 {
+		octave--
+	}
+	return sharpNames[(pitch%12+12)%12] + strconv.Itoa(octave)
+}
+
+// PitchFromName returns the pitch of a name like "C4", "F#5", "Bb3"
+// or "c-1", with the octaves numbered to follow MiddleCOctave
+func PitchFromName(name string) (pitch int, err error) {
+	name = strings.TrimSpace(name)
+	split := strings.IndexAny(name, "-0123456789")
+	if split < 1 {
+		err = fmt.Errorf("'%s' is not a note name", name)
+		return
+	}
+	tonic, ok := KeyTonic(name[:split])
+	if !ok {
+		err = fmt.Errorf("'%s' is not a note name", name)
+		return
+	}
+	octave, err := strconv.Atoi(name[split:])
+	if err != nil {
+		err = fmt.Errorf("'%s' is not a note name", name)
+		return
+	}
+	// the accidentals can go over to the next octave, like B#3
+	letter, _ := KeyTonic(name[:1])
+	pitch = (octave+5-MiddleCOctave)*12 + letter + (tonic-letter+18)%12 - 6
+	if pitch < 0 || pitch > 127 {
+		err = fmt.Errorf("%s is out of the MIDI range", name)
+	}
+	return
+}
+
+// Frequency returns the frequency of a pitch in hertz,
+// in equal temperament with A4 (pitch 69) at 440 Hz
+func Frequency(pitch int) float64 {
+	return 440 * math.Pow(2, float64(pitch-69)/12)
+}
@@ -0,0 +1,42 @@
+package music
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNoteNames(t *testing.T) {
+	for pitch, name := range map[int]string{60: "C4", 78: "F#5", 21: "A0", 0: "C-1", 127: "G9"} {
+		if NoteName(pitch) != name {
+			t.Errorf("expected %s for %d, got %s", name, pitch, NoteName(pitch))
+		}
+		if p, err := PitchFromName(name); err != nil || p != pitch {
+			t.Errorf("expected %d for %s, got %d (%v)", pitch, name, p, err)
+		}
+	}
+	for name, pitch := range map[string]int{"Bb3": 58, "db4": 61, "B#3": 60, "Cb4": 59} {
+		if p, err := PitchFromName(name); err != nil || p != pitch {
+			t.Errorf("expected %d for %s, got %d (%v)", pitch, name, p, err)
+		}
+	}
+	for _, name := range []string{"", "H4", "C", "4", "C#x", "G#9"} {
+		if _, err := PitchFromName(name); err == nil {
+			t.Errorf("'%s' should not be a pitch", name)
+		}
+	}
+
+	MiddleCOctave = 3
+	defer func() {
+		MiddleCOctave = 4
+	}()
+	if NoteName(60) != "C3" {
+		t.Errorf("expected C3, got %s", NoteName(60))
+	}
+	if p, _ := PitchFromName("C3"); p != 60 {
+		t.Errorf("expected 60, got %d", p)
+	}
+
+	if math.Abs(Frequency(69)-440) > 1e-9 || math.Abs(Frequency(60)-261.6256) > 1e-3 {
+		t.Errorf("got %f and %f", Frequency(69), Frequency(60))
+	}
+}
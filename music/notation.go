@@ -0,0 +1,194 @@
+package music
+
+import (
+	"sort"
+	"strings"
+)
+
+// letters are the names of the white keys, from C
+const letters = "CDEFGAB"
+
+// spelling is how a pitch is written in a score: a letter, its
+// sharps (or flats, if negative) and the octave, where middle C is 4
+type spelling struct {
+	letter     byte
+	accidental int
+	octave     int
+}
+
+// keySpelling says how to write the pitches in a key
+type keySpelling struct {
+	// pitchClasses are the spellings of the pitch classes, without octave
+	pitchClasses [12]spelling
+	// signature is the accidental of each letter in the key signature
+	signature map[byte]int
+	// tonic is the letter and accidental of the key, and minor its mode
+	tonic spelling
+	minor bool
+}
+
+// newKeySpelling spells the scale of a key from its tonic letter, and
+// the notes outside of it with sharps, or with flats in the keys that
+// have flats. Keys that are not recognized are spelled as C major.
+func newKeySpelling(key, mode string) (ks keySpelling) {
+	tonic, ok := KeyTonic(key)
+	if !ok {
+		key, tonic = "C", 0
+	}
+	ks.minor = strings.ToLower(mode) == "minor"
+	intervals := modeIntervals["major"]
+	if ks.minor {
+		intervals = modeIntervals["minor"]
+	}
+	ks.signature = make(map[byte]int)
+	first := strings.IndexByte(letters, strings.ToUpper(key[:1])[0])
+	inScale := [12]bool{}
+	flats := false
+	for degree, interval := range intervals {
+		letter := letters[(first+degree)%7]
+		pc := (tonic + interval) % 12
+		accidental := ((pc-noteOffsets[letter])%12 + 12) % 12
+		if accidental > 6 {
+			accidental -= 12
+		}
+		ks.signature[letter] = accidental
+		ks.pitchClasses[pc] = spelling{letter: letter, accidental: accidental}
+		inScale[pc] = true
+		flats = flats || accidental < 0
+		if degree == 0 {
+			ks.tonic = ks.pitchClasses[pc]
+		}
+	}
+	for pc := 0; pc < 12; pc++ {
+		if inScale[pc] {
+			continue
+		}
+		below, above := ks.pitchClasses[(pc+11)%12], ks.pitchClasses[(pc+1)%12]
+		sharp := spelling{letter: below.letter, accidental: below.accidental + 1}
+		flat := spelling{letter: above.letter, accidental: above.accidental - 1}
+		// whichever needs fewer accidentals, such as B natural rather
+		// than C flat in F major
+		switch {
+		case !inScale[(pc+11)%12] || abs(flat.accidental) < abs(sharp.accidental):
+			ks.pitchClasses[pc] = flat
+		case !inScale[(pc+1)%12] || abs(sharp.accidental) < abs(flat.accidental):
+			ks.pitchClasses[pc] = sharp
+		case flats:
+			ks.pitchClasses[pc] = flat
+		default:
+			ks.pitchClasses[pc] = sharp
+		}
+	}
+	return
+}
+
+// spell returns how a pitch is written in the key
+func (ks keySpelling) spell(pitch int) (s spelling) {
+	s = ks.pitchClasses[(pitch%12+12)%12]
+	natural := pitch - s.accidental - noteOffsets[s.letter]
+	s.octave = natural/12 - 1
+	return
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// scoreEvent is a note, a chord or a rest of a score, as a number of
+// sixteenth notes. A note is tied to the next one when it goes on
+// over the bar line.
+type scoreEvent struct {
+	// pitches are in order from the lowest, and none for a rest
+	pitches []int
+	length  int
+	tied    bool
+}
+
+// scoreBars turns the notes into the bars of a score, on a grid of
+// sixteenth notes. The notes that start together are a chord, which
+// is cut short when the next note starts, and gaps become rests.
+func (m *Music) scoreBars() (bars [][]scoreEvent) {
+	notes := m.Consolidate()
+	m.RLock()
+	sixteenth := m.ticksPerBeat() / 4
+	beatsPerBar, beatUnit := m.timeSignature()
+	m.RUnlock()
+	if sixteenth < 1 {
+		sixteenth = 1
+	}
+	barLength := beatsPerBar * 16 / beatUnit
+	if barLength < 1 {
+		barLength = 1
+	}
+
+	// the chords by the sixteenth they start on,
+	// and the sixteenth the shortest of their notes ends
+	chords := make(map[int][]int)
+	ends := make(map[int]int)
+	for _, note := range notes {
+		start := (note.Beat + sixteenth/2) / sixteenth
+		end := (note.Beat + note.Duration + sixteenth/2) / sixteenth
+		if end <= start {
+			end = start + 1
+		}
+		if _, ok := chords[start]; !ok || end < ends[start] {
+			ends[start] = end
+		}
+		found := false
+		for _, pitch := range chords[start] {
+			found = found || pitch == note.Pitch
+		}
+		if !found {
+			chords[start] = append(chords[start], note.Pitch)
+		}
+	}
+	starts := make([]int, 0, len(chords))
+	for start := range chords {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	// the events one after another, before they are split into bars
+	events := []scoreEvent{}
+	position := 0
+	for i, start := range starts {
+		if start > position {
+			events = append(events, scoreEvent{length: start - position})
+		}
+		end := ends[start]
+		if i+1 < len(starts) && starts[i+1] < end {
+			end = starts[i+1]
+		}
+		pitches := chords[start]
+		sort.Ints(pitches)
+		events = append(events, scoreEvent{pitches: pitches, length: end - start})
+		position = end
+	}
+	if position%barLength != 0 {
+		events = append(events, scoreEvent{length: barLength - position%barLength})
+	}
+
+	bar := []scoreEvent{}
+	filled := 0
+	for _, event := range events {
+		for event.length > 0 {
+			part := event
+			if filled+part.length > barLength {
+				part.length = barLength - filled
+				part.tied = len(part.pitches) > 0
+			}
+			bar = append(bar, part)
+			filled += part.length
+			event.length -= part.length
+			if filled == barLength {
+				bars = append(bars, bar)
+				bar = []scoreEvent{}
+				filled = 0
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,202 @@
+package music
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// PianoRollOptions change how RenderPianoRoll draws the notes
+type PianoRollOptions struct {
+	// PixelsPerBeat is the width of a beat (16 by default), which is
+	// made smaller if the picture would be wider than MaxWidth
+	PixelsPerBeat float64
+	MaxWidth      int
+	// RowHeight is the height of each pitch (4 by default)
+	RowHeight int
+	// ColorByChannel gives every MIDI channel its own color, instead
+	// of drawing all the notes in blue
+	ColorByChannel bool
+}
+
+const (
+	// pianoRollMargin is the space on the left for the names of the octaves
+	pianoRollMargin = 16
+	// glyphWidth and glyphHeight are the size of the letters of the labels
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+var (
+	pianoRollBackground = color.RGBA{255, 255, 255, 255}
+	pianoRollBlackKey   = color.RGBA{238, 238, 238, 255}
+	pianoRollLine       = color.RGBA{210, 210, 210, 255}
+	pianoRollLabel      = color.RGBA{80, 80, 80, 255}
+	// channelColors are the colors of the channels for ColorByChannel
+	channelColors = []color.RGBA{
+		{31, 119, 180, 255}, {255, 127, 14, 255}, {44, 160, 44, 255}, {214, 39, 40, 255},
+		{148, 103, 189, 255}, {140, 86, 75, 255}, {227, 119, 194, 255}, {127, 127, 127, 255},
+		{188, 189, 34, 255}, {23, 190, 207, 255}, {0, 0, 128, 255}, {128, 0, 0, 255},
+		{0, 128, 0, 255}, {128, 128, 0, 255}, {0, 128, 128, 255}, {64, 64, 64, 255},
+	}
+)
+
+// glyphs are the letters of the labels, three pixels wide and five
+// high, one row a line from the top
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"##.", "..#", ".#.", "#..", "###"},
+	'3': {"##.", "..#", ".#.", "..#", "##."},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "##.", "..#", "##."},
+	'6': {".##", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "##."},
+	'-': {"...", "...", "###", "...", "..."},
+	'C': {".##", "#..", "#..", "#..", ".##"},
+	'E': {"###", "#..", "##.", "#..", "###"},
+	'N': {"#.#", "###", "###", "#.#", "#.#"},
+	'O': {".#.", "#.#", "#.#", "#.#", ".#."},
+	'S': {".##", "#..", ".#.", "..#", "##."},
+	'T': {"###", ".#.", ".#.", ".#.", ".#."},
+}
+
+// RenderPianoRoll draws the notes as a piano roll to a PNG file, with
+// the pitches going up and the beats going to the right. Each note is
+// a bar as long as it is held, and the louder it is played the darker
+// it is. Music with no notes is drawn as an empty octave that says so.
+func (m *Music) RenderPianoRoll(filename string, opts ...PianoRollOptions) (err error) {
+	opt := PianoRollOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.PixelsPerBeat <= 0 {
+		opt.PixelsPerBeat = 16
+	}
+	if opt.MaxWidth <= 0 {
+		opt.MaxWidth = 8192
+	}
+	if opt.RowHeight <= 0 {
+		opt.RowHeight = 4
+	}
+
+	notes := m.Consolidate()
+	m.RLock()
+	ticksPerBeat := m.ticksPerBeat()
+	m.RUnlock()
+	// whole octaves, from a C to a B
+	low, high, lastTick := 60, 71, 4*ticksPerBeat
+	for i, note := range notes {
+		if i == 0 || note.Pitch < low {
+			low = note.Pitch
+		}
+		if i == 0 || note.Pitch > high {
+			high = note.Pitch
+		}
+		if note.Beat+note.Duration > lastTick {
+			lastTick = note.Beat + note.Duration
+		}
+	}
+	low -= ((low % 12) + 12) % 12
+	high += 11 - ((high%12)+12)%12
+
+	pixelsPerTick := opt.PixelsPerBeat / float64(ticksPerBeat)
+	if float64(lastTick)*pixelsPerTick > float64(opt.MaxWidth-pianoRollMargin) {
+		pixelsPerTick = float64(opt.MaxWidth-pianoRollMargin) / float64(lastTick)
+	}
+	width := pianoRollMargin + int(float64(lastTick)*pixelsPerTick) + 1
+	height := (high - low + 1) * opt.RowHeight
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill := func(x0, y0, x1, y1 int, c color.RGBA) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	// the row of a pitch, from the top
+	row := func(pitch int) int {
+		return (high - pitch) * opt.RowHeight
+	}
+
+	fill(0, 0, width, height, pianoRollBackground)
+	for pitch := low; pitch <= high; pitch++ {
+		if isBlackKey(pitch) {
+			fill(pianoRollMargin, row(pitch), width, row(pitch)+opt.RowHeight, pianoRollBlackKey)
+		}
+		if pitch%12 == 0 {
+			fill(pianoRollMargin, row(pitch)+opt.RowHeight-1, width, row(pitch)+opt.RowHeight, pianoRollLine)
+			y := row(pitch) + opt.RowHeight - glyphHeight
+			if y < 0 {
+				y = 0
+			}
+			drawLabel(img, 1, y, NoteName(pitch))
+		}
+	}
+	for tick := 0; tick <= lastTick; tick += ticksPerBeat {
+		x := pianoRollMargin + int(float64(tick)*pixelsPerTick)
+		fill(x, 0, x+1, height, pianoRollLine)
+	}
+
+	if len(notes) == 0 {
+		drawLabel(img, pianoRollMargin+2, 1, "NO NOTES")
+	}
+	for _, note := range notes {
+		x0 := pianoRollMargin + int(float64(note.Beat)*pixelsPerTick)
+		x1 := pianoRollMargin + int(float64(note.Beat+note.Duration)*pixelsPerTick)
+		if x1 <= x0 {
+			x1 = x0 + 1
+		}
+		base := channelColors[0]
+		if opt.ColorByChannel {
+			base = channelColors[note.Channel&0x0F]
+		}
+		fill(x0, row(note.Pitch), x1, row(note.Pitch)+opt.RowHeight, velocityColor(base, note.Velocity))
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+// isBlackKey returns whether a pitch is a black key of the piano
+func isBlackKey(pitch int) bool {
+	switch ((pitch % 12) + 12) % 12 {
+	case 1, 3, 6, 8, 10:
+		return true
+	}
+	return false
+}
+
+// velocityColor fades a color towards white for quieter notes
+func velocityColor(c color.RGBA, velocity int) color.RGBA {
+	amount := 0.25 + 0.75*float64(clampVelocity(velocity))/127
+	fade := func(v uint8) uint8 {
+		return uint8(255 - amount*float64(255-v))
+	}
+	return color.RGBA{fade(c.R), fade(c.G), fade(c.B), 255}
+}
+
+// drawLabel writes text with the glyphs, with its top left at x, y
+func drawLabel(img *image.RGBA, x, y int, text string) {
+	for _, r := range strings.ToUpper(text) {
+		glyph, ok := glyphs[r]
+		if ok {
+			for row, line := range glyph {
+				for col, pixel := range line {
+					if pixel == '#' {
+						img.SetRGBA(x+col, y+row, pianoRollLabel)
+					}
+				}
+			}
+		}
+		x += glyphWidth + 1
+	}
+}
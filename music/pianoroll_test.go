@@ -0,0 +1,47 @@
+package music
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderPianoRoll(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "pianoai_pianoroll.png")
+	defer os.Remove(filename)
+
+	m := New()
+	m.TicksPerBeat = 4
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 127, Beat: 0})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 8})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 40, Beat: 8, Channel: 1})
+	m.AddNote(Note{On: false, Pitch: 64, Beat: 12})
+	if err := m.RenderPianoRoll(filename, PianoRollOptions{PixelsPerBeat: 4, RowHeight: 2, ColorByChannel: true}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one octave of rows and four beats
+	if img.Bounds().Dx() != pianoRollMargin+16+1 || img.Bounds().Dy() != 12*2 {
+		t.Fatalf("got size %v", img.Bounds())
+	}
+	// C4 is the bottom row
+	if c := img.At(pianoRollMargin+4, 23); c != velocityColor(channelColors[0], 127) {
+		t.Errorf("expected the C, got %v", c)
+	}
+	if c := img.At(pianoRollMargin+9, 12*2-4*2-1); c != velocityColor(channelColors[1], 40) {
+		t.Errorf("expected the E, got %v", c)
+	}
+
+	if err := New().RenderPianoRoll(filename); err != nil {
+		t.Errorf("an empty piano roll should be drawn, got %s", err.Error())
+	}
+}
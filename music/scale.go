@@ -0,0 +1,87 @@
+package music
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scale is a set of pitch classes, as the semitones above the tonic
+// (from 0 to 11). A Scale without any Intervals is no scale at all.
+type Scale struct {
+	Name      string
+	Intervals []int
+}
+
+// Scales are the named scales, including the modes of the major scale
+var Scales = map[string]Scale{
+	"major":            {"major", modeIntervals["major"]},
+	"minor":            {"minor", modeIntervals["minor"]},
+	"ionian":           {"ionian", []int{0, 2, 4, 5, 7, 9, 11}},
+	"dorian":           {"dorian", []int{0, 2, 3, 5, 7, 9, 10}},
+	"phrygian":         {"phrygian", []int{0, 1, 3, 5, 7, 8, 10}},
+	"lydian":           {"lydian", []int{0, 2, 4, 6, 7, 9, 11}},
+	"mixolydian":       {"mixolydian", []int{0, 2, 4, 5, 7, 9, 10}},
+	"aeolian":          {"aeolian", []int{0, 2, 3, 5, 7, 8, 10}},
+	"locrian":          {"locrian", []int{0, 1, 3, 5, 6, 8, 10}},
+	"harmonic minor":   {"harmonic minor", []int{0, 2, 3, 5, 7, 8, 11}},
+	"melodic minor":    {"melodic minor", []int{0, 2, 3, 5, 7, 9, 11}},
+	"major pentatonic": {"major pentatonic", []int{0, 2, 4, 7, 9}},
+	"minor pentatonic": {"minor pentatonic", []int{0, 3, 5, 7, 10}},
+	"blues":            {"blues", []int{0, 3, 5, 6, 7, 10}},
+	"whole tone":       {"whole tone", []int{0, 2, 4, 6, 8, 10}},
+	"hirajoshi":        {"hirajoshi", []int{0, 2, 3, 7, 8}},
+}
+
+// ParseScale returns the scale with a name (see Scales), or a custom
+// scale from a list of intervals like "0,2,3,7,8"
+func ParseScale(s string) (scale Scale, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	scale, ok := Scales[s]
+	if ok {
+		return
+	}
+	scale = Scale{Name: s}
+	for _, field := range strings.Split(s, ",") {
+		var interval int
+		interval, err = strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			err = fmt.Errorf("unknown scale '%s'", s)
+			return
+		}
+		scale.Intervals = append(scale.Intervals, (interval%12+12)%12)
+	}
+	sort.Ints(scale.Intervals)
+	return
+}
+
+// Contains returns whether a pitch is in the scale on a tonic (the
+// pitch class of the key, 0 = C), which is always true for no scale
+func (s Scale) Contains(pitch int, tonic int) bool {
+	if len(s.Intervals) == 0 {
+		return true
+	}
+	pc := ((pitch-tonic)%12 + 12) % 12
+	for _, interval := range s.Intervals {
+		if pc == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Snap moves a pitch to the nearest pitch in the scale on a tonic,
+// preferring the lower pitch when two are equally near, and never
+// past the lowest or highest MIDI pitch
+func (s Scale) Snap(pitch int, tonic int) int {
+	for distance := 0; distance < 12; distance++ {
+		if pitch-distance >= 0 && s.Contains(pitch-distance, tonic) {
+			return pitch - distance
+		}
+		if pitch+distance <= 127 && s.Contains(pitch+distance, tonic) {
+			return pitch + distance
+		}
+	}
+	return pitch
+}
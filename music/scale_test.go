@@ -0,0 +1,33 @@
+package music
+
+import "testing"
+
+func TestScale(t *testing.T) {
+	dorian, err := ParseScale("Dorian")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// D dorian has the notes of C major
+	for pitch := 60; pitch < 72; pitch++ {
+		if dorian.Contains(pitch, 2) != Scales["major"].Contains(pitch, 0) {
+			t.Errorf("D dorian and C major differ on %d", pitch)
+		}
+	}
+	if dorian.Snap(66, 2) != 65 || dorian.Snap(68, 2) != 67 {
+		t.Errorf("expected F# to G and G# to G, got %d and %d", dorian.Snap(66, 2), dorian.Snap(68, 2))
+	}
+
+	custom, err := ParseScale("0, 7, 16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(custom.Intervals) != 3 || custom.Intervals[1] != 4 || !custom.Contains(52, 0) || custom.Contains(53, 0) {
+		t.Errorf("got %+v", custom)
+	}
+	if _, err = ParseScale("dorain"); err == nil {
+		t.Errorf("expected an unknown scale")
+	}
+	if !(Scale{}).Contains(61, 0) {
+		t.Errorf("no scale should contain every pitch")
+	}
+}
@@ -0,0 +1,48 @@
+package music
+
+import "fmt"
+
+// Source is where a note came from. The zero Source is Human, so the
+// notes of histories that were saved without one are from the keyboard.
+type Source int
+
+const (
+	// Human is a note played on the keyboard
+	Human Source = iota
+	// AI is a note the AI made up
+	AI
+	// Metronome is a click of the metronome
+	Metronome
+	// Accompaniment is a note of the bass, the arpeggiator or a loop
+	Accompaniment
+	// Echo is a repeat of a note played on the keyboard
+	Echo
+)
+
+var sourceNames = []string{"human", "ai", "metronome", "accompaniment", "echo"}
+
+func (s Source) String() string {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return fmt.Sprintf("source %d", int(s))
+	}
+	return sourceNames[s]
+}
+
+// MarshalText saves a Source by its name
+func (s Source) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return nil, fmt.Errorf("unknown %s", s)
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText reads a Source from its name
+func (s *Source) UnmarshalText(text []byte) error {
+	for i, name := range sourceNames {
+		if name == string(text) {
+			*s = Source(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown source '%s'", text)
+}
@@ -0,0 +1,34 @@
+package music
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	var note Note
+	if err := json.Unmarshal([]byte(`{"On":true,"Pitch":60,"Velocity":80,"Beat":0}`), &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Source != Human {
+		t.Errorf("expected an old note to be from a human, got %s", note.Source)
+	}
+
+	b, _ := json.Marshal(note)
+	if strings.Contains(string(b), "Source") {
+		t.Errorf("expected no source for a human, got %s", b)
+	}
+	note.Source = AI
+	b, _ = json.Marshal(note)
+	if !strings.Contains(string(b), `"Source":"ai"`) {
+		t.Errorf("expected the source by name, got %s", b)
+	}
+	var loaded Note
+	if err := json.Unmarshal(b, &loaded); err != nil || loaded != note {
+		t.Errorf("expected %+v, got %+v (%v)", note, loaded, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Source":"robot"}`), &loaded); err == nil {
+		t.Errorf("expected an unknown source to fail")
+	}
+}
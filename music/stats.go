@@ -0,0 +1,51 @@
+package music
+
+// Stats sums up some music
+type Stats struct {
+	// Notes is the number of notes played, and Pitches
+	// is the number of different pitches among them
+	Notes   int
+	Pitches int
+	// LowestPitch and HighestPitch are the range of the notes
+	LowestPitch  int
+	HighestPitch int
+	// Beats is how long the music is, from the start of
+	// the first note to the end of the last one
+	Beats float64
+	// AverageVelocity is the average velocity of the notes
+	AverageVelocity float64
+}
+
+// Stats returns the statistics of the music, which are all zero
+// if there are no notes
+func (m *Music) Stats() (stats Stats) {
+	notes := m.Consolidate()
+	if len(notes) == 0 {
+		return
+	}
+	m.RLock()
+	ticksPerBeat := m.ticksPerBeat()
+	m.RUnlock()
+	pitches := make(map[int]bool)
+	stats.LowestPitch, stats.HighestPitch = notes[0].Pitch, notes[0].Pitch
+	start, end := notes[0].Beat, notes[0].Beat
+	velocities := 0
+	for _, note := range notes {
+		pitches[note.Pitch] = true
+		if note.Pitch < stats.LowestPitch {
+			stats.LowestPitch = note.Pitch
+		}
+		if note.Pitch > stats.HighestPitch {
+			stats.HighestPitch = note.Pitch
+		}
+		if note.Beat+note.Duration > end {
+			end = note.Beat + note.Duration
+		}
+		velocities += note.Velocity
+	}
+	stats.Notes = len(notes)
+	stats.Pitches = len(pitches)
+	stats.Beats = float64(end-start) / float64(ticksPerBeat)
+	stats.AverageVelocity = float64(velocities) / float64(len(notes))
+	return
+}
@@ -0,0 +1,21 @@
+package music
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	m := New()
+	if stats := m.Stats(); stats != (Stats{}) {
+		t.Errorf("expected no stats for no music, got %+v", stats)
+	}
+	m.TicksPerBeat = 10
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 20})
+	m.AddNote(Note{On: true, Pitch: 67, Velocity: 60, Beat: 20})
+	m.AddNote(Note{On: false, Pitch: 67, Beat: 40})
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 70, Beat: 40})
+	m.AddNote(Note{On: false, Pitch: 60, Beat: 50})
+	expected := Stats{Notes: 3, Pitches: 2, LowestPitch: 60, HighestPitch: 67, Beats: 4, AverageVelocity: 70}
+	if stats := m.Stats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
@@ -0,0 +1,123 @@
+package music
+
+// SwingTick returns the tick that a tick is moved to when the music
+// swings on a grid of subdivision ticks. Every pair of subdivisions is
+// stretched so that the off beat comes swing × half a subdivision late,
+// and the ticks in between are moved along with it, so that a swing of
+// 0.66 is about the 2:1 of a shuffle.
+func SwingTick(tick, subdivision int, swing float64) int {
+	if swing <= 0 || subdivision < 2 {
+		return tick
+	}
+	if swing > 1 {
+		swing = 1
+	}
+	s := float64(subdivision)
+	d := swing * s / 2
+	pair := ((tick % (2 * subdivision)) + 2*subdivision) % (2 * subdivision)
+	x := float64(pair)
+	var swung float64
+	if x < s {
+		swung = x * (s + d) / s
+	} else {
+		swung = s + d + (x-s)*(s-d)/s
+	}
+	return tick - pair + int(swung+0.5)
+}
+
+// StraightTick is the opposite of SwingTick, returning the tick
+// that a tick of swung music would be on if it did not swing (to
+// within a tick, as SwingTick rounds to the nearest tick)
+func StraightTick(tick, subdivision int, swing float64) int {
+	if swing <= 0 || subdivision < 2 {
+		return tick
+	}
+	if swing > 1 {
+		swing = 1
+	}
+	s := float64(subdivision)
+	d := swing * s / 2
+	pair := ((tick % (2 * subdivision)) + 2*subdivision) % (2 * subdivision)
+	y := float64(pair)
+	var straight float64
+	if y < s+d {
+		straight = y * s / (s + d)
+	} else {
+		straight = s + (y-s-d)*s/(s-d)
+	}
+	return tick - pair + int(straight+0.5)
+}
+
+// minSwingNotes is the fewest notes on the off beats that
+// DetectSwing finds the swing from
+const minSwingNotes = 4
+
+// DetectSwing returns how much the notes swing (see SwingTick) on a
+// grid of subdivision ticks, from how late the ones played on the off
+// beats come, or 0 if there are too few of them to tell
+func (p Notes) DetectSwing(subdivision int) (swing float64) {
+	if subdivision < 2 {
+		return
+	}
+	s := float64(subdivision)
+	late, offBeats := 0.0, 0
+	for _, note := range p {
+		if !note.On {
+			continue
+		}
+		pair := ((note.Beat % (2 * subdivision)) + 2*subdivision) % (2 * subdivision)
+		y := float64(pair) + note.Offset
+		// up to a quarter of a subdivision early, or as late as it swings
+		if y < 0.75*s || y > 1.75*s {
+			continue
+		}
+		late += y - s
+		offBeats++
+	}
+	if offBeats < minSwingNotes {
+		return
+	}
+	swing = 2 * late / float64(offBeats) / s
+	if swing < 0 {
+		swing = 0
+	} else if swing > 1 {
+		swing = 1
+	}
+	return
+}
+
+// Swung returns a copy of the notes moved by SwingTick, keeping
+// them at least a tick long
+func (p Notes) Swung(subdivision int, swing float64) Notes {
+	return p.moved(func(tick int) int { return SwingTick(tick, subdivision, swing) })
+}
+
+// Straightened returns a copy of the notes moved by StraightTick,
+// keeping them at least a tick long
+func (p Notes) Straightened(subdivision int, swing float64) Notes {
+	return p.moved(func(tick int) int { return StraightTick(tick, subdivision, swing) })
+}
+
+// moved returns a copy of the notes (in order) on the ticks they are
+// moved to, with the note-offs kept after their note-ons
+func (p Notes) moved(move func(tick int) int) (moved Notes) {
+	moved = make(Notes, len(p))
+	onBeats := make(map[int]int)
+	for i, note := range p {
+		beat := move(note.Beat)
+		if note.On {
+			onBeats[note.Pitch] = beat
+		} else if onBeat, ok := onBeats[note.Pitch]; ok && beat <= onBeat {
+			beat = onBeat + 1
+		}
+		if note.Duration > 0 {
+			note.Duration = move(note.Beat+note.Duration) - beat
+			if note.Duration < 1 {
+				note.Duration = 1
+			}
+		}
+		note.Beat, note.Offset = beat, 0
+		moved[i] = note
+	}
+	return
+}
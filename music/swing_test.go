@@ -0,0 +1,36 @@
+package music
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSwing(t *testing.T) {
+	for tick := -64; tick < 128; tick++ {
+		if straight := StraightTick(SwingTick(tick, 32, 0.66), 32, 0.66); straight < tick-1 || straight > tick+1 {
+			t.Errorf("expected %d back from swinging it, got %d", tick, straight)
+		}
+	}
+	if tick := SwingTick(32, 32, 0.5); tick != 40 {
+		t.Errorf("expected the off beat a quarter of an eighth late, got %d", tick)
+	}
+
+	// straight eighths, swung
+	straight := Notes{}
+	for beat := 0; beat < 8*64; beat += 32 {
+		straight = append(straight, Note{On: true, Pitch: 60, Beat: beat, Duration: 16}, Note{Pitch: 60, Beat: beat + 16})
+	}
+	swung := straight.Swung(32, 0.66)
+	// to within the tick that the off beats are rounded to
+	if swing := swung.DetectSwing(32); math.Abs(swing-0.66) > 2.0/32 {
+		t.Errorf("expected a swing of 0.66, got %f", swing)
+	}
+	if swing := straight.DetectSwing(32); swing != 0 {
+		t.Errorf("expected straight eighths not to swing, got %f", swing)
+	}
+	for i, note := range swung.Straightened(32, 0.66) {
+		if note.Beat < straight[i].Beat-1 || note.Beat > straight[i].Beat+1 || note.On != straight[i].On {
+			t.Errorf("expected %+v back after straightening, got %+v", straight[i], note)
+		}
+	}
+}
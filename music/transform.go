@@ -0,0 +1,129 @@
+package music
+
+import (
+	"fmt"
+	"math"
+)
+
+// Retrograde returns new music with the notes in reverse order, over
+// the same beats as the music: the last note to end starts first. The
+// durations and velocities are kept, but not the bends, since a bend
+// holds until the next one and so can not be run backwards.
+func (m *Music) Retrograde() *Music {
+	notes := m.Consolidate()
+	start, end := 0, 0
+	for i, note := range notes {
+		if i == 0 || note.Beat < start {
+			start = note.Beat
+		}
+		if note.Beat+note.Duration > end {
+			end = note.Beat + note.Duration
+		}
+	}
+	for i := range notes {
+		notes[i].Beat = start + end - notes[i].Beat - notes[i].Duration
+	}
+	m.RLock()
+	retrograde := m.withoutNotes()
+	m.RUnlock()
+	retrograde.addPlayed(notes)
+	return retrograde
+}
+
+// Invert returns new music with every pitch mirrored around an axis,
+// so that a note a third above the axisPitch is a third below it. The
+// notes that end up outside of the MIDI range (0-127) are left out.
+// The durations and velocities are kept, and the bends go the other way.
+func (m *Music) Invert(axisPitch int) *Music {
+	notes := Notes{}
+	for _, note := range m.Consolidate() {
+		note.Pitch = 2*axisPitch - note.Pitch
+		if note.Pitch >= 0 && note.Pitch <= 127 {
+			notes = append(notes, note)
+		}
+	}
+	m.RLock()
+	inverted := m.withoutNotes()
+	for beat, bends := range m.Bends {
+		if inverted.Bends == nil {
+			inverted.Bends = make(map[int][]Bend)
+		}
+		for _, bend := range bends {
+			bend.Value = -bend.Value
+			if bend.Value > MaxBend {
+				bend.Value = MaxBend
+			}
+			inverted.Bends[beat] = append(inverted.Bends[beat], bend)
+		}
+	}
+	m.RUnlock()
+	inverted.addPlayed(notes)
+	return inverted
+}
+
+// Augment returns new music with its rhythm stretched by a factor from
+// its first note, so that 2 doubles the length of the notes and the gaps
+// between them and 0.5 halves them. The beats are rounded to the nearest
+// tick, and every note lasts a tick at least. It is an error for the
+// factor to put notes that started on different ticks onto the same one.
+func (m *Music) Augment(factor float64) (augmented *Music, err error) {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return nil, fmt.Errorf("can not augment by %g", factor)
+	}
+	notes := m.Consolidate()
+	start := 0
+	if len(notes) > 0 {
+		start = notes[0].Beat
+	}
+	stretch := func(beat int) int {
+		return start + int(math.Floor(float64(beat-start)*factor+0.5))
+	}
+	stretched := make(map[int]int)
+	for i, note := range notes {
+		notes[i].Beat = stretch(note.Beat)
+		if other, ok := stretched[notes[i].Beat]; ok && other != note.Beat {
+			return nil, fmt.Errorf("augmenting by %g puts the notes of %d and %d on the same tick", factor, other, note.Beat)
+		}
+		stretched[notes[i].Beat] = note.Beat
+		notes[i].Duration = stretch(note.Beat+note.Duration) - notes[i].Beat
+		if notes[i].Duration < 1 {
+			notes[i].Duration = 1
+		}
+	}
+	m.RLock()
+	augmented = m.withoutNotes()
+	m.RUnlock()
+	// in order, so that the last of the bends that end up
+	// on the same tick is the one that is kept
+	for _, bend := range m.AllBends() {
+		bend.Beat = stretch(bend.Beat)
+		augmented.AddBend(bend)
+	}
+	augmented.addPlayed(notes)
+	return
+}
+
+// withoutNotes returns new music with everything about the music, such
+// as its BPM, but none of its notes, and must be called with the lock held
+func (m *Music) withoutNotes() *Music {
+	other := New()
+	other.BPM, other.TicksPerBeat = m.BPM, m.TicksPerBeat
+	other.Key, other.Mode = m.Key, m.Mode
+	other.BeatsPerBar, other.BeatUnit = m.BeatsPerBar, m.BeatUnit
+	return other
+}
+
+// addPlayed adds consolidated notes as their note-ons and note-offs.
+// The note-ons go first, so that a note that starts where the same
+// pitch ends is kept rather than its note-off.
+func (m *Music) addPlayed(notes Notes) {
+	m.Lock()
+	defer m.Unlock()
+	for _, note := range notes {
+		note.Duration = 0
+		m.addNote(note)
+	}
+	for _, note := range notes {
+		m.addNote(Note{Pitch: note.Pitch, Beat: note.Beat + note.Duration, Channel: note.Channel, Source: note.Source})
+	}
+}
@@ -0,0 +1,92 @@
+package music
+
+import "testing"
+
+func TestRetrograde(t *testing.T) {
+	m := New()
+	m.BPM = 90
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 50, Beat: 10})
+	m.AddNote(Note{Pitch: 60, Beat: 20})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 20})
+	m.AddNote(Note{Pitch: 64, Beat: 50})
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 90, Beat: 50})
+	m.AddNote(Note{Pitch: 60, Beat: 60})
+	retrograde := m.Retrograde()
+	notes := retrograde.Consolidate()
+	expected := []Note{
+		{On: true, Pitch: 60, Velocity: 90, Beat: 10, Duration: 10},
+		{On: true, Pitch: 64, Velocity: 70, Beat: 20, Duration: 30},
+		{On: true, Pitch: 60, Velocity: 50, Beat: 50, Duration: 10},
+	}
+	if len(notes) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, notes)
+	}
+	for i := range expected {
+		if notes[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], notes[i])
+		}
+	}
+	if retrograde.BPM != 90 || len(m.Consolidate()) != 3 || m.Consolidate()[0].Velocity != 50 {
+		t.Error("expected the BPM to be kept and the music to be left alone")
+	}
+}
+
+func TestInvert(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 50, Beat: 0})
+	m.AddNote(Note{Pitch: 60, Beat: 10})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 10})
+	m.AddNote(Note{Pitch: 64, Beat: 30})
+	m.AddNote(Note{On: true, Pitch: 5, Velocity: 70, Beat: 10})
+	m.AddNote(Note{Pitch: 5, Beat: 30})
+	m.AddBend(Bend{Beat: 10, Value: 100})
+	inverted := m.Invert(62)
+	notes := inverted.Consolidate()
+	pitches := make(map[int]Note)
+	for _, note := range notes {
+		pitches[note.Pitch] = note
+	}
+	if len(notes) != 3 || pitches[64].Beat != 0 || pitches[60].Beat != 10 || pitches[60].Duration != 20 || pitches[60].Velocity != 70 {
+		t.Errorf("expected 60 and 64 to swap, got %+v", notes)
+	}
+	if notes := m.Invert(90).Consolidate(); len(notes) != 2 {
+		t.Errorf("expected 5 to be left out above the MIDI range, got %+v", notes)
+	}
+	if bends := inverted.AllBends(); len(bends) != 1 || bends[0].Value != -100 {
+		t.Errorf("expected the bend to go down, got %+v", bends)
+	}
+}
+
+func TestAugment(t *testing.T) {
+	m := New()
+	m.AddNote(Note{On: true, Pitch: 60, Velocity: 50, Beat: 100})
+	m.AddNote(Note{Pitch: 60, Beat: 110})
+	m.AddNote(Note{On: true, Pitch: 64, Velocity: 70, Beat: 103})
+	m.AddNote(Note{Pitch: 64, Beat: 104})
+	m.AddBend(Bend{Beat: 110, Value: 100})
+	augmented, err := m.Augment(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := augmented.Consolidate()
+	if len(notes) != 2 || notes[0] != (Note{On: true, Pitch: 60, Velocity: 50, Beat: 100, Duration: 20}) || notes[1].Beat != 106 || notes[1].Duration != 2 {
+		t.Errorf("expected the notes to be twice as long from 100, got %+v", notes)
+	}
+	if bends := augmented.AllBends(); len(bends) != 1 || bends[0].Beat != 120 {
+		t.Errorf("expected the bend to move to 120, got %+v", bends)
+	}
+
+	diminished, err := m.Augment(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notes := diminished.Consolidate(); len(notes) != 2 || notes[0].Duration != 5 || notes[1].Beat != 102 || notes[1].Duration != 1 {
+		t.Errorf("expected the notes to be half as long, and a tick at least, got %+v", notes)
+	}
+	if _, err = m.Augment(0.1); err == nil {
+		t.Error("expected an error for notes on the same tick")
+	}
+	if _, err = m.Augment(0); err == nil {
+		t.Error("expected an error for a factor of 0")
+	}
+}
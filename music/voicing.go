@@ -0,0 +1,71 @@
+package music
+
+import "sort"
+
+// Invert returns the pitches of a chord in an inversion, with its
+// lowest pitch moved up an octave for each one, from the lowest up
+func Invert(chord []int, inversion int) []int {
+	voiced := append([]int{}, chord...)
+	sort.Ints(voiced)
+	for i := 0; i < inversion && len(voiced) > 1; i++ {
+		voiced = append(voiced[1:], voiced[0]+12)
+	}
+	return voiced
+}
+
+// Spread returns the pitches of a chord in open position, with
+// every other pitch above the lowest moved up an octave, from the lowest up
+func Spread(chord []int) []int {
+	voiced := append([]int{}, chord...)
+	sort.Ints(voiced)
+	for i := 1; i < len(voiced); i += 2 {
+		voiced[i] += 12
+	}
+	sort.Ints(voiced)
+	return voiced
+}
+
+// VoiceLead returns the pitches of the next chord inverted and moved by
+// octaves so that they move as little as they can from the previous chord
+// altogether, from the lowest up. The next chord is only sorted if there
+// is no previous chord.
+func VoiceLead(prev, next []int) []int {
+	if len(prev) == 0 || len(next) == 0 {
+		return Invert(next, 0)
+	}
+	var best []int
+	bestMovement := -1
+	for inversion := 0; inversion < len(next); inversion++ {
+		inverted := Invert(next, inversion)
+		// staying in the same octave wins a tie
+		for _, octaves := range []int{0, -1, 1, -2, 2} {
+			voiced := make([]int, len(inverted))
+			for i, pitch := range inverted {
+				voiced[i] = pitch + 12*octaves
+			}
+			if movement := movement(prev, voiced); bestMovement < 0 || movement < bestMovement {
+				best, bestMovement = voiced, movement
+			}
+		}
+	}
+	return best
+}
+
+// movement adds up how far each pitch of a chord is
+// from the nearest pitch of the chord before it
+func movement(prev, next []int) (total int) {
+	for _, pitch := range next {
+		nearest := -1
+		for _, other := range prev {
+			distance := pitch - other
+			if distance < 0 {
+				distance = -distance
+			}
+			if nearest < 0 || distance < nearest {
+				nearest = distance
+			}
+		}
+		total += nearest
+	}
+	return
+}
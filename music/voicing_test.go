@@ -0,0 +1,30 @@
+package music
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVoicing(t *testing.T) {
+	c := []int{60, 64, 67}
+	if voiced := Invert(c, 1); !reflect.DeepEqual(voiced, []int{64, 67, 72}) {
+		t.Errorf("expected the first inversion, got %v", voiced)
+	}
+	if voiced := Invert(c, 2); !reflect.DeepEqual(voiced, []int{67, 72, 76}) {
+		t.Errorf("expected the second inversion, got %v", voiced)
+	}
+	if voiced := Spread(c); !reflect.DeepEqual(voiced, []int{60, 67, 76}) {
+		t.Errorf("expected an open C, got %v", voiced)
+	}
+	// C to F goes to the second inversion of F, and to G the first
+	// inversion of G a step below
+	if voiced := VoiceLead(c, []int{65, 69, 72}); !reflect.DeepEqual(voiced, []int{60, 65, 69}) {
+		t.Errorf("expected C F A, got %v", voiced)
+	}
+	if voiced := VoiceLead(c, []int{67, 71, 74}); !reflect.DeepEqual(voiced, []int{59, 62, 67}) {
+		t.Errorf("expected B D G, got %v", voiced)
+	}
+	if voiced := VoiceLead(nil, []int{67, 62, 71}); !reflect.DeepEqual(voiced, []int{62, 67, 71}) {
+		t.Errorf("expected the chord to be left alone, got %v", voiced)
+	}
+}
@@ -0,0 +1,176 @@
+package piano
+
+import (
+	"sync"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+)
+
+// Device is what the player plays on and listens to, which is a
+// Piano, or a Mock for trying the player without a keyboard
+type Device interface {
+	// PlayNotes plays the notes, each on its own channel
+	PlayNotes(notes []music.Note, bpm int) error
+	// Click plays a short percussive note on a channel
+	Click(channel, pitch, velocity int) error
+	// Panic turns off every note, and centers the pitch bends
+	Panic() error
+	// PitchBend bends the pitch of a channel, 0 being the center
+	PitchBend(channel, value int) error
+	// SendClock sends a MIDI clock message, such as TimingClock
+	SendClock(status int) error
+	// SetInstrument changes the instrument (program) of a channel
+	SetInstrument(channel, program int) error
+	// Read returns the input events that are waiting, and
+	// ErrClosed once the device is closed
+	Read() ([]portmidi.Event, error)
+	// Close shuts down the device
+	Close() error
+}
+
+var _ Device = (*Piano)(nil)
+var _ Device = (*Mock)(nil)
+
+// Mock is a Device that is played on with Send,
+// and which records what is played on it
+type Mock struct {
+	events   []portmidi.Event
+	played   []music.Note
+	clicks   int
+	panics   int
+	bends    []music.Bend
+	clock    map[int]int
+	programs map[int]int
+	closed   bool
+	sync.Mutex
+}
+
+// NewMock returns a Mock that will be read the events first
+func NewMock(events ...portmidi.Event) *Mock {
+	return &Mock{events: events}
+}
+
+// Send adds events for the next Read, as if they were played
+func (m *Mock) Send(events ...portmidi.Event) {
+	m.Lock()
+	defer m.Unlock()
+	m.events = append(m.events, events...)
+}
+
+// Played returns all the notes that were played, in order
+func (m *Mock) Played() []music.Note {
+	m.Lock()
+	defer m.Unlock()
+	return append([]music.Note{}, m.played...)
+}
+
+// Clicks returns the number of clicks that were played
+func (m *Mock) Clicks() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.clicks
+}
+
+// Panics returns the number of times Panic was called
+func (m *Mock) Panics() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.panics
+}
+
+// PlayNotes records the notes
+func (m *Mock) PlayNotes(notes []music.Note, bpm int) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.played = append(m.played, notes...)
+	return
+}
+
+// Click counts the click
+func (m *Mock) Click(channel, pitch, velocity int) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.clicks++
+	return
+}
+
+// Panic counts the panic
+func (m *Mock) Panic() (err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.panics++
+	return
+}
+
+// PitchBend records the bend
+func (m *Mock) PitchBend(channel, value int) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.bends = append(m.bends, music.Bend{Value: value, Channel: channel})
+	return
+}
+
+// Bends returns all the pitch bends, in order
+func (m *Mock) Bends() []music.Bend {
+	m.Lock()
+	defer m.Unlock()
+	return append([]music.Bend{}, m.bends...)
+}
+
+// SendClock counts the clock message
+func (m *Mock) SendClock(status int) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.clock == nil {
+		m.clock = make(map[int]int)
+	}
+	m.clock[status]++
+	return
+}
+
+// ClockMessages returns the number of clock messages of a status that were sent
+func (m *Mock) ClockMessages(status int) int {
+	m.Lock()
+	defer m.Unlock()
+	return m.clock[status]
+}
+
+// SetInstrument records the instrument of the channel
+func (m *Mock) SetInstrument(channel, program int) (err error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.programs == nil {
+		m.programs = make(map[int]int)
+	}
+	m.programs[channel] = program
+	return
+}
+
+// Instrument returns the instrument that the channel was set to
+func (m *Mock) Instrument(channel int) (program int, ok bool) {
+	m.Lock()
+	defer m.Unlock()
+	program, ok = m.programs[channel]
+	return
+}
+
+// Read returns the events that were sent since the last Read
+func (m *Mock) Read() (events []portmidi.Event, err error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.closed {
+		err = ErrClosed
+		return
+	}
+	events, m.events = m.events, nil
+	return
+}
+
+// Close makes the next Read return ErrClosed
+func (m *Mock) Close() (err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.closed = true
+	return
+}
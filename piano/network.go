@@ -0,0 +1,541 @@
+package piano
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// networkName is the name the session is joined with
+	networkName = "pianoai"
+	// networkTimeout is how long to wait for an answer to an invitation
+	networkTimeout = 2 * time.Second
+	// networkInvitations is how many times a session is invited
+	networkInvitations = 3
+	// networkSyncInterval is how often the clocks are synchronized,
+	// which keeps the session from timing out
+	networkSyncInterval = 10 * time.Second
+	// maxNetworkCommands is the most MIDI commands sent in one packet
+	maxNetworkCommands = 256
+	// rtpMIDIPayload is the RTP payload type of RTP-MIDI
+	rtpMIDIPayload = 0x61
+)
+
+// errSessionEnded is returned by Read once the other end ends the session
+var errSessionEnded = errors.New("network MIDI session ended")
+
+// Network is a Device that plays and listens over the network with
+// RTP-MIDI (AppleMIDI), joining the session of another machine, such
+// as a network session of macOS or rtpMIDI on Windows. The session
+// has a control port and, on the port after it, a data port.
+type Network struct {
+	controlAddr, dataAddr *net.UDPAddr
+	control, data         *net.UDPConn
+	// ssrc identifies this end of the session, and token the invitation
+	ssrc, token uint32
+	// seq is the sequence number of the next RTP packet
+	seq uint16
+	// start is what the timestamps are counted from
+	start time.Time
+	// events are the received events that are waiting for Read
+	events []portmidi.Event
+	// usedChannels are the channels that notes have been played on,
+	// besides channel 0, so that Panic can turn them off
+	usedChannels [16]bool
+	// answers are the answers to the invitations
+	answers chan []byte
+	// lost is set when the other end ends the session, and done is
+	// closed when the Network is, to stop waiting for answers
+	lost   bool
+	closed bool
+	done   chan struct{}
+	// joining is held while the session is joined, which takes a
+	// while if there is no answer, so that it is only joined once
+	// at a time without holding the lock all that time
+	joining sync.Mutex
+	sync.Mutex
+}
+
+var _ Device = (*Network)(nil)
+
+// NewNetwork joins the RTP-MIDI session at the address of its control
+// port, such as "192.168.1.10:5004"
+func NewNetwork(addr string) (n *Network, err error) {
+	n = &Network{
+		ssrc:    rand.Uint32(),
+		start:   time.Now(),
+		answers: make(chan []byte, 4),
+		done:    make(chan struct{}),
+	}
+	n.controlAddr, err = net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return
+	}
+	n.dataAddr = &net.UDPAddr{IP: n.controlAddr.IP, Port: n.controlAddr.Port + 1, Zone: n.controlAddr.Zone}
+	err = n.connect()
+	return
+}
+
+// connect opens the ports and joins the session. It must be called
+// without the lock, which it only takes once it has an answer, so
+// that the Network can be read and closed while it waits.
+func (n *Network) connect() (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Network.connect",
+	})
+	n.joining.Lock()
+	defer n.joining.Unlock()
+	control, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return
+	}
+	// some sessions expect the data port to be the one after the control port
+	data, err := net.ListenUDP("udp", &net.UDPAddr{Port: control.LocalAddr().(*net.UDPAddr).Port + 1})
+	if err != nil {
+		data, err = net.ListenUDP("udp", nil)
+	}
+	if err != nil {
+		control.Close()
+		return
+	}
+	n.Lock()
+	n.token = rand.Uint32()
+	n.lost = false
+	invitation := n.sessionPacket("IN")
+	n.Unlock()
+	go n.receive(control)
+	go n.receive(data)
+	for _, port := range []struct {
+		conn *net.UDPConn
+		addr *net.UDPAddr
+	}{{control, n.controlAddr}, {data, n.dataAddr}} {
+		err = n.invite(port.conn, port.addr, invitation)
+		if err != nil {
+			control.Close()
+			data.Close()
+			return
+		}
+	}
+	n.Lock()
+	defer n.Unlock()
+	if n.closed {
+		control.Close()
+		data.Close()
+		return ErrClosed
+	}
+	n.disconnect()
+	n.control, n.data = control, data
+	logger.Infof("Joined the network MIDI session at %s", n.controlAddr.String())
+	n.sync(0, n.timestamp())
+	go n.keepSynchronized(n.data)
+	return
+}
+
+// invite sends the invitation to a port of the session until it is
+// accepted or refused, or the Network is closed, and must be called
+// without the lock
+func (n *Network) invite(conn *net.UDPConn, addr *net.UDPAddr, invitation []byte) (err error) {
+	// an answer to an earlier invitation that came in late
+	select {
+	case <-n.answers:
+	default:
+	}
+	for try := 0; try < networkInvitations; try++ {
+		_, err = conn.WriteToUDP(invitation, addr)
+		if err != nil {
+			return
+		}
+		select {
+		case answer := <-n.answers:
+			if string(answer[2:4]) == "NO" {
+				return fmt.Errorf("the invitation to %s was refused", addr.String())
+			}
+			return nil
+		case <-n.done:
+			return ErrClosed
+		case <-time.After(networkTimeout):
+		}
+	}
+	return fmt.Errorf("no answer from %s", addr.String())
+}
+
+// disconnect closes the ports, and must be called with the lock held
+func (n *Network) disconnect() {
+	if n.control != nil {
+		n.control.Close()
+		n.control = nil
+	}
+	if n.data != nil {
+		n.data.Close()
+		n.data = nil
+	}
+}
+
+// Reopen joins the session again, after the other end ended it
+func (n *Network) Reopen() (err error) {
+	n.Lock()
+	closed := n.closed
+	n.disconnect()
+	n.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	return n.connect()
+}
+
+// Close leaves the session
+func (n *Network) Close() (err error) {
+	n.Lock()
+	defer n.Unlock()
+	if !n.closed {
+		close(n.done)
+	}
+	n.closed = true
+	if n.control != nil && !n.lost {
+		n.control.WriteToUDP(n.sessionPacket("BY"), n.controlAddr)
+	}
+	n.disconnect()
+	return
+}
+
+// Read returns the events that were received since the last Read
+func (n *Network) Read() (events []portmidi.Event, err error) {
+	n.Lock()
+	defer n.Unlock()
+	if n.closed {
+		err = ErrClosed
+		return
+	}
+	events, n.events = n.events, nil
+	if n.lost && len(events) == 0 {
+		err = errSessionEnded
+	}
+	return
+}
+
+// PlayNotes will play all the notes, each on its own channel
+func (n *Network) PlayNotes(notes []music.Note, bpm int) (err error) {
+	commands := make([][]byte, 0, len(notes))
+	n.Lock()
+	for _, note := range notes {
+		channel := byte(note.Channel & 0x0F)
+		n.usedChannels[channel] = true
+		status := NoteOff | channel
+		if note.On {
+			status = NoteOn | channel
+		}
+		commands = append(commands, []byte{status, byte(note.Pitch & 0x7F), byte(note.Velocity & 0x7F)})
+	}
+	n.Unlock()
+	return n.send(commands...)
+}
+
+// Click plays a short percussive note on a channel (0-15)
+func (n *Network) Click(channel, pitch, velocity int) (err error) {
+	ch := byte(channel & 0x0F)
+	n.Lock()
+	n.usedChannels[ch] = true
+	n.Unlock()
+	return n.send(
+		[]byte{NoteOn | ch, byte(pitch & 0x7F), byte(velocity & 0x7F)},
+		[]byte{NoteOff | ch, byte(pitch & 0x7F), 0},
+	)
+}
+
+// PitchBend bends the pitch of a channel (0-15), by a value from
+// -8192 to 8191 (see music.MaxBend), where 0 is the center
+func (n *Network) PitchBend(channel, value int) (err error) {
+	value += music.MaxBend + 1
+	if value < 0 {
+		value = 0
+	} else if value > 2*music.MaxBend+1 {
+		value = 2*music.MaxBend + 1
+	}
+	return n.send([]byte{PitchBend | byte(channel&0x0F), byte(value & 0x7F), byte(value >> 7)})
+}
+
+// SendClock sends a MIDI clock message, such as TimingClock
+func (n *Network) SendClock(status int) (err error) {
+	return n.send([]byte{byte(status)})
+}
+
+// SetInstrument changes the instrument (the General MIDI
+// program, 0-127) of a channel (0-15)
+func (n *Network) SetInstrument(channel, program int) (err error) {
+	if channel < 0 || channel > 15 || program < 0 || program > 127 {
+		return fmt.Errorf("invalid program %d on channel %d", program, channel)
+	}
+	return n.send([]byte{ProgramChange | byte(channel), byte(program)})
+}
+
+// Panic turns off every note on every channel that has been played on,
+// and returns their pitch bends to the center
+func (n *Network) Panic() (err error) {
+	commands := [][]byte{}
+	n.Lock()
+	for channel := byte(0); channel < 16; channel++ {
+		if channel > 0 && !n.usedChannels[channel] {
+			continue
+		}
+		for pitch := byte(0); pitch < 128; pitch++ {
+			commands = append(commands, []byte{NoteOff | channel, pitch, 0})
+		}
+		commands = append(commands, []byte{ControlChange | channel, 123, 0}, []byte{PitchBend | channel, 0, 0x40})
+	}
+	n.Unlock()
+	return n.send(commands...)
+}
+
+// send sends MIDI commands to the data port, as few RTP packets as it takes
+func (n *Network) send(commands ...[]byte) (err error) {
+	n.Lock()
+	defer n.Unlock()
+	if n.data == nil || n.lost {
+		return errNotConnected
+	}
+	for len(commands) > 0 {
+		count := len(commands)
+		if count > maxNetworkCommands {
+			count = maxNetworkCommands
+		}
+		_, err = n.data.WriteToUDP(n.midiPacket(commands[:count]), n.dataAddr)
+		if err != nil {
+			return
+		}
+		commands = commands[count:]
+	}
+	return
+}
+
+// midiPacket returns the RTP packet of MIDI commands, without a
+// journal, and must be called with the lock held
+func (n *Network) midiPacket(commands [][]byte) []byte {
+	var list bytes.Buffer
+	for i, command := range commands {
+		if i > 0 {
+			// no delta time
+			list.WriteByte(0)
+		}
+		list.Write(command)
+	}
+	var packet bytes.Buffer
+	packet.Write([]byte{0x80, rtpMIDIPayload})
+	binary.Write(&packet, binary.BigEndian, n.seq)
+	binary.Write(&packet, binary.BigEndian, uint32(n.timestamp()))
+	binary.Write(&packet, binary.BigEndian, n.ssrc)
+	if list.Len() <= 0x0F {
+		packet.WriteByte(byte(list.Len()))
+	} else {
+		packet.Write([]byte{0x80 | byte(list.Len()>>8&0x0F), byte(list.Len())})
+	}
+	packet.Write(list.Bytes())
+	n.seq++
+	return packet.Bytes()
+}
+
+// sessionPacket returns a session command of AppleMIDI, such
+// as "IN" (an invitation) or "BY" (the end of the session)
+func (n *Network) sessionPacket(command string) []byte {
+	var packet bytes.Buffer
+	packet.Write([]byte{0xFF, 0xFF})
+	packet.WriteString(command)
+	binary.Write(&packet, binary.BigEndian, uint32(2))
+	binary.Write(&packet, binary.BigEndian, n.token)
+	binary.Write(&packet, binary.BigEndian, n.ssrc)
+	if command == "IN" {
+		packet.WriteString(networkName)
+		packet.WriteByte(0)
+	}
+	return packet.Bytes()
+}
+
+// timestamp is the time since the start, in units of 100 microseconds
+func (n *Network) timestamp() uint64 {
+	return uint64(time.Since(n.start) / (100 * time.Microsecond))
+}
+
+// sync sends a clock synchronization to the data port,
+// and must be called with the lock held
+func (n *Network) sync(count byte, timestamps ...uint64) {
+	var packet bytes.Buffer
+	packet.Write([]byte{0xFF, 0xFF, 'C', 'K'})
+	binary.Write(&packet, binary.BigEndian, n.ssrc)
+	packet.Write([]byte{count, 0, 0, 0})
+	for i := 0; i < 3; i++ {
+		var timestamp uint64
+		if i < len(timestamps) {
+			timestamp = timestamps[i]
+		}
+		binary.Write(&packet, binary.BigEndian, timestamp)
+	}
+	if n.data != nil {
+		n.data.WriteToUDP(packet.Bytes(), n.dataAddr)
+	}
+}
+
+// keepSynchronized synchronizes the clocks every networkSyncInterval
+// until the data port is closed
+func (n *Network) keepSynchronized(data *net.UDPConn) {
+	ticker := time.NewTicker(networkSyncInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n.Lock()
+		if n.data != data {
+			n.Unlock()
+			return
+		}
+		n.sync(0, n.timestamp())
+		n.Unlock()
+	}
+}
+
+// receive handles the packets that come in on a port until it is closed
+func (n *Network) receive(conn *net.UDPConn) {
+	logger := log.WithFields(log.Fields{
+		"function": "Network.receive",
+	})
+	buf := make([]byte, 65536)
+	for {
+		length, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packet := append([]byte{}, buf[:length]...)
+		if length >= 4 && packet[0] == 0xFF && packet[1] == 0xFF {
+			n.handleSession(packet)
+			continue
+		}
+		events, err := parseMIDIPacket(packet)
+		if err != nil {
+			logger.Debug(err.Error())
+			continue
+		}
+		n.Lock()
+		n.events = append(n.events, events...)
+		n.Unlock()
+	}
+}
+
+// handleSession handles a session command of AppleMIDI
+func (n *Network) handleSession(packet []byte) {
+	switch string(packet[2:4]) {
+	case "OK", "NO":
+		select {
+		case n.answers <- packet:
+		default:
+		}
+	case "BY":
+		log.WithFields(log.Fields{
+			"function": "Network.handleSession",
+		}).Warn("The network MIDI session was ended")
+		n.Lock()
+		n.lost = true
+		n.Unlock()
+	case "CK":
+		if len(packet) < 36 {
+			return
+		}
+		count := packet[8]
+		n.Lock()
+		defer n.Unlock()
+		switch count {
+		case 0:
+			n.sync(1, binary.BigEndian.Uint64(packet[12:20]), n.timestamp())
+		case 1:
+			n.sync(2, binary.BigEndian.Uint64(packet[12:20]), binary.BigEndian.Uint64(packet[20:28]), n.timestamp())
+		}
+	}
+}
+
+// parseMIDIPacket returns the MIDI events of an RTP-MIDI packet,
+// leaving out system exclusive messages and ignoring the journal
+func parseMIDIPacket(packet []byte) (events []portmidi.Event, err error) {
+	if len(packet) < 13 || packet[0]>>6 != 2 || packet[1]&0x7F != rtpMIDIPayload {
+		err = errors.New("not an RTP-MIDI packet")
+		return
+	}
+	pos := 12
+	header := packet[pos]
+	length := int(header & 0x0F)
+	pos++
+	if header&0x80 != 0 {
+		if pos >= len(packet) {
+			err = errors.New("truncated RTP-MIDI packet")
+			return
+		}
+		length = length<<8 | int(packet[pos])
+		pos++
+	}
+	end := pos + length
+	if end > len(packet) {
+		err = errors.New("truncated RTP-MIDI packet")
+		return
+	}
+	var status byte
+	for first := true; pos < end; first = false {
+		if !first || header&0x20 != 0 {
+			// skip the delta time
+			for pos < end && packet[pos]&0x80 != 0 {
+				pos++
+			}
+			pos++
+		}
+		if pos >= end {
+			break
+		}
+		if packet[pos]&0x80 != 0 {
+			if packet[pos] >= 0xF8 {
+				// real-time messages don't change the running status
+				events = append(events, portmidi.Event{Status: int64(packet[pos])})
+				pos++
+				continue
+			}
+			status = packet[pos]
+			pos++
+		} else if status == 0 {
+			err = errors.New("running status without a status byte")
+			return
+		}
+		size := 2
+		switch {
+		case status == 0xF0:
+			for pos < end && packet[pos] != 0xF7 {
+				pos++
+			}
+			pos++
+			status = 0
+			continue
+		case status&0xF0 == 0xC0 || status&0xF0 == 0xD0 || status == 0xF1 || status == 0xF3:
+			size = 1
+		case status >= 0xF4:
+			size = 0
+		}
+		if pos+size > end {
+			err = errors.New("truncated MIDI command")
+			return
+		}
+		event := portmidi.Event{Status: int64(status)}
+		if size > 0 {
+			event.Data1 = int64(packet[pos])
+		}
+		if size > 1 {
+			event.Data2 = int64(packet[pos+1])
+		}
+		events = append(events, event)
+		pos += size
+		if status >= 0xF0 {
+			status = 0
+		}
+	}
+	return
+}
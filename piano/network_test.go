@@ -0,0 +1,164 @@
+package piano
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+)
+
+// session is the other end of a network MIDI session, which accepts
+// the invitations and passes on what it receives on the data port
+type session struct {
+	control, data *net.UDPConn
+	// peer is where the data of the Network come from
+	peer     *net.UDPAddr
+	received chan []byte
+}
+
+// newSession listens on a control port and the data port after it
+func newSession(t *testing.T) (s *session) {
+	s = &session{received: make(chan []byte, 16)}
+	for try := 0; try < 10 && s.data == nil; try++ {
+		control, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dataAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: control.LocalAddr().(*net.UDPAddr).Port + 1}
+		data, err := net.ListenUDP("udp", dataAddr)
+		if err != nil {
+			control.Close()
+			continue
+		}
+		s.control, s.data = control, data
+	}
+	if s.data == nil {
+		t.Fatal("could not listen on two ports in a row")
+	}
+	go s.serve(s.control, false)
+	go s.serve(s.data, true)
+	return
+}
+
+func (s *session) serve(conn *net.UDPConn, isData bool) {
+	buf := make([]byte, 65536)
+	for {
+		length, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packet := append([]byte{}, buf[:length]...)
+		if packet[0] == 0xFF && string(packet[2:4]) == "IN" {
+			if isData {
+				s.peer = addr
+			}
+			answer := append([]byte{}, packet[:16]...)
+			copy(answer[2:4], "OK")
+			conn.WriteToUDP(answer, addr)
+			continue
+		}
+		if isData && packet[0] != 0xFF {
+			s.received <- packet
+		}
+	}
+}
+
+func (s *session) close() {
+	s.control.Close()
+	s.data.Close()
+}
+
+func TestNetwork(t *testing.T) {
+	s := newSession(t)
+	defer s.close()
+	n, err := NewNetwork(s.control.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	err = n.PlayNotes([]music.Note{
+		{On: true, Pitch: 60, Velocity: 80},
+		{On: false, Pitch: 64, Channel: 2},
+	}, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case packet := <-s.received:
+		events, err := parseMIDIPacket(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].Status != NoteOn || events[0].Data1 != 60 || events[0].Data2 != 80 || events[1].Status != NoteOff|2 || events[1].Data1 != 64 {
+			t.Errorf("got %+v", events)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the notes were not received")
+	}
+
+	// a note-on and, with a delta time and running status, its note-off
+	packet := []byte{0x80, rtpMIDIPayload, 0, 1, 0, 0, 0, 0, 1, 2, 3, 4, 7, 0x90, 62, 70, 0x81, 0x00, 62, 0}
+	s.data.WriteToUDP(packet, s.peer)
+	var events []portmidi.Event
+	for i := 0; i < 100 && len(events) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		var more []portmidi.Event
+		more, err = n.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, more...)
+	}
+	if len(events) != 2 || !IsNoteOn(events[0]) || events[0].Data1 != 62 || IsNoteOn(events[1]) || events[1].Data1 != 62 {
+		t.Errorf("got %+v", events)
+	}
+
+	s.control.WriteToUDP([]byte{0xFF, 0xFF, 'B', 'Y', 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: n.control.LocalAddr().(*net.UDPAddr).Port})
+	for i := 0; i < 100 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err = n.Read()
+	}
+	if err != errSessionEnded {
+		t.Errorf("expected the session to end, got %v", err)
+	}
+}
+
+func TestNetworkReopen(t *testing.T) {
+	s := newSession(t)
+	n, err := NewNetwork(s.control.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the session is gone, so the invitations are never answered
+	s.close()
+	reopened := make(chan error)
+	go func() {
+		reopened <- n.Reopen()
+	}()
+	read := make(chan error)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := n.Read()
+		read <- err
+	}()
+	select {
+	case err = <-read:
+		if err != nil {
+			t.Errorf("expected to read while joining, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("could not read while joining")
+	}
+	n.Close()
+	select {
+	case err = <-reopened:
+		if err != ErrClosed {
+			t.Errorf("expected the joining to stop once closed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still joining after it was closed")
+	}
+}
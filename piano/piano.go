@@ -1,6 +1,8 @@
 package piano
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/rakyll/portmidi"
@@ -8,17 +10,34 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func init() {
-	// Log as JSON instead of the default ASCII formatter.
-	// log.SetFormatter(&log.JSONFormatter{})
+// Status bytes of the MIDI messages, without the channel
+const (
+	NoteOff       = 0x80
+	NoteOn        = 0x90
+	ControlChange = 0xB0
+	ProgramChange = 0xC0
+	PitchBend     = 0xE0
+)
 
-	// Output to stdout instead of the default stderr
-	// Can be any io.Writer, see below for File example
-	// log.SetOutput(os.Stdout)
+// Status bytes of the MIDI real-time messages of the clock
+const (
+	TimingClock   = 0xF8
+	ClockStart    = 0xFA
+	ClockContinue = 0xFB
+	ClockStop     = 0xFC
+)
 
-	// Only log the warning severity or above.
-	log.SetLevel(log.DebugLevel)
-}
+// Controller numbers of the control changes
+const (
+	ModWheel     = 1
+	SustainPedal = 64
+)
+
+// ErrClosed is returned when reading from a piano that was closed
+var ErrClosed = errors.New("piano is closed")
+
+// errNotConnected is returned when writing while the devices are lost
+var errNotConnected = errors.New("MIDI output is not connected")
 
 // Piano is the AI class for the piano
 type Piano struct {
@@ -26,66 +45,196 @@ type Piano struct {
 	OutputDevice portmidi.DeviceID
 	outputStream *portmidi.Stream
 	InputStream  *portmidi.Stream
+	// usedChannels are the channels that notes have been played on,
+	// besides channel 0, so that Panic can turn them off
+	usedChannels [16]bool
+	// programs are the instruments of the channels that were set
+	// with SetInstrument, or -1, so that Reopen can set them again
+	programs [16]int
+	// inputName and outputName are the names of the devices,
+	// so that Reopen can find them again
+	inputName  string
+	outputName string
+	// inputOnly is set for the pianos of NewInput, which have no output
+	inputOnly bool
+	closed    bool
 	sync.Mutex
 }
 
 // New sets the device ports. Optionally you can
 // pass the input and output ports, respectively.
 func New(ports ...int) (p *Piano, err error) {
-	p = new(Piano)
+	p = newPiano()
 	logger := log.WithFields(log.Fields{
 		"function": "Piano.Init",
 	})
 	logger.Debug("Initializing portmidi...")
-	err = portmidi.Initialize()
+	err = startPortmidi()
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"msg": "initiailization failed",
 		}).Error(err.Error())
 		return
 	}
-	numDevices := portmidi.CountDevices()
-	logger.Debugf("Found %d devices", numDevices)
-	for i := 0; i < numDevices; i++ {
-		deviceInfo := portmidi.Info(portmidi.DeviceID(i))
-		var inputOutput string
-		if deviceInfo.IsOutputAvailable {
-			inputOutput = "output"
-			p.OutputDevice = portmidi.DeviceID(i)
-		} else {
-			inputOutput = "input"
-			p.InputDevice = portmidi.DeviceID(i)
-		}
-		logger.Debugf("%d) %s %s %s", i, deviceInfo.Interface, deviceInfo.Name, inputOutput)
+	devices, err := ListDevices()
+	if err != nil {
+		return
 	}
+	logger.Debugf("Found %d devices", len(devices))
+	for _, device := range devices {
+		logger.Debugf("%d) %s %s (input: %t, output: %t)", device.ID, device.Interface, device.Name, device.IsInput, device.IsOutput)
+	}
+	p.InputDevice, p.OutputDevice, _, _ = pickDevices(devices, "", "")
 	if len(ports) == 2 {
 		p.InputDevice = portmidi.DeviceID(ports[0])
 		p.OutputDevice = portmidi.DeviceID(ports[1])
 	}
-	logger.Infof("Using input device %d and output device %d", p.InputDevice, p.OutputDevice)
+	err = p.openStreams()
+	return
+}
+
+func newPiano() (p *Piano) {
+	p = new(Piano)
+	for channel := range p.programs {
+		p.programs[channel] = -1
+	}
+	return
+}
+
+// DeviceInfo describes a MIDI device
+type DeviceInfo struct {
+	ID        int
+	Interface string
+	Name      string
+	IsInput   bool
+	IsOutput  bool
+}
 
-	logger.Debug("Opening output stream")
-	p.outputStream, err = portmidi.NewOutputStream(p.OutputDevice, 1024, 0)
+// ListDevices returns all the connected MIDI devices
+func ListDevices() (devices []DeviceInfo, err error) {
+	err = startPortmidi()
 	if err != nil {
-		if err != nil {
-			logger.WithFields(log.Fields{
-				"msg": "problem getting output stream from device " + string(p.OutputDevice),
-			}).Error(err.Error())
-			return
+		return
+	}
+	defer stopPortmidi()
+	numDevices := portmidi.CountDevices()
+	devices = make([]DeviceInfo, numDevices)
+	for i := 0; i < numDevices; i++ {
+		info := portmidi.Info(portmidi.DeviceID(i))
+		devices[i] = DeviceInfo{
+			ID:        i,
+			Interface: info.Interface,
+			Name:      info.Name,
+			IsInput:   info.IsInputAvailable,
+			IsOutput:  info.IsOutputAvailable,
 		}
+	}
+	return
+}
 
+// pickDevices returns the input and output devices with the given
+// names, the first of them if there are several, or the last ones
+// found for an empty name, which are the ones New uses. Either of
+// found is false if there is no such device.
+func pickDevices(devices []DeviceInfo, inputName, outputName string) (input, output portmidi.DeviceID, foundInput, foundOutput bool) {
+	for _, device := range devices {
+		if device.IsOutput && (outputName == "" || (device.Name == outputName && !foundOutput)) {
+			output, foundOutput = portmidi.DeviceID(device.ID), true
+		}
+		if device.IsInput && (inputName == "" || (device.Name == inputName && !foundInput)) {
+			input, foundInput = portmidi.DeviceID(device.ID), true
+		}
 	}
+	return
+}
 
-	logger.Debug("Opening input stream")
-	p.InputStream, err = portmidi.NewInputStream(p.InputDevice, 1024)
+// NewWithDevice connects to the input and output devices with the
+// given names. An empty name uses the same device that New would,
+// and an error is returned if a named device is not found.
+func NewWithDevice(inputName, outputName string) (p *Piano, err error) {
+	return newWithDevice(inputName, outputName, false)
+}
+
+// NewInput connects to only an input device, with the given name, to
+// listen to along with another piano. Nothing can be played on it, so
+// that it does not open another stream to the output of that piano.
+func NewInput(inputName string) (p *Piano, err error) {
+	return newWithDevice(inputName, "", true)
+}
+
+func newWithDevice(inputName, outputName string, inputOnly bool) (p *Piano, err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Piano.NewWithDevice",
+	})
+	if err = startPortmidi(); err != nil {
+		logger.WithFields(log.Fields{
+			"msg": "initiailization failed",
+		}).Error(err.Error())
+		return
+	}
+	defer func() {
+		if err != nil {
+			if p != nil {
+				p.closeStreams()
+			}
+			stopPortmidi()
+			p = nil
+		}
+	}()
+	devices, err := ListDevices()
 	if err != nil {
+		return
+	}
+	p = newPiano()
+	p.inputOnly = inputOnly
+	for _, device := range devices {
+		logger.Debugf("%d) %s %s (input: %t, output: %t)", device.ID, device.Interface, device.Name, device.IsInput, device.IsOutput)
+	}
+	var foundInput, foundOutput bool
+	p.InputDevice, p.OutputDevice, foundInput, foundOutput = pickDevices(devices, inputName, outputName)
+	if inputName != "" && !foundInput {
+		err = fmt.Errorf("could not find input device '%s'", inputName)
+		return
+	}
+	if outputName != "" && !foundOutput && !inputOnly {
+		err = fmt.Errorf("could not find output device '%s'", outputName)
+		return
+	}
+	err = p.openStreams()
+	return
+}
+
+// openStreams opens the streams of the selected devices
+func (p *Piano) openStreams() (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Piano.openStreams",
+	})
+	logger.Infof("Using input device %d and output device %d", p.InputDevice, p.OutputDevice)
+	if info := portmidi.Info(p.InputDevice); info != nil {
+		p.inputName = info.Name
+	}
+	if info := portmidi.Info(p.OutputDevice); info != nil && !p.inputOnly {
+		p.outputName = info.Name
+	}
+
+	if !p.inputOnly {
+		logger.Debug("Opening output stream")
+		p.outputStream, err = portmidi.NewOutputStream(p.OutputDevice, 1024, 0)
 		if err != nil {
 			logger.WithFields(log.Fields{
-				"msg": "problem getting input stream from device " + string(p.InputDevice),
+				"msg": fmt.Sprintf("problem getting output stream from device %d", p.OutputDevice),
 			}).Error(err.Error())
 			return
 		}
+	}
 
+	logger.Debug("Opening input stream")
+	p.InputStream, err = portmidi.NewInputStream(p.InputDevice, 1024)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"msg": fmt.Sprintf("problem getting input stream from device %d", p.InputDevice),
+		}).Error(err.Error())
+		return
 	}
 	return
 }
@@ -96,29 +245,131 @@ func (p *Piano) Close() (err error) {
 	logger := log.WithFields(log.Fields{
 		"function": "Piano.Close",
 	})
-	logger.Debug("Closing output stream")
-	p.outputStream.Close()
-	logger.Debug("Closing input stream")
-	p.InputStream.Close()
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.closeStreams()
 	logger.Debug("Terminating portmidi")
-	portmidi.Terminate()
+	stopPortmidi()
+	return
+}
+
+// closeStreams closes the streams, if they are open
+func (p *Piano) closeStreams() {
+	logger := log.WithFields(log.Fields{
+		"function": "Piano.closeStreams",
+	})
+	if p.outputStream != nil {
+		logger.Debug("Closing output stream")
+		p.outputStream.Close()
+		p.outputStream = nil
+	}
+	if p.InputStream != nil {
+		logger.Debug("Closing input stream")
+		p.InputStream.Close()
+		p.InputStream = nil
+	}
+}
+
+// Read returns the events that are waiting on the input stream. Unlike
+// the Listen of the stream, it returns the error when reading fails,
+// such as when the keyboard is unplugged, and ErrClosed after Close.
+func (p *Piano) Read() (events []portmidi.Event, err error) {
+	p.Lock()
+	closed, input := p.closed, p.InputStream
+	p.Unlock()
+	if closed {
+		err = ErrClosed
+		return
+	}
+	if input == nil {
+		err = errors.New("MIDI input is not connected")
+		return
+	}
+	return input.Read(1024)
+}
+
+// Reopen closes the streams and opens the same devices again, which are
+// found by their names since they can have a different ID after they
+// are plugged back in
+func (p *Piano) Reopen() (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.closeStreams()
+	// portmidi only finds the devices that were plugged back in when it
+	// is restarted, which is not done while other pianos are using it,
+	// so then only the devices it already knows are opened
+	restarted, err := restartPortmidi()
+	if err != nil {
+		return
+	}
+	if !restarted {
+		log.WithFields(log.Fields{
+			"function": "Piano.Reopen",
+		}).Debug("Not restarting portmidi, which the other devices are using")
+	}
+	foundInput, foundOutput := false, false
+	for i := 0; i < portmidi.CountDevices(); i++ {
+		info := portmidi.Info(portmidi.DeviceID(i))
+		if info == nil {
+			continue
+		}
+		if info.IsInputAvailable && info.Name == p.inputName && !foundInput {
+			p.InputDevice = portmidi.DeviceID(i)
+			foundInput = true
+		}
+		if info.IsOutputAvailable && info.Name == p.outputName && !foundOutput {
+			p.OutputDevice = portmidi.DeviceID(i)
+			foundOutput = true
+		}
+	}
+	if !foundInput {
+		return fmt.Errorf("input device '%s' is not connected", p.inputName)
+	}
+	if !foundOutput && !p.inputOnly {
+		return fmt.Errorf("output device '%s' is not connected", p.outputName)
+	}
+	err = p.openStreams()
+	if err != nil {
+		p.closeStreams()
+		return
+	}
+	for channel, program := range p.programs {
+		if program < 0 || p.outputStream == nil {
+			continue
+		}
+		err = p.outputStream.WriteShort(int64(ProgramChange|channel), int64(program), 0)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
-// PlayNotes will play all the notes
+// PlayNotes will play all the notes, each on its own channel
 func (p *Piano) PlayNotes(notes []music.Note, bpm int) (err error) {
 	p.Lock()
 	defer p.Unlock()
 	logger := log.WithFields(log.Fields{
 		"function": "Piano.PlayNotes",
 	})
+	if p.outputStream == nil {
+		return errNotConnected
+	}
 	for _, note := range notes {
+		p.usedChannels[note.Channel&0x0F] = true
 		if note.On {
 			logger.WithFields(log.Fields{
 				"p": note.Pitch,
 				"v": note.Velocity,
-			}).Debugf("on, beat %d", note.Beat)
-			err = p.outputStream.WriteShort(0x90, int64(note.Pitch), int64(note.Velocity))
+			}).Tracef("on, beat %d", note.Beat)
+			err = p.outputStream.WriteShort(int64(NoteOn|note.Channel&0x0F), int64(note.Pitch), int64(note.Velocity))
 			if err != nil {
 				logger.WithFields(log.Fields{
 					"p":   note.Pitch,
@@ -131,8 +382,8 @@ func (p *Piano) PlayNotes(notes []music.Note, bpm int) (err error) {
 			logger.WithFields(log.Fields{
 				"p": note.Pitch,
 				"v": note.Velocity,
-			}).Debugf("off, beat %d", note.Beat)
-			err = p.outputStream.WriteShort(0x80, int64(note.Pitch), int64(note.Velocity))
+			}).Tracef("off, beat %d", note.Beat)
+			err = p.outputStream.WriteShort(int64(NoteOff|note.Channel&0x0F), int64(note.Pitch), int64(note.Velocity))
 			if err != nil {
 				logger.WithFields(log.Fields{
 					"p":   note.Pitch,
@@ -145,3 +396,146 @@ func (p *Piano) PlayNotes(notes []music.Note, bpm int) (err error) {
 	}
 	return
 }
+
+// Click plays a short percussive note on a channel (0-15),
+// such as a metronome click on the drums of channel 9
+func (p *Piano) Click(channel, pitch, velocity int) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.outputStream == nil {
+		return errNotConnected
+	}
+	channel &= 0x0F
+	p.usedChannels[channel] = true
+	err = p.outputStream.WriteShort(int64(NoteOn|channel), int64(pitch), int64(velocity))
+	if err != nil {
+		return
+	}
+	return p.outputStream.WriteShort(int64(NoteOff|channel), int64(pitch), 0)
+}
+
+// SetInstrument changes the instrument (the General MIDI program,
+// 0-127) of a channel (0-15), which is set again after Reopen
+func (p *Piano) SetInstrument(channel, program int) (err error) {
+	if channel < 0 || channel > 15 || program < 0 || program > 127 {
+		return fmt.Errorf("invalid program %d on channel %d", program, channel)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.programs[channel] = program
+	if p.outputStream == nil {
+		return errNotConnected
+	}
+	return p.outputStream.WriteShort(int64(ProgramChange|channel), int64(program), 0)
+}
+
+// PitchBend bends the pitch of a channel (0-15), by a value from
+// -8192 to 8191 (see music.MaxBend), where 0 is the center
+func (p *Piano) PitchBend(channel, value int) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.outputStream == nil {
+		return errNotConnected
+	}
+	channel &= 0x0F
+	p.usedChannels[channel] = true
+	value += music.MaxBend + 1
+	if value < 0 {
+		value = 0
+	} else if value > 2*music.MaxBend+1 {
+		value = 2*music.MaxBend + 1
+	}
+	return p.outputStream.WriteShort(int64(PitchBend|channel), int64(value&0x7F), int64(value>>7))
+}
+
+// IsBend returns whether the event is a pitch bend, and the value
+// it bends by, from -8192 to 8191 where 0 is the center
+func IsBend(event portmidi.Event) (isBend bool, value int) {
+	isBend = event.Status&0xF0 == PitchBend
+	value = int(event.Data1&0x7F) | int(event.Data2&0x7F)<<7 - music.MaxBend - 1
+	return
+}
+
+// SendClock sends a MIDI clock message (TimingClock, ClockStart,
+// ClockContinue or ClockStop), for other gear to follow
+func (p *Piano) SendClock(status int) (err error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.outputStream == nil {
+		return errNotConnected
+	}
+	return p.outputStream.WriteShort(int64(status), 0, 0)
+}
+
+// IsClock returns whether the event is a MIDI clock message:
+// a TimingClock, ClockStart, ClockContinue or ClockStop
+func IsClock(event portmidi.Event) bool {
+	return event.Status >= TimingClock && event.Status <= ClockStop
+}
+
+// IsNote returns whether the event turns a note on or off
+func IsNote(event portmidi.Event) bool {
+	return event.Status&0xF0 == NoteOn || event.Status&0xF0 == NoteOff
+}
+
+// IsNoteOn returns whether the event turns a note on. A note-on
+// with zero velocity is a note-off.
+func IsNoteOn(event portmidi.Event) bool {
+	return event.Status&0xF0 == NoteOn && event.Data2 > 0
+}
+
+// IsControl returns whether the event is a control change,
+// and the controller number and value
+func IsControl(event portmidi.Event) (isControl bool, controller int, value int) {
+	isControl = event.Status&0xF0 == ControlChange
+	controller = int(event.Data1)
+	value = int(event.Data2)
+	return
+}
+
+// IsSustain returns whether the event moves the sustain pedal,
+// and whether the pedal is now down
+func IsSustain(event portmidi.Event) (isSustain bool, down bool) {
+	isSustain = event.Status&0xF0 == ControlChange && event.Data1 == SustainPedal
+	down = isSustain && event.Data2 >= 64
+	return
+}
+
+// Panic turns off every note on every channel that has been
+// played on, and returns their pitch bends to the center, for
+// when notes get stuck
+func (p *Piano) Panic() (err error) {
+	p.Lock()
+	defer p.Unlock()
+	logger := log.WithFields(log.Fields{
+		"function": "Piano.Panic",
+	})
+	if p.outputStream == nil {
+		return errNotConnected
+	}
+	logger.Debug("Turning off all notes")
+	for channel := int64(0); channel < 16; channel++ {
+		if channel > 0 && !p.usedChannels[channel] {
+			continue
+		}
+		for pitch := int64(0); pitch < 128; pitch++ {
+			err = p.outputStream.WriteShort(NoteOff|channel, pitch, 0)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+		}
+		// all notes off, for anything that is still held
+		err = p.outputStream.WriteShort(ControlChange|channel, 123, 0)
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		err = p.outputStream.WriteShort(PitchBend|channel, 0, 0x40)
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package piano
+
+import (
+	"testing"
+
+	"github.com/rakyll/portmidi"
+)
+
+func TestPickDevices(t *testing.T) {
+	devices := []DeviceInfo{
+		{ID: 0, Name: "keys", IsInput: true},
+		{ID: 1, Name: "keys", IsOutput: true},
+		{ID: 2, Name: "pads", IsInput: true},
+		{ID: 3, Name: "pads", IsOutput: true},
+		{ID: 4, Name: "keys", IsInput: true},
+	}
+	for _, test := range []struct {
+		inputName, outputName string
+		input, output         portmidi.DeviceID
+		foundInput            bool
+		foundOutput           bool
+	}{
+		// the same devices as New, the last ones found
+		{"", "", 4, 3, true, true},
+		// the first of the devices with a name
+		{"keys", "keys", 0, 1, true, true},
+		{"pads", "", 2, 3, true, true},
+		{"drums", "keys", 0, 1, false, true},
+	} {
+		input, output, foundInput, foundOutput := pickDevices(devices, test.inputName, test.outputName)
+		if input != test.input || output != test.output || foundInput != test.foundInput || foundOutput != test.foundOutput {
+			t.Errorf("expected %q and %q to be %d and %d (%t, %t), got %d and %d (%t, %t)", test.inputName, test.outputName, test.input, test.output, test.foundInput, test.foundOutput, input, output, foundInput, foundOutput)
+		}
+	}
+	if _, _, foundInput, foundOutput := pickDevices(nil, "", ""); foundInput || foundOutput {
+		t.Error("expected no devices to be found when there are none")
+	}
+}
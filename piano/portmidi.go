@@ -0,0 +1,57 @@
+package piano
+
+import (
+	"sync"
+
+	"github.com/rakyll/portmidi"
+)
+
+// portmidiUsers is how many pianos (and calls of ListDevices) are using
+// portmidi, which is only terminated once none of them are, since
+// terminating it closes the streams of all of them
+var (
+	portmidiUsers int
+	portmidiLock  sync.Mutex
+)
+
+// startPortmidi initializes portmidi for one more user
+func startPortmidi() (err error) {
+	portmidiLock.Lock()
+	defer portmidiLock.Unlock()
+	if portmidiUsers == 0 {
+		err = portmidi.Initialize()
+		if err != nil {
+			return
+		}
+	}
+	portmidiUsers++
+	return
+}
+
+// stopPortmidi lets go of portmidi for one user,
+// and terminates it if it was the last one
+func stopPortmidi() {
+	portmidiLock.Lock()
+	defer portmidiLock.Unlock()
+	if portmidiUsers == 0 {
+		return
+	}
+	portmidiUsers--
+	if portmidiUsers == 0 {
+		portmidi.Terminate()
+	}
+}
+
+// restartPortmidi terminates portmidi and initializes it again, which is
+// the only way it finds devices that were plugged in since it started.
+// It is only restarted for its only user, since that would close the
+// streams of the others, and restarted is false otherwise.
+func restartPortmidi() (restarted bool, err error) {
+	portmidiLock.Lock()
+	defer portmidiLock.Unlock()
+	if portmidiUsers > 1 {
+		return
+	}
+	portmidi.Terminate()
+	return true, portmidi.Initialize()
+}
@@ -0,0 +1,38 @@
+package player
+
+import (
+	"path/filepath"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// recordAI adds the notes the AI played on a beat to the AIHistory,
+// as note-ons and note-offs like the MusicHistory, unless they were muted
+func (p *Player) recordAI(beat int, notes []music.Note, mute bool) {
+	if mute {
+		return
+	}
+	for _, note := range notes {
+		if !note.On || note.Source != music.AI {
+			continue
+		}
+		note.Beat = beat
+		p.AIHistory.AddNote(note)
+		p.AIHistory.AddNote(music.Note{Pitch: note.Pitch, Beat: beat + note.Duration, Channel: note.Channel, Source: music.AI})
+	}
+}
+
+// aiHistoryFile returns the file the AIHistory is saved to, which
+// is next to MusicHistoryFile with "ai_" in front of its name
+func (p *Player) aiHistoryFile() string {
+	historyFile := p.historyFile()
+	return filepath.Join(filepath.Dir(historyFile), "ai_"+filepath.Base(historyFile))
+}
+
+// SaveAIHistory writes the AIHistory to its own file next to the
+// MusicHistoryFile, and returns the name of the file
+func (p *Player) SaveAIHistory() (filename string, err error) {
+	filename = p.aiHistoryFile()
+	err = p.saveMusic(p.AIHistory, filename)
+	return
+}
@@ -0,0 +1,44 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestAIHistory(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 60, Beat: 5})
+	p.LastHostPress = -1000
+	p.CountIn = 0
+
+	// what is played back is not from the AI
+	p.Playback()
+	for beat := 0; beat < 10; beat++ {
+		p.setTick(beat)
+		p.Emit(beat)
+	}
+	if p.AIHistory.End() != 0 {
+		t.Fatalf("expected the playback to be left out, got %+v", p.AIHistory.Consolidate())
+	}
+
+	p.addToFuture(p.fromAI(music.Notes{{On: true, Pitch: 64, Velocity: 70, Duration: 3}}), 20)
+	for beat := 10; beat < 30; beat++ {
+		p.setTick(beat)
+		p.Emit(beat)
+	}
+	notes := p.AIHistory.Consolidate()
+	if len(notes) != 1 || notes[0].Pitch != 64 || notes[0].Beat != 20 || notes[0].Duration != 3 {
+		t.Errorf("expected the note from the AI, got %+v", notes)
+	}
+	if p.MusicHistory.Consolidate()[0].Pitch != 60 {
+		t.Errorf("expected the music history to be left alone")
+	}
+}
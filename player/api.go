@@ -0,0 +1,125 @@
+package player
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StartAPI serves an HTTP API on an address like ":8081", so that
+// the player can be scripted without the keyboard. POST to /teach,
+// /improvise, /save and /playback does the same as the control keys,
+// and GET /history returns the music history as JSON. Errors are
+// returned as JSON with an "error" field.
+func (p *Player) StartAPI(addr string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.StartAPI",
+	})
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	logger.Infof("Serving the API on http://%s/", listener.Addr())
+	go func() {
+		err := http.Serve(listener, p.api())
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+	return
+}
+
+// api returns the handler of the endpoints of StartAPI
+func (p *Player) api() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/teach", post(func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Teach(); err != nil {
+			apiError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/improvise", post(func(w http.ResponseWriter, r *http.Request) {
+		// the improvisation is claimed here, so that only one
+		// of the requests that come in together gets it
+		if p.MusicFuture.HasFuture(p.CurrentBeat()) || !p.startImprovising() {
+			apiError(w, http.StatusConflict, errors.New("already improvising"))
+			return
+		}
+		if !p.hasLearned() {
+			if err := p.Teach(); err != nil {
+				p.stopImprovising()
+				apiError(w, http.StatusConflict, errors.New("the AI has not learned yet: "+err.Error()))
+				return
+			}
+		}
+		go p.improvise()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	mux.HandleFunc("/save", post(func(w http.ResponseWriter, r *http.Request) {
+		if err := p.Save(); err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/playback", post(func(w http.ResponseWriter, r *http.Request) {
+		p.Playback()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			apiError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+			return
+		}
+		// the history is replaced when a session is loaded
+		p.RLock()
+		mus := p.MusicHistory
+		p.RUnlock()
+		mus.RLock()
+		history, err := json.Marshal(mus.Notes)
+		mus.RUnlock()
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(history)
+	})
+	return mux
+}
+
+// hasLearned returns whether the AI has learned anything. Other
+// generators are assumed to be ready to improvise.
+func (p *Player) hasLearned() bool {
+	ai := p.builtIn()
+	if ai == nil {
+		return true
+	}
+	ai.RLock()
+	defer ai.RUnlock()
+	return ai.HasLearned
+}
+
+// post only lets POST requests through to a handler
+func post(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			apiError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// apiError writes an error as JSON
+func apiError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,105 @@
+package player
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestAPI(t *testing.T) {
+	p := &Player{AI: ai2.New(64), MusicHistory: music.New(), MusicFuture: music.New()}
+	p.Generator = aiGenerator{p.AI}
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	api := p.api()
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := request("GET", "/history")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var history map[int]map[int]music.Note
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if history[10][60].Velocity != 80 {
+		t.Errorf("got %+v", history)
+	}
+
+	// a single note is not enough to learn from
+	w = request("POST", "/improvise")
+	if w.Code != http.StatusConflict {
+		t.Errorf("got %d: %s", w.Code, w.Body)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == "" {
+		t.Errorf("expected an error, got %s", w.Body)
+	}
+
+	// the improvisation is started from another goroutine
+	go p.startImprovising()
+	for i := 0; i < 100 && !strings.Contains(w.Body.String(), "already improvising"); i++ {
+		time.Sleep(time.Millisecond)
+		w = request("POST", "/improvise")
+	}
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "already improvising") {
+		t.Errorf("expected not to improvise twice, got %d: %s", w.Code, w.Body)
+	}
+
+	if w = request("GET", "/teach"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d: %s", w.Code, w.Body)
+	}
+	if w = request("POST", "/history"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d: %s", w.Code, w.Body)
+	}
+}
+
+// slowLicker is a learner whose licks wait to be let go
+type slowLicker struct {
+	learner
+	release chan bool
+}
+
+func (l *slowLicker) Lick(startBeat int) (*music.Music, error) {
+	<-l.release
+	return music.New(), nil
+}
+
+func TestAPIImprovisesOnce(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &slowLicker{release: make(chan bool)}
+	p.SetGenerator(l)
+	api := p.api()
+	codes := make(chan int)
+	for i := 0; i < 10; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest("POST", "/improvise", nil))
+			codes <- w.Code
+		}()
+	}
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		if <-codes == http.StatusAccepted {
+			accepted++
+		}
+	}
+	close(l.release)
+	if accepted != 1 {
+		t.Errorf("expected one of the requests to improvise, got %d", accepted)
+	}
+}
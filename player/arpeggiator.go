@@ -0,0 +1,118 @@
+package player
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// Arpeggiator breaks the chord that is held into single notes,
+// going "up", "down", "updown" or "random" through its pitches
+// every Rate ticks (a sixteenth note if not set)
+type Arpeggiator struct {
+	Mode string
+	Rate int
+}
+
+// ToggleArpeggiator turns the arpeggiator on or off
+func (p *Player) ToggleArpeggiator() {
+	p.Lock()
+	p.Arpeggiate = !p.Arpeggiate
+	on := p.Arpeggiate
+	p.arpNext = 0
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.ToggleArpeggiator",
+	}).Infof("Arpeggiator on: %v", on)
+}
+
+// hold keeps track of the keys that are held down, for the
+// arpeggiator and to find the ones that are stuck
+func (p *Player) hold(note music.Note) {
+	p.Lock()
+	defer p.Unlock()
+	if note.On {
+		p.held[note.Pitch] = note
+	} else {
+		delete(p.held, note.Pitch)
+	}
+}
+
+// arpeggiate adds the next note of the arpeggio to arpFuture just
+// before it is due. The pitches are taken from the keys held at that
+// moment, so the pattern follows the chord as it changes.
+func (p *Player) arpeggiate(tick int) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.Arpeggiate || len(p.held) == 0 {
+		p.arpNext = 0
+		p.arpStep = 0
+		return
+	}
+	rate := p.Arpeggiator.Rate
+	if rate < 1 {
+		rate = p.TicksPerBeat / 4
+	}
+	if rate < 1 {
+		rate = 1
+	}
+	if p.arpNext <= tick {
+		// a new chord starts right away
+		p.arpNext = tick + 1
+	}
+	if tick < p.arpNext-1 {
+		return
+	}
+
+	pitches := make([]int, 0, len(p.held))
+	for pitch := range p.held {
+		pitches = append(pitches, pitch)
+	}
+	sort.Ints(pitches)
+	note := p.held[pitches[arpeggioIndex(p.Arpeggiator.Mode, p.arpStep, len(pitches))]]
+	note.Beat = p.arpNext
+	note.Duration = rate * 9 / 10
+	if note.Duration < 1 {
+		note.Duration = 1
+	}
+	note.Source = music.Accompaniment
+	p.arpFuture.AddNote(note)
+	p.arpStep++
+	p.arpNext += rate
+}
+
+// arpeggioIndex returns which of n sorted pitches to play on a step
+func arpeggioIndex(mode string, step, n int) int {
+	switch mode {
+	case "down":
+		return n - 1 - step%n
+	case "updown":
+		if n == 1 {
+			return 0
+		}
+		// up and back down, without repeating the top and bottom
+		i := step % (2*n - 2)
+		if i >= n {
+			i = 2*n - 2 - i
+		}
+		return i
+	case "random":
+		return rand.Intn(n)
+	default:
+		return step % n
+	}
+}
+
+// arpNotes returns the notes of the arpeggio on a beat
+func (p *Player) arpNotes(beat int) (notes []music.Note) {
+	p.RLock()
+	arpFuture := p.arpFuture
+	p.RUnlock()
+	if arpFuture == nil {
+		return
+	}
+	_, notes = arpFuture.Get(beat)
+	return
+}
@@ -0,0 +1,54 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestArpeggioIndex(t *testing.T) {
+	expected := map[string][]int{
+		"up":     {0, 1, 2, 0, 1, 2},
+		"down":   {2, 1, 0, 2, 1, 0},
+		"updown": {0, 1, 2, 1, 0, 1},
+	}
+	for mode, indices := range expected {
+		for step, index := range indices {
+			if got := arpeggioIndex(mode, step, 3); got != index {
+				t.Errorf("%s step %d: got %d, expected %d", mode, step, got, index)
+			}
+		}
+	}
+	if arpeggioIndex("updown", 5, 1) != 0 {
+		t.Errorf("a single note should always be played")
+	}
+}
+
+func TestArpeggiate(t *testing.T) {
+	p := &Player{TicksPerBeat: 8, Arpeggiate: true, Arpeggiator: Arpeggiator{Mode: "up"},
+		arpFuture: music.New(), held: make(map[int]music.Note)}
+	p.hold(music.Note{On: true, Pitch: 64, Velocity: 80})
+	p.hold(music.Note{On: true, Pitch: 60, Velocity: 80})
+	played := make(map[int]int)
+	for tick := 10; tick < 20; tick++ {
+		p.arpeggiate(tick)
+		for _, note := range p.arpNotes(tick) {
+			if note.On {
+				played[tick] = note.Pitch
+			}
+		}
+		if tick == 14 {
+			// a new chord tone joins the pattern, which goes on from its step
+			p.hold(music.Note{On: true, Pitch: 67, Velocity: 80})
+		}
+	}
+	expected := map[int]int{11: 60, 13: 64, 15: 60, 17: 60, 19: 64}
+	if len(played) != len(expected) {
+		t.Errorf("got %+v", played)
+	}
+	for tick, pitch := range expected {
+		if played[tick] != pitch {
+			t.Errorf("expected %d at %d, got %+v", pitch, tick, played)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// chordTolerance is how close together, in ticks, the notes
+// of a chord are played for the bass to follow the harmony
+const chordTolerance = 20
+
+// ToggleBass starts or stops the bass line
+func (p *Player) ToggleBass() {
+	p.Lock()
+	p.Bass = !p.Bass
+	on := p.Bass
+	if !on {
+		p.bassFuture = music.New()
+	}
+	p.bassUntil = 0
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.ToggleBass",
+	}).Infof("Bass on: %v", on)
+}
+
+// repeatBass makes the bass line for the next BassBars bars just
+// before they start, following the harmony of the last BassBars bars
+// of the history. The first bass line starts on the next bar.
+func (p *Player) repeatBass(tick int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.repeatBass",
+	})
+	p.Lock()
+	barTicks := p.TimeSignature.barTicks(p.TicksPerBeat)
+	if !p.Bass || p.BassBars < 1 || barTicks < 1 {
+		p.Unlock()
+		return
+	}
+	if p.bassUntil <= tick {
+		p.bassUntil = tick + barTicks - p.barTick
+	}
+	if tick < p.bassUntil-1 {
+		p.Unlock()
+		return
+	}
+	start := p.bassUntil
+	p.bassUntil += p.BassBars * barTicks
+	bassFuture := p.bassFuture
+	p.Unlock()
+
+	chords := p.historySince(start - p.BassBars*barTicks).GetChords(chordTolerance)
+	bass, err := p.AI.GenerateBass(chords, start)
+	if err != nil {
+		logger.Debug(err.Error())
+		return
+	}
+	for _, note := range bass.Consolidate() {
+		note.Source = music.Accompaniment
+		bassFuture.AddNote(note)
+	}
+}
+
+// bassNotes returns the notes of the bass line on a beat
+func (p *Player) bassNotes(beat int) (notes []music.Note) {
+	p.RLock()
+	bassFuture := p.bassFuture
+	p.RUnlock()
+	if bassFuture == nil {
+		return
+	}
+	_, notes = bassFuture.Get(beat)
+	return
+}
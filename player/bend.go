@@ -0,0 +1,39 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/music"
+)
+
+// bend handles a move of the pitch bend wheel, which is recorded
+// in the history (and played straight away when Thru is on)
+func (p *Player) bend(value, channel int) {
+	if p.Thru {
+		p.Piano.PitchBend(channel, value)
+	}
+	go p.MusicHistory.AddBend(music.Bend{Beat: p.CurrentBeat(), Value: value, Channel: channel})
+}
+
+// addBendsToFuture adds bends to the future, shifted by offset ticks,
+// and then returns to the center any channel that is left bent
+func (p *Player) addBendsToFuture(bends []music.Bend, offset int) {
+	for _, bend := range append(bends, music.CenterBends(bends)...) {
+		bend.Beat += offset
+		p.MusicFuture.AddBend(bend)
+	}
+}
+
+// playBends plays the bends of the future on a beat. While the future
+// is muted only the returns to the center are played, so the notes
+// of the host are not bent, but no bend is left stuck either.
+func (p *Player) playBends(beat int, mute bool) {
+	hasBends, bends := p.MusicFuture.GetBends(beat)
+	if !hasBends {
+		return
+	}
+	for _, bend := range bends {
+		if mute && bend.Value != 0 {
+			continue
+		}
+		p.Piano.PitchBend(bend.Channel, bend.Value)
+	}
+}
@@ -0,0 +1,45 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Blend has the AI improvise in between the styles of two saved
+// models (see ai2.AI.Blend), mixed by BlendRatio, which is set to the
+// ratio and can be changed by the BlendController. The AI is not taught
+// the history while it blends, until it is made to Forget.
+func (p *Player) Blend(modelA, modelB string, ratio float64) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Blend",
+	})
+	a, err := ai2.LoadModel(modelA)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	b, err := ai2.LoadModel(modelB)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	err = p.AI.Blend(a, b, ratio)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	p.Lock()
+	p.BlendRatio = ratio
+	p.blending = true
+	p.taughtUntil = 0
+	p.Unlock()
+	logger.Infof("Blending %s and %s (%2.0f%%)", modelA, modelB, 100*ratio)
+	return
+}
+
+// isBlending returns whether the AI is blending two models
+func (p *Player) isBlending() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.blending
+}
@@ -0,0 +1,279 @@
+package player
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// modeler is a Generator whose model can be kept in a session bundle
+type modeler interface {
+	Model() (*ai2.Model, error)
+	UseModel(m *ai2.Model) error
+}
+
+var _ modeler = (*ai2.AI)(nil)
+
+// sessionVersion is the version of the bundles SaveSession writes. It
+// goes up whenever what is in them changes, so that LoadSession knows
+// how to read the older ones.
+const sessionVersion = 1
+
+// the files in a session bundle
+const (
+	bundleSettingsFile  = "session.json"
+	bundleHistoryFile   = "music_history.json"
+	bundleAIHistoryFile = "ai_music_history.json"
+	bundleModelFile     = "ai_model.json"
+)
+
+// sessionSettings are the settings of the player that are kept in a
+// session bundle, along with its Version
+type sessionSettings struct {
+	Version            int
+	BPM                int
+	Resolution         int `json:",omitempty"`
+	ListeningRateHertz int
+	Key                string
+	Mode               string
+	TimeSignature      TimeSignature
+	HighPassFilter     int
+	LowPassFilter      int `json:",omitempty"`
+	FilterHistory      bool
+	ConstrainToKey     bool
+}
+
+// SaveSession writes everything needed to carry on from where the
+// player is into a single zip file: the music history and the AI
+// history, what the AI has learned (if anything) and the settings that
+// go with them, such as the tempo, the key, the time signature and
+// the filters. LoadSession puts it all back. What is learned is only
+// kept if the Generator has a model, like the built-in AI.
+func (p *Player) SaveSession(filename string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.SaveSession",
+	})
+	p.RLock()
+	settings := sessionSettings{
+		Version:            sessionVersion,
+		BPM:                p.BPM,
+		Resolution:         p.Resolution,
+		ListeningRateHertz: p.ListeningRateHertz,
+		Key:                p.Key,
+		Mode:               p.Mode,
+		TimeSignature:      p.TimeSignature,
+		HighPassFilter:     p.HighPassFilter,
+		LowPassFilter:      p.LowPassFilter,
+		FilterHistory:      p.FilterHistory,
+		ConstrainToKey:     p.ConstrainToKey,
+	}
+	p.RUnlock()
+	files := make(map[string][]byte)
+	files[bundleSettingsFile], err = json.Marshal(settings)
+	if err != nil {
+		return
+	}
+	files[bundleHistoryFile], err = p.MusicHistory.Encode()
+	if err != nil {
+		return
+	}
+	files[bundleAIHistoryFile], err = p.AIHistory.Encode()
+	if err != nil {
+		return
+	}
+	// there is no model if nothing has been learned
+	if m, ok := p.generator().(modeler); ok {
+		if model, errModel := m.Model(); errModel == nil {
+			files[bundleModelFile], err = json.Marshal(model)
+			if err != nil {
+				return
+			}
+		}
+	}
+	err = writeBundle(filename, files)
+	if err != nil {
+		return
+	}
+	logger.Infof("Saved the session to %s", filename)
+	return
+}
+
+// validate returns an error for the first setting that makes no sense,
+// like the Options of the same settings
+func (s sessionSettings) validate() error {
+	switch {
+	case s.Version < 1:
+		return errors.New("it is not a session")
+	case s.Version > sessionVersion:
+		return fmt.Errorf("it is from a newer version (%d) of the session format", s.Version)
+	case s.BPM < MinimumBPM:
+		return fmt.Errorf("BPM must be at least %d, not %d", MinimumBPM, s.BPM)
+	case s.Resolution == 0 && s.ListeningRateHertz*60/s.BPM < 1:
+		return fmt.Errorf("the metronome can not tick %d times a second at %d BPM", s.ListeningRateHertz, s.BPM)
+	}
+	if err := s.TimeSignature.validate(); err != nil {
+		return err
+	}
+	return Options{
+		BPM:            s.BPM,
+		ListenHertz:    s.ListeningRateHertz,
+		Resolution:     s.Resolution,
+		HighPassFilter: s.HighPassFilter,
+		LowPassFilter:  s.LowPassFilter,
+		Key:            s.Key,
+		Mode:           s.Mode,
+	}.validate()
+}
+
+// writeBundle writes files to a zip file, with the settings first,
+// all at once so that it is never left half written
+func writeBundle(filename string, files map[string][]byte) (err error) {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := zip.NewWriter(tmp)
+	for _, name := range []string{bundleSettingsFile, bundleHistoryFile, bundleAIHistoryFile, bundleModelFile} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		var f io.Writer
+		f, err = w.Create(name)
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if err != nil {
+			tmp.Close()
+			return
+		}
+	}
+	err = w.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// LoadSession restores a session bundle made by SaveSession: the
+// histories and the settings take the place of the ones of the player,
+// and the AI plays from the model in it, or forgets what it learned if
+// there is none. Nothing is changed if the bundle can not be read.
+func (p *Player) LoadSession(filename string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.LoadSession",
+	})
+	files, err := readBundle(filename)
+	if err != nil {
+		return
+	}
+	var settings sessionSettings
+	if err = json.Unmarshal(files[bundleSettingsFile], &settings); err != nil {
+		return fmt.Errorf("could not read the settings of %s: %s", filename, err.Error())
+	}
+	if err = settings.validate(); err != nil {
+		return fmt.Errorf("could not load %s: %s", filename, err.Error())
+	}
+	history, err := music.Decode(files[bundleHistoryFile])
+	if err != nil {
+		return
+	}
+	aiHistory, err := music.Decode(files[bundleAIHistoryFile])
+	if err != nil {
+		return
+	}
+	var model *ai2.Model
+	if data, ok := files[bundleModelFile]; ok {
+		model, err = ai2.DecodeModel(data)
+		if err != nil {
+			return
+		}
+		if len(model.Chords) < p.AI.WindowSizeMax {
+			return fmt.Errorf("the model of %s has too few chords", filename)
+		}
+	}
+
+	for _, m := range []*music.Music{history, aiHistory} {
+		m.BPM = settings.BPM
+		m.Key, m.Mode = settings.Key, settings.Mode
+		m.BeatsPerBar, m.BeatUnit = settings.TimeSignature.Numerator, settings.TimeSignature.Denominator
+	}
+	p.Lock()
+	p.Key, p.Mode = settings.Key, settings.Mode
+	p.HighPassFilter, p.LowPassFilter = settings.HighPassFilter, settings.LowPassFilter
+	p.FilterHistory = settings.FilterHistory
+	p.ConstrainToKey = settings.ConstrainToKey
+	p.ListeningRateHertz = settings.ListeningRateHertz
+	p.Resolution = settings.Resolution
+	p.MusicHistory = history
+	p.AIHistory = aiHistory
+	p.learnFrom = 0
+	p.taughtUntil = 0
+	p.Unlock()
+	p.AI.SetFilters(settings.HighPassFilter, settings.LowPassFilter)
+	p.SetTimeSignature(settings.TimeSignature.Numerator, settings.TimeSignature.Denominator)
+	// this gives the history the tempo, and the AI its ticks per beat
+	p.SetBPM(settings.BPM)
+	g := p.generator()
+	if m, ok := g.(modeler); ok && model != nil {
+		err = m.UseModel(model)
+	} else if f, ok := g.(forgetter); ok {
+		f.Forget()
+	}
+	logger.Infof("Loaded the session from %s", filename)
+	return
+}
+
+// bundleName returns the name of the session bundle of
+// music saved in a file, next to it
+func bundleName(filename string) string {
+	filename = strings.TrimSuffix(filename, ".gz")
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".zip"
+}
+
+// readBundle reads all the files of a zip file
+func readBundle(filename string) (files map[string][]byte, err error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	files = make(map[string][]byte)
+	for _, f := range r.File {
+		var rc io.ReadCloser
+		rc, err = f.Open()
+		if err != nil {
+			return
+		}
+		files[f.Name], err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return
+		}
+	}
+	for _, name := range []string{bundleSettingsFile, bundleHistoryFile, bundleAIHistoryFile} {
+		if _, ok := files[name]; !ok {
+			return nil, errors.New("the session has no " + name)
+		}
+	}
+	return
+}
@@ -0,0 +1,217 @@
+package player
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := NewWithPiano(piano.NewMock(), 100, 48, 0, 60, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetTimeSignature(3, 4)
+	p.Key, p.Mode = "D", "minor"
+	p.LowPassFilter = 90
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 62, Velocity: 80, Beat: 10, Offset: 0.5})
+	p.MusicHistory.AddNote(music.Note{Pitch: 62, Beat: 20})
+	p.AIHistory.AddNote(music.Note{On: true, Pitch: 74, Velocity: 70, Beat: 30, Source: music.AI})
+	model := &ai2.Model{TicksPerBeat: p.TicksPerBeat}
+	for i := 0; i < p.AI.WindowSizeMax; i++ {
+		model.Chords = append(model.Chords, ai2.Chord{Pitches: []int{62 + i%12}, Velocity: 80, Duration: 10, Lag: 10})
+		model.ChordStrings = append(model.ChordStrings, strconv.Itoa(62+i%12))
+	}
+	model.ChordStrings[1] = "65-69"
+	if err = p.AI.UseModel(model); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "session.zip")
+	if err = p.SaveSession(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = q.LoadSession(filename); err != nil {
+		t.Fatal(err)
+	}
+	if q.BPM != 100 || q.TicksPerBeat != p.TicksPerBeat || q.TimeSignature != (TimeSignature{3, 4}) || q.Key != "D" || q.Mode != "minor" || q.HighPassFilter != 60 || q.LowPassFilter != 90 {
+		t.Errorf("expected the settings back, got %d BPM, %d ticks, %+v, %s %s, %d-%d", q.BPM, q.TicksPerBeat, q.TimeSignature, q.Key, q.Mode, q.HighPassFilter, q.LowPassFilter)
+	}
+	if notes := q.MusicHistory.GetRange(0, 100); len(notes) != 2 || notes[0].Offset != 0.5 || q.MusicHistory.BeatsPerBar != 3 {
+		t.Errorf("expected the history back, got %+v", notes)
+	}
+	if notes := q.AIHistory.GetAll(); len(notes) != 1 || notes[0].Source != music.AI {
+		t.Errorf("expected the AI history back, got %+v", notes)
+	}
+	if loaded, err := q.AI.Model(); err != nil || len(loaded.Chords) != len(model.Chords) || loaded.ChordStrings[1] != "65-69" {
+		t.Errorf("expected the AI model back, got %+v (%v)", loaded, err)
+	}
+
+	// a bundle from a newer version, with settings that make no sense
+	// or with too small a model is not loaded
+	valid := sessionSettings{Version: sessionVersion, BPM: 80, ListeningRateHertz: 64, TimeSignature: TimeSignature{4, 4}}
+	newer, noRate, noSignature := valid, valid, valid
+	newer.Version++
+	noRate.ListeningRateHertz = 0
+	noSignature.TimeSignature.Denominator = 3
+	small, _ := json.Marshal(ai2.Model{Chords: model.Chords[:5], ChordStrings: model.ChordStrings[:5]})
+	for i, bad := range []struct {
+		settings sessionSettings
+		model    []byte
+	}{{newer, nil}, {noRate, nil}, {noSignature, nil}, {valid, small}} {
+		settings, _ := json.Marshal(bad.settings)
+		files := map[string][]byte{
+			bundleSettingsFile:  settings,
+			bundleHistoryFile:   []byte("{}"),
+			bundleAIHistoryFile: []byte("{}"),
+		}
+		if bad.model != nil {
+			files[bundleModelFile] = bad.model
+		}
+		filename := filepath.Join(dir, "bad.zip")
+		if err = writeBundle(filename, files); err != nil {
+			t.Fatal(err)
+		}
+		if err = q.LoadSession(filename); err == nil || q.BPM != 100 || len(q.MusicHistory.GetAll()) != 2 {
+			t.Errorf("expected session %d not to be loaded, got %v and %d BPM", i, err, q.BPM)
+		}
+	}
+}
+
+// modelLearner is a learner that keeps what it learned in a model
+type modelLearner struct {
+	learner
+	model *ai2.Model
+}
+
+func (l *modelLearner) Model() (*ai2.Model, error) {
+	if l.model == nil {
+		return nil, errors.New("nothing has been learned")
+	}
+	return l.model, nil
+}
+
+func (l *modelLearner) UseModel(m *ai2.Model) error {
+	l.model = m
+	return nil
+}
+
+func TestSessionGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &ai2.Model{TicksPerBeat: p.TicksPerBeat}
+	for i := 0; i < p.AI.WindowSizeMax; i++ {
+		model.Chords = append(model.Chords, ai2.Chord{Pitches: []int{70 + i%12}, Velocity: 80, Duration: 10, Lag: 10})
+		model.ChordStrings = append(model.ChordStrings, strconv.Itoa(70+i%12))
+	}
+	l := &modelLearner{model: model}
+	p.SetGenerator(l)
+	filename := filepath.Join(dir, "session.zip")
+	if err = p.SaveSession(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// the model goes to the generator, not to the built-in AI
+	q, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &modelLearner{}
+	q.SetGenerator(other)
+	if err = q.LoadSession(filename); err != nil {
+		t.Fatal(err)
+	}
+	if other.model == nil || len(other.model.Chords) != len(model.Chords) {
+		t.Errorf("expected the generator to get the model, got %+v", other.model)
+	}
+	if _, err = q.AI.Model(); err == nil {
+		t.Error("expected the built-in AI not to learn the model")
+	}
+
+	// a generator without a model has none to save
+	p.SetGenerator(&learner{})
+	if err = p.SaveSession(filename); err != nil {
+		t.Fatal(err)
+	}
+	files, err := readBundle(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files[bundleModelFile]; ok {
+		t.Error("expected no model in the session")
+	}
+}
+
+func TestLoadSessionWhileLearning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := NewWithPiano(piano.NewMock(), 100, 48, 0, 70, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.LowPassFilter = 90
+	filename := filepath.Join(dir, "session.zip")
+	if err = p.SaveSession(filename); err != nil {
+		t.Fatal(err)
+	}
+	history := music.New()
+	for beat := 1; beat < 200; beat += 5 {
+		history.AddNote(music.Note{On: true, Pitch: 66 + beat%12, Velocity: 80, Beat: beat})
+		history.AddNote(music.Note{Pitch: 66 + beat%12, Beat: beat + 3})
+	}
+	q, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if err := q.LoadSession(filename); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for learning := true; learning; {
+		select {
+		case err = <-done:
+			learning = false
+		default:
+			q.AI.Learn(history)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.AI.HighPassFilter != 70 || q.AI.LowPassFilter != 90 {
+		t.Errorf("expected the filters of the session, got %d-%d", q.AI.HighPassFilter, q.AI.LowPassFilter)
+	}
+}
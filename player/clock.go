@@ -0,0 +1,115 @@
+package player
+
+import (
+	"math"
+	"time"
+
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// clocksPerBeat is the number of MIDI clocks in a quarter note
+	clocksPerBeat = 24
+	// clocksToAverage is the number of clocks the tempo is measured over
+	clocksToAverage = 4 * clocksPerBeat
+)
+
+// clockEvent is a MIDI clock message, and when it came in
+type clockEvent struct {
+	status int64
+	at     time.Time
+}
+
+// externalClock counts the MIDI clocks of ExternalClock
+type externalClock struct {
+	// clocks is the number of clocks since the last beat
+	clocks int
+	// times are when the last clocksToAverage clocks came in
+	times []time.Time
+}
+
+// followClock handles a message of the external clock, and returns
+// the number of ticks the metronome moves on by. The 24 clocks of a
+// beat are spread over the ticks of the beat, and at the end of every
+// beat the BPM is set to the tempo of the last four beats of clocks.
+// Start starts counting the bars again, Stop pauses and Continue
+// resumes.
+func (p *Player) followClock(event clockEvent) (ticks int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.followClock",
+	})
+	switch event.status {
+	case piano.ClockStart:
+		logger.Debug("Clock started")
+		p.clock = externalClock{}
+		p.resetBars()
+		p.Resume()
+	case piano.ClockContinue:
+		logger.Debug("Clock continued")
+		p.Resume()
+	case piano.ClockStop:
+		logger.Debug("Clock stopped")
+		p.Pause()
+	case piano.TimingClock:
+		c := &p.clock
+		c.times = append(c.times, event.at)
+		if len(c.times) > clocksToAverage+1 {
+			c.times = c.times[1:]
+		}
+		_, ticksPerBeat := p.tempo()
+		before := c.clocks * ticksPerBeat / clocksPerBeat
+		c.clocks++
+		ticks = c.clocks*ticksPerBeat/clocksPerBeat - before
+		if c.clocks == clocksPerBeat {
+			c.clocks = 0
+			p.measureClockTempo()
+		}
+	}
+	return
+}
+
+// sendClock sends the MIDI clocks that fall on a tick, when SendClock
+// is on. There are always 24 clocks to a beat, spread over the ticks of
+// the beat, so with fewer than 24 ticks a beat some are sent together.
+func (p *Player) sendClock(tick int) {
+	if !p.SendClock {
+		return
+	}
+	_, ticksPerBeat := p.tempo()
+	if ticksPerBeat < 1 {
+		return
+	}
+	// the clocks from the start of the beat until a point in it
+	clocksUntil := func(ticks int) int {
+		return (ticks*clocksPerBeat + ticksPerBeat - 1) / ticksPerBeat
+	}
+	phase := tick % ticksPerBeat
+	for n := clocksUntil(phase+1) - clocksUntil(phase); n > 0; n-- {
+		p.Piano.SendClock(piano.TimingClock)
+	}
+}
+
+// sendClockMessage sends a start, stop or continue, when SendClock is on
+func (p *Player) sendClockMessage(status int) {
+	if p.SendClock {
+		p.Piano.SendClock(status)
+	}
+}
+
+// measureClockTempo sets the BPM to the tempo of the clocks
+func (p *Player) measureClockTempo() {
+	times := p.clock.times
+	if len(times) <= clocksPerBeat {
+		return
+	}
+	elapsed := times[len(times)-1].Sub(times[0])
+	if elapsed <= 0 {
+		return
+	}
+	beats := float64(len(times)-1) / clocksPerBeat
+	bpm := int(math.Round(beats * float64(time.Minute) / float64(elapsed)))
+	if current, _ := p.tempo(); bpm != current {
+		p.SetBPM(bpm)
+	}
+}
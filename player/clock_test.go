@@ -0,0 +1,66 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestExternalClock(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetResolution(10)
+	p.followClock(clockEvent{status: piano.ClockStop})
+	if !p.Paused() {
+		t.Errorf("stop should pause")
+	}
+	p.followClock(clockEvent{status: piano.ClockStart})
+	if p.Paused() {
+		t.Errorf("start should resume")
+	}
+	// four beats at 100 BPM
+	start := time.Now()
+	clockTime := time.Minute / 100 / clocksPerBeat
+	ticks := 0
+	for clock := 0; clock <= clocksToAverage; clock++ {
+		if clock == clocksPerBeat {
+			if ticks != 10 {
+				t.Errorf("got %d ticks in a beat, expected 10", ticks)
+			}
+		}
+		ticks += p.followClock(clockEvent{piano.TimingClock, start.Add(time.Duration(clock) * clockTime)})
+	}
+	if ticks != 40 {
+		t.Errorf("got %d ticks in four beats, expected 40", ticks)
+	}
+	if bpm, ticksPerBeat := p.tempo(); bpm != 100 || ticksPerBeat != 10 {
+		t.Errorf("got %d BPM (%d ticks / beat), expected 100 BPM", bpm, ticksPerBeat)
+	}
+}
+
+func TestSendClock(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SendClock = true
+	for _, ticksPerBeat := range []int{10, 96} {
+		p.SetResolution(ticksPerBeat)
+		before := mock.ClockMessages(piano.TimingClock)
+		for tick := 1; tick <= 2*ticksPerBeat; tick++ {
+			p.sendClock(tick)
+		}
+		if clocks := mock.ClockMessages(piano.TimingClock) - before; clocks != 2*clocksPerBeat {
+			t.Errorf("got %d clocks in two beats of %d ticks, expected %d", clocks, ticksPerBeat, 2*clocksPerBeat)
+		}
+	}
+	p.Pause()
+	p.Resume()
+	if mock.ClockMessages(piano.ClockStop) != 1 || mock.ClockMessages(piano.ClockContinue) != 1 {
+		t.Errorf("expected pausing to stop and continue the clock")
+	}
+}
@@ -0,0 +1,416 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// actions are what can be triggered by the control keys
+var actions = map[string]func(p *Player){
+	"save": func(p *Player) {
+		p.Save()
+	},
+	"playback": func(p *Player) {
+		p.Playback()
+	},
+	"export": func(p *Player) {
+		p.ExportMIDI()
+	},
+	"bass": func(p *Player) {
+		p.ToggleBass()
+	},
+	"drums": func(p *Player) {
+		p.ToggleDrums()
+	},
+	"arpeggiator": func(p *Player) {
+		p.ToggleArpeggiator()
+	},
+	"session": func(p *Player) {
+		p.NewSession("")
+	},
+	"bundle": func(p *Player) {
+		p.SaveSession(bundleName(p.historyFile()))
+	},
+	"metronome": func(p *Player) {
+		p.ToggleMetronome()
+	},
+	"pause": func(p *Player) {
+		if p.Paused() {
+			p.Resume()
+		} else {
+			p.Pause()
+		}
+	},
+	"tap": func(p *Player) {
+		p.TapTempo()
+	},
+	"slower": func(p *Player) {
+		bpm, _ := p.tempo()
+		p.SetBPM(bpm - 5)
+	},
+	"faster": func(p *Player) {
+		bpm, _ := p.tempo()
+		p.SetBPM(bpm + 5)
+	},
+	"teach": func(p *Player) {
+		p.Teach()
+	},
+	"forget": func(p *Player) {
+		p.Forget()
+	},
+	"undo": func(p *Player) {
+		p.UndoPhrase()
+	},
+	"improvise": func(p *Player) {
+		p.Improvisation()
+	},
+	"harmonize": func(p *Player) {
+		p.Harmonize()
+	},
+	"retrograde": func(p *Player) {
+		p.Retrograde()
+	},
+	"invert": func(p *Player) {
+		p.Invert()
+	},
+	"augment": func(p *Player) {
+		p.Augment(2)
+	},
+	"diminish": func(p *Player) {
+		p.Augment(0.5)
+	},
+	"panic": func(p *Player) {
+		p.Panic()
+	},
+	"transpose-up": func(p *Player) {
+		p.Transpose(1)
+	},
+	"transpose-down": func(p *Player) {
+		p.Transpose(-1)
+	},
+	"step-mode": func(p *Player) {
+		p.ToggleStepMode()
+	},
+	"step": func(p *Player) {
+		p.Step()
+	},
+	"next-instrument": func(p *Player) {
+		p.NextInstrument()
+	},
+	"quantize": func(p *Player) {
+		_, ticksPerBeat := p.tempo()
+		p.MusicHistory.Quantize(ticksPerBeat / 4)
+		p.relearn()
+	},
+}
+
+// DefaultControlMap returns the control keys for an 88-key keyboard:
+// the bottom five keys save, play back and export the history, toggle
+// the metronome and pause, and the top keys undo the last phrase, make
+// the AI forget, turn off stuck notes, set the tempo, teach and improvise.
+func DefaultControlMap() map[int]string {
+	return map[int]string{
+		21:  "save",
+		22:  "playback",
+		23:  "export",
+		24:  "metronome",
+		25:  "pause",
+		101: "undo",
+		102: "forget",
+		103: "panic",
+		104: "tap",
+		105: "slower",
+		106: "faster",
+		107: "teach",
+		108: "improvise",
+	}
+}
+
+// SetControl assigns an action to the key of a pitch, replacing
+// whatever key the action had before. An empty action makes the
+// key a normal note again.
+func (p *Player) SetControl(pitch int, action string) (err error) {
+	if _, ok := actions[action]; !ok && action != "" {
+		return fmt.Errorf("unknown action '%s'", action)
+	}
+	p.Lock()
+	defer p.Unlock()
+	for otherPitch, otherAction := range p.ControlMap {
+		if otherAction == action {
+			delete(p.ControlMap, otherPitch)
+		}
+	}
+	if action == "" {
+		delete(p.ControlMap, pitch)
+	} else {
+		p.ControlMap[pitch] = action
+	}
+	return
+}
+
+// control returns the action of a pitch, if it is a control key
+func (p *Player) control(pitch int) (action string, isControl bool) {
+	p.RLock()
+	defer p.RUnlock()
+	action, isControl = p.ControlMap[pitch]
+	return
+}
+
+func (p *Player) doAction(action string) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.doAction",
+	})
+	f, ok := actions[action]
+	if !ok {
+		logger.Warnf("Unknown action '%s'", action)
+		return
+	}
+	logger.Debugf("Doing '%s'", action)
+	f(p)
+}
+
+// Panic turns off all the notes, including the ones scheduled
+// to be turned off later
+func (p *Player) Panic() (err error) {
+	p.scheduler.reset(p.CurrentBeat())
+	p.dropLate()
+	err = p.Piano.Panic()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"function": "Player.Panic",
+		}).Error(err.Error())
+	}
+	return
+}
+
+// Forget makes the AI forget what it has learned, and then teaches
+// it again with only the last RecentBeats beats of the history
+func (p *Player) Forget() (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Forget",
+	})
+	_, ticksPerBeat := p.tempo()
+	p.Lock()
+	p.learnFrom = p.CurrentBeat() - p.RecentBeats*ticksPerBeat
+	if p.learnFrom < 0 {
+		p.learnFrom = 0
+	}
+	p.blending = false
+	p.taughtUntil = 0
+	p.Unlock()
+	if f, ok := p.generator().(forgetter); ok {
+		f.Forget()
+		logger.Info("Forgot what was learned")
+	}
+	return p.Teach()
+}
+
+// UndoPhrase removes the phrase that was played last, everything
+// since the last silence, from the music history
+func (p *Player) UndoPhrase() {
+	p.RLock()
+	phraseStart := p.phraseStart
+	p.RUnlock()
+	phrase := p.MusicHistory.GetRange(phraseStart, math.MaxInt32)
+	removed := p.MusicHistory.RemoveLast(len(phrase))
+	p.relearn()
+	log.WithFields(log.Fields{
+		"function": "Player.UndoPhrase",
+	}).Infof("Removed %d notes", removed)
+}
+
+// teachingHistory returns the part of the music history that
+// the AI learns from, which is all of it until the AI forgets
+func (p *Player) teachingHistory() *music.Music {
+	p.RLock()
+	learnFrom := p.learnFrom
+	p.RUnlock()
+	if learnFrom <= 0 {
+		return p.MusicHistory
+	}
+	return p.historySince(learnFrom)
+}
+
+// relearn makes the AI learn from all of the teaching history the
+// next time it is taught, after notes it has learned have changed
+func (p *Player) relearn() {
+	p.Lock()
+	p.taughtUntil = 0
+	p.Unlock()
+}
+
+// historySince returns a copy of the music history from a beat on
+func (p *Player) historySince(beat int) *music.Music {
+	recent := music.New()
+	p.MusicHistory.RLock()
+	recent.BPM = p.MusicHistory.BPM
+	recent.TicksPerBeat = p.MusicHistory.TicksPerBeat
+	p.MusicHistory.RUnlock()
+	for _, note := range p.MusicHistory.GetRange(beat, math.MaxInt32) {
+		recent.AddNote(note)
+	}
+	return recent
+}
+
+// Transpose shifts the music history by a number of semitones,
+// dropping any notes that go out of range
+func (p *Player) Transpose(semitones int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Transpose",
+	})
+	dropped := p.MusicHistory.Transpose(semitones)
+	p.relearn()
+	if dropped > 0 {
+		logger.Warnf("Dropped %d notes that were out of range", dropped)
+	}
+	logger.Infof("Transposed history by %d semitones", semitones)
+}
+
+// Save writes the music history to MusicHistoryFile, what the AI
+// played (if it has changed) next to it, and what the AI has learned
+// (if anything) to AIModelFile
+func (p *Player) Save() (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Save",
+	})
+	historyFile := p.historyFile()
+	err = p.saveMusic(p.MusicHistory, historyFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	logger.Infof("Saved %s", historyFile)
+	p.publish(Event{Type: Saved, Beat: p.CurrentBeat(), File: historyFile})
+	if p.AIHistory.Unsaved() {
+		var aiHistoryFile string
+		aiHistoryFile, err = p.SaveAIHistory()
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		logger.Infof("Saved %s", aiHistoryFile)
+		p.publish(Event{Type: Saved, Beat: p.CurrentBeat(), File: aiHistoryFile})
+	}
+	ai := p.builtIn()
+	if ai == nil || !p.hasLearned() {
+		return
+	}
+	err = ai.Save(p.AIModelFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	logger.Infof("Saved %s", p.AIModelFile)
+	p.publish(Event{Type: Saved, Beat: p.CurrentBeat(), File: p.AIModelFile})
+	return
+}
+
+// saveMusic saves music to a file, in the compact form
+// if CompactHistory is set
+func (p *Player) saveMusic(mus *music.Music, filename string) error {
+	p.RLock()
+	compact := p.CompactHistory
+	p.RUnlock()
+	if compact {
+		return mus.SaveCompact(filename)
+	}
+	return mus.Save(filename)
+}
+
+// midiName returns the name of the MIDI file that music saved
+// in a file is exported to, next to it
+func midiName(filename string) string {
+	filename = strings.TrimSuffix(filename, ".gz")
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mid"
+}
+
+// autosave saves the music history to MusicHistoryFile every
+// AutosaveInterval, whenever it has changed since it was saved
+func (p *Player) autosave() {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.autosave",
+	})
+	ticker := time.NewTicker(p.AutosaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !p.MusicHistory.Unsaved() {
+			continue
+		}
+		historyFile := p.historyFile()
+		err := p.saveMusic(p.MusicHistory, historyFile)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+		logger.Debugf("Autosaved %s", historyFile)
+		p.publish(Event{Type: Saved, Beat: p.CurrentBeat(), File: historyFile})
+	}
+}
+
+// Playback plays the music history from the beginning, after
+// counting in CountIn bars and transposed by PlaybackTranspose,
+// and stops the loop if there is one
+func (p *Player) Playback() {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Playback",
+	})
+	logger.Info("Playing back history")
+	p.StopLoop()
+	p.RLock()
+	countIn := p.countInTicks()
+	semitones := p.PlaybackTranspose
+	p.RUnlock()
+	notes, dropped := p.MusicHistory.Consolidate().Transpose(semitones)
+	if dropped > 0 {
+		logger.Warnf("Dropped %d notes that were out of range", dropped)
+	}
+	p.addToFuture(notes, countIn)
+	p.addBendsToFuture(p.MusicHistory.AllBends(), countIn)
+	bpm, _ := p.tempo()
+	p.Piano.PlayNotes(p.scheduler.reset(p.CurrentBeat()), bpm)
+	p.setTick(0)
+	p.resetBars()
+	p.Lock()
+	p.resetSwing = true
+	p.countInUntil = countIn
+	p.Unlock()
+	if countIn > 0 {
+		// the first click of the count-in is on this tick
+		p.click()
+	}
+}
+
+// ExportMIDI writes the music history as a standard MIDI file
+// next to MusicHistoryFile, and what the AI played (if anything)
+// as another one next to it
+func (p *Player) ExportMIDI() (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.ExportMIDI",
+	})
+	historyFile := p.historyFile()
+	midiFile := midiName(historyFile)
+	err = p.MusicHistory.ExportMIDI(midiFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	logger.Infof("Exported %s", midiFile)
+	if p.AIHistory.End() == 0 {
+		return
+	}
+	aiHistoryFile := p.aiHistoryFile()
+	aiMidiFile := midiName(aiHistoryFile)
+	err = p.AIHistory.ExportMIDI(aiMidiFile)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	logger.Infof("Exported %s", aiMidiFile)
+	return
+}
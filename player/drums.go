@@ -0,0 +1,112 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// drummer is a Generator that can learn and play drums
+type drummer interface {
+	LearnDrums(mus *music.Music) error
+	GenerateDrums(bars int, startBeat int) (*music.Music, error)
+}
+
+var _ drummer = (*ai2.AI)(nil)
+
+// drummer returns the Generator if it can play drums, or else the
+// built-in AI, or nil if there is neither
+func (p *Player) drummer() drummer {
+	if d, ok := p.generator().(drummer); ok {
+		return d
+	}
+	if p.AI == nil {
+		return nil
+	}
+	return p.AI
+}
+
+// ToggleDrums starts or stops the drum groove
+func (p *Player) ToggleDrums() {
+	p.Lock()
+	p.Drums = !p.Drums
+	on := p.Drums
+	if !on {
+		p.drumFuture = music.New()
+	}
+	p.drumsUntil = 0
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.ToggleDrums",
+	}).Infof("Drums on: %v", on)
+}
+
+// repeatDrums makes the next bar of the groove just before it starts,
+// so that it follows any change of the time signature or of what the
+// AI learned. The first bar of drums starts on the next bar.
+func (p *Player) repeatDrums(tick int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.repeatDrums",
+	})
+	p.Lock()
+	barTicks := p.TimeSignature.barTicks(p.TicksPerBeat)
+	if !p.Drums || barTicks < 1 {
+		p.Unlock()
+		return
+	}
+	if p.drumsUntil <= tick {
+		p.drumsUntil = tick + barTicks - p.barTick
+	}
+	if tick < p.drumsUntil-1 {
+		p.Unlock()
+		return
+	}
+	start := p.drumsUntil
+	p.drumsUntil += barTicks
+	drumFuture := p.drumFuture
+	p.Unlock()
+
+	d := p.drummer()
+	if d == nil {
+		return
+	}
+	drums, err := d.GenerateDrums(1, start)
+	if err != nil {
+		logger.Debug(err.Error())
+		return
+	}
+	for _, note := range drums.GetAll() {
+		note.Source = music.Accompaniment
+		drumFuture.AddNote(note)
+	}
+}
+
+// drumNotes returns the notes of the drums on a beat
+func (p *Player) drumNotes(beat int) (notes []music.Note) {
+	p.RLock()
+	drumFuture := p.drumFuture
+	p.RUnlock()
+	if drumFuture == nil {
+		return
+	}
+	_, notes = drumFuture.Get(beat)
+	return
+}
+
+// teachDrums teaches the drummer the groove of the drums
+// that were played, if any were
+func (p *Player) teachDrums() {
+	d := p.drummer()
+	if d == nil {
+		return
+	}
+	history := p.teachingHistory().Filter(func(note music.Note) bool {
+		return note.Source == music.Human
+	})
+	err := d.LearnDrums(history)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"function": "Player.teachDrums",
+		}).Debug(err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package player
+
+import (
+	"math"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// the furthest apart and the most echoes that the control changes set
+const (
+	maxEchoDelay    = 4
+	maxEchoFeedback = 8
+)
+
+// Echo repeats the notes played on the keyboard Feedback times, every
+// Delay beats (to the nearest sixteenth note, so that it keeps to the
+// beat), with each repeat Decay times as loud as the one before. The
+// DelayController and FeedbackController control changes set the Delay
+// and Feedback, if they are set.
+type Echo struct {
+	Delay              float64
+	Feedback           int
+	Decay              float64
+	DelayController    int
+	FeedbackController int
+}
+
+// echo adds the repeats of a note played on the keyboard to the
+// echoes to come. The repeats are never recorded, only the note itself.
+func (p *Player) echo(note music.Note) {
+	p.RLock()
+	echo := p.Echo
+	sixteenth := p.TicksPerBeat / 4
+	echoFuture := p.echoFuture
+	p.RUnlock()
+	if echoFuture == nil {
+		return
+	}
+	if sixteenth < 1 {
+		sixteenth = 1
+	}
+	delay := int(math.Floor(echo.Delay*4+0.5)) * sixteenth
+	if delay < 1 || echo.Feedback < 1 {
+		return
+	}
+	velocity := float64(note.Velocity)
+	for i := 1; i <= echo.Feedback; i++ {
+		repeat := note
+		repeat.Beat += i * delay
+		repeat.Source = music.Echo
+		if note.On {
+			velocity *= echo.Decay
+			repeat.Velocity = int(velocity + 0.5)
+			if repeat.Velocity < 1 {
+				break
+			}
+		}
+		echoFuture.AddNote(repeat)
+	}
+}
+
+// controlEcho sets the Delay or Feedback of the Echo from a control
+// change, and returns whether it was one of their controllers
+func (p *Player) controlEcho(controller, value int) bool {
+	p.Lock()
+	defer p.Unlock()
+	switch {
+	case p.Echo.DelayController > 0 && controller == p.Echo.DelayController:
+		p.Echo.Delay = maxEchoDelay * float64(value) / 127
+	case p.Echo.FeedbackController > 0 && controller == p.Echo.FeedbackController:
+		p.Echo.Feedback = int(float64(maxEchoFeedback*value)/127 + 0.5)
+	default:
+		return false
+	}
+	return true
+}
+
+// echoNotes returns the repeats of the Echo on a beat
+func (p *Player) echoNotes(beat int) (notes []music.Note) {
+	p.RLock()
+	echoFuture := p.echoFuture
+	p.RUnlock()
+	if echoFuture == nil {
+		return
+	}
+	_, notes = echoFuture.Get(beat)
+	return
+}
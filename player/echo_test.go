@@ -0,0 +1,67 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestEcho(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.Echo = Echo{Delay: 0.5, Feedback: 2, Decay: 0.5, FeedbackController: 20}
+	go p.Listen()
+	waitFor := func(n int) {
+		for i := 0; i < 100 && len(p.MusicHistory.GetAll()) < n; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// a note of the AI where the first echo goes
+	p.MusicFuture.AddNote(music.Note{On: true, Pitch: 70, Velocity: 60, Beat: 22, Source: music.AI})
+	p.setTick(10)
+	mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+	waitFor(1)
+	if note := p.MusicFuture.Notes[22][70]; note.Source != music.AI || p.MusicFuture.HasFuture(23) {
+		t.Errorf("expected the echoes to stay out of the future, got %+v", p.MusicFuture.GetAll())
+	}
+	p.MusicFuture.Reset()
+	p.setTick(20)
+	mock.Send(portmidi.Event{Status: piano.NoteOff, Data1: 70})
+	waitFor(2)
+	if notes := p.MusicHistory.GetAll(); len(notes) != 2 {
+		t.Fatalf("expected only the note to be recorded, got %+v", notes)
+	}
+
+	// the echoes are played while the AI is muted for the keys
+	for beat := 11; beat < 80; beat++ {
+		p.Emit(beat)
+	}
+	played := mock.Played()
+	if len(played) != 4 {
+		t.Fatalf("expected two echoes, got %+v", played)
+	}
+	for i, beat := range []int{22, 32, 34, 44} {
+		if played[i].Beat != beat || played[i].Pitch != 70 || played[i].On != (i%2 == 0) {
+			t.Errorf("expected echo %d on %d, got %+v", i, beat, played[i])
+		}
+	}
+	if played[0].Velocity != 40 || played[2].Velocity != 20 {
+		t.Errorf("expected the echoes to decay, got %d and %d", played[0].Velocity, played[2].Velocity)
+	}
+	if len(p.MusicHistory.GetAll()) != 2 {
+		t.Error("expected the echoes not to be recorded")
+	}
+
+	p.controlChange(20, 127)
+	if p.Echo.Feedback != maxEchoFeedback {
+		t.Errorf("expected the control change to set the feedback, got %d", p.Echo.Feedback)
+	}
+}
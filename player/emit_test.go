@@ -0,0 +1,42 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+// quietPiano is a piano.Mock that does not record the notes
+type quietPiano struct {
+	*piano.Mock
+}
+
+func (quietPiano) PlayNotes(notes []music.Note, bpm int) error {
+	return nil
+}
+
+func BenchmarkEmit(b *testing.B) {
+	for _, every := range []int{0, 4} {
+		name := "silence"
+		if every > 0 {
+			name = "notes"
+		}
+		b.Run(name, func(b *testing.B) {
+			p, err := NewWithPiano(quietPiano{piano.NewMock()}, 120, 500, 0, 0, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			p.MusicHistory = music.New()
+			for beat := 0; every > 0 && beat < b.N; beat += every {
+				p.MusicFuture.AddNote(music.Note{On: true, Pitch: 60 + beat%12, Velocity: 80, Beat: beat, Duration: 2})
+			}
+			p.setTick(b.N + 1000)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for beat := 0; beat < b.N; beat++ {
+				p.Emit(beat)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package player
+
+import (
+	"fmt"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// eventBuffer is the number of events kept for a slow consumer of
+// Events, after which the events are dropped
+const eventBuffer = 256
+
+// EventType is what happened in an Event
+type EventType int
+
+const (
+	// NoteOn is a note that was played, on the keyboard or by the player
+	NoteOn EventType = iota
+	// NoteOff is a note that was let go or turned off
+	NoteOff
+	// BeatTick is the start of every beat
+	BeatTick
+	// Improvised is the AI adding notes to play
+	Improvised
+	// Taught is the AI learning from the history
+	Taught
+	// Saved is a file being saved
+	Saved
+)
+
+var eventTypeNames = []string{"note on", "note off", "beat", "improvised", "taught", "saved"}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return fmt.Sprintf("event %d", int(t))
+	}
+	return eventTypeNames[t]
+}
+
+// Event is something that happened in the player, on the tick of Beat.
+// A NoteOn or NoteOff has its Note (and whether it was played on the
+// keyboard, as Human), a BeatTick has its Bar (counting from 1) and
+// BarBeat (counting from 0), Improvised and Taught have the number of
+// Notes, and Saved has the File.
+type Event struct {
+	Type    EventType
+	Beat    int
+	Note    music.Note
+	Human   bool
+	Bar     int
+	BarBeat int
+	Notes   int
+	File    string
+}
+
+// Events returns the events of the player as they happen, until it is
+// closed. Events are dropped rather than holding up the player when
+// they are not read fast enough.
+func (p *Player) Events() <-chan Event {
+	return p.events
+}
+
+// publish sends an event to Events, unless it is full or closed
+func (p *Player) publish(event Event) {
+	p.eventsLock.RLock()
+	defer p.eventsLock.RUnlock()
+	if p.eventsClosed {
+		return
+	}
+	select {
+	case p.events <- event:
+	default:
+	}
+}
+
+// publishNotes sends a NoteOn or NoteOff event for each note
+func (p *Player) publishNotes(human bool, notes ...music.Note) {
+	for _, note := range notes {
+		eventType := NoteOn
+		if !note.On {
+			eventType = NoteOff
+		}
+		p.publish(Event{Type: eventType, Beat: note.Beat, Note: note, Human: human})
+	}
+}
+
+// publishBeat sends a BeatTick event when the tick is on a beat
+func (p *Player) publishBeat(tick int) {
+	bar, beat, beatTick := p.position()
+	if beatTick == 0 {
+		p.publish(Event{Type: BeatTick, Beat: tick, Bar: bar, BarBeat: beat})
+	}
+}
+
+// closeEvents closes the channel of Events, after which
+// nothing more is sent
+func (p *Player) closeEvents() {
+	p.eventsLock.Lock()
+	defer p.eventsLock.Unlock()
+	if p.eventsClosed || p.events == nil {
+		return
+	}
+	close(p.events)
+	p.eventsClosed = true
+}
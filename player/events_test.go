@@ -0,0 +1,55 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestEvents(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MusicHistory = music.New()
+	events := p.Events()
+	go p.Listen()
+	mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+	select {
+	case event := <-events:
+		if event.Type != NoteOn || !event.Human || event.Note.Pitch != 70 {
+			t.Errorf("expected the note played, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an event for the note played")
+	}
+
+	// the first tick of the second beat
+	beatTicks := p.TimeSignature.beatTicks(p.TicksPerBeat)
+	for i := 0; i < beatTicks; i++ {
+		p.nextTick()
+	}
+	found := false
+	for len(events) > 0 {
+		event := <-events
+		if event.Type == BeatTick {
+			found = event.Bar == 1 && event.BarBeat == 1
+		}
+	}
+	if !found {
+		t.Error("expected the second beat of the first bar")
+	}
+
+	// nothing is held up by a consumer that does not read
+	for i := 0; i < 2*eventBuffer; i++ {
+		p.publish(Event{Type: Saved})
+	}
+	p.Close()
+	p.publish(Event{Type: Saved})
+	for range events {
+	}
+}
@@ -0,0 +1,74 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// filler is a Generator that can make fills
+type filler interface {
+	GenerateFill(context []music.Note, bars int) (*music.Music, error)
+}
+
+var _ filler = (*ai2.AI)(nil)
+
+// Fill has the AI play a one-bar fill that carries on from the phrase
+// that was just played, placed so that it ends right before the next
+// downbeat (or the one after, if the next one is less than a beat away),
+// for the host to come back in on. Only the part of the fill from the
+// next tick on is played. A Generator that can not make fills does not
+// play anything.
+func (p *Player) Fill() {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Fill",
+	})
+	f, ok := p.generator().(filler)
+	if !ok {
+		logger.Debug("The generator can not make fills")
+		return
+	}
+	if !p.startImprovising() {
+		logger.Debug("Improvising is already in progress")
+		return
+	}
+	defer p.stopImprovising()
+	p.Teach()
+
+	p.RLock()
+	phraseStart := p.phraseStart
+	p.RUnlock()
+	phrase := []music.Note{}
+	for _, note := range p.MusicHistory.Consolidate() {
+		if note.Beat >= phraseStart {
+			phrase = append(phrase, note)
+		}
+	}
+	p.configureAI()
+	fill, err := f.GenerateFill(phrase, 1)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	p.RLock()
+	barTicks := p.TimeSignature.barTicks(p.TicksPerBeat)
+	beatTicks := p.TimeSignature.beatTicks(p.TicksPerBeat)
+	tick := p.CurrentBeat()
+	start := tick + 1
+	downbeat := tick + barTicks - p.barTick
+	p.RUnlock()
+	if downbeat-start < beatTicks {
+		downbeat += barTicks
+	}
+	offset := downbeat - barTicks
+	newNotes := music.Notes{}
+	for _, note := range p.fromAI(fill.Consolidate()) {
+		if note.Beat+offset >= start {
+			newNotes = append(newNotes, note)
+		}
+	}
+	p.addToFuture(newNotes, offset)
+	logger.Infof("Added a fill of %d notes from AI", len(newNotes))
+	p.publish(Event{Type: Improvised, Beat: p.CurrentBeat(), Notes: len(newNotes)})
+}
@@ -0,0 +1,61 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+// barFiller is a Generator with a fill of three notes in a bar
+type barFiller struct{}
+
+func (barFiller) Learn(notes []music.Note) error {
+	return nil
+}
+
+func (barFiller) Lick(startBeat int) (*music.Music, error) {
+	return music.New(), nil
+}
+
+func (barFiller) GenerateFill(context []music.Note, bars int) (*music.Music, error) {
+	fill := music.New()
+	for _, beat := range []int{0, 40, 80} {
+		fill.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: beat})
+		fill.AddNote(music.Note{On: false, Pitch: 60, Beat: beat + 10})
+	}
+	return fill, nil
+}
+
+func TestFill(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetGenerator(barFiller{})
+	p.MusicHistory = music.New()
+	// bars of 96 ticks, and the next downbeat is on 96
+	for _, test := range []struct {
+		tick     int
+		expected []int
+	}{
+		// the start of the fill is already over
+		{10, []int{40, 80}},
+		// the next downbeat is too close, so it ends on the one after
+		{80, []int{96, 136, 176}},
+	} {
+		p.MusicFuture = music.New()
+		p.setTick(test.tick)
+		p.barTick = test.tick
+		p.Fill()
+		notes := p.MusicFuture.Consolidate()
+		if len(notes) != len(test.expected) {
+			t.Fatalf("at %d expected notes on %v, got %+v", test.tick, test.expected, notes)
+		}
+		for i, beat := range test.expected {
+			if notes[i].Beat != beat || notes[i].Channel != p.AIChannel {
+				t.Errorf("at %d expected notes on %v, got %+v", test.tick, test.expected, notes)
+			}
+		}
+	}
+}
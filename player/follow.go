@@ -0,0 +1,159 @@
+package player
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// followOnsets is the most note-ons that TempoFollow remembers,
+	// and followWindow how long it remembers them for
+	followOnsets = 32
+	followWindow = 8 * time.Second
+	// minFollowOnsets is how many note-ons it needs to find a tempo
+	minFollowOnsets = 6
+	// minOnsetInterval is how close note-ons are to be one onset,
+	// such as the notes of a chord, and maxOnsetInterval the longest
+	// interval between two onsets that tells anything of the tempo
+	minOnsetInterval = 70 * time.Millisecond
+	maxOnsetInterval = 2 * time.Second
+	// onsetClusterWidth is how close intervals are to be counted
+	// as the same one
+	onsetClusterWidth = 25 * time.Millisecond
+	// followSmoothing is how much of the way to the tempo that is
+	// played the tempo is moved every beat
+	followSmoothing = 0.25
+	// defaultMaxTempoChange is the MaxTempoChange if it is not set
+	defaultMaxTempoChange = 2
+)
+
+// onset remembers when a note was played, for TempoFollow
+func (p *Player) onset(at time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.TempoFollow {
+		return
+	}
+	if n := len(p.onsets); n > 0 && at.Sub(p.onsets[n-1]) < minOnsetInterval {
+		return
+	}
+	p.onsets = append(p.onsets, at)
+	for len(p.onsets) > followOnsets || at.Sub(p.onsets[0]) > followWindow {
+		p.onsets = p.onsets[1:]
+	}
+}
+
+// followTempo moves the tempo towards the one that is being played,
+// at the start of every beat if TempoFollow is set, by no more than
+// MaxTempoChange BPM at a time
+func (p *Player) followTempo(tick int) {
+	p.Lock()
+	if !p.TempoFollow || p.ExternalClock || p.TicksPerBeat <= 0 || tick%p.TicksPerBeat != 0 {
+		p.Unlock()
+		return
+	}
+	for len(p.onsets) > 0 && time.Since(p.onsets[0]) > followWindow {
+		p.onsets = p.onsets[1:]
+	}
+	if p.followBPM == 0 {
+		p.followBPM = float64(p.BPM)
+	}
+	beat := estimateBeat(p.onsets, time.Duration(float64(time.Minute)/p.followBPM))
+	if beat <= 0 {
+		p.Unlock()
+		return
+	}
+	maxChange := p.MaxTempoChange
+	if maxChange <= 0 {
+		maxChange = defaultMaxTempoChange
+	}
+	change := (float64(time.Minute)/float64(beat) - p.followBPM) * followSmoothing
+	change = math.Max(-maxChange, math.Min(maxChange, change))
+	p.followBPM = math.Max(MinimumBPM, p.followBPM+change)
+	bpm := int(math.Floor(p.followBPM + 0.5))
+	changed := bpm != p.BPM
+	p.Unlock()
+	if changed {
+		log.WithFields(log.Fields{
+			"function": "Player.followTempo",
+		}).Debugf("Following the tempo to %d BPM", bpm)
+		p.setBPM(bpm)
+	}
+}
+
+// estimateBeat returns the length of the beat that the onsets are
+// played at, or 0 if there are too few of them to tell. The intervals
+// between every two onsets are grouped, and the group that most of the
+// others are multiples of is the dominant period. This is doubled or
+// halved to the octave nearest to the current beat, since a tempo and
+// its double fit the same notes.
+func estimateBeat(onsets []time.Time, current time.Duration) time.Duration {
+	if len(onsets) < minFollowOnsets || current <= 0 {
+		return 0
+	}
+	var intervals []time.Duration
+	for i := range onsets {
+		for j := i + 1; j < len(onsets); j++ {
+			interval := onsets[j].Sub(onsets[i])
+			if interval > maxOnsetInterval {
+				break
+			}
+			if interval >= minOnsetInterval {
+				intervals = append(intervals, interval)
+			}
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+
+	// groups of intervals within onsetClusterWidth of their average
+	type cluster struct {
+		sum   time.Duration
+		count int
+	}
+	var clusters []cluster
+	for _, interval := range intervals {
+		if n := len(clusters); n > 0 {
+			c := &clusters[n-1]
+			if interval-c.sum/time.Duration(c.count) <= onsetClusterWidth {
+				c.sum += interval
+				c.count++
+				continue
+			}
+		}
+		clusters = append(clusters, cluster{interval, 1})
+	}
+
+	// each group scores its own intervals and those of the groups that
+	// are (about) a multiple of it, less the further they are
+	best, bestScore := time.Duration(0), 0.0
+	for _, c := range clusters {
+		period := c.sum / time.Duration(c.count)
+		score := 0.0
+		for _, other := range clusters {
+			length := other.sum / time.Duration(other.count)
+			multiple := math.Floor(float64(length)/float64(period) + 0.5)
+			if multiple < 1 || multiple > 4 {
+				continue
+			}
+			if math.Abs(float64(length)-multiple*float64(period)) <= float64(onsetClusterWidth)*multiple {
+				score += float64(other.count) / multiple
+			}
+		}
+		if score > bestScore {
+			best, bestScore = period, score
+		}
+	}
+	for best > 0 && float64(best) < float64(current)/math.Sqrt2 {
+		best *= 2
+	}
+	for float64(best) > float64(current)*math.Sqrt2 {
+		best /= 2
+	}
+	return best
+}
@@ -0,0 +1,61 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// playedAt returns the onsets of quarter notes at 100 BPM, some of them
+// split into eighths and all a little off the beat, up to now
+func playedAt(now time.Time) (onsets []time.Time) {
+	jitter := []time.Duration{0, 8, -5, 10, -9, 3, -2, 7}
+	beat := 600 * time.Millisecond
+	start := now.Add(-11 * beat)
+	for i := 0; i < 12; i++ {
+		at := start.Add(time.Duration(i)*beat + jitter[i%len(jitter)]*time.Millisecond)
+		onsets = append(onsets, at)
+		if i%3 == 1 {
+			onsets = append(onsets, at.Add(beat/2))
+		}
+	}
+	return
+}
+
+func TestEstimateBeat(t *testing.T) {
+	onsets := playedAt(time.Now())
+	if beat := estimateBeat(onsets, time.Minute/90); beat < 590*time.Millisecond || beat > 610*time.Millisecond {
+		t.Errorf("expected a beat of about 600 ms, got %s", beat)
+	}
+	// the same notes in double time
+	if beat := estimateBeat(onsets, time.Minute/190); beat < 295*time.Millisecond || beat > 305*time.Millisecond {
+		t.Errorf("expected a beat of about 300 ms, got %s", beat)
+	}
+	if beat := estimateBeat(onsets[:3], time.Minute/90); beat != 0 {
+		t.Errorf("expected no beat from three notes, got %s", beat)
+	}
+}
+
+func TestFollowTempo(t *testing.T) {
+	p := &Player{BPM: 80, Resolution: 10, TicksPerBeat: 10, MusicHistory: music.New(), TempoFollow: true, MaxTempoChange: 3}
+	p.onsets = playedAt(time.Now())
+	for tick := 1; tick <= 10; tick++ {
+		p.followTempo(tick)
+	}
+	if p.BPM != 83 {
+		t.Errorf("expected the tempo to go up by 3 BPM, got %d", p.BPM)
+	}
+	for tick := 11; tick <= 400; tick++ {
+		p.followTempo(tick)
+	}
+	if p.BPM < 99 || p.BPM > 101 {
+		t.Errorf("expected the tempo to follow to 100 BPM, got %d", p.BPM)
+	}
+	p.TempoFollow = false
+	p.SetBPM(80)
+	p.followTempo(410)
+	if p.BPM != 80 {
+		t.Errorf("expected the tempo not to follow, got %d", p.BPM)
+	}
+}
@@ -0,0 +1,72 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+)
+
+// Generator is anything that can learn from the music history and
+// improvise from it. The built-in AI is the default Generator.
+type Generator interface {
+	// Learn learns from all the notes played so far
+	Learn(notes []music.Note) error
+	// Lick returns an improvisation starting at a beat
+	Lick(startBeat int) (*music.Music, error)
+}
+
+// forgetter is a Generator that can forget what it has learned
+type forgetter interface {
+	Forget()
+}
+
+// incrementalLearner is a Generator that can learn from only the
+// notes played since it was last taught
+type incrementalLearner interface {
+	LearnIncremental(newNotes []music.Note) error
+}
+
+var _ Generator = aiGenerator{}
+var _ forgetter = (*ai2.AI)(nil)
+var _ incrementalLearner = (*ai2.AI)(nil)
+
+// aiGenerator is the built-in AI as a Generator, which has
+// everything else the AI can do as well
+type aiGenerator struct {
+	*ai2.AI
+}
+
+// Learn puts the notes back into a music history for the AI to learn
+func (g aiGenerator) Learn(notes []music.Note) error {
+	mus := music.New()
+	for _, note := range notes {
+		mus.AddNote(note)
+	}
+	return g.AI.Learn(mus)
+}
+
+// SetGenerator replaces the AI used for improvising.
+// Setting it to nil goes back to the built-in AI.
+func (p *Player) SetGenerator(g Generator) {
+	p.Lock()
+	defer p.Unlock()
+	if g == nil {
+		g = aiGenerator{p.AI}
+	}
+	p.Generator = g
+	p.taughtUntil = 0
+}
+
+func (p *Player) generator() Generator {
+	p.RLock()
+	defer p.RUnlock()
+	return p.Generator
+}
+
+// builtIn returns the built-in AI if it is the Generator, or nil
+// if it was replaced, for what only the built-in AI has
+func (p *Player) builtIn() *ai2.AI {
+	if g, ok := p.generator().(aiGenerator); ok {
+		return g.AI
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// harmonizer is a Generator that can put chords under a melody
+type harmonizer interface {
+	Harmonize(melody []music.Note) (*music.Music, error)
+}
+
+var _ harmonizer = (*ai2.AI)(nil)
+
+// Harmonize plays the phrase that was just played, from phraseStart
+// until now, again from the start of the next bar, with chords from the
+// AI under it. The phrase starts in the same place of the bar as it was
+// played, so that the chords stay on the strong beats.
+func (p *Player) Harmonize() {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Harmonize",
+	})
+	h, ok := p.generator().(harmonizer)
+	if !ok {
+		logger.Warn("The generator can not harmonize")
+		return
+	}
+	if !p.startImprovising() {
+		logger.Debug("Improvising is already in progress")
+		return
+	}
+	defer p.stopImprovising()
+	// the chords lean towards what was learned
+	p.Teach()
+
+	p.RLock()
+	phraseStart := p.phraseStart
+	ticksPerBar := p.TimeSignature.barTicks(p.TicksPerBeat)
+	p.RUnlock()
+	phrase := []music.Note{}
+	for _, note := range p.MusicHistory.Consolidate() {
+		if note.Beat >= phraseStart {
+			phrase = append(phrase, note)
+		}
+	}
+	logger.Infof("Harmonizing %d notes", len(phrase))
+	p.configureAI()
+	harmony, err := h.Harmonize(phrase)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	chords := harmony.Consolidate()
+	for i := range chords {
+		chords[i].Source = music.AI
+	}
+	offset := (p.CurrentBeat()/ticksPerBar + 1) * ticksPerBar
+	if len(phrase) > 0 {
+		offset -= phrase[0].Beat / ticksPerBar * ticksPerBar
+	}
+	p.addToFuture(phrase, offset)
+	p.addToFuture(chords, offset)
+	logger.Infof("Added %d notes of harmony", len(chords))
+	p.publish(Event{Type: Improvised, Beat: p.CurrentBeat(), Notes: len(chords)})
+}
@@ -0,0 +1,89 @@
+package player
+
+import (
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+// AddInput listens to one more MIDI device, as one of the Inputs, and
+// returns the Device its notes are marked with. It can be called while
+// Listen is running, such as when a keyboard is plugged in.
+func (p *Player) AddInput(device piano.Device) (id int) {
+	p.Lock()
+	defer p.Unlock()
+	p.Inputs = append(p.Inputs, device)
+	id = len(p.Inputs)
+	log.WithFields(log.Fields{
+		"function": "Player.AddInput",
+	}).Infof("Listening to MIDI input %d", id)
+	if p.deviceEvents != nil {
+		go p.readInput(device, id)
+	}
+	return
+}
+
+// RemoveInput stops listening to one of the Inputs, such as when it is
+// unplugged, and lets go of the keys that are down on it. The device
+// is not closed, and the others keep their Device.
+func (p *Player) RemoveInput(id int) {
+	p.Lock()
+	defer p.Unlock()
+	if id > 0 && id <= len(p.Inputs) {
+		p.Inputs[id-1] = nil
+	}
+}
+
+// inputDevice returns one of the Inputs, or nil if it was removed
+func (p *Player) inputDevice(id int) piano.Device {
+	p.RLock()
+	defer p.RUnlock()
+	if id <= 0 || id > len(p.Inputs) {
+		return nil
+	}
+	return p.Inputs[id-1]
+}
+
+// inputs returns the Inputs that have not been removed
+func (p *Player) inputs() (inputs []piano.Device) {
+	p.RLock()
+	defer p.RUnlock()
+	for _, input := range p.Inputs {
+		if input != nil {
+			inputs = append(inputs, input)
+		}
+	}
+	return
+}
+
+// sendInput sends an event to Listen as if it came from a device, and
+// returns false if Listen is behind. It must be called with the lock held.
+func (p *Player) sendInput(device int, event portmidi.Event) bool {
+	if device == 0 {
+		select {
+		case p.inputEvents <- event:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case p.deviceEvents <- inputEvent{event, device}:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceFilter returns a TeachFilter for the AI to learn only from the
+// notes of some of the devices, which pass HumanInRange too
+func (p *Player) DeviceFilter(devices ...int) func(music.Note) bool {
+	learn := make(map[int]bool)
+	for _, device := range devices {
+		learn[device] = true
+	}
+	return func(note music.Note) bool {
+		return learn[note.Device] && p.HumanInRange(note)
+	}
+}
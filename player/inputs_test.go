@@ -0,0 +1,87 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestInputs(t *testing.T) {
+	second, third := piano.NewMock(), piano.NewMock()
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.MusicHistory = music.New()
+	p.Inputs = []piano.Device{second}
+	go p.Listen()
+	second.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+	time.Sleep(50 * time.Millisecond)
+	if id := p.AddInput(third); id != 2 {
+		t.Errorf("expected the third device to be 2, got %d", id)
+	}
+	third.Send(portmidi.Event{Status: piano.NoteOn, Data1: 72, Data2: 80})
+	time.Sleep(50 * time.Millisecond)
+	if p.KeysPressed(0) != 0 || p.KeysPressed(1) != 1 || p.KeysPressed(2) != 1 || p.KeysCurrentlyPressed != 2 {
+		t.Errorf("expected a key down on both inputs, got %d, %d and %d", p.KeysPressed(0), p.KeysPressed(1), p.KeysPressed(2))
+	}
+	devices := make(map[int]int)
+	for _, note := range p.MusicHistory.GetAll() {
+		devices[note.Pitch] = note.Device
+	}
+	if len(devices) != 2 || devices[70] != 1 || devices[72] != 2 {
+		t.Errorf("expected the notes of both inputs, got %+v", p.MusicHistory.GetAll())
+	}
+	p.RemoveInput(1)
+	time.Sleep(50 * time.Millisecond)
+	if p.KeysPressed(1) != 0 || p.KeysPressed(2) != 1 {
+		t.Errorf("expected the key of the removed input to be let go, got %d and %d", p.KeysPressed(1), p.KeysPressed(2))
+	}
+	learn := p.DeviceFilter(0, 2)
+	if learn(music.Note{On: true, Pitch: 70, Device: 1}) || !learn(music.Note{On: true, Pitch: 70, Device: 2}) {
+		t.Errorf("expected only the notes of devices 0 and 2 to be learned from")
+	}
+}
+
+func TestInputSustain(t *testing.T) {
+	second := piano.NewMock()
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.MusicHistory = music.New()
+	p.Inputs = []piano.Device{second}
+	main := p.Piano.(*piano.Mock)
+	go p.Listen()
+	// the pedal of the main keyboard does not hold the notes of the second
+	main.Send(portmidi.Event{Status: piano.ControlChange, Data1: piano.SustainPedal, Data2: 127})
+	main.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+	second.Send(portmidi.Event{Status: piano.NoteOn | 3, Data1: 72, Data2: 80})
+	time.Sleep(50 * time.Millisecond)
+	p.setTick(5)
+	main.Send(portmidi.Event{Status: piano.NoteOff, Data1: 70})
+	second.Send(portmidi.Event{Status: piano.NoteOff | 3, Data1: 72})
+	time.Sleep(50 * time.Millisecond)
+	offs := func() (offs []music.Note) {
+		for _, note := range p.MusicHistory.GetAll() {
+			if !note.On {
+				offs = append(offs, note)
+			}
+		}
+		return
+	}
+	if notes := offs(); len(notes) != 1 || notes[0].Pitch != 72 || notes[0].Device != 1 || notes[0].Channel != 3 {
+		t.Errorf("expected only 72 of the second device to be let go, got %+v", notes)
+	}
+	p.setTick(10)
+	main.Send(portmidi.Event{Status: piano.ControlChange, Data1: piano.SustainPedal, Data2: 0})
+	time.Sleep(50 * time.Millisecond)
+	if notes := offs(); len(notes) != 2 {
+		t.Errorf("expected the pedal to let go of 70, got %+v", notes)
+	}
+}
@@ -0,0 +1,37 @@
+package player
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// SetInstrument changes the instrument (the General MIDI program,
+// 0-127) that a channel (0-15) plays with, such as AIChannel
+func (p *Player) SetInstrument(channel, program int) (err error) {
+	err = p.Piano.SetInstrument(channel, program)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"function": "Player.SetInstrument",
+		}).Error(err.Error())
+		return
+	}
+	p.Lock()
+	if p.instruments == nil {
+		p.instruments = make(map[int]int)
+	}
+	p.instruments[channel] = program
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.SetInstrument",
+	}).Infof("Channel %d plays program %d", channel+1, program)
+	return
+}
+
+// NextInstrument changes the instrument of AIChannel to the next
+// program, going back to the first after the last
+func (p *Player) NextInstrument() (err error) {
+	p.RLock()
+	channel := p.AIChannel
+	program := p.instruments[channel]
+	p.RUnlock()
+	return p.SetInstrument(channel, (program+1)%128)
+}
@@ -0,0 +1,106 @@
+package player
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxOutputLatency is the most that the ticks can come early
+const maxOutputLatency = time.Second
+
+// outputLatency returns the OutputLatency, up to maxOutputLatency
+func (p *Player) outputLatency() time.Duration {
+	p.RLock()
+	defer p.RUnlock()
+	if p.OutputLatency < 0 {
+		return 0
+	} else if p.OutputLatency > maxOutputLatency {
+		return maxOutputLatency
+	}
+	return p.OutputLatency
+}
+
+// CalibrateLatency measures the OutputLatency and sets it, by clicking
+// the metronome every beat and timing the keys that are played along with
+// the clicks that are heard (or the clicks that come back, with the output
+// looped back into the input). The keys are not recorded. Listen has to be
+// running, and it takes the median of the clicks.
+func (p *Player) CalibrateLatency(clicks int) (latency time.Duration, err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.CalibrateLatency",
+	})
+	if clicks < 1 {
+		return 0, errors.New("it takes at least one click to calibrate")
+	}
+	heard := make(chan time.Time, 1)
+	p.Lock()
+	if p.calibration != nil {
+		p.Unlock()
+		return 0, errors.New("already calibrating")
+	}
+	p.calibration = heard
+	beat := time.Minute / time.Duration(p.BPM)
+	channel, pitch := p.MetronomeChannel, p.MetronomePitch
+	p.Unlock()
+	defer func() {
+		p.Lock()
+		p.calibration = nil
+		p.Unlock()
+	}()
+
+	logger.Infof("Play a key along with each of the next %d clicks", clicks)
+	delays := []time.Duration{}
+	for i := 0; i < clicks; i++ {
+		select {
+		case <-heard:
+		default:
+		}
+		clicked := time.Now()
+		err = p.Piano.Click(channel, pitch, accentVelocity)
+		if err != nil {
+			return
+		}
+		select {
+		case at := <-heard:
+			delays = append(delays, at.Sub(clicked))
+		case <-time.After(beat):
+		}
+		time.Sleep(time.Until(clicked.Add(beat)))
+	}
+	if len(delays) == 0 {
+		return 0, errors.New("none of the clicks were heard")
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	latency = delays[len(delays)/2]
+	if latency < 0 {
+		latency = 0
+	} else if latency > maxOutputLatency {
+		latency = maxOutputLatency
+	}
+	p.Lock()
+	p.OutputLatency = latency
+	p.Unlock()
+	logger.Infof("Output latency: %s (%d of %d clicks heard)", latency, len(delays), clicks)
+	return
+}
+
+// heardClick passes the time a key was played on to CalibrateLatency,
+// and returns whether it is calibrating, so the key is not played
+func (p *Player) heardClick(on bool, at time.Time) bool {
+	p.RLock()
+	heard := p.calibration
+	p.RUnlock()
+	if heard == nil {
+		return false
+	}
+	if on {
+		select {
+		case heard <- at:
+		default:
+		}
+	}
+	return true
+}
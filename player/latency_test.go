@@ -0,0 +1,56 @@
+package player
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestCalibrateLatency(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 240, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	go p.Listen()
+	// a key is played 30 ms after each click is heard
+	go func() {
+		for clicks := 0; clicks < 3; {
+			if mock.Clicks() > clicks {
+				clicks++
+				time.Sleep(30 * time.Millisecond)
+				mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+				mock.Send(portmidi.Event{Status: piano.NoteOff, Data1: 70})
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	latency, err := p.CalibrateLatency(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency < 30*time.Millisecond || latency > 60*time.Millisecond || p.outputLatency() != latency {
+		t.Errorf("expected a latency of about 30 ms, got %s", latency)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if notes := p.MusicHistory.GetAll(); len(notes) != 0 {
+		t.Errorf("expected the keys not to be recorded, got %+v", notes)
+	}
+
+	// the ticks come early, so the notes are on a tick before
+	p.RLock()
+	tickTime := p.tickTime()
+	p.RUnlock()
+	now := time.Now()
+	p.setTick(10)
+	atomic.StoreInt64(&p.tickStarted, now.Add(5*tickTime/2).UnixNano())
+	if tick, offset := p.tickOffset(now); tick != 7 || offset < 0.49 || offset > 0.51 {
+		t.Errorf("expected to be half way into tick 7, got %d and %f", tick, offset)
+	}
+}
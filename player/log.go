@@ -0,0 +1,126 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logBufferSize is the number of log messages that can wait to be
+// written before more are dropped
+const logBufferSize = 1024
+
+// asyncLogging makes sure the logs are only made asynchronous once
+var asyncLogging sync.Once
+
+// SetLogLevel changes what is logged, which is "info" and above by
+// default. The levels are "trace" (which logs every note), "debug",
+// "info", "warn", "error", "fatal" and "panic".
+func SetLogLevel(level string) (err error) {
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return
+	}
+	log.SetLevel(l)
+	return
+}
+
+// LogAsynchronously writes the logs of the standard logger to where
+// they go now from a goroutine of their own, so that logging never
+// makes the metronome or Listen wait. When it falls behind, the
+// messages below the warning level are dropped, and the warnings and
+// errors wait for their turn instead. It is only done once, and the
+// logs are written as they are made until it is.
+func LogAsynchronously() {
+	asyncLogging.Do(func() {
+		logger := log.StandardLogger()
+		logger.AddHook(asyncHook{newAsyncWriter(logger.Out, logBufferSize)})
+		logger.SetOutput(ioutil.Discard)
+	})
+}
+
+// asyncHook writes every message of a logger to an asyncWriter,
+// which knows from the level of the message whether it may be dropped
+type asyncHook struct {
+	w *asyncWriter
+}
+
+func (h asyncHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h asyncHook) Fire(entry *log.Entry) (err error) {
+	line, err := entry.Bytes()
+	if err != nil {
+		return
+	}
+	switch {
+	case entry.Level <= log.FatalLevel:
+		// the program stops right after these
+		h.w.writeAndWait(line)
+	case entry.Level <= log.WarnLevel:
+		h.w.writeAll(line)
+	default:
+		h.w.Write(line)
+	}
+	return
+}
+
+// asyncWriter writes in a goroutine of its own, dropping what is
+// written when it falls more than a buffer behind
+type asyncWriter struct {
+	out     io.Writer
+	lines   chan asyncLine
+	dropped uint64
+}
+
+// asyncLine is a line to write, and done is closed once it is
+// written if it is not nil
+type asyncLine struct {
+	line []byte
+	done chan struct{}
+}
+
+func newAsyncWriter(out io.Writer, size int) (w *asyncWriter) {
+	w = &asyncWriter{out: out, lines: make(chan asyncLine, size)}
+	go func() {
+		for line := range w.lines {
+			w.out.Write(line.line)
+			if dropped := atomic.SwapUint64(&w.dropped, 0); dropped > 0 {
+				fmt.Fprintf(w.out, "dropped %d log messages\n", dropped)
+			}
+			if line.done != nil {
+				close(line.done)
+			}
+		}
+	}()
+	return
+}
+
+// Write never blocks, and always succeeds even if it is dropped
+func (w *asyncWriter) Write(b []byte) (n int, err error) {
+	// the buffer is reused by the logger
+	line := append([]byte{}, b...)
+	select {
+	case w.lines <- asyncLine{line: line}:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	return len(b), nil
+}
+
+// writeAll waits for room in the buffer rather than drop the line
+func (w *asyncWriter) writeAll(b []byte) {
+	w.lines <- asyncLine{line: append([]byte{}, b...)}
+}
+
+// writeAndWait waits until the line has been written
+func (w *asyncWriter) writeAndWait(b []byte) {
+	done := make(chan struct{})
+	w.lines <- asyncLine{line: append([]byte{}, b...), done: done}
+	<-done
+}
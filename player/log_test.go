@@ -0,0 +1,75 @@
+package player
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slowWriter waits to be told before every write
+type slowWriter struct {
+	buf  bytes.Buffer
+	next chan bool
+	sync.Mutex
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	<-w.next
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *slowWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriter(t *testing.T) {
+	out := &slowWriter{next: make(chan bool)}
+	w := newAsyncWriter(out, 2)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("note\n"))
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("writing should not wait for the output")
+	}
+	// at most one is being written and two wait in the buffer,
+	// so the rest are dropped
+	close(out.next)
+	for i := 0; i < 100 && !strings.Contains(out.String(), "dropped"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if notes := strings.Count(out.String(), "note"); notes < 2 || notes > 3 || !strings.Contains(out.String(), "dropped") {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestAsyncHook(t *testing.T) {
+	out := &slowWriter{next: make(chan bool)}
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(asyncHook{newAsyncWriter(out, 1)})
+	for i := 0; i < 5; i++ {
+		logger.Info("note")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(out.next)
+	}()
+	// the warning waits for the output rather than be dropped
+	logger.Warn("stuck")
+	for i := 0; i < 100 && !strings.Contains(out.String(), "stuck"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "stuck") || strings.Count(out.String(), "note") > 2 {
+		t.Errorf("expected the warning and only some of the notes, got %q", out.String())
+	}
+}
@@ -0,0 +1,118 @@
+package player
+
+import (
+	"errors"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// loop is a phrase of the music history that is played over and over
+type loop struct {
+	// start is the beat of the history the phrase starts on,
+	// and length is how many ticks it lasts
+	start, length int
+	notes         music.Notes
+	// next is the tick that the next repetition starts on
+	next int
+}
+
+// Loop plays the notes of the music history from startBeat up to endBeat
+// over and over, starting on the next bar (after counting in CountIn bars),
+// until StopLoop is called.
+// The loop is played even while the host is playing, so that the AI
+// can improvise over it too. A loop that is not a whole number of bars
+// is padded with a rest up to the next bar, so that it stays on the bars.
+func (p *Player) Loop(startBeat, endBeat int) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Loop",
+	})
+	if endBeat <= startBeat {
+		return errors.New("the loop has to end after it starts")
+	}
+	l := &loop{start: startBeat, length: endBeat - startBeat}
+	for _, note := range p.MusicHistory.Consolidate() {
+		if note.Beat < startBeat || note.Beat >= endBeat {
+			continue
+		}
+		// notes stop at the end of the loop, rather than
+		// ringing on into the next repetition
+		if note.Beat+note.Duration > endBeat {
+			note.Duration = endBeat - note.Beat
+		}
+		l.notes = append(l.notes, note)
+	}
+	if len(l.notes) == 0 {
+		return errors.New("there are no notes to loop")
+	}
+
+	p.Lock()
+	barTicks := p.TimeSignature.barTicks(p.TicksPerBeat)
+	if barTicks > 0 && l.length%barTicks != 0 {
+		l.length += barTicks - l.length%barTicks
+		logger.Debugf("Padding loop to %d bars", l.length/barTicks)
+	}
+	l.next = p.CurrentBeat() + barTicks - p.barTick + p.countInTicks()
+	if p.CountIn > 0 {
+		p.countInUntil = l.next
+	}
+	p.loop = l
+	p.loopFuture = music.New()
+	p.Unlock()
+	logger.Infof("Looping %d notes from %d to %d", len(l.notes), startBeat, endBeat)
+	p.repeatLoop(p.CurrentBeat())
+	return
+}
+
+// StopLoop stops playing the loop, letting the notes
+// that are sounding finish
+func (p *Player) StopLoop() {
+	p.Lock()
+	defer p.Unlock()
+	if p.loop == nil {
+		return
+	}
+	p.loop = nil
+	p.loopFuture = music.New()
+	log.WithFields(log.Fields{
+		"function": "Player.StopLoop",
+	}).Info("Stopped looping")
+}
+
+// repeatLoop adds the next repetition of the loop to loopFuture
+// just before it is due, so that there is only ever one ahead
+func (p *Player) repeatLoop(tick int) {
+	p.Lock()
+	defer p.Unlock()
+	if p.loop == nil || tick < p.loop.next-1 {
+		return
+	}
+	offset := p.loop.next - p.loop.start
+	notes, dropped := p.loop.notes.Transpose(p.PlaybackTranspose)
+	if dropped > 0 {
+		log.WithFields(log.Fields{
+			"function": "Player.repeatLoop",
+		}).Debugf("Dropped %d notes that were out of range", dropped)
+	}
+	for _, note := range notes {
+		if note.Duration < 1 {
+			note.Duration = 1
+		}
+		note.Beat += offset
+		note.Source = music.Accompaniment
+		p.loopFuture.AddNote(note)
+	}
+	p.loop.next += p.loop.length
+}
+
+// loopNotes returns the notes of the loop on a beat
+func (p *Player) loopNotes(beat int) (notes []music.Note) {
+	p.RLock()
+	loopFuture := p.loopFuture
+	p.RUnlock()
+	if loopFuture == nil {
+		return
+	}
+	_, notes = loopFuture.Get(beat)
+	return
+}
@@ -0,0 +1,45 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestLoop(t *testing.T) {
+	p := &Player{TicksPerBeat: 4, TimeSignature: TimeSignature{4, 4}, MusicHistory: music.New()}
+	p.resetBars()
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 0})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 60, Beat: 3})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 62, Velocity: 80, Beat: 4})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 62, Beat: 10})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 64, Velocity: 80, Beat: 8})
+	// only the first 6 ticks, which is padded out to a bar of 16
+	if err := p.Loop(0, 6); err != nil {
+		t.Fatal(err)
+	}
+	played := make(map[int]music.Note)
+	for tick := 1; tick <= 40; tick++ {
+		for _, note := range p.loopNotes(tick) {
+			played[tick] = note
+		}
+		p.repeatLoop(tick)
+	}
+	expected := map[int]int{16: 60, 20: 62, 32: 60, 36: 62}
+	if len(played) != len(expected) {
+		t.Errorf("got %+v", played)
+	}
+	for tick, pitch := range expected {
+		if played[tick].Pitch != pitch {
+			t.Errorf("expected %d at %d, got %+v", pitch, tick, played)
+		}
+	}
+	if played[20].Duration != 2 {
+		t.Errorf("the note should stop at the end of the loop, got %+v", played[20])
+	}
+
+	p.StopLoop()
+	if len(p.loopNotes(48)) > 0 {
+		t.Errorf("loop should have stopped")
+	}
+}
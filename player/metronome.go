@@ -0,0 +1,175 @@
+package player
+
+import (
+	"fmt"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMetronomePitch is the high wood block of the General MIDI drums
+	DefaultMetronomePitch = 76
+	// DefaultMetronomeChannel is channel 10, where the drums are
+	DefaultMetronomeChannel = 9
+	// metronomeSubdivisions is the number of clicks in every beat
+	metronomeSubdivisions = 2
+)
+
+// velocities of the clicks on the first beat of the bar,
+// the other beats and in between the beats
+const (
+	accentVelocity  = 127
+	beatVelocity    = 90
+	subBeatVelocity = 50
+)
+
+// TimeSignature is the number of beats in a bar (Numerator), and
+// the note that counts as a beat (Denominator, 4 for a quarter note)
+type TimeSignature struct {
+	Numerator, Denominator int
+}
+
+// beatTicks returns the number of ticks in one beat of the time signature
+func (ts TimeSignature) beatTicks(ticksPerBeat int) int {
+	if ts.Denominator <= 0 {
+		return ticksPerBeat
+	}
+	return ticksPerBeat * 4 / ts.Denominator
+}
+
+// beatsPerBar returns the number of beats in a bar, which is 4 if not set
+func (ts TimeSignature) beatsPerBar() int {
+	if ts.Numerator <= 0 {
+		return 4
+	}
+	return ts.Numerator
+}
+
+// barTicks returns the number of ticks in a bar of the time signature
+func (ts TimeSignature) barTicks(ticksPerBeat int) int {
+	return ts.beatsPerBar() * ts.beatTicks(ticksPerBeat)
+}
+
+// validate returns an error if the time signature makes no sense
+func (ts TimeSignature) validate() error {
+	if ts.Numerator < 1 || ts.Denominator < 1 || ts.Denominator&(ts.Denominator-1) != 0 {
+		return fmt.Errorf("invalid time signature %d/%d", ts.Numerator, ts.Denominator)
+	}
+	return nil
+}
+
+// SetTimeSignature changes the number of beats in a bar and the
+// note that counts as a beat, which has to be a power of two
+func (p *Player) SetTimeSignature(numerator, denominator int) (err error) {
+	if err = (TimeSignature{numerator, denominator}).validate(); err != nil {
+		return
+	}
+	p.Lock()
+	p.TimeSignature = TimeSignature{numerator, denominator}
+	ticksPerBeat := p.TicksPerBeat
+	ticksPerBar := p.TimeSignature.barTicks(ticksPerBeat)
+	p.Unlock()
+	if p.AI != nil {
+		p.AI.SetTempo(ticksPerBeat, ticksPerBar)
+	}
+	if p.MusicHistory != nil {
+		p.MusicHistory.Lock()
+		p.MusicHistory.BeatsPerBar, p.MusicHistory.BeatUnit = numerator, denominator
+		p.MusicHistory.Unlock()
+	}
+	return
+}
+
+// CurrentBar returns the bar that is playing, counting from 1
+func (p *Player) CurrentBar() int {
+	p.RLock()
+	defer p.RUnlock()
+	return p.bar
+}
+
+// position returns the bar that is playing, the beat within that
+// bar (counting from 0) and the tick within that beat
+func (p *Player) position() (bar, beat, tick int) {
+	p.RLock()
+	defer p.RUnlock()
+	beatTicks := p.TimeSignature.beatTicks(p.TicksPerBeat)
+	if beatTicks < 1 {
+		return p.bar, 0, p.barTick
+	}
+	return p.bar, p.barTick / beatTicks, p.barTick % beatTicks
+}
+
+// advanceBar moves the bar counter on by a tick. The bar is counted
+// tick by tick, rather than from the Tick, so that the bars stay in
+// place when the tempo or time signature change.
+func (p *Player) advanceBar() {
+	p.Lock()
+	defer p.Unlock()
+	p.barTick++
+	if p.barTick >= p.TimeSignature.barTicks(p.TicksPerBeat) {
+		p.barTick = 0
+		p.bar++
+	}
+}
+
+// resetBars starts counting bars again from the first bar
+func (p *Player) resetBars() {
+	p.Lock()
+	p.bar = 1
+	p.barTick = 0
+	p.Unlock()
+}
+
+// ToggleMetronome turns the metronome on or off
+func (p *Player) ToggleMetronome() {
+	p.Lock()
+	p.Metronome = !p.Metronome
+	on := p.Metronome
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.ToggleMetronome",
+	}).Infof("Metronome on: %v", on)
+}
+
+// countInTicks returns the length of the count-in, in ticks,
+// and must be called with the lock held
+func (p *Player) countInTicks() int {
+	if p.CountIn <= 0 {
+		return 0
+	}
+	return p.CountIn * p.TimeSignature.barTicks(p.TicksPerBeat)
+}
+
+// click sounds the metronome when the current tick falls on a beat,
+// or in between beats, accenting the first beat of every bar. The clicks go
+// straight to the piano so they are never part of the music history.
+// The metronome always clicks during a count-in.
+func (p *Player) click() {
+	p.RLock()
+	on := p.Metronome || p.CurrentBeat() < p.countInUntil
+	beatTicks := p.TimeSignature.beatTicks(p.TicksPerBeat)
+	channel, pitch := p.MetronomeChannel, p.MetronomePitch
+	p.RUnlock()
+	if !on || beatTicks < metronomeSubdivisions {
+		return
+	}
+	_, beat, tick := p.position()
+	if tick%(beatTicks/metronomeSubdivisions) != 0 {
+		return
+	}
+	velocity := subBeatVelocity
+	if tick == 0 {
+		velocity = beatVelocity
+		if beat == 0 {
+			velocity = accentVelocity
+		}
+	}
+	err := p.Piano.Click(channel, pitch, velocity)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"function": "Player.click",
+		}).Error(err.Error())
+	}
+	p.broadcast(false, music.Note{On: true, Pitch: pitch, Velocity: velocity, Beat: p.CurrentBeat(), Channel: channel, Source: music.Metronome})
+}
@@ -0,0 +1,22 @@
+package player
+
+import "testing"
+
+func TestBars(t *testing.T) {
+	p := &Player{TicksPerBeat: 4, TimeSignature: TimeSignature{6, 8}}
+	p.resetBars()
+	// a bar of 6/8 is 6 eighths of 2 ticks
+	for i := 0; i < 11; i++ {
+		p.advanceBar()
+	}
+	if bar, beat, tick := p.position(); bar != 1 || beat != 5 || tick != 1 {
+		t.Errorf("got bar %d, beat %d, tick %d", bar, beat, tick)
+	}
+	p.advanceBar()
+	if p.CurrentBar() != 2 {
+		t.Errorf("got bar %d, expected 2", p.CurrentBar())
+	}
+	if err := p.SetTimeSignature(3, 5); err == nil {
+		t.Errorf("5 is not a note")
+	}
+}
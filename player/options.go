@@ -0,0 +1,146 @@
+package player
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+const (
+	// DefaultListenHertz is how often the metronome ticks, if not set
+	DefaultListenHertz = 500
+	// DefaultQuantize is the Quantize of the notes, if not set
+	DefaultQuantize = 64
+	// DefaultHighPassFilter is the HighPassFilter, if not set
+	DefaultHighPassFilter = 65
+)
+
+// Options are the settings of a new Player (see NewWithOptions).
+// Any that are not set are the defaults.
+type Options struct {
+	// BPM is the tempo (DefaultBPM of the music if not set), and
+	// ListenHertz is how many times a second the metronome ticks
+	BPM         int
+	ListenHertz int
+	// Resolution, if set, is the number of ticks in a beat whatever
+	// the tempo is (see SetResolution)
+	Resolution int
+	// Quantize makes 1/Quantize of a beat the shortest note
+	// (DefaultQuantize if not set)
+	Quantize int
+	// Order is the Markov order of the AI
+	Order int
+	// HighPassFilter (DefaultHighPassFilter if not set) and
+	// LowPassFilter (if set) are the range of the pitches the AI
+	// learns from
+	HighPassFilter int
+	LowPassFilter  int
+	// BeatsOfSilence is how many beats it waits before improvising,
+	// or SilenceThreshold how many bars if it is set
+	BeatsOfSilence   int
+	SilenceThreshold float64
+	// Key and Mode ("major" or "minor") are C major if not set
+	Key  string
+	Mode string
+	// HistoryFile is where the music history is loaded from and
+	// saved to, DefaultHistoryFile if not set
+	HistoryFile string
+	// Piano is the device to play on. If it is not set, the MIDI
+	// devices named Input and Output are opened, or the default ones.
+	Piano  piano.Device
+	Input  string
+	Output string
+	// Debug logs at the debug level, unless SetLogLevel already set
+	// it to trace
+	Debug bool
+}
+
+// validate returns an error for the first setting that makes no sense
+func (o Options) validate() error {
+	switch {
+	case o.BPM != 0 && o.BPM < MinimumBPM:
+		return fmt.Errorf("BPM must be at least %d, not %d", MinimumBPM, o.BPM)
+	case o.ListenHertz < 0:
+		return fmt.Errorf("the metronome can not tick %d times a second", o.ListenHertz)
+	case o.Resolution < 0:
+		return fmt.Errorf("resolution must be at least 1 tick a beat, not %d", o.Resolution)
+	case o.Quantize < 0:
+		return fmt.Errorf("can not quantize to 1/%d of a beat", o.Quantize)
+	case o.Order < 0:
+		return fmt.Errorf("order must be at least 1, not %d", o.Order)
+	case o.HighPassFilter < 0 || o.HighPassFilter > 127:
+		return fmt.Errorf("high pass filter %d is not a MIDI pitch", o.HighPassFilter)
+	case o.LowPassFilter < 0 || o.LowPassFilter > 127:
+		return fmt.Errorf("low pass filter %d is not a MIDI pitch", o.LowPassFilter)
+	case o.LowPassFilter > 0 && o.LowPassFilter <= o.HighPassFilter+1:
+		return fmt.Errorf("low pass filter %d lets no pitches above the high pass filter %d through", o.LowPassFilter, o.HighPassFilter)
+	case o.BeatsOfSilence < 0:
+		return fmt.Errorf("can not wait %d beats of silence", o.BeatsOfSilence)
+	case o.SilenceThreshold < 0:
+		return fmt.Errorf("can not wait %g bars of silence", o.SilenceThreshold)
+	case o.Mode != "" && o.Mode != "major" && o.Mode != "minor":
+		return fmt.Errorf("unknown mode '%s'", o.Mode)
+	}
+	if _, ok := music.KeyTonic(o.Key); o.Key != "" && !ok {
+		return fmt.Errorf("unknown key '%s'", o.Key)
+	}
+	return nil
+}
+
+// NewWithOptions initializes a Player like New, with the settings of
+// the options, and returns an error for any that make no sense
+func NewWithOptions(opts Options) (p *Player, err error) {
+	// the low pass filter is checked against the filter that is used
+	if opts.HighPassFilter == 0 {
+		opts.HighPassFilter = DefaultHighPassFilter
+	}
+	err = opts.validate()
+	if err != nil {
+		return
+	}
+	if opts.BPM == 0 {
+		opts.BPM = music.DefaultBPM
+	}
+	if opts.ListenHertz == 0 {
+		opts.ListenHertz = DefaultListenHertz
+	}
+	device := opts.Piano
+	if device == nil {
+		if opts.Input != "" || opts.Output != "" {
+			device, err = piano.NewWithDevice(opts.Input, opts.Output)
+		} else {
+			device, err = piano.New()
+		}
+		if err != nil {
+			return
+		}
+	}
+	p, err = NewWithPiano(device, opts.BPM, opts.ListenHertz, opts.Order, opts.HighPassFilter, opts.Debug)
+	if err != nil {
+		return
+	}
+	if opts.Resolution > 0 {
+		p.SetResolution(opts.Resolution)
+	}
+	if opts.Quantize > 0 {
+		p.Quantize = opts.Quantize
+	}
+	p.LowPassFilter = opts.LowPassFilter
+	p.AI.SetFilters(p.HighPassFilter, opts.LowPassFilter)
+	if opts.BeatsOfSilence > 0 {
+		p.BeatsOfSilence = opts.BeatsOfSilence
+	}
+	p.SilenceThreshold = opts.SilenceThreshold
+	if opts.Key != "" {
+		p.Key = strings.TrimSpace(opts.Key)
+	}
+	if opts.Mode != "" {
+		p.Mode = opts.Mode
+	}
+	if opts.HistoryFile != "" && opts.HistoryFile != p.MusicHistoryFile {
+		err = p.OpenHistory(opts.HistoryFile)
+	}
+	return
+}
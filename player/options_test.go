@@ -0,0 +1,57 @@
+package player
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{BPM: 5},
+		{Order: -1},
+		{HighPassFilter: 128},
+		{HighPassFilter: 60, LowPassFilter: 50},
+		// below the default high pass filter
+		{LowPassFilter: 60},
+		// nothing is between the two
+		{HighPassFilter: 60, LowPassFilter: 61},
+		{BeatsOfSilence: -2},
+		{SilenceThreshold: -1},
+		{Key: "H"},
+		{Mode: "dorian"},
+	} {
+		opts.Piano = piano.NewMock()
+		if _, err := NewWithOptions(opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := NewWithOptions(Options{
+		Piano:          piano.NewMock(),
+		Resolution:     96,
+		BeatsOfSilence: 4,
+		Key:            "F#",
+		Mode:           "minor",
+		HistoryFile:    filepath.Join(dir, "history.json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	if p.BPM != 120 || p.TicksPerBeat != 96 || p.BeatsOfSilence != 4 || p.Key != "F#" || p.Mode != "minor" {
+		t.Errorf("expected the options to be set, got %d BPM at %d ticks, %d beats of silence in %s %s",
+			p.BPM, p.TicksPerBeat, p.BeatsOfSilence, p.Key, p.Mode)
+	}
+	if p.MusicHistoryFile != filepath.Join(dir, "history.json") || p.HighPassFilter != 65 {
+		t.Errorf("expected the history in %s and the default high pass filter, got %s and %d", dir, p.MusicHistoryFile, p.HighPassFilter)
+	}
+}
@@ -0,0 +1,251 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// oscPrefix is the start of all the OSC addresses of the player
+const oscPrefix = "/pianoai/"
+
+// oscMessage is a single OSC message, with arguments that are
+// int32, float32, float64, string or bool
+type oscMessage struct {
+	Address string
+	Args    []interface{}
+}
+
+// oscHandlers are the OSC addresses that take an argument. Every
+// action of the control keys can also be sent to its own address,
+// such as /pianoai/improvise or /pianoai/teach.
+var oscHandlers = map[string]func(p *Player, args []interface{}) error{
+	"bpm": func(p *Player, args []interface{}) (err error) {
+		bpm, err := oscFloat(args)
+		if err != nil {
+			return
+		}
+		p.SetBPM(int(bpm))
+		return
+	},
+	"swing": func(p *Player, args []interface{}) (err error) {
+		swing, err := oscFloat(args)
+		if err != nil {
+			return
+		}
+		p.Lock()
+		p.Swing = swing
+		p.Unlock()
+		return
+	},
+	"temperature": func(p *Player, args []interface{}) (err error) {
+		temperature, err := oscFloat(args)
+		if err != nil {
+			return
+		}
+		p.Lock()
+		p.Temperature = temperature
+		p.Unlock()
+		return
+	},
+}
+
+// StartOSC listens for Open Sound Control messages on a UDP address
+// like ":57120", alongside the MIDI Listen. Messages to
+// /pianoai/bpm, /pianoai/temperature and /pianoai/swing set the tempo,
+// the temperature of the AI and the Swing, and /pianoai/ followed by
+// the name of an action (see ControlMap) does that action.
+func (p *Player) StartOSC(addr string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.StartOSC",
+	})
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return
+	}
+	logger.Infof("Listening for OSC on %s", conn.LocalAddr())
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			messages, err := parseOSC(buf[:n])
+			if err != nil {
+				logger.Warn(err.Error())
+				continue
+			}
+			for _, message := range messages {
+				if err := p.handleOSC(message); err != nil {
+					logger.Warn(err.Error())
+				}
+			}
+		}
+	}()
+	return
+}
+
+// handleOSC does whatever an OSC message asks for
+func (p *Player) handleOSC(message oscMessage) (err error) {
+	log.WithFields(log.Fields{
+		"function": "Player.handleOSC",
+	}).Debugf("%s %v", message.Address, message.Args)
+	if !strings.HasPrefix(message.Address, oscPrefix) {
+		return fmt.Errorf("unknown OSC address '%s'", message.Address)
+	}
+	name := strings.TrimPrefix(message.Address, oscPrefix)
+	if handler, ok := oscHandlers[name]; ok {
+		err = handler(p, message.Args)
+		if err != nil {
+			err = fmt.Errorf("%s: %s", message.Address, err.Error())
+		}
+		return
+	}
+	if _, ok := actions[name]; !ok {
+		return fmt.Errorf("unknown OSC address '%s'", message.Address)
+	}
+	// a button sends 0 when it is released
+	if value, err := oscFloat(message.Args); err == nil && value == 0 {
+		return nil
+	}
+	go p.doAction(name)
+	return
+}
+
+// oscFloat returns the first argument of a message as a number
+func oscFloat(args []interface{}) (value float64, err error) {
+	if len(args) == 0 {
+		err = errors.New("missing argument")
+		return
+	}
+	switch v := args[0].(type) {
+	case int32:
+		value = float64(v)
+	case float32:
+		value = float64(v)
+	case float64:
+		value = v
+	case bool:
+		if v {
+			value = 1
+		}
+	default:
+		err = fmt.Errorf("argument %v is not a number", args[0])
+	}
+	return
+}
+
+// parseOSC returns the messages in an OSC packet, which is either a
+// single message or a bundle of them. The time tags of bundles are
+// ignored, so everything happens as soon as it arrives.
+func parseOSC(packet []byte) (messages []oscMessage, err error) {
+	if bytes.HasPrefix(packet, []byte("#bundle\x00")) {
+		if len(packet) < 16 {
+			err = errors.New("OSC bundle is truncated")
+			return
+		}
+		pos := 16
+		for pos+4 <= len(packet) {
+			size := int(binary.BigEndian.Uint32(packet[pos:]))
+			pos += 4
+			if size < 0 || pos+size > len(packet) {
+				err = errors.New("OSC bundle element is truncated")
+				return
+			}
+			var elements []oscMessage
+			elements, err = parseOSC(packet[pos : pos+size])
+			if err != nil {
+				return
+			}
+			messages = append(messages, elements...)
+			pos += size
+		}
+		return
+	}
+
+	address, pos, err := readOSCString(packet, 0)
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(address, "/") {
+		err = fmt.Errorf("invalid OSC address '%s'", address)
+		return
+	}
+	message := oscMessage{Address: address}
+	if pos >= len(packet) {
+		// no type tags, so no arguments
+		messages = []oscMessage{message}
+		return
+	}
+	tags, pos, err := readOSCString(packet, pos)
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(tags, ",") {
+		err = errors.New("OSC message has no type tags")
+		return
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if pos+4 > len(packet) {
+				err = errors.New("OSC argument is truncated")
+				return
+			}
+			bits := binary.BigEndian.Uint32(packet[pos:])
+			if tag == 'i' {
+				message.Args = append(message.Args, int32(bits))
+			} else {
+				message.Args = append(message.Args, math.Float32frombits(bits))
+			}
+			pos += 4
+		case 'd':
+			if pos+8 > len(packet) {
+				err = errors.New("OSC argument is truncated")
+				return
+			}
+			message.Args = append(message.Args, math.Float64frombits(binary.BigEndian.Uint64(packet[pos:])))
+			pos += 8
+		case 's':
+			var s string
+			s, pos, err = readOSCString(packet, pos)
+			if err != nil {
+				return
+			}
+			message.Args = append(message.Args, s)
+		case 'T':
+			message.Args = append(message.Args, true)
+		case 'F':
+			message.Args = append(message.Args, false)
+		default:
+			err = fmt.Errorf("OSC type tag '%c' is not supported", tag)
+			return
+		}
+	}
+	messages = []oscMessage{message}
+	return
+}
+
+// readOSCString reads a null-terminated string, padded to four bytes
+func readOSCString(data []byte, pos int) (s string, newPos int, err error) {
+	end := bytes.IndexByte(data[pos:], 0)
+	if end < 0 {
+		err = errors.New("OSC string is not terminated")
+		return
+	}
+	s = string(data[pos : pos+end])
+	newPos = pos + (end/4+1)*4
+	if newPos > len(data) {
+		newPos = len(data)
+	}
+	return
+}
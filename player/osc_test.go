@@ -0,0 +1,63 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// oscString pads a string for an OSC packet
+func oscString(s string) []byte {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestParseOSC(t *testing.T) {
+	var message bytes.Buffer
+	message.Write(oscString("/pianoai/temperature"))
+	message.Write(oscString(",fi"))
+	binary.Write(&message, binary.BigEndian, math.Float32bits(0.5))
+	binary.Write(&message, binary.BigEndian, int32(3))
+
+	var bundle bytes.Buffer
+	bundle.Write(oscString("#bundle"))
+	bundle.Write(make([]byte, 8))
+	binary.Write(&bundle, binary.BigEndian, uint32(message.Len()))
+	bundle.Write(message.Bytes())
+	bare := oscString("/pianoai/teach")
+	binary.Write(&bundle, binary.BigEndian, uint32(len(bare)))
+	bundle.Write(bare)
+
+	messages, err := parseOSC(bundle.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("got %+v", messages)
+	}
+	if messages[0].Address != "/pianoai/temperature" || len(messages[0].Args) != 2 ||
+		messages[0].Args[0] != float32(0.5) || messages[0].Args[1] != int32(3) {
+		t.Errorf("got %+v", messages[0])
+	}
+	if messages[1].Address != "/pianoai/teach" || len(messages[1].Args) != 0 {
+		t.Errorf("got %+v", messages[1])
+	}
+
+	p := &Player{Temperature: 1}
+	if err := p.handleOSC(messages[0]); err != nil {
+		t.Fatal(err)
+	}
+	if p.Temperature != 0.5 {
+		t.Errorf("temperature is %2.2f, expected 0.5", p.Temperature)
+	}
+	if err := p.handleOSC(oscMessage{Address: "/pianoai/nothing"}); err == nil {
+		t.Errorf("expected an error for an unknown address")
+	}
+	if _, err := parseOSC([]byte("/pianoai")); err == nil {
+		t.Errorf("expected an error for an unterminated address")
+	}
+}
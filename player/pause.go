@@ -0,0 +1,47 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pause stops the metronome, and with it everything that is played,
+// turning off whatever is sounding (and stopping the MIDI clock). The
+// Tick, the notes still to come and what the AI learned are kept for
+// Resume.
+func (p *Player) Pause() {
+	p.Lock()
+	if p.paused {
+		p.Unlock()
+		return
+	}
+	p.paused = true
+	p.Unlock()
+	p.sendClockMessage(piano.ClockStop)
+	p.Panic()
+	log.WithFields(log.Fields{
+		"function": "Player.Pause",
+	}).Infof("Paused on tick %d", p.CurrentBeat())
+}
+
+// Resume starts the metronome again from the tick it was paused on,
+// so the time that passed while paused is skipped
+func (p *Player) Resume() {
+	p.Lock()
+	wasPaused := p.paused
+	p.paused = false
+	p.Unlock()
+	if wasPaused {
+		p.sendClockMessage(piano.ClockContinue)
+		log.WithFields(log.Fields{
+			"function": "Player.Resume",
+		}).Infof("Resumed on tick %d", p.CurrentBeat())
+	}
+}
+
+// Paused returns whether the player is paused
+func (p *Player) Paused() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.paused
+}
@@ -4,119 +4,432 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/rakyll/portmidi"
 	"github.com/schollz/pianoai/ai2"
 	"github.com/schollz/pianoai/music"
 	"github.com/schollz/pianoai/piano"
 	log "github.com/sirupsen/logrus"
 )
 
-func init() {
-	// Log as JSON instead of the default ASCII formatter.
-	// log.SetFormatter(&log.JSONFormatter{})
-
-	// Output to stdout instead of the default stderr
-	// Can be any io.Writer, see below for File example
-	// log.SetOutput(os.Stdout)
-
-	// Only log the warning severity or above.
-	log.SetLevel(log.DebugLevel)
-}
+// minKeyConfidence is how sure DetectKey has to be for AutoKey to change the key
+const minKeyConfidence = 0.5
 
 // Player is the main structure which facilitates the Piano, and the AI.
 // The Player spawns threads for listening to events on the Piano, and also
 // spawns threads for playing notes on the piano. It also spawns threads
 // for doing the machine learning and using the results.
 type Player struct {
+	// tick counts the ticks of the metronome, and is only used
+	// atomically (see CurrentBeat), which needs it to come first, and
+	// tickStarted is when the tick is heard, in Unix nanoseconds
+	tick        int64
+	tickStarted int64
 	// BPM is the beats per minute
 	BPM int
-	// Beat counts the number of 1/64 beats
-	Tick int
-	// Key stores the key of the song (TODO: Add in key-signature constraints)
-	Key string
+	// Key stores the key of the song, and Mode is either "major" or "minor"
+	Key  string
+	Mode string
+	// ConstrainToKey snaps the improvisation to the notes of the key
+	ConstrainToKey bool
+	// Scale, if it has any intervals, snaps the improvisation to the
+	// notes of that scale on the tonic of Key instead, whether or not
+	// it is ConstrainToKey, from the next improvisation on
+	Scale music.Scale
+	// AutoKey sets the Key and Mode from what is played whenever the
+	// AI is taught, if the key is clear enough
+	AutoKey bool
+	// TeachFilter picks the notes of the history that the AI learns
+	// from. If it is not set, the AI learns from HumanInRange, so that
+	// it does not learn from what it played itself.
+	TeachFilter func(music.Note) bool
+	// Temperature is passed on to the AI, and follows the mod wheel
+	Temperature float64
+	// IntensitySensitivity is how much the AI follows how hard the
+	// last intensityBeats beats were played, from 0 to 1: it plays
+	// that much nearer to their velocity, and sparser if they were soft
+	IntensitySensitivity float64
+	// BlendRatio is passed on to the AI, to mix the models of a Blend,
+	// and follows the control change of BlendController (if it is set).
+	// blending is set while the AI blends instead of learning.
+	BlendRatio      float64
+	BlendController int
+	blending        bool
+	// TimeSignature is the number of beats in a bar (4/4 by default),
+	// use SetTimeSignature to change it. bar is the bar that is playing
+	// and barTick is the number of ticks since it started.
+	TimeSignature TimeSignature
+	bar, barTick  int
+	// Metronome clicks the beats on MetronomePitch of MetronomeChannel
+	// (0-15), which default to a wood block on the drums of channel 10
+	Metronome        bool
+	MetronomePitch   int
+	MetronomeChannel int
+	// CountIn is the number of bars the metronome clicks before a playback
+	// or a loop starts, and countInUntil is the tick the count-in ends
+	CountIn      int
+	countInUntil int
+	// OutputLatency is how long it takes for what is played to be heard.
+	// The ticks of the metronome come that much early to make up for it,
+	// which only changes when the notes are played, not their beats.
+	// calibration gets the times of the keys played to CalibrateLatency.
+	OutputLatency time.Duration
+	calibration   chan time.Time
 
 	// Piano is the piano that does the playing, the MIDI keyboard
-	Piano *piano.Piano
+	Piano piano.Device
 	// MusicFuture is a map of future chords to play
 	MusicFuture *music.Music
 	// MusicHistory is a map of all the previous notes played
 	MusicHistory     *music.Music
 	MusicHistoryFile string
+	// AIHistory is the notes the AI played, kept apart from what was
+	// played on the keyboard
+	AIHistory *music.Music
+	// AutosaveInterval, if set, is how often the music history is
+	// saved to MusicHistoryFile while it is changing
+	AutosaveInterval time.Duration
+	// scheduler keeps track of the notes sounding from MusicFuture
+	scheduler *scheduler
+	// loop is the phrase being looped, if any, and loopFuture
+	// has its notes for the repetition that is coming up
+	loop       *loop
+	loopFuture *music.Music
+	// Bass plays a bass line under what is played, made by the AI for
+	// BassBars bars at a time from the harmony of the bars before.
+	// bassFuture has its notes and bassUntil is the tick it ends.
+	Bass       bool
+	BassBars   int
+	bassFuture *music.Music
+	bassUntil  int
+	// Drums plays a groove along, made by the AI a bar at a time.
+	// drumFuture has its notes and drumsUntil is the tick it ends.
+	Drums      bool
+	drumFuture *music.Music
+	drumsUntil int
+	// Arpeggiate breaks held chords into the pattern of the Arpeggiator,
+	// from the keys that are held (by pitch, with their note-on). The
+	// notes go into arpFuture, and arpNext and arpStep are the tick and
+	// step of the next note.
+	Arpeggiate  bool
+	Arpeggiator Arpeggiator
+	held        map[int]music.Note
+	arpFuture   *music.Music
+	arpNext     int
+	arpStep     int
+	// OnReconnect is called when the MIDI devices come back after
+	// they were lost, such as when the keyboard is plugged back in
+	OnReconnect func()
+	// broadcaster sends the notes to the clients of StartWebSocket
+	broadcaster *broadcaster
 
-	// AI stores the AI being used
-	AI *ai2.AI
+	// ControlMap maps the pitches of the control keys to their
+	// actions ("save", "playback", "export", "bass", "arpeggiator",
+	// "session", "bundle", "metronome", "pause", "undo", "forget", "panic", "tap",
+	// "slower", "faster", "teach", "improvise", "harmonize",
+	// "transpose-up", "transpose-down", "quantize", "step-mode", "step"
+	// and "next-instrument")
+	ControlMap map[int]string
+
+	// AI stores the AI being used, and AIModelFile is where
+	// what it learned is saved
+	AI          *ai2.AI
+	AIModelFile string
+	// Generator is what learns and improvises, which is AI
+	// unless it is replaced with SetGenerator
+	Generator Generator
 	// BeatsOfSilence waits this number of beats before asking
-	// the AI for an improvisation
-	BeatsOfSilence int
+	// the AI for an improvisation, unless SilenceThreshold is set
+	// to wait a number of bars of the time signature instead
+	BeatsOfSilence   int
+	SilenceThreshold float64
+	// RecentBeats is how many of the last beats the AI learns from
+	// after it forgets, and learnFrom is the beat it learns from since
+	RecentBeats int
+	learnFrom   int
+	// taughtUntil is the beat of the last note the AI was taught, or 0
+	// to learn them all, and taughtCount is how many notes had been
+	// added to the history by then, so that it only has to learn the
+	// notes added after. It learns them all again if any of those
+	// come before taughtUntil, as they can not be learned on top.
+	taughtUntil int
+	taughtCount int
+	// MinNotesToTeach is the fewest notes the AI is taught from,
+	// as it only repeats itself when it learns from any less
+	MinNotesToTeach int
 	// lastNote is the beat of the last note played
 	lastNote int
 	// HighPassFilter only uses notes above a certain level
-	// for computing last note
+	// for computing last note, and LowPassFilter (if set) only the
+	// ones below it. A note passes when HighPassFilter < pitch <
+	// LowPassFilter, so neither of the edges themselves pass, and
+	// nothing does if LowPassFilter is not above HighPassFilter + 1.
+	// The AI is told the same filters, but it also keeps a note on
+	// HighPassFilter itself.
 	HighPassFilter int
-	// KeysCurrentlyPressed keeps track of whether a key is down (should be 0 if no keys are down)
+	LowPassFilter  int
+	// FilterHistory leaves the notes that do not pass the filters
+	// out of the MusicHistory altogether
+	FilterHistory bool
+	// KeysCurrentlyPressed keeps track of whether a key is down (should be 0 if no keys are down),
+	// and is the number of pitches in pressed, on all the devices
 	KeysCurrentlyPressed int
+	// pressed are the pitches that are down, by device
+	pressed map[int]map[int]bool
 
 	// Listening frequency (to determine tick size)
 	ListeningRateHertz int
 	// Number of ticks per beat
 	TicksPerBeat int
-	// 1/Quantize = shortest possible note
+	// Resolution, if set, is the fixed number of ticks per beat, and the
+	// listening rate follows the tempo (use SetResolution to change it).
+	// The beats of the music history are ticks, so a saved history
+	// plays back at the speed it was recorded only with the same
+	// resolution (or listening rate) and BPM it was recorded with.
+	Resolution int
+	// tickTimeChange tells the metronome that the tick size changed
+	tickTimeChange chan struct{}
+	// ramp is the TempoRamp that is changing the tempo, if any
+	ramp *tempoRamp
+	// paused stops the ticks of the metronome until Resume
+	paused bool
+	// ExternalClock moves the metronome on with the MIDI clock of the
+	// input (such as a drum machine) instead of its own ticks, and sets
+	// the BPM to the tempo of the clock. The clock messages go from
+	// Listen to the metronome through clockEvents.
+	ExternalClock bool
+	clockEvents   chan clockEvent
+	clock         externalClock
+	// SendClock sends MIDI clock to the output, so that other gear can
+	// follow the tempo, starting it in Start and stopping it in Close
+	SendClock bool
+	// 1/Quantize = shortest possible note, as a part of a beat
+	// (DefaultQuantize), or any note if it is 0
 	Quantize int
 
-	// flag to allow only manually activation
-	ManualAI bool
+	// AutoImprovise lets the AI improvise by itself after BeatsOfSilence,
+	// once per silence, instead of only when triggered by a control key
+	AutoImprovise bool
+	// hasImprovised is set when the AI has improvised in the current silence
+	hasImprovised bool
+	// CallResponse has the AI answer each phrase that is played, once
+	// there is a silence, instead of improvising. phraseStart is the beat
+	// the phrase started on.
+	CallResponse bool
+	phraseStart  int
+	// LickLength is the number of beats the AI improvises
+	// for, which is 4 if not set
+	LickLength int
+	// FillMode has the AI play a short Fill when the host stops for half
+	// of BeatsOfSilence, instead of improvising once the silence is over
+	FillMode bool
+
+	// AIChannel is the MIDI channel (0-15) that the AI plays on, so that
+	// it can be mixed separately from what is played on the keyboard
+	AIChannel int
+	// instruments are the programs that were set on each channel
+	instruments map[int]int
 
 	// UseHostVelocity changes emitted notes to follow the velocity of the host
 	UseHostVelocity bool
+	// Thru sends the notes played on the keyboard straight to the
+	// output as well, on their own channel, besides recording them
+	Thru bool
+	// CompactHistory saves the music history in the shorter form of
+	// SaveCompact. Either form is compressed if its file ends in ".gz".
+	CompactHistory bool
+	// PlaybackTranspose shifts the history by a number of semitones as
+	// it is played back or looped, without changing the history itself
+	PlaybackTranspose int
+	// events are sent to Events until eventsClosed, guarded by eventsLock
+	events       chan Event
+	eventsLock   sync.RWMutex
+	eventsClosed bool
+	// Echo repeats the notes played on the keyboard in time, and
+	// echoFuture has the repeats to come, apart from the future so
+	// that they never hold up an improvisation nor replace its notes
+	Echo       Echo
+	echoFuture *music.Music
+	// Swing plays the off beats of the improvisations and the loop late,
+	// from 0 for straight to about 0.66 for a heavy shuffle, without
+	// changing the history. SwingSubdivision is 8 to swing the eighth
+	// notes (the default) or 16 for the sixteenth notes. The notes that
+	// are late wait in swungFuture and swungLoop, which only Emit
+	// uses, and resetSwing empties them on its next tick.
+	Swing            float64
+	SwingSubdivision int
+	swungFuture      swingBuffer
+	swungLoop        swingBuffer
+	resetSwing       bool
+	// StepMode records the notes one step at a time instead of when they
+	// are played: every key pressed goes on the step, and the "step"
+	// control key moves on to the next one. StepLength is the length of
+	// the steps in ticks (a sixteenth note if not set), step is the beat
+	// of the step and stepping is whether the steps have started.
+	StepMode   bool
+	StepLength int
+	step       int
+	stepping   bool
+	// MaxPolyphony is the most notes the player sounds at once, after
+	// which the oldest note is turned off to play a new one. It is
+	// unlimited if 0.
+	MaxPolyphony int
+	// MaxNoteDuration is the most beats a key can be held before it is
+	// turned off, in case its note-off was lost. It is unlimited if 0.
+	MaxNoteDuration int
+	// inputEvents are the events that Listen gets from the keyboard
+	inputEvents chan portmidi.Event
+	// Inputs are more MIDI devices to listen to, such as a second
+	// keyboard or a drum pad, whose notes are marked with their Device
+	// (from 1 on, in order). Nothing is played on them.
+	Inputs []piano.Device
+	// deviceEvents are the events that Listen gets from all of them
+	deviceEvents chan inputEvent
+	// emitNotes and emitPlay are used again by every Emit, for the notes
+	// of the future and the notes to play, so that it does not allocate
+	emitNotes []music.Note
+	emitPlay  []music.Note
+	// late are the notes with an Offset, waiting to be played
+	late lateNotes
+	// VelocityCurve changes the velocity of the notes that are played,
+	// before they are stored (nil keeps the velocities as they are)
+	VelocityCurve VelocityCurve
 
 	LastHostPress int
 	IsImprovising bool
 	lastVelocity  int
+	taps          []time.Time
+	// TempoFollow changes the BPM gradually to the tempo that is played,
+	// from when the recent notes were played, by at most MaxTempoChange
+	// BPM every beat (2 if it is not set). onsets are those times, and
+	// followBPM is the tempo being followed, before it is rounded.
+	TempoFollow    bool
+	MaxTempoChange float64
+	onsets         []time.Time
+	followBPM      float64
+
+	// sustainDown is whether the sustain pedal of each device is down, and
+	// sustainedPitches are the keys released while it was down and which
+	// are still sounding
+	sustainDown      map[int]bool
+	sustainedPitches map[sustainedKey]bool
+
+	sync.RWMutex
+}
+
+// New initializes the parameters and connects up the piano.
+// Debug logs at the debug level, unless SetLogLevel already set
+// it to trace. Optionally you can pass the names of the input and
+// output MIDI devices, respectively. NewWithOptions has the rest
+// of the settings, such as the Markov order of the AI and the
+// HighPassFilter.
+func New(bpm, listenHertz int, debug bool, devices ...string) (p *Player, err error) {
+	opts := Options{BPM: bpm, ListenHertz: listenHertz, Debug: debug}
+	if len(devices) > 0 {
+		opts.Input = devices[0]
+	}
+	if len(devices) > 1 {
+		opts.Output = devices[1]
+	}
+	return NewWithOptions(opts)
 }
 
-// New initializes the parameters and connects up the piano
-func New(bpm, listenHertz int, debug bool) (p *Player, err error) {
+// NewWithPiano initializes the parameters like New, but plays
+// on a device that is already connected, such as a piano.Mock
+func NewWithPiano(device piano.Device, bpm, listenHertz, order, highPass int, debug bool) (p *Player, err error) {
 	p = new(Player)
 	logger := log.WithFields(log.Fields{
 		"function": "Player.Init",
 	})
-	if !debug {
-		log.SetLevel(log.InfoLevel)
+	if order < 0 {
+		err = fmt.Errorf("order must be at least 1, not %d", order)
+		return
 	}
-	p.BPM = bpm
-	p.Tick = 0
-	p.Key = "C"
-	p.Quantize = 64
-
-	logger.Debug("Loading piano")
-	p.Piano, err = piano.New()
-	if err != nil {
+	if listenHertz < 1 {
+		err = fmt.Errorf("the metronome can not tick %d times a second", listenHertz)
 		return
 	}
+	if debug && !log.IsLevelEnabled(log.DebugLevel) {
+		log.SetLevel(log.DebugLevel)
+	}
+	p.Piano = device
+	p.BPM = bpm
+	if p.BPM < MinimumBPM {
+		p.BPM = MinimumBPM
+	}
+	p.setTick(0)
+	p.Key = "C"
+	p.Mode = "major"
+	p.Temperature = 1
+	p.IntensitySensitivity = 0.5
+	p.TimeSignature = TimeSignature{4, 4}
+	p.bar = 1
+	p.MetronomePitch = DefaultMetronomePitch
+	p.MetronomeChannel = DefaultMetronomeChannel
+	p.Quantize = DefaultQuantize
 
 	logger.Debug("Loading music")
 	p.MusicFuture = music.New()
-	var errOpening error
-	p.MusicHistoryFile = "music_history.json"
-	p.MusicHistory, errOpening = music.Open(p.MusicHistoryFile)
+	p.events = make(chan Event, eventBuffer)
+	p.bassFuture = music.New()
+	p.BassBars = 4
+	p.drumFuture = music.New()
+	p.echoFuture = music.New()
+	p.arpFuture = music.New()
+	p.swungFuture = make(swingBuffer)
+	p.swungLoop = make(swingBuffer)
+	p.broadcaster = newBroadcaster()
+	p.held = make(map[int]music.Note)
+	p.Arpeggiator = Arpeggiator{Mode: "up"}
+	p.Echo = Echo{Feedback: 3, Decay: 0.6}
+	p.scheduler = newScheduler()
+	p.ControlMap = DefaultControlMap()
+	errOpening := p.OpenHistory(DefaultHistoryFile)
 	if errOpening != nil {
 		logger.Warn(errOpening.Error())
-		p.MusicHistory = music.New()
-	} else {
-		logger.Info("Loaded previous music history")
+		p.MusicHistoryFile, p.MusicHistory = DefaultHistoryFile, music.New()
 	}
 
 	logger.Debug("Loading AI")
 	p.ListeningRateHertz = listenHertz
+	p.tickTimeChange = make(chan struct{}, 1)
+	p.clockEvents = make(chan clockEvent, 1024)
 	p.BeatsOfSilence = 2
-	p.HighPassFilter = 65
+	p.RecentBeats = 64
+	p.MinNotesToTeach = 8
+	p.HighPassFilter = DefaultHighPassFilter
+	if highPass != 0 {
+		p.HighPassFilter = highPass
+	}
 	p.lastNote = 0
+	p.AutoImprovise = true
+	p.sustainDown = make(map[int]bool)
+	p.sustainedPitches = make(map[sustainedKey]bool)
 
-	p.TicksPerBeat = int(float64(p.ListeningRateHertz) / (float64(p.BPM) / 60))
+	p.TicksPerBeat = p.ticksPerBeat()
+	p.MusicHistory.BPM = p.BPM
+	p.MusicHistory.TicksPerBeat = p.TicksPerBeat
+	p.AIHistory = music.New()
+	p.AIHistory.BPM = p.BPM
+	p.AIHistory.TicksPerBeat = p.TicksPerBeat
 
 	p.AI = ai2.New(p.TicksPerBeat)
 	p.AI.HighPassFilter = p.HighPassFilter
+	p.AI.TicksPerBar = p.TimeSignature.barTicks(p.TicksPerBeat)
+	if order > 0 {
+		p.AI.Order = order
+	}
+	p.Generator = aiGenerator{p.AI}
+	p.AIModelFile = "ai_model.json"
+	errOpening = p.AI.Load(p.AIModelFile)
+	if errOpening != nil {
+		logger.Debug(errOpening.Error())
+	} else {
+		logger.Info("Loaded previous AI model")
+	}
 
 	return
 }
@@ -126,11 +439,23 @@ func (p *Player) Close() (err error) {
 	logger := log.WithFields(log.Fields{
 		"function": "Player.Close",
 	})
+	p.sendClockMessage(piano.ClockStop)
+	defer p.closeEvents()
+	logger.Debug("Turning off all notes...")
+	err = p.Piano.Panic()
+	if err != nil {
+		logger.Error(err.Error())
+	}
 	logger.Debug("Closing piano...")
 	err = p.Piano.Close()
 	if err != nil {
 		logger.Error(err.Error())
 	}
+	for _, input := range p.inputs() {
+		if errClose := input.Close(); errClose != nil {
+			logger.Error(errClose.Error())
+		}
+	}
 	return
 }
 
@@ -155,38 +480,63 @@ func (p *Player) Start() {
 		}
 	}()
 
+	// the key is written in the scores of the history
+	p.MusicHistory.Lock()
+	p.MusicHistory.Key, p.MusicHistory.Mode = p.Key, p.Mode
+	p.MusicHistory.Unlock()
+
 	// start listening
 	go p.Listen()
+	if p.AutosaveInterval > 0 {
+		go p.autosave()
+	}
 
-	p.Tick = 0
-	tickTime := 1000 * time.Duration(1000000/p.ListeningRateHertz)
-	tickChan := time.NewTicker(tickTime).C
-	logger.Infof("BPM:  %d, tick size: %s (%d ticks / beat)", p.BPM, tickTime.String(), p.TicksPerBeat)
+	p.setTick(0)
+	p.resetBars()
+	if p.ExternalClock && p.Resolution == 0 {
+		// the beats have to stay the same length when the clock changes tempo
+		_, ticksPerBeat := p.tempo()
+		p.SetResolution(ticksPerBeat)
+	}
+	p.RLock()
+	tickTime := p.tickTime()
+	p.RUnlock()
+	schedule := newTickSchedule(time.Now(), tickTime)
+	timer := time.NewTimer(time.Until(schedule.next().Add(-p.outputLatency())))
+	defer timer.Stop()
+	ticks := timer.C
+	p.sendClockMessage(piano.ClockStart)
+	bpm, ticksPerBeat := p.tempo()
+	if p.ExternalClock {
+		timer.Stop()
+		ticks = nil
+		logger.Infof("Following the MIDI clock (%d ticks / beat)", ticksPerBeat)
+	} else {
+		logger.Infof("BPM:  %d, tick size: %s (%d ticks / beat)", bpm, tickTime.String(), ticksPerBeat)
+	}
 	for {
 		select {
-		case <-tickChan:
-			// if p.Tick == math.Trunc(p.Tick) {
-			// 	logger.Debugf("beat %2.0f", p.Tick)
-			// }
-			p.Tick += 1
-			go p.Emit(p.Tick)
-
-			if !p.ManualAI {
-				if p.Tick-p.lastNote > (p.TicksPerBeat*p.BeatsOfSilence) && p.KeysCurrentlyPressed == 0 && !p.AI.IsLearning {
-					logger.Info("Silence exceeded, trying to improvise")
-					p.lastNote = p.Tick
-					go p.Improvisation()
-				}
+		case <-p.tickTimeChange:
+			if p.ExternalClock {
+				continue
 			}
-
-			// if math.Mod(float64(p.Tick), 64) == 0 {
-			// 	logger.WithFields(log.Fields{
-			// 		"Beat":     p.Tick,
-			// 		"LastNote": p.lastNote,
-			// 		"KeysDown": p.KeysCurrentlyPressed,
-			// 	}).Debug("metronome")
-			// }
-
+			p.RLock()
+			tickTime = p.tickTime()
+			p.RUnlock()
+			schedule.change(tickTime)
+			logger.Debugf("tick size: %s", tickTime.String())
+		case event := <-p.clockEvents:
+			for i := p.followClock(event); i > 0 && !p.Paused(); i-- {
+				p.nextTick()
+			}
+		case <-ticks:
+			schedule.catchUp(time.Now())
+			// the ticks come early, so that what is played is heard on time
+			timer.Reset(time.Until(schedule.next().Add(-p.outputLatency())))
+			if p.Paused() {
+				continue
+			}
+			p.nextTick()
 		case <-doneChan:
 			fmt.Println("Done")
 			return
@@ -194,61 +544,319 @@ func (p *Player) Start() {
 	}
 }
 
+// nextTick moves the metronome on by a tick, playing
+// whatever is on it and improvising after a silence
+func (p *Player) nextTick() {
+	heard := time.Now()
+	if !p.ExternalClock {
+		heard = heard.Add(p.outputLatency())
+	}
+	atomic.StoreInt64(&p.tickStarted, heard.UnixNano())
+	tick := int(atomic.AddInt64(&p.tick, 1))
+	p.rampTempo()
+	p.followTempo(tick)
+	p.sendClock(tick)
+	p.Emit(tick)
+	p.repeatLoop(tick)
+	p.repeatBass(tick)
+	p.repeatDrums(tick)
+	p.arpeggiate(tick)
+	if released := p.releaseStuck(tick); len(released) > 0 {
+		bpm, _ := p.tempo()
+		p.Piano.PlayNotes(released, bpm)
+	}
+	p.advanceBar()
+	p.publishBeat(tick)
+	p.click()
+
+	// the keys are pressed and the notes played on the goroutine
+	// of Listen, so the silence is checked and ended under the lock
+	silence := p.silenceTicks()
+	learning := p.AI.Learning()
+	p.Lock()
+	silent := p.KeysCurrentlyPressed == 0 && !learning && !p.hasImprovised
+	fill := p.FillMode && silent && tick-p.lastNote > silence/2
+	improvise := (p.AutoImprovise || p.CallResponse) && silent && !fill && tick-p.lastNote > silence
+	if improvise {
+		p.lastNote = tick
+	}
+	if fill || improvise {
+		p.hasImprovised = true
+	}
+	callResponse := p.CallResponse
+	p.Unlock()
+	if fill {
+		go p.Fill()
+	}
+	if improvise {
+		log.WithFields(log.Fields{
+			"function": "Player.nextTick",
+		}).Info("Silence exceeded, trying to improvise")
+		if callResponse {
+			go p.Respond()
+		} else {
+			go p.Improvisation()
+		}
+	}
+
+}
+
+// CurrentBeat returns the tick the metronome is on, which
+// is what the Beat of the notes counts
+func (p *Player) CurrentBeat() int {
+	return int(atomic.LoadInt64(&p.tick))
+}
+
+// setTick moves the metronome to a tick
+func (p *Player) setTick(tick int) {
+	atomic.StoreInt64(&p.tick, int64(tick))
+}
+
 func (p *Player) Teach() (err error) {
 	logger := log.WithFields(log.Fields{
 		"function": "Player.Teach",
 	})
-	logger.Info("Sending history to AI")
-	err = p.AI.Learn(p.MusicHistory)
+	if p.isBlending() {
+		logger.Debug("Blending, so not learning the history")
+		return
+	}
+	p.RLock()
+	filter := p.TeachFilter
+	p.RUnlock()
+	if filter == nil {
+		filter = p.HumanInRange
+	}
+	p.teachDrums()
+	p.RLock()
+	taughtUntil, taughtCount, learnFrom := p.taughtUntil, p.taughtCount, p.learnFrom
+	p.RUnlock()
+	// the new notes are counted before the history is taken, so that
+	// none that are added in between are missed
+	added, count := p.MusicHistory.AddedSince(taughtCount)
+	history := p.teachingHistory().Filter(filter)
+	stats := history.Stats()
+	p.RLock()
+	minNotes := p.MinNotesToTeach
+	p.RUnlock()
+	if stats.Notes < minNotes {
+		err = fmt.Errorf("not teaching the AI with %d notes, it needs at least %d", stats.Notes, minNotes)
+		logger.Warn(err.Error())
+		return
+	}
+	learner, incremental := p.generator().(incrementalLearner)
+	newNotes := []music.Note{}
+	for _, note := range added {
+		if note.Beat < learnFrom || !filter(note) {
+			continue
+		}
+		if note.Beat < taughtUntil {
+			incremental = false
+		}
+		newNotes = append(newNotes, note)
+	}
+	if incremental && taughtUntil > 0 {
+		logger.Infof("Sending %d new notes to AI", len(newNotes))
+		err = learner.LearnIncremental(newNotes)
+	} else {
+		logger.Infof("Sending history to AI: %d notes of %d pitches over %2.0f beats", stats.Notes, stats.Pitches, stats.Beats)
+		err = p.generator().Learn(history.GetAll())
+	}
 	if err != nil {
+		p.relearn()
 		logger.Warn(err.Error())
 		return
 	}
+	p.Lock()
+	p.taughtUntil = history.End()
+	p.taughtCount = count
+	p.Unlock()
+	p.publish(Event{Type: Taught, Beat: p.CurrentBeat(), Notes: stats.Notes})
+	if p.AutoKey {
+		p.detectKey(history)
+	}
 	return
 }
 
-// Improvisation generates an improvisation from the AI
-// and loads into the next beats to be playing
-func (p *Player) Improvisation() {
+// detectKey sets the Key and Mode to the key of the music, unless
+// it is not at least minKeyConfidence sure about it
+func (p *Player) detectKey(mus *music.Music) {
+	key, mode, confidence := mus.DetectKey()
+	if confidence < minKeyConfidence {
+		return
+	}
+	p.Lock()
+	changed := p.Key != key || p.Mode != mode
+	p.Key, p.Mode = key, mode
+	p.Unlock()
+	p.MusicHistory.Lock()
+	p.MusicHistory.Key, p.MusicHistory.Mode = key, mode
+	p.MusicHistory.Unlock()
+	if changed {
+		log.WithFields(log.Fields{
+			"function": "Player.detectKey",
+		}).Infof("Key: %s %s (%2.0f%% sure)", key, mode, 100*confidence)
+	}
+}
+
+// Improvisation generates an improvisation from the AI, of LickLength
+// beats, and loads into the next beats to be playing. It returns the
+// beat the improvisation ends on, or 0 if there is none.
+func (p *Player) Improvisation() (end int) {
 	logger := log.WithFields(log.Fields{
 		"function": "Player.Improvisation",
 	})
-	if p.MusicFuture.HasFuture(p.Tick) || p.IsImprovising {
+	if p.MusicFuture.HasFuture(p.CurrentBeat()) || !p.startImprovising() {
 		logger.Debug("Improvising is already in progress")
 		return
 	}
-	p.IsImprovising = true
-	err := p.Teach()
-	if err != nil {
-		return
-	}
+	return p.improvise()
+}
+
+// improvise is Improvisation once startImprovising has
+// succeeded, and stops improvising when it is done
+func (p *Player) improvise() (end int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Improvisation",
+	})
+	defer p.stopImprovising()
+	// even if there is not enough to learn from,
+	// there may be something learned before
+	p.Teach()
 	logger.Info("Getting improvisation")
-	notes, err := p.AI.Lick(p.Tick)
+	p.configureAI()
+	notes, err := p.generator().Lick(p.CurrentBeat())
 	if err != nil {
 		logger.Error(err.Error())
+		return
 	}
-	newNotes := notes.GetAll()
-	for _, note := range newNotes {
-		p.MusicFuture.AddNote(note)
+	newNotes := p.fromAI(notes.Consolidate())
+	p.addToFuture(newNotes, 0)
+	end = notes.End()
+	logger.Infof("Added %d notes from AI, until %d", len(newNotes), end)
+	p.publish(Event{Type: Improvised, Beat: p.CurrentBeat(), Notes: len(newNotes)})
+	return
+}
+
+// startImprovising sets IsImprovising, unless it is already set
+// by another improvisation, in which case it returns false
+func (p *Player) startImprovising() bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.IsImprovising {
+		return false
 	}
-	logger.Infof("Added %d notes from AI", len(newNotes))
+	p.IsImprovising = true
+	return true
+}
+
+// stopImprovising clears IsImprovising when an improvisation is done
+func (p *Player) stopImprovising() {
+	p.Lock()
 	p.IsImprovising = false
+	p.Unlock()
+}
+
+// configureAI passes on the settings of the player that change how
+// the AI improvises, if the Generator is the built-in AI
+func (p *Player) configureAI() {
+	ai := p.builtIn()
+	if ai == nil {
+		return
+	}
+	intensity := p.intensity()
+	p.RLock()
+	defer p.RUnlock()
+	if p.ConstrainToKey || len(p.Scale.Intervals) > 0 {
+		ai.Key, ai.Mode = p.Key, p.Mode
+	} else {
+		ai.Key = ""
+	}
+	ai.Scale = p.Scale
+	ai.Temperature = p.Temperature
+	ai.BlendRatio = p.BlendRatio
+	ai.LickLength = p.LickLength
+	ai.Intensity = intensity
+	ai.IntensitySensitivity = p.IntensitySensitivity
+}
+
+// intensityBeats is the number of the last beats that the
+// intensity of what is played is heard over
+const intensityBeats = 8
+
+// intensity returns the average velocity of the notes played
+// on the keyboard in the last intensityBeats beats
+func (p *Player) intensity() float64 {
+	_, ticksPerBeat := p.tempo()
+	recent := p.historySince(p.CurrentBeat() - intensityBeats*ticksPerBeat)
+	return recent.Filter(p.HumanInRange).Stats().AverageVelocity
 }
 
-// Emit will play/stop notes depending on the current beat.
-// This should be run in a separate thread.
+// fromAI puts the notes made by the AI on AIChannel, with the AI as their Source
+func (p *Player) fromAI(notes music.Notes) music.Notes {
+	for i := range notes {
+		notes[i].Channel = p.AIChannel
+		notes[i].Source = music.AI
+	}
+	return notes
+}
+
+// addToFuture adds consolidated notes to the future, shifted by
+// offset ticks. Every note gets a duration so that the scheduler
+// will always turn it off.
+func (p *Player) addToFuture(notes music.Notes, offset int) {
+	for _, note := range notes {
+		if note.Duration < 1 {
+			note.Duration = 1
+		}
+		note.Beat += offset
+		p.MusicFuture.AddNote(note)
+	}
+}
+
+// Emit will play/stop notes depending on the current beat. It is
+// called on every tick of the metronome, in order, so that the
+// scheduled note-offs are always sent after their note-ons.
 func (p *Player) Emit(beat int) {
-	hasNotes, notes := p.MusicFuture.Get(beat)
+	hasNotes, notes := p.MusicFuture.AppendNotes(p.emitNotes[:0], beat)
+	p.emitNotes = notes
+	bpm, _ := p.tempo()
+	subdivision, swing := p.swingSubdivision()
+	p.Lock()
+	if p.resetSwing {
+		p.swungFuture, p.swungLoop = make(swingBuffer), make(swingBuffer)
+		p.resetSwing = false
+	}
+	p.Unlock()
+	notes = p.swungFuture.swing(beat, notes, subdivision, swing)
+	silence := p.silenceTicks()
+	p.RLock()
+	mute := !(p.CurrentBeat()-p.LastHostPress > silence && p.KeysCurrentlyPressed == 0)
+	velocity := p.lastVelocity
+	p.RUnlock()
 	if hasNotes {
-		if p.Tick-p.LastHostPress > p.BeatsOfSilence*p.TicksPerBeat && p.KeysCurrentlyPressed == 0 {
-			if p.UseHostVelocity && p.lastVelocity > 0 {
-				for i := range notes {
-					notes[i].Velocity = p.lastVelocity
-				}
+		if !mute && p.UseHostVelocity && velocity > 0 {
+			for i := range notes {
+				notes[i].Velocity = velocity
 			}
-			go p.Piano.PlayNotes(notes, p.BPM)
 		}
-		p.lastNote = p.Tick
+		p.Lock()
+		p.lastNote = p.CurrentBeat()
+		p.Unlock()
+		p.recordAI(beat, notes, mute)
+	}
+	p.scheduler.limit(p.MaxPolyphony)
+	// the loop, the bass, the arpeggio, the drums and the echoes are never muted
+	accompaniment := append(p.swungLoop.swing(beat, p.loopNotes(beat), subdivision, swing), p.bassNotes(beat)...)
+	accompaniment = append(accompaniment, p.arpNotes(beat)...)
+	accompaniment = append(accompaniment, p.drumNotes(beat)...)
+	accompaniment = append(accompaniment, p.echoNotes(beat)...)
+	toPlay := p.scheduler.appendNext(p.emitPlay[:0], beat, accompaniment, false)
+	toPlay = p.scheduler.appendNext(toPlay, beat, notes, mute)
+	p.emitPlay = toPlay
+	p.playBends(beat, mute)
+	if len(toPlay) > 0 {
+		p.playOnTime(toPlay, bpm)
+		p.broadcast(false, toPlay...)
 	}
 }
 
@@ -260,63 +868,256 @@ func (p *Player) Listen() {
 		"function": "Player.Listen",
 	})
 
-	ch := p.Piano.InputStream.Listen()
-	prevTick := p.Tick
+	ch := p.input()
+	prevTick := p.CurrentBeat()
 	for {
-		event := <-ch
-		tickOfNote := p.Tick
-		// only allow up to 64th notes
-		if tickOfNote-prevTick < p.TicksPerBeat/p.Quantize {
-			tickOfNote = prevTick
+		input := <-ch
+		event := input.Event
+		arrived := time.Now()
+		if piano.IsClock(event) {
+			if p.ExternalClock {
+				p.clockEvents <- clockEvent{event.Status, time.Now()}
+			}
+			continue
+		}
+		// bends are not quantized like the notes
+		if isBend, value := piano.IsBend(event); isBend {
+			p.bend(value, int(event.Status&0x0F))
+			continue
+		}
+		tickOfNote, offset := p.tickOffset(arrived)
+		_, ticksPerBeat := p.tempo()
+		// notes closer together than 1/Quantize of a beat are played together
+		if p.Quantize > 0 && tickOfNote-prevTick < ticksPerBeat/p.Quantize {
+			tickOfNote, offset = prevTick, 0
+		}
+		prevTick = tickOfNote
+		if isSustain, down := piano.IsSustain(event); isSustain {
+			p.sustain(down, input.device, tickOfNote)
+			continue
+		}
+		if isControl, controller, value := piano.IsControl(event); isControl {
+			p.controlChange(controller, value)
+			continue
+		}
+		if !piano.IsNote(event) {
+			continue
+		}
+		if p.heardClick(piano.IsNoteOn(event), arrived) {
+			continue
 		}
 		note := music.Note{
-			On:       event.Data2 > 0,
+			On:       piano.IsNoteOn(event),
 			Pitch:    int(event.Data1),
 			Velocity: int(event.Data2),
 			Beat:     tickOfNote,
+			Channel:  int(event.Status & 0x0F),
+			Source:   music.Human,
+			Offset:   offset,
+			Device:   input.device,
+		}
+		if note.On {
+			note.Velocity = p.velocityCurve().apply(note.Velocity)
 		}
-		prevTick = tickOfNote
 
-		if note.Pitch == 21 {
-			if !note.On {
-				continue
-			}
-			p.MusicHistory.Save(p.MusicHistoryFile)
-			logger.Infof("Saved %s.json", p.MusicHistoryFile)
-		} else if note.Pitch == 22 {
-			if !note.On {
-				continue
+		if action, isControl := p.control(note.Pitch); isControl {
+			if note.On {
+				p.doAction(action)
 			}
-			logger.Info("Playing back history")
-			for _, note := range p.MusicHistory.GetAll() {
-				logger.Infof("Adding %+v to future", note)
-				p.MusicFuture.AddNote(note)
+			continue
+		}
+		if p.Thru && note.On {
+			p.thru(note)
+		}
+		if p.stepMode() {
+			if p.Thru && !note.On {
+				p.thru(note)
 			}
-			p.Tick = 0
-		} else if note.Pitch == 107 {
-			if !note.On {
-				continue
+			if p.inRange(note.Pitch) {
+				p.press(note)
 			}
-			p.Teach()
-		} else if note.Pitch == 108 {
-			if !note.On {
-				continue
+			p.broadcast(true, note)
+			p.stepNote(note)
+			continue
+		}
+		if !note.On && p.inRange(note.Pitch) {
+			p.Lock()
+			p.lastNote = p.CurrentBeat()
+			p.Unlock()
+			p.press(note)
+		}
+		if note.On && p.inRange(note.Pitch) {
+			silence := p.silenceTicks()
+			p.Lock()
+			if p.hasImprovised || p.CurrentBeat()-p.lastNote > silence {
+				p.phraseStart = tickOfNote
 			}
-			p.Improvisation()
+			p.LastHostPress = p.CurrentBeat()
+			p.Unlock()
+			p.onset(arrived)
+			p.press(note)
+			p.Lock()
+			p.hasImprovised = false
+			p.Unlock()
+		}
+		if note.On && p.UseHostVelocity {
+			p.Lock()
+			p.lastVelocity = note.Velocity
+			p.Unlock()
+		}
+		// the arpeggio is not recorded, only the chord that is held
+		p.hold(note)
+		p.broadcast(true, note)
+		if note.On {
+			delete(p.sustainedPitches, sustainedKey{note.Device, note.Channel, note.Pitch})
+		} else if p.sustainDown[note.Device] {
+			// the note keeps sounding until the pedal is released
+			p.sustainedPitches[sustainedKey{note.Device, note.Channel, note.Pitch}] = true
+			continue
+		}
+		if p.Thru && !note.On {
+			p.thru(note)
+		}
+		// the keys that are filtered out are still played through
+		if p.FilterHistory && !p.inRange(note.Pitch) {
+			continue
+		}
+		if note.On {
+			logger.Tracef("Adding %s (velocity %d) at %d", music.NoteName(note.Pitch), note.Velocity, note.Beat)
 		} else {
-			if !note.On && note.Pitch > p.HighPassFilter {
-				p.lastNote = p.Tick
-				p.KeysCurrentlyPressed--
-			}
-			if note.On && note.Pitch > p.HighPassFilter {
-				p.LastHostPress = p.Tick
-				p.KeysCurrentlyPressed++
-			}
-			if note.On && p.UseHostVelocity {
-				p.lastVelocity = note.Velocity
-			}
-			logger.Infof("Adding %+v", note)
-			go p.MusicHistory.AddNote(note)
+			logger.Tracef("Adding %s off at %d", music.NoteName(note.Pitch), note.Beat)
+		}
+		p.echo(note)
+		go p.MusicHistory.AddNote(note)
+	}
+}
+
+// silenceTicks returns how long a silence is, in ticks, from the
+// SilenceThreshold in bars of the current time signature and tempo
+// if it is set, or else from BeatsOfSilence
+func (p *Player) silenceTicks() int {
+	p.RLock()
+	defer p.RUnlock()
+	if p.SilenceThreshold > 0 {
+		return int(p.SilenceThreshold*float64(p.TimeSignature.barTicks(p.TicksPerBeat)) + 0.5)
+	}
+	return p.BeatsOfSilence * p.TicksPerBeat
+}
+
+// HumanInRange returns whether a note was played on the keyboard,
+// and passes the HighPassFilter and LowPassFilter
+func (p *Player) HumanInRange(note music.Note) bool {
+	return note.Source == music.Human && p.inRange(note.Pitch)
+}
+
+// inRange returns whether a pitch passes the HighPassFilter and LowPassFilter
+func (p *Player) inRange(pitch int) bool {
+	return pitch > p.HighPassFilter && (p.LowPassFilter <= 0 || pitch < p.LowPassFilter)
+}
+
+// press keeps track of the keys that are down on each device, so
+// that a note-on or note-off that comes twice is only counted once
+func (p *Player) press(note music.Note) {
+	p.Lock()
+	defer p.Unlock()
+	if p.pressed == nil {
+		p.pressed = make(map[int]map[int]bool)
+	}
+	if p.pressed[note.Device] == nil {
+		p.pressed[note.Device] = make(map[int]bool)
+	}
+	if note.On {
+		p.pressed[note.Device][note.Pitch] = true
+	} else {
+		delete(p.pressed[note.Device], note.Pitch)
+	}
+	p.KeysCurrentlyPressed = 0
+	for _, pitches := range p.pressed {
+		p.KeysCurrentlyPressed += len(pitches)
+	}
+}
+
+// KeysPressed returns the number of keys that are down on a device
+func (p *Player) KeysPressed(device int) int {
+	p.RLock()
+	defer p.RUnlock()
+	return len(p.pressed[device])
+}
+
+// thru plays notes from the keyboard straight away, without
+// waiting for the next tick of the metronome
+func (p *Player) thru(notes ...music.Note) {
+	bpm, _ := p.tempo()
+	p.Piano.PlayNotes(notes, bpm)
+}
+
+// controlChange handles the control changes other than the sustain pedal
+func (p *Player) controlChange(controller, value int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.controlChange",
+	})
+	if p.BlendController > 0 && controller == p.BlendController {
+		p.Lock()
+		p.BlendRatio = float64(value) / 127
+		p.Unlock()
+		logger.Debugf("Blend ratio: %2.2f", float64(value)/127)
+		return
+	}
+	if p.controlEcho(controller, value) {
+		p.RLock()
+		logger.Debugf("Echo every %2.2f beats, %d times", p.Echo.Delay, p.Echo.Feedback)
+		p.RUnlock()
+		return
+	}
+	switch controller {
+	case piano.ModWheel:
+		// the middle of the wheel is a temperature of 1
+		p.Lock()
+		p.Temperature = 2 * float64(value) / 127
+		p.Unlock()
+		logger.Debugf("Temperature: %2.2f", 2*float64(value)/127)
+	}
+}
+
+// sustainedKey is a key that was released while the sustain pedal was
+// down, on its device and channel
+type sustainedKey struct {
+	device, channel, pitch int
+}
+
+// sustain handles the sustain pedal of a device. Releasing the pedal
+// turns off all the notes of that device that were held by it.
+func (p *Player) sustain(down bool, device int, beat int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.sustain",
+		"device":   device,
+	})
+	p.sustainDown[device] = down
+	if down {
+		logger.Debug("Sustain pedal down")
+		return
+	}
+	logger.Debug("Sustain pedal up")
+	for key := range p.sustainedPitches {
+		if key.device != device {
+			continue
+		}
+		delete(p.sustainedPitches, key)
+		note := music.Note{
+			On:        false,
+			Pitch:     key.pitch,
+			Velocity:  0,
+			Beat:      beat,
+			Sustained: true,
+			Channel:   key.channel,
+			Device:    key.device,
+		}
+		if p.Thru {
+			p.thru(note)
+		}
+		if p.FilterHistory && !p.inRange(note.Pitch) {
+			continue
 		}
+		go p.MusicHistory.AddNote(note)
 	}
 }
@@ -0,0 +1,439 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestPress(t *testing.T) {
+	p := &Player{}
+	for _, note := range []music.Note{
+		{On: true, Pitch: 60},
+		// the same note-on again, such as from a bouncing key
+		{On: true, Pitch: 60},
+		{On: false, Pitch: 60},
+		// a note-off that was never turned on
+		{On: false, Pitch: 62},
+	} {
+		p.press(note)
+	}
+	if p.KeysCurrentlyPressed != 0 {
+		t.Errorf("got %d keys pressed, expected 0", p.KeysCurrentlyPressed)
+	}
+	p.press(music.Note{On: true, Pitch: 64})
+	p.press(music.Note{On: true, Pitch: 67})
+	if p.KeysCurrentlyPressed != 2 {
+		t.Errorf("got %d keys pressed, expected 2", p.KeysCurrentlyPressed)
+	}
+}
+
+func TestInRange(t *testing.T) {
+	p := &Player{HighPassFilter: 40}
+	if p.inRange(40) || !p.inRange(41) || !p.inRange(127) {
+		t.Errorf("only the notes above the high-pass filter should pass")
+	}
+	p.LowPassFilter = 72
+	if !p.inRange(71) || p.inRange(72) {
+		t.Errorf("only the notes below the low-pass filter should pass")
+	}
+	p.LowPassFilter = 41
+	for pitch := 0; pitch < 128; pitch++ {
+		if p.inRange(pitch) {
+			t.Errorf("%d should not pass when the filters meet", pitch)
+		}
+	}
+}
+
+func TestMockPiano(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	go p.Listen()
+	waitFor := func(n int) {
+		for i := 0; i < 100 && len(p.MusicHistory.GetAll()) < n; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+	waitFor(1)
+	p.setTick(10)
+	mock.Send(
+		portmidi.Event{Status: piano.NoteOff, Data1: 70},
+		// the top C is a control key, so it is not recorded
+		portmidi.Event{Status: piano.NoteOff, Data1: 108},
+	)
+	waitFor(2)
+	if notes := p.MusicHistory.Consolidate(); len(notes) != 1 || notes[0].Pitch != 70 || notes[0].Duration != 10 {
+		t.Fatalf("expected 70 to be recorded, got %+v", notes)
+	}
+
+	// long after the keys were let go, so the AI is not muted
+	p.setTick(200)
+	p.MusicFuture.AddNote(music.Note{On: true, Pitch: 72, Velocity: 90, Beat: 201, Duration: 2})
+	for beat := 201; beat < 205; beat++ {
+		p.Emit(beat)
+	}
+	played := mock.Played()
+	if len(played) != 2 || !played[0].On || played[0].Pitch != 72 || played[1].On || played[1].Beat != 203 {
+		t.Errorf("expected 72 to be played for 2 ticks, got %+v", played)
+	}
+}
+
+func TestPause(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setTick(100)
+	p.doAction("pause")
+	if !p.Paused() || mock.Panics() != 1 {
+		t.Errorf("expected a pause that turns off the notes")
+	}
+	p.Pause()
+	if mock.Panics() != 1 {
+		t.Errorf("pausing again should do nothing")
+	}
+	p.doAction("pause")
+	if p.Paused() || p.CurrentBeat() != 100 {
+		t.Errorf("expected to resume on tick 100, got %d", p.CurrentBeat())
+	}
+}
+
+func TestInstruments(t *testing.T) {
+	mock := piano.NewMock()
+	p := &Player{Piano: mock, AIChannel: 1}
+	if err := p.SetInstrument(1, 127); err != nil {
+		t.Fatal(err)
+	}
+	p.doAction("next-instrument")
+	if program, ok := mock.Instrument(1); !ok || program != 0 {
+		t.Errorf("expected the AI channel to go around to program 0, got %d", program)
+	}
+	p.doAction("next-instrument")
+	if program, _ := mock.Instrument(1); program != 1 {
+		t.Errorf("expected program 1, got %d", program)
+	}
+}
+
+func TestPitchBend(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.Thru = true
+	p.setTick(5)
+	go p.Listen()
+	// halfway up, which is not set back to the center
+	mock.Send(portmidi.Event{Status: piano.PitchBend | 2, Data1: 0, Data2: 0x60})
+	for i := 0; i < 100 && len(p.MusicHistory.AllBends()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if bends := p.MusicHistory.AllBends(); len(bends) != 1 || bends[0] != (music.Bend{Beat: 5, Value: 4096, Channel: 2}) {
+		t.Fatalf("expected the bend to be recorded, got %+v", bends)
+	}
+	if bends := mock.Bends(); len(bends) != 1 || bends[0].Value != 4096 {
+		t.Errorf("expected the bend to be played through, got %+v", bends)
+	}
+
+	// long after the host played, so the playback is not muted
+	p.LastHostPress = -1000
+	p.CountIn = 0
+	p.Playback()
+	for beat := 0; beat < 10; beat++ {
+		p.setTick(beat)
+		p.Emit(beat)
+	}
+	bends := mock.Bends()
+	if len(bends) != 3 || bends[1] != (music.Bend{Value: 4096, Channel: 2}) || bends[2] != (music.Bend{Value: 0, Channel: 2}) {
+		t.Errorf("expected the bend to be played back and centered, got %+v", bends)
+	}
+}
+
+func TestSustain(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.Thru = true
+	go p.Listen()
+	mock.Send(portmidi.Event{Status: piano.NoteOn | 2, Data1: 70, Data2: 80})
+	mock.Send(portmidi.Event{Status: piano.ControlChange | 2, Data1: piano.SustainPedal, Data2: 127})
+	mock.Send(portmidi.Event{Status: piano.NoteOff | 2, Data1: 70})
+	mock.Send(portmidi.Event{Status: piano.ControlChange | 2, Data1: piano.SustainPedal, Data2: 0})
+	time.Sleep(50 * time.Millisecond)
+	played := mock.Played()
+	if len(played) != 2 || played[1].On || played[1].Pitch != 70 || played[1].Channel != 2 {
+		t.Errorf("expected the pedal to turn off 70 on channel 2, got %+v", played)
+	}
+}
+
+func TestThruFilter(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.Thru = true
+	p.FilterHistory = true
+	go p.Listen()
+	// below the high pass filter, so kept out of the history
+	mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 40, Data2: 80})
+	mock.Send(portmidi.Event{Status: piano.NoteOff, Data1: 40})
+	time.Sleep(50 * time.Millisecond)
+	played := mock.Played()
+	if len(played) != 2 || !played[0].On || played[1].On || played[1].Pitch != 40 {
+		t.Errorf("expected 40 to be played through and turned off, got %+v", played)
+	}
+	if notes := p.MusicHistory.GetAll(); len(notes) != 0 {
+		t.Errorf("expected 40 to be kept out of the history, got %+v", notes)
+	}
+}
+
+func TestPlaybackTranspose(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.MusicHistory = music.New()
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 2})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 125, Velocity: 80, Beat: 2})
+	p.MusicHistory.AddNote(music.Note{Pitch: 60, Beat: 4})
+	p.MusicHistory.AddNote(music.Note{Pitch: 125, Beat: 4})
+	p.LastHostPress = -1000
+	p.PlaybackTranspose = 7
+	p.Playback()
+	for beat := 0; beat < 10; beat++ {
+		p.setTick(beat)
+		p.Emit(beat)
+	}
+	played := mock.Played()
+	if len(played) != 2 || played[0].Pitch != 67 || played[1].Pitch != 67 {
+		t.Errorf("expected only 60 to be played a fifth up, got %+v", played)
+	}
+	for _, note := range p.MusicHistory.GetAll() {
+		if note.Pitch != 60 && note.Pitch != 125 {
+			t.Errorf("expected the history to stay the same, got %+v", note)
+		}
+	}
+}
+
+// learner is a Generator that keeps what it learned
+type learner struct {
+	learned []music.Note
+}
+
+func (l *learner) Learn(notes []music.Note) error {
+	l.learned = notes
+	return nil
+}
+
+func (l *learner) Lick(startBeat int) (*music.Music, error) {
+	return music.New(), nil
+}
+
+func TestTeachFilter(t *testing.T) {
+	p := &Player{HighPassFilter: 40, MusicHistory: music.New()}
+	l := &learner{}
+	p.SetGenerator(l)
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 30, Velocity: 80})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 64, Velocity: 80, Source: music.AI})
+	if err := p.Teach(); err != nil {
+		t.Fatal(err)
+	}
+	if notes := l.learned; len(notes) != 1 || notes[0].Pitch != 60 {
+		t.Errorf("expected to learn only the human note in range, got %+v", notes)
+	}
+	p.TeachFilter = func(note music.Note) bool { return true }
+	p.Teach()
+	if notes := l.learned; len(notes) != 3 {
+		t.Errorf("expected to learn everything, got %+v", notes)
+	}
+
+	l.learned = nil
+	p.MinNotesToTeach = 4
+	if err := p.Teach(); err == nil || l.learned != nil {
+		t.Errorf("expected not to teach with too few notes, got %v", err)
+	}
+}
+
+// deltaLearner is a learner that also keeps the new notes it learned
+type deltaLearner struct {
+	learner
+	newNotes []music.Note
+}
+
+func (l *deltaLearner) LearnIncremental(newNotes []music.Note) error {
+	l.newNotes = newNotes
+	return nil
+}
+
+func TestTeachIncremental(t *testing.T) {
+	p := &Player{MusicHistory: music.New()}
+	l := &deltaLearner{}
+	p.SetGenerator(l)
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 1})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 62, Velocity: 80, Beat: 5})
+	p.Teach()
+	if l.learned == nil || l.newNotes != nil {
+		t.Fatal("expected to learn all of the history first")
+	}
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 64, Velocity: 80, Beat: 9})
+	p.Teach()
+	if len(l.newNotes) != 1 || l.newNotes[0].Beat != 9 {
+		t.Errorf("expected to learn only the notes added since, got %+v", l.newNotes)
+	}
+	// one more note of the chord on the last beat taught
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 67, Velocity: 80, Beat: 9})
+	p.Teach()
+	if len(l.newNotes) != 1 || l.newNotes[0].Pitch != 67 {
+		t.Errorf("expected to learn the note added on the last beat, got %+v", l.newNotes)
+	}
+
+	// a note that comes in late, before the last beat taught
+	l.learned = nil
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 65, Velocity: 80, Beat: 7})
+	p.Teach()
+	if len(l.learned) != 5 {
+		t.Errorf("expected to learn all of the history again with the late note, got %+v", l.learned)
+	}
+
+	l.learned = nil
+	p.Transpose(1)
+	p.Teach()
+	if l.learned == nil {
+		t.Error("expected to learn all of the history again after it changed")
+	}
+}
+
+// drumLearner is a learner that also learns the drums
+type drumLearner struct {
+	learner
+	drums *music.Music
+}
+
+func (l *drumLearner) LearnDrums(mus *music.Music) error {
+	l.drums = mus
+	return nil
+}
+
+func (l *drumLearner) GenerateDrums(bars int, startBeat int) (*music.Music, error) {
+	return music.New(), nil
+}
+
+func TestTeachDrums(t *testing.T) {
+	p := &Player{MusicHistory: music.New()}
+	l := &drumLearner{}
+	p.SetGenerator(l)
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 36, Velocity: 80, Channel: 9})
+	p.Teach()
+	if l.drums == nil || len(l.drums.GetAll()) != 1 {
+		t.Errorf("expected the generator to learn the drums, got %+v", l.drums)
+	}
+}
+
+func TestCurrentBeat(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 500, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MusicHistory = music.New()
+	// it tries to improvise in every silence between the notes
+	p.BeatsOfSilence = 0
+	// the metronome runs until the test is over
+	go p.Start()
+	for i := 0; i < 20; i++ {
+		time.Sleep(5 * time.Millisecond)
+		mock.Send(portmidi.Event{Status: piano.NoteOn, Data1: 70, Data2: 80})
+		mock.Send(portmidi.Event{Status: piano.NoteOff, Data1: 70})
+	}
+	time.Sleep(20 * time.Millisecond)
+	beat := p.CurrentBeat()
+	if beat == 0 {
+		t.Fatal("expected the metronome to be running")
+	}
+	notes := p.MusicHistory.GetAll()
+	if len(notes) == 0 {
+		t.Fatal("expected the notes to be recorded")
+	}
+	for _, note := range notes {
+		if note.Beat > beat {
+			t.Errorf("expected notes on beats before %d, got one on %d", beat, note.Beat)
+		}
+	}
+}
+
+// phraseLicker is a Generator whose licks are a phrase of two notes
+type phraseLicker struct {
+	learner
+}
+
+func (phraseLicker) Lick(startBeat int) (*music.Music, error) {
+	lick := music.New()
+	lick.AddNote(music.Note{On: true, Pitch: 72, Velocity: 80, Beat: startBeat})
+	lick.AddNote(music.Note{On: false, Pitch: 72, Beat: startBeat + 20})
+	lick.AddNote(music.Note{On: true, Pitch: 74, Velocity: 80, Beat: startBeat + 20})
+	lick.AddNote(music.Note{On: false, Pitch: 74, Beat: startBeat + 50})
+	return lick, nil
+}
+
+func TestImprovisationEnd(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MusicHistory = music.New()
+	p.SetGenerator(&phraseLicker{})
+	p.setTick(100)
+	if end := p.Improvisation(); end != 150 {
+		t.Errorf("expected the improvisation to end on 150, got %d", end)
+	}
+	// the future has the notes with how long they are held
+	if notes := p.MusicFuture.GetRange(100, 200); len(notes) != 2 || notes[1].Beat+notes[1].Duration != 150 {
+		t.Errorf("expected the lick to be played until 150, got %+v", notes)
+	}
+	// there is one already
+	if end := p.Improvisation(); end != 0 {
+		t.Errorf("expected no improvisation while one is playing, got one until %d", end)
+	}
+}
+
+func TestModWheel(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		for value := 0; value <= 127; value++ {
+			p.controlChange(piano.ModWheel, value)
+		}
+		close(done)
+	}()
+	// the AI is configured while the wheel is turned
+	p.configureAI()
+	<-done
+	if p.Temperature != 2 {
+		t.Errorf("expected the top of the wheel to be a temperature of 2, got %2.2f", p.Temperature)
+	}
+}
@@ -0,0 +1,157 @@
+package player
+
+import (
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// pollInterval is how often the MIDI input is read,
+	// the same as the Listen of portmidi
+	pollInterval = 10 * time.Millisecond
+	// minReconnectWait and maxReconnectWait bound the time between
+	// the tries to reopen the MIDI devices, which doubles every try
+	minReconnectWait = 500 * time.Millisecond
+	maxReconnectWait = 30 * time.Second
+)
+
+// inputEvent is an event of the MIDI input, with the device it came
+// from: 0 for the Piano, and from 1 on for the Inputs
+type inputEvent struct {
+	portmidi.Event
+	device int
+}
+
+// input returns the events of the MIDI inputs for Listen, all in one.
+// When reading one fails, such as when the keyboard is unplugged, the
+// keys that were down on it are let go and the device is reopened until
+// it comes back, so the Tick and the MusicHistory carry on as if nothing
+// happened.
+func (p *Player) input() <-chan inputEvent {
+	ch := make(chan portmidi.Event, 1024)
+	events := make(chan inputEvent, 1024)
+	p.Lock()
+	p.inputEvents = ch
+	p.deviceEvents = events
+	inputs := append([]piano.Device{}, p.Inputs...)
+	p.Unlock()
+	go p.read(p.Piano, 0, func(event portmidi.Event) { ch <- event })
+	go func() {
+		// what is sent to inputEvents is from the Piano too
+		for event := range ch {
+			events <- inputEvent{event, 0}
+		}
+	}()
+	for i, device := range inputs {
+		if device != nil {
+			go p.readInput(device, i+1)
+		}
+	}
+	return events
+}
+
+// readInput reads the events of one of the Inputs for Listen
+func (p *Player) readInput(device piano.Device, id int) {
+	p.RLock()
+	events := p.deviceEvents
+	p.RUnlock()
+	p.read(device, id, func(event portmidi.Event) { events <- inputEvent{event, id} })
+}
+
+// read sends the events of a device on, until it is closed or
+// (for the Inputs) removed, and then lets go of the keys down on it
+func (p *Player) read(device piano.Device, id int, send func(portmidi.Event)) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.read",
+		"device":   id,
+	})
+	// the keys that are down, by channel and pitch
+	pressed := make(map[[2]int64]bool)
+	release := func() {
+		for key := range pressed {
+			send(portmidi.Event{Status: piano.NoteOff | key[0], Data1: key[1]})
+		}
+		pressed = make(map[[2]int64]bool)
+	}
+	for {
+		time.Sleep(pollInterval)
+		if id > 0 && p.inputDevice(id) != device {
+			logger.Info("Stopped listening to the MIDI input")
+			release()
+			return
+		}
+		events, err := device.Read()
+		if err == piano.ErrClosed {
+			release()
+			return
+		}
+		if err != nil {
+			logger.Warnf("Lost the MIDI input: %s", err.Error())
+			release()
+			if !p.reconnect(device) {
+				return
+			}
+			continue
+		}
+		for _, event := range events {
+			if piano.IsNote(event) {
+				key := [2]int64{event.Status & 0x0F, event.Data1}
+				if piano.IsNoteOn(event) {
+					pressed[key] = true
+				} else {
+					delete(pressed, key)
+				}
+			}
+			send(event)
+		}
+	}
+}
+
+// reopener is a piano.Device that can be opened again
+type reopener interface {
+	Reopen() error
+}
+
+var _ reopener = (*piano.Piano)(nil)
+
+// reconnect tries to reopen a MIDI device until it works, waiting
+// longer after each try, and then calls OnReconnect if it is the Piano.
+// It returns false if the device was closed in the meantime, or if it
+// can not be reopened.
+func (p *Player) reconnect(input piano.Device) bool {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.reconnect",
+	})
+	device, ok := input.(reopener)
+	if !ok {
+		logger.Error("The MIDI device can not be reopened")
+		return false
+	}
+	wait := minReconnectWait
+	for {
+		time.Sleep(wait)
+		err := device.Reopen()
+		if err == nil {
+			break
+		}
+		if err == piano.ErrClosed {
+			return false
+		}
+		wait *= 2
+		if wait > maxReconnectWait {
+			wait = maxReconnectWait
+		}
+		logger.Warnf("Could not reconnect (%s), trying again in %s", err.Error(), wait)
+	}
+	logger.Info("Reconnected to the MIDI devices")
+	p.RLock()
+	onReconnect := p.OnReconnect
+	p.RUnlock()
+	if onReconnect != nil && input == p.Piano {
+		onReconnect()
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package player
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+// replayEvent is an event of ReplayFrom, on a beat of the music
+type replayEvent struct {
+	beat  int
+	event portmidi.Event
+}
+
+// ReplayFrom plays the notes and pitch bends of some music into
+// Listen, as if they were played on the keyboard, so they are recorded
+// and control keys do their actions. The notes are sent in real time at the BPM and
+// ticks per beat of the music, starting with the first note right
+// away. It starts once the player is listening, and returns when
+// the last note has been sent.
+func (p *Player) ReplayFrom(mus *music.Music) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.ReplayFrom",
+	})
+	mus.RLock()
+	bpm, ticksPerBeat := mus.BPM, mus.TicksPerBeat
+	mus.RUnlock()
+	if bpm <= 0 {
+		bpm = music.DefaultBPM
+	}
+	if ticksPerBeat <= 0 {
+		ticksPerBeat = music.DefaultTicksPerBeat
+	}
+	tickTime := time.Minute / time.Duration(bpm*ticksPerBeat)
+
+	events := []replayEvent{}
+	for _, note := range mus.Consolidate() {
+		channel := int64(note.Channel & 0x0F)
+		events = append(events, replayEvent{note.Beat, portmidi.Event{
+			Status: piano.NoteOn | channel,
+			Data1:  int64(note.Pitch),
+			Data2:  int64(note.Velocity),
+		}})
+		events = append(events, replayEvent{note.Beat + note.Duration, portmidi.Event{
+			Status: piano.NoteOff | channel,
+			Data1:  int64(note.Pitch),
+		}})
+	}
+	notes := len(events) / 2
+	for _, bend := range mus.AllBends() {
+		value := int64(bend.Value + music.MaxBend + 1)
+		events = append(events, replayEvent{bend.Beat, portmidi.Event{
+			Status: piano.PitchBend | int64(bend.Channel&0x0F),
+			Data1:  value & 0x7F,
+			Data2:  value >> 7,
+		}})
+	}
+	// note-offs go before note-ons on the same beat
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].beat == events[j].beat {
+			return events[i].event.Status&0xF0 < events[j].event.Status&0xF0
+		}
+		return events[i].beat < events[j].beat
+	})
+	if len(events) == 0 {
+		return
+	}
+
+	var input chan portmidi.Event
+	for {
+		p.RLock()
+		input = p.inputEvents
+		p.RUnlock()
+		if input != nil {
+			break
+		}
+		time.Sleep(pollInterval)
+	}
+	logger.Infof("Replaying %d notes", notes)
+	start := time.Now()
+	for _, e := range events {
+		time.Sleep(time.Until(start.Add(time.Duration(e.beat-events[0].beat) * tickTime)))
+		input <- e.event
+	}
+	logger.Info("Finished replaying")
+}
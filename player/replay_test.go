@@ -0,0 +1,36 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestReplayFrom(t *testing.T) {
+	p := &Player{}
+	p.inputEvents = make(chan portmidi.Event, 16)
+	// a millisecond a tick
+	mus := music.New()
+	mus.BPM, mus.TicksPerBeat = 6000, 10
+	mus.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 100})
+	mus.AddNote(music.Note{On: false, Pitch: 60, Beat: 120})
+	mus.AddNote(music.Note{On: true, Pitch: 62, Velocity: 70, Beat: 120, Channel: 1})
+	mus.AddNote(music.Note{On: false, Pitch: 62, Beat: 150})
+	start := time.Now()
+	p.ReplayFrom(mus)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("the notes should take 50 ms, took %s", elapsed)
+	}
+	close(p.inputEvents)
+	events := []portmidi.Event{}
+	for event := range p.inputEvents {
+		events = append(events, event)
+	}
+	if len(events) != 4 || !piano.IsNoteOn(events[0]) || piano.IsNoteOn(events[1]) || events[1].Status&0x0F != 0 ||
+		!piano.IsNoteOn(events[2]) || events[2].Data2 != 70 || events[3].Status != piano.NoteOff|1 {
+		t.Errorf("got %+v", events)
+	}
+}
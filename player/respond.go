@@ -0,0 +1,58 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// responder is a Generator that can answer a phrase
+type responder interface {
+	Respond(phrase []music.Note) (*music.Music, error)
+}
+
+var _ responder = (*ai2.AI)(nil)
+
+// Respond has the AI answer the phrase that was just played, from
+// phraseStart until now. The answer starts on the next beat that is
+// at least half a beat away, so that there is a short gap before it.
+// A Generator that can not respond improvises instead.
+func (p *Player) Respond() {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.Respond",
+	})
+	r, ok := p.generator().(responder)
+	if !ok {
+		p.Improvisation()
+		return
+	}
+	if !p.startImprovising() {
+		logger.Debug("Improvising is already in progress")
+		return
+	}
+	defer p.stopImprovising()
+	p.Teach()
+
+	p.RLock()
+	phraseStart := p.phraseStart
+	p.RUnlock()
+	phrase := []music.Note{}
+	for _, note := range p.MusicHistory.Consolidate() {
+		if note.Beat >= phraseStart {
+			phrase = append(phrase, note)
+		}
+	}
+	logger.Infof("Responding to %d notes", len(phrase))
+	p.configureAI()
+	response, err := r.Respond(phrase)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	_, ticksPerBeat := p.tempo()
+	start := ((p.CurrentBeat()+ticksPerBeat/2)/ticksPerBeat + 1) * ticksPerBeat
+	newNotes := p.fromAI(response.Consolidate())
+	p.addToFuture(newNotes, start)
+	logger.Infof("Added %d notes from AI", len(newNotes))
+	p.publish(Event{Type: Improvised, Beat: p.CurrentBeat(), Notes: len(newNotes)})
+}
@@ -0,0 +1,150 @@
+package player
+
+import (
+	"sync"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// scheduler decides which MIDI messages to send on each beat. It keeps
+// track of the pitches that are sounding on each channel so that every
+// note-on that is played gets exactly one note-off, either from an
+// explicit note-off or from a pending note-off scheduled from the
+// duration of the note.
+type scheduler struct {
+	// sounding maps each sounding voice to the beat it will be
+	// turned off on, or -1 if it waits for an explicit note-off
+	sounding map[voice]int
+	// offs maps a beat to the voices that are due to be turned off
+	offs map[int][]voice
+	// maxPolyphony is the most pitches that can sound at once (or
+	// unlimited if 0), and started has the sounding voices from the
+	// oldest, so that the oldest can be stopped to make room
+	maxPolyphony int
+	started      []voice
+	// spare are the slices of offs that were played, to be used again
+	spare [][]voice
+	sync.Mutex
+}
+
+// voice is a pitch on a channel, which sounds apart from
+// the same pitch on the other channels
+type voice struct {
+	channel, pitch int
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		sounding: make(map[voice]int),
+		offs:     make(map[int][]voice),
+	}
+}
+
+// next returns the notes to play on a beat. Pending note-offs are
+// played first, then the note-offs and note-ons of the beat. If mute
+// is set then the note-ons are skipped (and so are their note-offs).
+func (s *scheduler) next(beat int, notes []music.Note, mute bool) (toPlay []music.Note) {
+	return s.appendNext(nil, beat, notes, mute)
+}
+
+// appendNext is like next, but appends the notes to play to a
+// slice, so that the same slice can be used for every beat
+func (s *scheduler) appendNext(toPlay []music.Note, beat int, notes []music.Note, mute bool) []music.Note {
+	s.Lock()
+	defer s.Unlock()
+	if voices, ok := s.offs[beat]; ok {
+		for _, v := range voices {
+			// the pitch may have been retriggered since
+			if offBeat, sounding := s.sounding[v]; sounding && offBeat == beat {
+				toPlay = append(toPlay, s.off(v, beat))
+			}
+		}
+		delete(s.offs, beat)
+		s.spare = append(s.spare, voices[:0])
+	}
+	for _, note := range notes {
+		if note.On {
+			continue
+		}
+		v := voice{note.Channel, note.Pitch}
+		if _, sounding := s.sounding[v]; sounding {
+			toPlay = append(toPlay, s.off(v, beat))
+		}
+	}
+	if mute {
+		return toPlay
+	}
+	for _, note := range notes {
+		if !note.On {
+			continue
+		}
+		v := voice{note.Channel, note.Pitch}
+		if _, sounding := s.sounding[v]; sounding {
+			toPlay = append(toPlay, s.off(v, beat))
+		}
+		if s.maxPolyphony > 0 && len(s.started) >= s.maxPolyphony {
+			// steal the voice of the oldest note
+			toPlay = append(toPlay, s.off(s.started[0], beat))
+		}
+		toPlay = append(toPlay, note)
+		s.started = append(s.started, v)
+		if note.Duration > 0 {
+			offBeat := beat + note.Duration
+			s.sounding[v] = offBeat
+			voices, ok := s.offs[offBeat]
+			if !ok && len(s.spare) > 0 {
+				voices = s.spare[len(s.spare)-1]
+				s.spare = s.spare[:len(s.spare)-1]
+			}
+			s.offs[offBeat] = append(voices, v)
+		} else {
+			s.sounding[v] = -1
+		}
+	}
+	return toPlay
+}
+
+// reset forgets all the pending note-offs, returning the
+// note-offs for everything that is still sounding
+func (s *scheduler) reset(beat int) (toPlay []music.Note) {
+	s.Lock()
+	defer s.Unlock()
+	for v := range s.sounding {
+		toPlay = append(toPlay, s.off(v, beat))
+	}
+	s.sounding = make(map[voice]int)
+	s.offs = make(map[int][]voice)
+	s.started = nil
+	return
+}
+
+// limit sets the most pitches that can sound at once, where 0 is unlimited
+func (s *scheduler) limit(maxPolyphony int) {
+	s.Lock()
+	defer s.Unlock()
+	s.maxPolyphony = maxPolyphony
+}
+
+// off stops a sounding voice, returning its note-off
+// on the channel it was played on
+func (s *scheduler) off(v voice, beat int) (note music.Note) {
+	note = offNote(v.pitch, beat)
+	note.Channel = v.channel
+	delete(s.sounding, v)
+	for i, started := range s.started {
+		if started == v {
+			s.started = append(s.started[:i], s.started[i+1:]...)
+			break
+		}
+	}
+	return
+}
+
+func offNote(pitch, beat int) music.Note {
+	return music.Note{
+		On:       false,
+		Pitch:    pitch,
+		Velocity: 0,
+		Beat:     beat,
+	}
+}
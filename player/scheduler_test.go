@@ -0,0 +1,138 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestSchedulerOverlappingNotes(t *testing.T) {
+	s := newScheduler()
+	future := music.New()
+	// 50 overlapping notes, some of which are retriggered
+	// before they finish and some with explicit note-offs
+	for i := 0; i < 50; i++ {
+		future.AddNote(music.Note{On: true, Pitch: 40 + i%30, Velocity: 80, Beat: i * 3, Duration: 40 + i})
+		if i%7 == 0 {
+			future.AddNote(music.Note{On: false, Pitch: 40 + i%30, Beat: i*3 + 10})
+		}
+	}
+
+	ons := make(map[int]int)
+	offs := make(map[int]int)
+	sounding := make(map[int]bool)
+	for beat := 0; beat < 500; beat++ {
+		_, notes := future.Get(beat)
+		for _, note := range s.next(beat, notes, false) {
+			if note.On {
+				if sounding[note.Pitch] {
+					t.Errorf("pitch %d turned on twice at beat %d", note.Pitch, beat)
+				}
+				ons[note.Pitch]++
+				sounding[note.Pitch] = true
+			} else {
+				if !sounding[note.Pitch] {
+					t.Errorf("pitch %d turned off when not sounding at beat %d", note.Pitch, beat)
+				}
+				offs[note.Pitch]++
+				sounding[note.Pitch] = false
+			}
+		}
+	}
+	total := 0
+	for pitch := range ons {
+		total += ons[pitch]
+		if ons[pitch] != offs[pitch] {
+			t.Errorf("pitch %d had %d note-ons and %d note-offs", pitch, ons[pitch], offs[pitch])
+		}
+	}
+	if total != 50 {
+		t.Errorf("played %d notes, expected 50", total)
+	}
+}
+
+func TestSchedulerMute(t *testing.T) {
+	s := newScheduler()
+	played := s.next(0, []music.Note{{On: true, Pitch: 60, Velocity: 80, Duration: 10}}, false)
+	if len(played) != 1 {
+		t.Fatalf("expected the note to play, got %+v", played)
+	}
+	// muted notes are never turned on, but the note-off still needs to play
+	played = s.next(5, []music.Note{{On: true, Pitch: 62, Velocity: 80, Duration: 2}}, true)
+	if len(played) != 0 {
+		t.Errorf("expected nothing to play, got %+v", played)
+	}
+	played = s.next(7, nil, false)
+	if len(played) != 0 {
+		t.Errorf("expected nothing to play, got %+v", played)
+	}
+	played = s.next(10, nil, true)
+	if len(played) != 1 || played[0].On || played[0].Pitch != 60 {
+		t.Errorf("expected pitch 60 to turn off, got %+v", played)
+	}
+}
+
+func TestSchedulerChannels(t *testing.T) {
+	s := newScheduler()
+	s.next(0, []music.Note{{On: true, Pitch: 40, Velocity: 80, Beat: 0, Duration: 5, Channel: 3}}, false)
+	toPlay := s.next(5, nil, false)
+	if len(toPlay) != 1 || toPlay[0].On || toPlay[0].Channel != 3 {
+		t.Errorf("expected a note-off on channel 3, got %+v", toPlay)
+	}
+	s.next(6, []music.Note{{On: true, Pitch: 41, Velocity: 80, Beat: 6, Channel: 2}}, false)
+	toPlay = s.reset(7)
+	if len(toPlay) != 1 || toPlay[0].Channel != 2 {
+		t.Errorf("expected a note-off on channel 2, got %+v", toPlay)
+	}
+
+	// the same pitch on two channels, such as a bass note and a kick
+	toPlay = s.next(10, []music.Note{
+		{On: true, Pitch: 36, Velocity: 80, Beat: 10, Duration: 8, Channel: 1},
+		{On: true, Pitch: 36, Velocity: 80, Beat: 10, Duration: 1, Channel: 9},
+	}, false)
+	if len(toPlay) != 2 || !toPlay[0].On || !toPlay[1].On {
+		t.Errorf("expected both notes to play, got %+v", toPlay)
+	}
+	if toPlay = s.next(11, nil, false); len(toPlay) != 1 || toPlay[0].On || toPlay[0].Channel != 9 {
+		t.Errorf("expected only the kick to turn off, got %+v", toPlay)
+	}
+	if toPlay = s.next(18, []music.Note{{On: false, Pitch: 36, Beat: 18, Channel: 9}}, false); len(toPlay) != 1 || toPlay[0].Channel != 1 {
+		t.Errorf("expected only the bass note to turn off, got %+v", toPlay)
+	}
+}
+
+func TestSchedulerPolyphony(t *testing.T) {
+	s := newScheduler()
+	s.limit(4)
+	sounding := make(map[int]bool)
+	offs := 0
+	for beat := 0; beat < 150; beat++ {
+		notes := []music.Note{}
+		if beat < 60 && beat%10 == 0 {
+			// six overlapping notes
+			notes = append(notes, music.Note{On: true, Pitch: 60 + beat/10, Velocity: 80, Duration: 70})
+		}
+		for _, note := range s.next(beat, notes, false) {
+			if !note.On {
+				if !sounding[note.Pitch] {
+					t.Errorf("pitch %d turned off when not sounding at beat %d", note.Pitch, beat)
+				}
+				offs++
+			}
+			sounding[note.Pitch] = note.On
+		}
+		count := 0
+		for _, on := range sounding {
+			if on {
+				count++
+			}
+		}
+		if count > 4 {
+			t.Errorf("%d notes sounding at beat %d", count, beat)
+		}
+	}
+	// the two oldest are stolen
+	if sounding[60] || offs != 6 {
+		t.Errorf("expected all six notes to be turned off once, got %d: %+v", offs, sounding)
+	}
+}
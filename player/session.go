@@ -0,0 +1,108 @@
+package player
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionPrefix starts the name of every music history file
+const sessionPrefix = "music_history"
+
+// DefaultHistoryFile is the music history file in the working
+// directory, until another one is opened with OpenHistory
+const DefaultHistoryFile = sessionPrefix + ".json"
+
+// OpenHistory loads the music history from a file, which is where it is
+// saved from then on, or starts a new one there if there is no such file.
+// The directory of the file is made when it is first saved.
+func (p *Player) OpenHistory(filename string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.OpenHistory",
+	})
+	history, err := music.Open(filename)
+	if os.IsNotExist(err) {
+		logger.Infof("Starting a new music history in %s", filename)
+		history, err = music.New(), nil
+	} else if err != nil {
+		return
+	} else {
+		logger.Infof("Loaded previous music history from %s", filename)
+	}
+	p.Lock()
+	history.BPM, history.TicksPerBeat = p.BPM, p.TicksPerBeat
+	history.Key, history.Mode = p.Key, p.Mode
+	history.BeatsPerBar, history.BeatUnit = p.TimeSignature.Numerator, p.TimeSignature.Denominator
+	p.MusicHistoryFile = filename
+	p.MusicHistory = history
+	p.learnFrom = 0
+	p.taughtUntil = 0
+	p.Unlock()
+	return
+}
+
+// NewSession saves the music history (if it has changed) and starts a new,
+// empty one in its own file next to MusicHistoryFile, so that the sessions
+// are kept apart. An empty name names the session after the current time.
+func (p *Player) NewSession(name string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.NewSession",
+	})
+	if name == "" {
+		name = time.Now().Format("2006-01-02_15-04-05")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("session name '%s' can not have slashes", name)
+	}
+	oldFile := p.historyFile()
+	newFile := filepath.Join(filepath.Dir(oldFile), sessionPrefix+"_"+name+".json")
+	if _, err = os.Stat(newFile); err == nil {
+		return fmt.Errorf("session '%s' already exists", name)
+	}
+
+	if p.MusicHistory.Unsaved() {
+		err = p.saveMusic(p.MusicHistory, oldFile)
+		if err != nil {
+			return
+		}
+		logger.Infof("Saved %s", oldFile)
+	}
+	if p.AIHistory.Unsaved() {
+		var aiHistoryFile string
+		aiHistoryFile, err = p.SaveAIHistory()
+		if err != nil {
+			return
+		}
+		logger.Infof("Saved %s", aiHistoryFile)
+	}
+	p.Lock()
+	p.MusicHistoryFile = newFile
+	p.learnFrom = 0
+	p.taughtUntil = 0
+	p.Unlock()
+	p.MusicHistory.Reset()
+	p.AIHistory.Reset()
+	logger.Infof("Started session %s", newFile)
+	return nil
+}
+
+// ListSessions returns the music history files of every
+// session that is next to MusicHistoryFile, in order
+func (p *Player) ListSessions() (files []string, err error) {
+	files, err = filepath.Glob(filepath.Join(filepath.Dir(p.historyFile()), sessionPrefix+"*.json"))
+	sort.Strings(files)
+	return
+}
+
+// historyFile returns the file the music history is saved to
+func (p *Player) historyFile() string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.MusicHistoryFile
+}
@@ -0,0 +1,68 @@
+package player
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestNewSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := &Player{MusicHistory: music.New(), AIHistory: music.New(), MusicHistoryFile: filepath.Join(dir, "music_history.json")}
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+
+	if err = p.NewSession("jam"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.MusicHistory.GetAll()) != 0 {
+		t.Errorf("new session should be empty")
+	}
+	if p.MusicHistoryFile != filepath.Join(dir, "music_history_jam.json") {
+		t.Errorf("got %s", p.MusicHistoryFile)
+	}
+	// the old session was saved, and the new one only once it is saved
+	sessions, err := p.ListSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("got %+v, %v", sessions, err)
+	}
+	p.MusicHistory.Save(p.MusicHistoryFile)
+	sessions, _ = p.ListSessions()
+	if len(sessions) != 2 {
+		t.Errorf("got %+v", sessions)
+	}
+	if err = p.NewSession("jam"); err == nil {
+		t.Errorf("should not replace a session")
+	}
+}
+
+func TestOpenHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pianoai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sessions", "history.json")
+	p := &Player{BPM: 90, TicksPerBeat: 16}
+	if err = p.OpenHistory(file); err != nil {
+		t.Fatal(err)
+	}
+	if p.MusicHistoryFile != file || len(p.MusicHistory.GetAll()) != 0 || p.MusicHistory.BPM != 90 {
+		t.Errorf("expected a new history in %s, got %s", file, p.MusicHistoryFile)
+	}
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	// the directory is made to save it in
+	if err = p.MusicHistory.Save(p.historyFile()); err != nil {
+		t.Fatal(err)
+	}
+	other := &Player{}
+	if err = other.OpenHistory(file); err != nil || len(other.MusicHistory.GetAll()) != 1 {
+		t.Errorf("expected the saved history, got %+v (%v)", other.MusicHistory.GetAll(), err)
+	}
+}
@@ -0,0 +1,79 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// ToggleStepMode turns StepMode on or off. The steps start again
+// after the current tick every time StepMode is turned on.
+func (p *Player) ToggleStepMode() {
+	p.Lock()
+	p.StepMode = !p.StepMode
+	on := p.StepMode
+	p.stepping = false
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.ToggleStepMode",
+	}).Infof("Step mode on: %v", on)
+}
+
+// stepMode returns whether the notes are recorded in StepMode
+func (p *Player) stepMode() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.StepMode
+}
+
+// Step moves on to the next step of StepMode, leaving a rest
+// if nothing was played on the step
+func (p *Player) Step() {
+	p.Lock()
+	defer p.Unlock()
+	p.startStep()
+	p.step += p.stepLength()
+}
+
+// stepNote records a note-on that is played in StepMode on the step,
+// lasting all of the step, where the note-offs do not matter
+func (p *Player) stepNote(note music.Note) {
+	if !note.On {
+		return
+	}
+	p.Lock()
+	p.startStep()
+	beat, length := p.step, p.stepLength()
+	p.Unlock()
+	note.Beat, note.Offset = beat, 0
+	p.MusicHistory.AddNote(note)
+	// a tick early, so that the same note can be on the next step
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: note.Pitch, Beat: beat + length - 1, Channel: note.Channel})
+	log.WithFields(log.Fields{
+		"function": "Player.stepNote",
+	}).Debugf("Adding %s on step %d", music.NoteName(note.Pitch), beat)
+}
+
+// startStep puts the first step after the current tick, if the steps
+// have not started yet, and must be called with the lock held
+func (p *Player) startStep() {
+	if p.stepping {
+		return
+	}
+	length := p.stepLength()
+	p.step = (p.CurrentBeat()/length + 1) * length
+	p.stepping = true
+}
+
+// stepLength returns the length of the steps in ticks, which is a
+// sixteenth note if StepLength is not set, and must be called with
+// the lock held
+func (p *Player) stepLength() int {
+	length := p.StepLength
+	if length < 1 {
+		length = p.TicksPerBeat / 4
+	}
+	if length < 2 {
+		length = 2
+	}
+	return length
+}
@@ -0,0 +1,39 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestStepMode(t *testing.T) {
+	p := &Player{TicksPerBeat: 40, MusicHistory: music.New()}
+	p.setTick(25)
+	p.ToggleStepMode()
+	// a chord on the first step, after the current tick
+	p.stepNote(music.Note{On: true, Pitch: 60, Velocity: 80})
+	p.stepNote(music.Note{On: true, Pitch: 64, Velocity: 80})
+	p.stepNote(music.Note{On: false, Pitch: 60})
+	p.Step()
+	// a rest and then the same note again
+	p.Step()
+	p.stepNote(music.Note{On: true, Pitch: 60, Velocity: 70})
+	notes := p.MusicHistory.Consolidate()
+	expected := []music.Note{
+		{On: true, Pitch: 60, Velocity: 80, Beat: 30, Duration: 9},
+		{On: true, Pitch: 64, Velocity: 80, Beat: 30, Duration: 9},
+		{On: true, Pitch: 60, Velocity: 70, Beat: 50, Duration: 9},
+	}
+	if len(notes) != len(expected) {
+		t.Fatalf("got %+v", notes)
+	}
+	for _, e := range expected {
+		found := false
+		for _, note := range notes {
+			found = found || note == e
+		}
+		if !found {
+			t.Errorf("missing %+v in %+v", e, notes)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package player
+
+import (
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+	log "github.com/sirupsen/logrus"
+)
+
+// releaseStuck turns off the keys that have been held for longer than
+// MaxNoteDuration beats, in case their note-offs were lost. The
+// note-offs are sent to Listen as if they came from the keyboard, so
+// that they are recorded and the keys are no longer counted as
+// pressed, and are returned to be played.
+func (p *Player) releaseStuck(tick int) (released []music.Note) {
+	p.Lock()
+	defer p.Unlock()
+	if p.MaxNoteDuration <= 0 || p.inputEvents == nil {
+		return
+	}
+	for pitch, note := range p.held {
+		if tick-note.Beat <= p.MaxNoteDuration*p.TicksPerBeat {
+			continue
+		}
+		event := portmidi.Event{Status: int64(piano.NoteOff | note.Channel&0x0F), Data1: int64(pitch)}
+		if !p.sendInput(note.Device, event) {
+			// Listen is behind, so try again on the next tick
+			continue
+		}
+		delete(p.held, pitch)
+		off := offNote(pitch, tick)
+		off.Channel = note.Channel
+		released = append(released, off)
+		log.WithFields(log.Fields{
+			"function": "Player.releaseStuck",
+		}).Warnf("Turned off pitch %d, held since tick %d", pitch, note.Beat)
+	}
+	return
+}
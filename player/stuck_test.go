@@ -0,0 +1,30 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/rakyll/portmidi"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestReleaseStuck(t *testing.T) {
+	p := &Player{TicksPerBeat: 10, MaxNoteDuration: 4, held: make(map[int]music.Note)}
+	p.inputEvents = make(chan portmidi.Event, 1)
+	p.hold(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 0, Channel: 2})
+	p.hold(music.Note{On: true, Pitch: 64, Velocity: 80, Beat: 30})
+	if released := p.releaseStuck(40); len(released) != 0 {
+		t.Errorf("nothing is stuck yet, got %+v", released)
+	}
+	released := p.releaseStuck(41)
+	if len(released) != 1 || released[0].On || released[0].Pitch != 60 || released[0].Channel != 2 {
+		t.Fatalf("expected 60 to be turned off, got %+v", released)
+	}
+	event := <-p.inputEvents
+	if piano.IsNoteOn(event) || event.Data1 != 60 || event.Status&0x0F != 2 {
+		t.Errorf("expected a note-off for Listen, got %+v", event)
+	}
+	if _, ok := p.held[60]; ok || len(p.releaseStuck(42)) != 0 {
+		t.Errorf("60 should only be turned off once")
+	}
+}
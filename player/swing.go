@@ -0,0 +1,42 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/music"
+)
+
+// swingBuffer holds the notes that swing has delayed, by the tick
+// they are played on
+type swingBuffer map[int][]music.Note
+
+// swingDelay returns how many ticks late a note on a tick is played
+// with swing (see music.SwingTick)
+func swingDelay(tick, subdivision int, swing float64) int {
+	return music.SwingTick(tick, subdivision, swing) - tick
+}
+
+// swing delays the notes of a tick by swingDelay, returning the ones
+// to play on this tick, which includes those delayed to it before
+func (b swingBuffer) swing(tick int, notes []music.Note, subdivision int, swing float64) (now []music.Note) {
+	now = b[tick]
+	delete(b, tick)
+	delay := swingDelay(tick, subdivision, swing)
+	if delay == 0 {
+		return append(now, notes...)
+	}
+	for _, note := range notes {
+		note.Beat += delay
+		b[tick+delay] = append(b[tick+delay], note)
+	}
+	return
+}
+
+// swingSubdivision returns the number of ticks of the subdivision
+// that swings, which is an eighth note unless SwingSubdivision is 16
+func (p *Player) swingSubdivision() (ticks int, swing float64) {
+	p.RLock()
+	defer p.RUnlock()
+	if p.SwingSubdivision == 16 {
+		return p.TicksPerBeat / 4, p.Swing
+	}
+	return p.TicksPerBeat / 2, p.Swing
+}
@@ -0,0 +1,85 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestSwingDelay(t *testing.T) {
+	// eighths of 12 ticks
+	for tick, expected := range map[int]int{0: 0, 6: 2, 12: 4, 18: 2, 24: 0, 36: 4} {
+		if delay := swingDelay(tick, 12, 0.66); delay != expected {
+			t.Errorf("tick %d is %d late, expected %d", tick, delay, expected)
+		}
+	}
+	if swingDelay(12, 12, 0) != 0 {
+		t.Errorf("no swing should be straight")
+	}
+}
+
+func TestSwingBuffer(t *testing.T) {
+	b := make(swingBuffer)
+	played := make(map[int]int)
+	for tick := 0; tick < 30; tick++ {
+		notes := []music.Note{}
+		if tick%6 == 0 && tick < 24 {
+			notes = append(notes, music.Note{On: true, Pitch: 60 + tick/6, Beat: tick, Duration: 5})
+		}
+		for _, note := range b.swing(tick, notes, 6, 0.66) {
+			played[tick] = note.Pitch
+			if note.Beat != tick {
+				t.Errorf("note of tick %d played on %d", note.Beat, tick)
+			}
+		}
+	}
+	// the off beats of the pairs of sixes are 2 ticks late
+	expected := map[int]int{0: 60, 8: 61, 12: 62, 20: 63}
+	if len(played) != len(expected) {
+		t.Errorf("got %+v", played)
+	}
+	for tick, pitch := range expected {
+		if played[tick] != pitch {
+			t.Errorf("expected %d at %d, got %+v", pitch, tick, played)
+		}
+	}
+}
+
+func TestPlaybackWhileSwinging(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Swing = 0.5
+	p.CountIn = 0
+	for beat := 0; beat < 100; beat += 6 {
+		p.MusicHistory.AddNote(music.Note{On: true, Pitch: 70, Velocity: 80, Beat: beat})
+		p.MusicHistory.AddNote(music.Note{On: false, Pitch: 70, Beat: beat + 3})
+	}
+	done := make(chan bool)
+	go func() {
+		// from another goroutine, like the control keys and the API
+		for i := 0; i < 5; i++ {
+			p.Playback()
+		}
+		close(done)
+	}()
+	for playing := true; playing; {
+		select {
+		case <-done:
+			playing = false
+		default:
+			beat := p.CurrentBeat()
+			p.Emit(beat)
+			p.setTick(beat + 1)
+		}
+	}
+	// the next tick empties what was swung before the playback
+	p.swungFuture[1000] = []music.Note{{On: true, Pitch: 72}}
+	p.Playback()
+	p.Emit(0)
+	if len(p.swungFuture[1000]) != 0 {
+		t.Error("expected the playback to start without the swung notes")
+	}
+}
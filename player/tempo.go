@@ -0,0 +1,210 @@
+package player
+
+import (
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MinimumBPM is the slowest tempo the player will accept
+	MinimumBPM = 10
+	// tapsToAverage is the number of taps used to determine the tempo
+	tapsToAverage = 5
+	// maximumTapInterval is the longest time between the first two taps
+	maximumTapInterval = 60 * time.Second / MinimumBPM
+)
+
+// SetBPM changes the tempo while the player is running, taking
+// effect on the next tick. Without a Resolution the metronome ticks at
+// about ListeningRateHertz regardless of the tempo, so only the number of
+// ticks per beat changes. With a Resolution the ticks per beat stay the
+// same and the metronome ticks faster or slower instead. Either way the
+// Tick counter is left alone. It cancels any TempoRamp, and TempoFollow
+// follows on from the new tempo.
+func (p *Player) SetBPM(bpm int) {
+	p.Lock()
+	p.ramp = nil
+	p.followBPM = 0
+	p.Unlock()
+	p.setBPM(bpm)
+}
+
+func (p *Player) setBPM(bpm int) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.SetBPM",
+	})
+	if bpm < MinimumBPM {
+		bpm = MinimumBPM
+	}
+	p.Lock()
+	p.BPM = bpm
+	p.TicksPerBeat = p.ticksPerBeat()
+	ticksPerBeat := p.TicksPerBeat
+	ticksPerBar := p.TimeSignature.barTicks(ticksPerBeat)
+	p.Unlock()
+
+	// let the metronome know that the tick size changed, which it
+	// reads when it gets to it, so that it never misses the newest
+	select {
+	case p.tickTimeChange <- struct{}{}:
+	default:
+	}
+
+	p.MusicHistory.Lock()
+	p.MusicHistory.BPM = bpm
+	p.MusicHistory.TicksPerBeat = ticksPerBeat
+	p.MusicHistory.Unlock()
+	if p.AI != nil {
+		p.AI.SetTempo(ticksPerBeat, ticksPerBar)
+	}
+	logger.Infof("BPM: %d (%d ticks / beat)", bpm, ticksPerBeat)
+}
+
+// ticksPerBeat returns the Resolution, or else the number of ticks
+// at ListeningRateHertz in a beat at the BPM, and at least 1.
+// It must be called with the lock held.
+func (p *Player) ticksPerBeat() int {
+	if p.Resolution > 0 {
+		return p.Resolution
+	}
+	ticks := 1
+	if p.BPM > 0 {
+		ticks = int(float64(p.ListeningRateHertz) / (float64(p.BPM) / 60))
+	}
+	if ticks < 1 {
+		return 1
+	}
+	return ticks
+}
+
+// SetResolution fixes the number of ticks per beat, so that the
+// metronome ticks at whatever rate gives that many ticks for the
+// current BPM. ListeningRateHertz is left as it is, and a
+// resolution of 0 goes back to ticking at it.
+func (p *Player) SetResolution(ticksPerBeat int) {
+	if ticksPerBeat < 0 {
+		ticksPerBeat = 0
+	}
+	p.Lock()
+	p.Resolution = ticksPerBeat
+	bpm := p.BPM
+	p.Unlock()
+	p.setBPM(bpm)
+}
+
+// tempoRamp is a change of tempo spread over a number of beats, going
+// from one length of the beat (in minutes) to another
+type tempoRamp struct {
+	from, to float64
+	beats    int
+	// beat is the number of beats changed so far, and ticks
+	// is the number of ticks since the last change
+	beat  int
+	ticks int
+}
+
+// TempoRamp changes the tempo gradually to targetBPM, for an
+// accelerando or a ritardando, over the next overBeats beats, after
+// which the tempo holds. The length of the ticks changes evenly from one
+// beat to the next. Another TempoRamp or a SetBPM cancels it.
+func (p *Player) TempoRamp(targetBPM int, overBeats int) {
+	if targetBPM < MinimumBPM {
+		targetBPM = MinimumBPM
+	}
+	if overBeats < 1 {
+		p.SetBPM(targetBPM)
+		return
+	}
+	p.Lock()
+	p.ramp = &tempoRamp{
+		from:  1 / float64(p.BPM),
+		to:    1 / float64(targetBPM),
+		beats: overBeats,
+	}
+	p.Unlock()
+	log.WithFields(log.Fields{
+		"function": "Player.TempoRamp",
+	}).Infof("Changing BPM to %d over %d beats", targetBPM, overBeats)
+}
+
+// rampTempo moves the tempo along the TempoRamp, if there is
+// one, at the end of each beat
+func (p *Player) rampTempo() {
+	p.Lock()
+	r := p.ramp
+	if r == nil {
+		p.Unlock()
+		return
+	}
+	r.ticks++
+	if r.ticks < p.TicksPerBeat {
+		p.Unlock()
+		return
+	}
+	r.ticks = 0
+	r.beat++
+	if r.beat >= r.beats {
+		p.ramp = nil
+	}
+	beatLength := r.from + (r.to-r.from)*float64(r.beat)/float64(r.beats)
+	p.Unlock()
+	p.setBPM(int(math.Floor(1/beatLength + 0.5)))
+}
+
+// tickTime returns the time between ticks of the metronome, which is
+// what makes TicksPerBeat ticks last a beat at the BPM (and so is only
+// about 1 / ListeningRateHertz, as the ticks per beat are rounded down).
+// It must be called with the lock held.
+func (p *Player) tickTime() time.Duration {
+	if p.Resolution > 0 {
+		return time.Minute / time.Duration(p.BPM*p.Resolution)
+	}
+	if p.TicksPerBeat > 0 && p.BPM > 0 {
+		return time.Minute / time.Duration(p.BPM*p.TicksPerBeat)
+	}
+	return time.Second / time.Duration(p.ListeningRateHertz)
+}
+
+// tempo returns the current BPM and ticks per beat
+func (p *Player) tempo() (bpm int, ticksPerBeat int) {
+	p.RLock()
+	defer p.RUnlock()
+	return p.BPM, p.TicksPerBeat
+}
+
+// TapTempo registers a tap of the tempo key. Once at least three taps
+// have been made, the tempo is set from the average of the last few
+// intervals. A tap that comes more than twice the running average
+// after the previous one is treated as the start of a new set of taps.
+func (p *Player) TapTempo() {
+	p.tapTempo(time.Now())
+}
+
+func (p *Player) tapTempo(now time.Time) {
+	p.Lock()
+	if len(p.taps) > 1 {
+		average := p.taps[len(p.taps)-1].Sub(p.taps[0]) / time.Duration(len(p.taps)-1)
+		if now.Sub(p.taps[len(p.taps)-1]) > 2*average {
+			p.taps = p.taps[:0]
+		}
+	} else if len(p.taps) == 1 && now.Sub(p.taps[0]) > maximumTapInterval {
+		p.taps = p.taps[:0]
+	}
+	p.taps = append(p.taps, now)
+	if len(p.taps) > tapsToAverage {
+		p.taps = p.taps[len(p.taps)-tapsToAverage:]
+	}
+	taps := len(p.taps)
+	average := time.Duration(0)
+	if taps > 1 {
+		average = p.taps[taps-1].Sub(p.taps[0]) / time.Duration(taps-1)
+	}
+	p.Unlock()
+
+	if taps < 3 || average <= 0 {
+		return
+	}
+	p.SetBPM(int(time.Minute / average))
+}
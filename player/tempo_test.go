@@ -0,0 +1,154 @@
+package player
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/ai2"
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestTempoRamp(t *testing.T) {
+	p := &Player{BPM: 120, Resolution: 10, TicksPerBeat: 10, MusicHistory: music.New()}
+	// a ritardando to half the tempo over 4 beats
+	p.TempoRamp(60, 4)
+	bpms := []int{}
+	for tick := 1; tick <= 60; tick++ {
+		p.rampTempo()
+		if tick%10 == 0 {
+			bpms = append(bpms, p.BPM)
+		}
+	}
+	// the beats get longer by an eighth of a second each
+	expected := []int{96, 80, 69, 60, 60, 60}
+	for i, bpm := range expected {
+		if bpms[i] != bpm {
+			t.Fatalf("expected the tempos %v, got %v", expected, bpms)
+		}
+	}
+	if p.TicksPerBeat != 10 || p.MusicHistory.BPM != 60 {
+		t.Errorf("the tempo should be set, got %d ticks / beat and %d BPM", p.TicksPerBeat, p.MusicHistory.BPM)
+	}
+
+	p.TempoRamp(120, 2)
+	for tick := 1; tick <= 10; tick++ {
+		p.rampTempo()
+	}
+	p.SetBPM(100)
+	for tick := 1; tick <= 20; tick++ {
+		p.rampTempo()
+	}
+	if p.BPM != 100 {
+		t.Errorf("SetBPM should cancel the ramp, got %d BPM", p.BPM)
+	}
+}
+
+func TestSetResolution(t *testing.T) {
+	p := &Player{BPM: 30, ListeningRateHertz: 40, MusicHistory: music.New(), tickTimeChange: make(chan struct{}, 1)}
+	p.SetResolution(1)
+	if p.TicksPerBeat != 1 || p.ListeningRateHertz != 40 {
+		t.Errorf("expected 1 tick / beat and the rate left alone, got %d ticks / beat and %d Hz", p.TicksPerBeat, p.ListeningRateHertz)
+	}
+	p.SetResolution(0)
+	if p.TicksPerBeat != 80 {
+		t.Errorf("expected to tick at 40 Hz again, got %d ticks / beat", p.TicksPerBeat)
+	}
+	// too slow a rate still has a tick in every beat
+	p.ListeningRateHertz = 0
+	p.SetBPM(60)
+	if p.TicksPerBeat != 1 {
+		t.Errorf("expected at least 1 tick / beat, got %d", p.TicksPerBeat)
+	}
+	// the metronome is told once, and reads the newest tick size
+	if len(p.tickTimeChange) != 1 {
+		t.Errorf("expected the metronome to be told of the change")
+	}
+}
+
+func TestSetBPMWhileImprovising(t *testing.T) {
+	p, err := NewWithPiano(piano.NewMock(), 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &ai2.Model{TicksPerBeat: p.TicksPerBeat}
+	for i := 0; i < 2*p.AI.WindowSizeMax; i++ {
+		model.Chords = append(model.Chords, ai2.Chord{Pitches: []int{70 + i%12}, Velocity: 80, Duration: 10, Lag: 10})
+		model.ChordStrings = append(model.ChordStrings, strconv.Itoa(70+i%12))
+	}
+	if err = p.AI.UseModel(model); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		for bpm := 100; bpm < 140; bpm++ {
+			p.SetBPM(bpm)
+			p.SetTimeSignature(3+bpm%2, 4)
+		}
+		close(done)
+	}()
+	history := music.New()
+	for beat := 1; beat < 200; beat += 5 {
+		history.AddNote(music.Note{On: true, Pitch: 70 + beat%12, Velocity: 80, Beat: beat})
+		history.AddNote(music.Note{Pitch: 70 + beat%12, Beat: beat + 3})
+	}
+	for improvising := true; improvising; {
+		select {
+		case <-done:
+			improvising = false
+		default:
+			p.AI.Lick(0)
+			p.AI.LearnIncremental(history.GetAll())
+		}
+	}
+	if ticksPerBeat := p.TicksPerBeat; p.AI.TicksBerBeat != ticksPerBeat || p.AI.TicksPerBar != 4*ticksPerBeat {
+		t.Errorf("expected the AI to have the last tempo, got %d ticks a beat and %d a bar", p.AI.TicksBerBeat, p.AI.TicksPerBar)
+	}
+}
+
+func TestSilenceThreshold(t *testing.T) {
+	p := &Player{BPM: 60, ListeningRateHertz: 100, BeatsOfSilence: 2, SilenceThreshold: 1, MusicHistory: music.New()}
+	p.SetTimeSignature(4, 4)
+	p.SetBPM(60)
+	if ticks := p.silenceTicks(); ticks != 400 {
+		t.Errorf("expected a bar of 4 beats of 100 ticks, got %d", ticks)
+	}
+	// the bar is as long as ever in time, but has fewer ticks
+	p.SetBPM(120)
+	if ticks := p.silenceTicks(); ticks != 200 {
+		t.Errorf("expected a bar at twice the tempo to be 200 ticks, got %d", ticks)
+	}
+	p.SetTimeSignature(3, 4)
+	if ticks := p.silenceTicks(); ticks != 150 {
+		t.Errorf("expected a bar of 3/4 to be 150 ticks, got %d", ticks)
+	}
+	p.SilenceThreshold = 0
+	if ticks := p.silenceTicks(); ticks != 100 {
+		t.Errorf("expected 2 beats of silence to be 100 ticks, got %d", ticks)
+	}
+}
+
+func TestTapTempo(t *testing.T) {
+	ms := time.Millisecond
+	for _, test := range []struct {
+		name string
+		taps []time.Duration
+		bpm  int
+	}{
+		{"too few taps", []time.Duration{0, 500 * ms}, 100},
+		{"averaged", []time.Duration{0, 490 * ms, 1010 * ms, 1500 * ms}, 120},
+		{"too long before the second tap", []time.Duration{0, 7 * time.Second, 7500 * ms}, 100},
+		{"too long after the others", []time.Duration{0, 500 * ms, 1000 * ms, 5000 * ms, 5400 * ms, 5800 * ms}, 150},
+		{"only the last few", []time.Duration{0, 600 * ms, 1200 * ms, 1700 * ms, 2200 * ms, 2700 * ms, 3200 * ms, 3700 * ms}, 120},
+	} {
+		p := &Player{BPM: 100, ListeningRateHertz: 100, MusicHistory: music.New()}
+		start := time.Now()
+		for _, tap := range test.taps {
+			p.tapTempo(start.Add(tap))
+		}
+		if p.BPM != test.bpm {
+			t.Errorf("%s: expected %d BPM, got %d", test.name, test.bpm, p.BPM)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package player
+
+import "time"
+
+// maxLateness is how far behind the metronome can fall (when the
+// computer is busy or asleep) before it stops catching up on the
+// ticks it missed and goes on from where it is
+const maxLateness = time.Second
+
+// tickSchedule times the ticks of the metronome from when it started,
+// the nth tick coming n tick sizes after the start, so that the rounding
+// of the tick size and the lateness of the timer do not add up over time
+type tickSchedule struct {
+	start    time.Time
+	tickTime time.Duration
+	ticks    int64
+}
+
+func newTickSchedule(start time.Time, tickTime time.Duration) *tickSchedule {
+	return &tickSchedule{start: start, tickTime: tickTime}
+}
+
+// current returns the time of the tick that was scheduled last
+func (s *tickSchedule) current() time.Time {
+	return s.start.Add(time.Duration(s.ticks) * s.tickTime)
+}
+
+// next schedules another tick and returns its time
+func (s *tickSchedule) next() time.Time {
+	s.ticks++
+	return s.current()
+}
+
+// change changes the tick size for the ticks after the
+// one that was scheduled last
+func (s *tickSchedule) change(tickTime time.Duration) {
+	s.start, s.ticks, s.tickTime = s.current(), 0, tickTime
+}
+
+// catchUp starts the schedule over from now if the
+// tick that was scheduled last is too far behind
+func (s *tickSchedule) catchUp(now time.Time) {
+	if now.Sub(s.current()) > maxLateness {
+		s.start, s.ticks = now, 0
+	}
+}
@@ -0,0 +1,40 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestTickSchedule(t *testing.T) {
+	// an odd tempo, where the ticks per beat are rounded a lot
+	p := &Player{ListeningRateHertz: 64, MusicHistory: music.New()}
+	p.SetBPM(97)
+	p.RLock()
+	tickTime, ticksPerBeat := p.tickTime(), p.TicksPerBeat
+	p.RUnlock()
+
+	start := time.Now()
+	schedule := newTickSchedule(start, tickTime)
+	var last time.Time
+	for i := 0; i < 10000; i++ {
+		// the timer is always a little late
+		schedule.catchUp(schedule.current().Add(time.Millisecond))
+		last = schedule.next()
+	}
+	expected := time.Duration(10000 * float64(time.Minute) / float64(97*ticksPerBeat))
+	if elapsed := last.Sub(start); elapsed-expected > 10*time.Microsecond || expected-elapsed > 10*time.Microsecond {
+		t.Errorf("expected 10000 ticks to take %s at 97 BPM, took %s", expected, elapsed)
+	}
+
+	schedule.change(tickTime / 2)
+	if next := schedule.next(); next.Sub(last) != tickTime/2 {
+		t.Errorf("expected the tick size to change after the last tick, got %s", next.Sub(last))
+	}
+	now := schedule.current().Add(2 * maxLateness)
+	schedule.catchUp(now)
+	if next := schedule.next(); next.Sub(now) != tickTime/2 {
+		t.Errorf("expected to go on from now when far behind, got %s", next.Sub(now))
+	}
+}
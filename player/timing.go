@@ -0,0 +1,142 @@
+package player
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+)
+
+// lateNote is a note that is played after the tick it is on,
+// at the Offset it was played at
+type lateNote struct {
+	due  time.Time
+	note music.Note
+	bpm  int
+}
+
+// lateNotes are the notes waiting to be played after their tick
+type lateNotes struct {
+	sync.Mutex
+	notes []lateNote
+	timer *time.Timer
+}
+
+// tickOffset returns the tick that is heard at a time, and how far into
+// the tick the time is, from 0 up to 1. With an OutputLatency that can
+// be a tick before the one the metronome is on, as the ticks come early.
+func (p *Player) tickOffset(now time.Time) (tick int, offset float64) {
+	started := atomic.LoadInt64(&p.tickStarted)
+	tick = p.CurrentBeat()
+	p.RLock()
+	tickTime := p.tickTime()
+	p.RUnlock()
+	if started == 0 || tickTime <= 0 {
+		return
+	}
+	offset = float64(now.UnixNano()-started) / float64(tickTime)
+	if offset < 0 {
+		ticks := math.Floor(offset)
+		tick += int(ticks)
+		offset -= ticks
+		if tick < 0 {
+			tick, offset = 0, 0
+		}
+	} else if offset >= 1 {
+		// the next tick is late, so the note is at the end of this one
+		offset = 1 - 1e-3
+	}
+	// no finer than a thousandth of a tick, to keep the files short
+	offset = float64(int(offset*1000)) / 1000
+	return
+}
+
+// playOnTime plays the notes of a tick, the ones with an Offset that
+// much of a tick later, so that they are heard that far into the tick.
+// The notes still waiting from the tick before are played first, so
+// that they stay in order.
+func (p *Player) playOnTime(notes []music.Note, bpm int) {
+	p.late.Lock()
+	defer p.late.Unlock()
+	p.playLate(time.Time{})
+	started := atomic.LoadInt64(&p.tickStarted)
+	p.RLock()
+	tickTime := p.tickTime()
+	p.RUnlock()
+	latency := p.outputLatency()
+	if p.ExternalClock {
+		latency = 0
+	}
+	hasLate := false
+	for _, note := range notes {
+		hasLate = hasLate || note.Offset > 0
+	}
+	if !hasLate || started == 0 || tickTime <= 0 {
+		p.Piano.PlayNotes(notes, bpm)
+		return
+	}
+	onTick := make([]music.Note, 0, len(notes))
+	for _, note := range notes {
+		if note.Offset <= 0 {
+			onTick = append(onTick, note)
+			continue
+		}
+		due := time.Unix(0, started).Add(time.Duration(note.Offset*float64(tickTime)) - latency)
+		p.late.notes = append(p.late.notes, lateNote{due, note, bpm})
+	}
+	if len(onTick) > 0 {
+		p.Piano.PlayNotes(onTick, bpm)
+	}
+	if len(p.late.notes) == 0 {
+		return
+	}
+	sort.SliceStable(p.late.notes, func(i, j int) bool {
+		return p.late.notes[i].due.Before(p.late.notes[j].due)
+	})
+	p.waitForLate()
+}
+
+// playLate plays the waiting notes that are due by a time (all of
+// them for the zero time), and must be called with the late lock held
+func (p *Player) playLate(now time.Time) {
+	if p.late.timer != nil {
+		p.late.timer.Stop()
+		p.late.timer = nil
+	}
+	i := 0
+	for ; i < len(p.late.notes); i++ {
+		late := p.late.notes[i]
+		if !now.IsZero() && late.due.After(now) {
+			break
+		}
+		p.Piano.PlayNotes([]music.Note{late.note}, late.bpm)
+	}
+	p.late.notes = append(p.late.notes[:0], p.late.notes[i:]...)
+}
+
+// waitForLate plays the next of the waiting notes when it is due,
+// and must be called with the late lock held
+func (p *Player) waitForLate() {
+	p.late.timer = time.AfterFunc(time.Until(p.late.notes[0].due), func() {
+		p.late.Lock()
+		defer p.late.Unlock()
+		p.playLate(time.Now())
+		if len(p.late.notes) > 0 {
+			p.waitForLate()
+		}
+	})
+}
+
+// dropLate forgets the notes that are waiting to be played
+func (p *Player) dropLate() {
+	p.late.Lock()
+	defer p.late.Unlock()
+	if p.late.timer != nil {
+		p.late.timer.Stop()
+		p.late.timer = nil
+	}
+	p.late.notes = p.late.notes[:0]
+}
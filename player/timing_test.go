@@ -0,0 +1,47 @@
+package player
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+	"github.com/schollz/pianoai/piano"
+)
+
+func TestPlayOnTime(t *testing.T) {
+	mock := piano.NewMock()
+	p, err := NewWithPiano(mock, 120, 48, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Piano.Close()
+	p.RLock()
+	tickTime := p.tickTime()
+	p.RUnlock()
+
+	now := time.Now()
+	p.setTick(10)
+	atomic.StoreInt64(&p.tickStarted, now.Add(-tickTime/4).UnixNano())
+	if tick, offset := p.tickOffset(now); tick != 10 || offset < 0.24 || offset > 0.26 {
+		t.Errorf("expected to be a quarter into tick 10, got %d and %f", tick, offset)
+	}
+
+	atomic.StoreInt64(&p.tickStarted, time.Now().UnixNano())
+	p.playOnTime([]music.Note{{On: true, Pitch: 60}, {On: true, Pitch: 62, Offset: 0.5}}, 120)
+	if played := mock.Played(); len(played) != 1 || played[0].Pitch != 60 {
+		t.Fatalf("expected only the note on the tick to be played at once, got %+v", played)
+	}
+	// the next tick comes early, and the late note is played before it
+	p.playOnTime([]music.Note{{Pitch: 62}}, 120)
+	if played := mock.Played(); len(played) != 3 || played[1].Pitch != 62 || !played[1].On || played[2].On {
+		t.Fatalf("expected the late note before the next tick, got %+v", played)
+	}
+
+	atomic.StoreInt64(&p.tickStarted, time.Now().UnixNano())
+	p.playOnTime([]music.Note{{On: true, Pitch: 64, Offset: 0.5}}, 120)
+	time.Sleep(2 * tickTime)
+	if played := mock.Played(); len(played) != 4 || played[3].Pitch != 64 {
+		t.Errorf("expected the late note to be played after half a tick, got %+v", played)
+	}
+}
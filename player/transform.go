@@ -0,0 +1,66 @@
+package player
+
+import (
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+// Retrograde plays the phrase that was just played backwards,
+// from the start of the next bar
+func (p *Player) Retrograde() {
+	p.playPhrase("Player.Retrograde", p.lastPhrase().Retrograde())
+}
+
+// Invert plays the phrase that was just played upside down,
+// mirrored around its first note, from the start of the next bar
+func (p *Player) Invert() {
+	phrase := p.lastPhrase()
+	notes := phrase.Consolidate()
+	if len(notes) == 0 {
+		p.playPhrase("Player.Invert", phrase)
+		return
+	}
+	p.playPhrase("Player.Invert", phrase.Invert(notes[0].Pitch))
+}
+
+// Augment plays the phrase that was just played with its rhythm
+// stretched by a factor, from the start of the next bar, so that
+// 2 plays it at half speed and 0.5 at double speed
+func (p *Player) Augment(factor float64) {
+	augmented, err := p.lastPhrase().Augment(factor)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"function": "Player.Augment",
+		}).Warn(err.Error())
+		return
+	}
+	p.playPhrase("Player.Augment", augmented)
+}
+
+// lastPhrase returns the notes played on the keyboard since phraseStart
+func (p *Player) lastPhrase() *music.Music {
+	p.RLock()
+	phraseStart := p.phraseStart
+	p.RUnlock()
+	return p.historySince(phraseStart).Filter(p.HumanInRange)
+}
+
+// playPhrase adds a phrase to the future from the start of the next bar,
+// in the same place of the bar as it was played, like Harmonize does
+func (p *Player) playPhrase(function string, phrase *music.Music) {
+	logger := log.WithFields(log.Fields{
+		"function": function,
+	})
+	notes := phrase.Consolidate()
+	if len(notes) == 0 {
+		logger.Info("There is no phrase to play")
+		return
+	}
+	p.RLock()
+	ticksPerBar := p.TimeSignature.barTicks(p.TicksPerBeat)
+	p.RUnlock()
+	offset := (p.CurrentBeat()/ticksPerBar+1)*ticksPerBar - notes[0].Beat/ticksPerBar*ticksPerBar
+	p.addToFuture(notes, offset)
+	p.addBendsToFuture(phrase.AllBends(), offset)
+	logger.Infof("Added %d notes of the phrase", len(notes))
+}
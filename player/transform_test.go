@@ -0,0 +1,35 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestRetrograde(t *testing.T) {
+	p := &Player{TicksPerBeat: 4, TimeSignature: TimeSignature{4, 4}, MusicHistory: music.New(), MusicFuture: music.New()}
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 50, Velocity: 80, Beat: 1})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 50, Beat: 2})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 5})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 60, Beat: 7})
+	p.MusicHistory.AddNote(music.Note{On: true, Pitch: 64, Velocity: 90, Beat: 7})
+	p.MusicHistory.AddNote(music.Note{On: false, Pitch: 64, Beat: 8})
+	p.phraseStart = 4
+	p.setTick(9)
+	// the phrase starts in the first bar, so it is played in the second
+	p.Retrograde()
+	pitches := make(map[int]int)
+	for _, note := range p.MusicFuture.Consolidate() {
+		pitches[note.Beat] = note.Pitch
+	}
+	if len(pitches) != 2 || pitches[21] != 64 || pitches[22] != 60 {
+		t.Errorf("expected the phrase backwards from 21, got %+v", pitches)
+	}
+
+	p.MusicFuture = music.New()
+	p.Augment(2)
+	notes := p.MusicFuture.Consolidate()
+	if len(notes) != 2 || notes[0].Beat != 21 || notes[0].Duration != 4 || notes[1].Beat != 25 {
+		t.Errorf("expected the phrase at half speed from 21, got %+v", notes)
+	}
+}
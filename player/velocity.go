@@ -0,0 +1,73 @@
+package player
+
+import "math"
+
+// VelocityCurve maps the velocity of every key press (0-127) to the
+// velocity that is stored, for keyboards that do not use the whole
+// range. A curve that does not have all 128 velocities is linear.
+type VelocityCurve []int
+
+// LinearCurve stores the velocities as they are played
+func LinearCurve() VelocityCurve {
+	return newCurve(func(x float64) float64 {
+		return x
+	})
+}
+
+// ExponentialCurve spreads out the loud velocities, making it harder
+// to play loudly. The amount (such as 2) is how strong the curve is.
+func ExponentialCurve(amount float64) VelocityCurve {
+	if amount <= 0 {
+		return LinearCurve()
+	}
+	return newCurve(func(x float64) float64 {
+		return (math.Exp(amount*x) - 1) / (math.Exp(amount) - 1)
+	})
+}
+
+// LogarithmicCurve spreads out the soft velocities, making it easier
+// to play loudly. The amount (such as 10) is how strong the curve is.
+func LogarithmicCurve(amount float64) VelocityCurve {
+	if amount <= 0 {
+		return LinearCurve()
+	}
+	return newCurve(func(x float64) float64 {
+		return math.Log(1+amount*x) / math.Log(1+amount)
+	})
+}
+
+// newCurve makes a curve from a function between 0 and 1
+func newCurve(f func(x float64) float64) (curve VelocityCurve) {
+	curve = make(VelocityCurve, 128)
+	for velocity := range curve {
+		curve[velocity] = int(math.Floor(127*f(float64(velocity)/127) + 0.5))
+	}
+	return
+}
+
+// apply maps a played velocity through the curve, keeping
+// note-offs at 0 and everything else between 1 and 127
+func (curve VelocityCurve) apply(velocity int) int {
+	if velocity <= 0 {
+		return 0
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+	if len(curve) >= 128 {
+		velocity = curve[velocity]
+	}
+	if velocity < 1 {
+		return 1
+	}
+	if velocity > 127 {
+		return 127
+	}
+	return velocity
+}
+
+func (p *Player) velocityCurve() VelocityCurve {
+	p.RLock()
+	defer p.RUnlock()
+	return p.VelocityCurve
+}
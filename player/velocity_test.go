@@ -0,0 +1,26 @@
+package player
+
+import "testing"
+
+func TestVelocityCurve(t *testing.T) {
+	var none VelocityCurve
+	for _, curve := range []VelocityCurve{none, LinearCurve()} {
+		for v := 0; v < 128; v++ {
+			if curve.apply(v) != v {
+				t.Errorf("linear changed %d to %d", v, curve.apply(v))
+			}
+		}
+	}
+	exponential, logarithmic := ExponentialCurve(2), LogarithmicCurve(10)
+	if exponential.apply(64) >= 64 || logarithmic.apply(64) <= 64 {
+		t.Errorf("got %d and %d for 64", exponential.apply(64), logarithmic.apply(64))
+	}
+	if exponential.apply(1) != 1 || logarithmic.apply(127) != 127 || exponential.apply(0) != 0 {
+		t.Errorf("velocities should stay between 1 and 127")
+	}
+	custom := make(VelocityCurve, 128)
+	custom[100] = 200
+	if custom.apply(100) != 127 || custom.apply(50) != 1 {
+		t.Errorf("custom curve should be clamped")
+	}
+}
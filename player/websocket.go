@@ -0,0 +1,231 @@
+package player
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/schollz/pianoai/music"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// websocketGUID is appended to the key of the client in the handshake
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// websocketBuffer is the number of messages kept for a slow client,
+	// after which its messages are dropped
+	websocketBuffer = 256
+)
+
+// NoteEvent is a note sent to the WebSocket clients, and Human
+// is whether it was played on the keyboard rather than by the player
+type NoteEvent struct {
+	music.Note
+	Human bool
+}
+
+// broadcaster sends messages to every connected client
+type broadcaster struct {
+	sync.RWMutex
+	clients map[chan []byte]bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{clients: make(map[chan []byte]bool)}
+}
+
+func (b *broadcaster) add() chan []byte {
+	client := make(chan []byte, websocketBuffer)
+	b.Lock()
+	b.clients[client] = true
+	b.Unlock()
+	return client
+}
+
+func (b *broadcaster) remove(client chan []byte) {
+	b.Lock()
+	if b.clients[client] {
+		delete(b.clients, client)
+		close(client)
+	}
+	b.Unlock()
+}
+
+// hasClients returns whether anyone is listening, so that nothing
+// is encoded when there is no one to send it to
+func (b *broadcaster) hasClients() bool {
+	if b == nil {
+		return false
+	}
+	b.RLock()
+	defer b.RUnlock()
+	return len(b.clients) > 0
+}
+
+func (b *broadcaster) send(message []byte) {
+	b.RLock()
+	defer b.RUnlock()
+	for client := range b.clients {
+		select {
+		case client <- message:
+		default:
+		}
+	}
+}
+
+// broadcast sends notes to the WebSocket clients and to Events
+func (p *Player) broadcast(human bool, notes ...music.Note) {
+	p.publishNotes(human, notes...)
+	if !p.broadcaster.hasClients() {
+		return
+	}
+	for _, note := range notes {
+		message, err := json.Marshal(NoteEvent{Note: note, Human: human})
+		if err != nil {
+			continue
+		}
+		p.broadcaster.send(message)
+	}
+}
+
+// StartWebSocket serves a WebSocket on an address like ":8080" that
+// sends every note as JSON when it happens, both the ones from the
+// keyboard (with Human set) and the ones the player plays
+func (p *Player) StartWebSocket(addr string) (err error) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.StartWebSocket",
+	})
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	logger.Infof("Serving notes on ws://%s/", listener.Addr())
+	go func() {
+		err := http.Serve(listener, http.HandlerFunc(p.serveWebSocket))
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+	return
+}
+
+// serveWebSocket upgrades a request to a WebSocket and sends
+// it the notes until it is closed
+func (p *Player) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"function": "Player.serveWebSocket",
+	})
+	conn, rw, err := upgradeWebSocket(w, r)
+	if err != nil {
+		logger.Warn(err.Error())
+		return
+	}
+	defer conn.Close()
+	logger.Debugf("%s connected", conn.RemoteAddr())
+
+	client := p.broadcaster.add()
+	// the client is removed as soon as it closes or sends something
+	// that isn't understood, which ends the writing below
+	go func() {
+		defer p.broadcaster.remove(client)
+		for {
+			opcode, err := readWebSocketFrame(rw.Reader)
+			if err != nil || opcode == 0x8 {
+				return
+			}
+		}
+	}()
+	for message := range client {
+		if err := writeWebSocketFrame(rw.Writer, 0x1, message); err != nil {
+			break
+		}
+	}
+	p.broadcaster.remove(client)
+	writeWebSocketFrame(rw.Writer, 0x8, nil)
+	logger.Debugf("%s disconnected", conn.RemoteAddr())
+}
+
+// upgradeWebSocket does the opening handshake of a WebSocket
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "only WebSocket connections are served", http.StatusBadRequest)
+		err = errors.New("not a WebSocket request")
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cannot upgrade the connection", http.StatusInternalServerError)
+		err = errors.New("connection cannot be hijacked")
+		return
+	}
+	conn, rw, err = hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	err = rw.Flush()
+	return
+}
+
+// writeWebSocketFrame writes an unmasked frame, as servers do
+func writeWebSocketFrame(w *bufio.Writer, opcode byte, payload []byte) (err error) {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		header = append(header, 127)
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	w.Write(header)
+	w.Write(payload)
+	return w.Flush()
+}
+
+// readWebSocketFrame reads a frame from a client and
+// returns its opcode, throwing away the payload
+func readWebSocketFrame(r *bufio.Reader) (opcode byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	opcode = header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		b := make([]byte, 2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(b)
+	}
+	if header[1]&0x80 != 0 {
+		// the masking key
+		length += 4
+	}
+	_, err = io.CopyN(ioutil.Discard, r, int64(length))
+	return
+}
@@ -0,0 +1,69 @@
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schollz/pianoai/music"
+)
+
+func TestWebSocket(t *testing.T) {
+	p := &Player{broadcaster: newBroadcaster()}
+	server := httptest.NewServer(http.HandlerFunc(p.serveWebSocket))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the example of RFC 6455
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("got %+v", response)
+	}
+
+	for !p.broadcaster.hasClients() {
+		time.Sleep(time.Millisecond)
+	}
+	p.broadcast(true, music.Note{On: true, Pitch: 60, Velocity: 80, Beat: 10})
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != 0x81 {
+		t.Fatalf("expected a text frame, got %x", header)
+	}
+	payload := make([]byte, header[1])
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	var event NoteEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if !event.Human || event.Pitch != 60 || event.Beat != 10 {
+		t.Errorf("got %+v", event)
+	}
+
+	// a masked close frame
+	conn.Write([]byte{0x88, 0x80, 1, 2, 3, 4})
+	for p.broadcaster.hasClients() {
+		time.Sleep(time.Millisecond)
+	}
+}